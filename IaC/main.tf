@@ -51,6 +51,25 @@ resource "aws_dynamodb_table" "location-dynamodb-table" {
     type = "S"
   }
 
+  attribute {
+    name = "geohash_cell"
+    type = "S"
+  }
+
+  attribute {
+    name = "geohash"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "by_geohash_cell"
+    hash_key        = "geohash_cell"
+    range_key       = "geohash"
+    write_capacity  = 2
+    read_capacity   = 2
+    projection_type = "ALL"
+  }
+
   tags = {
     Name        = "env"
     Environment = "recyapp"
@@ -135,6 +154,16 @@ resource "aws_dynamodb_table" "PickingRoute-dynamodb-table" {
     name = "starts_at"
     type = "S"
   }
+
+  attribute {
+    name = "gatherer_id"
+    type = "S"
+  }
+
+  attribute {
+    name = "finished_at"
+    type = "S"
+  }
   global_secondary_index {
     name            = "by_status_and_starts_at"
     hash_key        = "status"
@@ -143,6 +172,14 @@ resource "aws_dynamodb_table" "PickingRoute-dynamodb-table" {
     read_capacity   = 2
     projection_type = "ALL"
   }
+  global_secondary_index {
+    name            = "by_gatherer_id_and_unfinished"
+    hash_key        = "gatherer_id"
+    range_key       = "finished_at"
+    write_capacity  = 2
+    read_capacity   = 2
+    projection_type = "ALL"
+  }
   tags = {
     Name        = "env"
     Environment = "recyapp"
@@ -187,3 +224,83 @@ resource "aws_dynamodb_table" "LocationbalanceMovements-dynamodb-table" {
     Environment = "recyapp"
   }
 }
+
+####### IdempotencyKeys table  #####
+resource "aws_dynamodb_table" "IdempotencyKeys-dynamodb-table" {
+  name           = "idempotency_keys"
+  billing_mode   = "PROVISIONED"
+  read_capacity  = 2
+  write_capacity = 2
+  hash_key       = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Name        = "env"
+    Environment = "recyapp"
+  }
+}
+
+####### GathererPositions table  #####
+resource "aws_dynamodb_table" "GathererPositions-dynamodb-table" {
+  name           = "gatherer_positions"
+  billing_mode   = "PROVISIONED"
+  read_capacity  = 5
+  write_capacity = 5
+  hash_key       = "route_id"
+
+  attribute {
+    name = "route_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
+  tags = {
+    Name        = "env"
+    Environment = "recyapp"
+  }
+}
+
+####### Sectors table  #####
+resource "aws_dynamodb_table" "Sectors-dynamodb-table" {
+  name           = "sectors"
+  billing_mode   = "PROVISIONED"
+  read_capacity  = 2
+  write_capacity = 1
+  hash_key       = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  tags = {
+    Name        = "env"
+    Environment = "recyapp"
+  }
+}
+
+####### S3  #####
+
+####### PickingPointPhotos bucket  #####
+resource "aws_s3_bucket" "PickingPointPhotos-s3-bucket" {
+  bucket = "picking-point-photos"
+  acl    = "private"
+
+  tags = {
+    Name        = "env"
+    Environment = "recyapp"
+  }
+}
@@ -0,0 +1,95 @@
+// Command bootstrap creates every table and global secondary index used by the
+// repositories on a DynamoDB endpoint (DynamoDB Local by default) and
+// optionally loads the seed fixtures: users of both types, their locations and
+// a route on every status
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/fixtures"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/schema"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func main() {
+	endpoint := flag.String("dynamodb-endpoint", "http://localhost:8000", "DynamoDB endpoint, e.g. DynamoDB Local")
+	region := flag.String("region", "us-east-1", "AWS region")
+	usersTable := flag.String("dynamodb-users", schema.DefaultNames.Users, "users table")
+	locationsTable := flag.String("dynamodb-locations", schema.DefaultNames.Locations, "locations table")
+	userLocationsTable := flag.String("dynamodb-user-locations", schema.DefaultNames.UserLocations, "user_locations table")
+	routesTable := flag.String("dynamodb-picking-routes", schema.DefaultNames.PickingRoutes, "picking_routes table")
+	idempotencyTable := flag.String("dynamodb-idempotency-keys", schema.DefaultNames.IdempotencyKeys, "idempotency_keys table")
+	positionsTable := flag.String("dynamodb-gatherer-positions", schema.DefaultNames.GathererPositions, "gatherer_positions table")
+	sectorsTable := flag.String("dynamodb-sectors", schema.DefaultNames.Sectors, "sectors table")
+	timezone := flag.String("timezone", "America/Bogota", "timezone used to store dates")
+	drop := flag.Bool("drop", false, "drop the tables before creating them")
+	seed := flag.Bool("seed", true, "load the seed fixtures")
+	flag.Parse()
+
+	timeHelper, err := internal.NewTimeHelper(*timezone)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	session := session.Must(session.NewSession(&aws.Config{
+		Region:   aws.String(*region),
+		Endpoint: aws.String(*endpoint),
+	}))
+	dynamodbClient := dynamodb.New(session)
+
+	names := schema.Names{
+		Users:             *usersTable,
+		Locations:         *locationsTable,
+		UserLocations:     *userLocationsTable,
+		PickingRoutes:     *routesTable,
+		IdempotencyKeys:   *idempotencyTable,
+		GathererPositions: *positionsTable,
+		Sectors:           *sectorsTable,
+	}
+
+	if *drop {
+		if err := schema.Drop(dynamodbClient, names); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("bootstrap: tables dropped")
+	}
+	if err := schema.Create(dynamodbClient, names); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("bootstrap: tables ready on %s\n", *endpoint)
+
+	if !*seed {
+		return
+	}
+
+	usersRepo := repositories.NewDynamoDBUsersRepository(dynamodbClient, names.Users)
+	locationsRepo := repositories.NewDynamoDBLocationsRepository(dynamodbClient, names.UserLocations, names.Locations)
+	sectorsRepo := repositories.NewDynamoDBSectorsRepository(dynamodbClient, names.Sectors)
+	routesRepo := repositories.NewDynamoDBRoutesRepository(
+		dynamodbClient,
+		names.PickingRoutes,
+		names.Locations,
+		timeHelper,
+		internal.NewUUIDHelper(),
+	)
+
+	now, err := timeHelper.NowWithTimezone()
+	if err != nil {
+		log.Fatal(err)
+	}
+	set := fixtures.Default(now)
+	if err := fixtures.Load(context.Background(), set, usersRepo, locationsRepo, sectorsRepo, routesRepo); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf(
+		"bootstrap: seeded %d users, %d locations, %d sectors and %d routes\n",
+		len(set.Users), len(set.Locations), len(set.Sectors), len(set.Routes),
+	)
+}
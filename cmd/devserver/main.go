@@ -0,0 +1,244 @@
+// Command devserver hosts every Lambda Adapter on a single net/http server so
+// the backend can be run locally without deploying with serverless.
+//
+// Every function is mounted under the name of its serverless service, e.g.
+// the login function deployed as login.reciapp.quartrino.com/v1 is served at
+// http://localhost:8080/login/v1
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/fixtures"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/assignpickingroute"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/finishpickingpoint"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getassignedroutes"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getgathererposition"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getlocationscore"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getopenshifts"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getpickingroutes"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getpickupcode"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/login"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/pinpickingpoint"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/requestphotoupload"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/startpickingroute"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/syncfieldwork"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/trackgathererposition"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	BackendDynamoDB = "dynamodb"
+	BackendMemory   = "memory"
+)
+
+type TrackingRepository interface {
+	Track(ctx context.Context, position models.GathererPosition, ttl time.Duration) error
+	Latest(ctx context.Context, routeID string) (models.GathererPosition, error)
+}
+
+type SectorsRepository interface {
+	Locate(ctx context.Context, lat float64, lon float64) (models.Sector, error)
+}
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+	FindByUsername(ctx context.Context, username string) (models.User, error)
+}
+
+type LocationsRepository interface {
+	Find(ctx context.Context, id string) (models.Location, error)
+	FindByUserID(ctx context.Context, id string) ([]models.Location, error)
+	GetScoreByUserID(ctx context.Context, userID string) (int, error)
+}
+
+type RoutesRepository interface {
+	Find(ctx context.Context, routeID string) (models.Route, error)
+	Initiate(ctx context.Context, routeID string, at time.Time) error
+	FinishPickingPoint(ctx context.Context, routeID string, pickingPointIndex int, pickingPoint models.PickingPoint, score int, remaining int) error
+	FailPickingPoint(ctx context.Context, routeID string, pickingPointIndex int, pickingPoint models.PickingPoint, remaining int) error
+	AttachPhoto(ctx context.Context, routeID string, pickingPointIndex int, photo models.Photo) error
+	FindAssignedRoutesPage(ctx context.Context, userID string, page repositories.PageQuery) (repositories.RoutesPage, error)
+	FindAvailableRoutesPage(ctx context.Context, currentTime time.Time, maxTime time.Time, page repositories.PageQuery) (repositories.RoutesPage, error)
+	FindOpenShiftsPage(ctx context.Context, currentTime time.Time, maxTime time.Time, page repositories.PageQuery) (repositories.RoutesPage, error)
+	FindOpenShiftsInSectorPage(ctx context.Context, sectorID string, currentTime time.Time, maxTime time.Time, page repositories.PageQuery) (repositories.RoutesPage, error)
+	Assign(ctx context.Context, userID string, routeID string) error
+	Pin(ctx context.Context, userID string, location models.Location, shiftID string, materials []string) error
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	backend := flag.String("backend", BackendDynamoDB, "either dynamodb or memory")
+	endpoint := flag.String("dynamodb-endpoint", "http://localhost:8000", "DynamoDB endpoint, e.g. DynamoDB Local")
+	region := flag.String("region", "us-east-1", "AWS region")
+	usersTable := flag.String("dynamodb-users", "users", "users table")
+	locationsTable := flag.String("dynamodb-locations", "locations", "locations table")
+	userLocationsTable := flag.String("dynamodb-user-locations", "user_locations", "user_locations table")
+	routesTable := flag.String("dynamodb-picking-routes", "picking_routes", "picking_routes table")
+	idempotencyTable := flag.String("dynamodb-idempotency-keys", "idempotency_keys", "idempotency_keys table")
+	positionsTable := flag.String("dynamodb-gatherer-positions", "gatherer_positions", "gatherer_positions table")
+	sectorsTable := flag.String("dynamodb-sectors", "sectors", "sectors table")
+	timezone := flag.String("timezone", "America/Bogota", "timezone used to render dates")
+	daysOffset := flag.Int("days-offset", 7, "days ahead to look for open shifts")
+	hoursOffset := flag.Int("hours-offset", 12, "hours ahead to look for available routes")
+	geofenceRadius := flag.Float64("geofence-radius-meters", 150, "max distance to a picking point when finishing it")
+	geofenceMode := flag.String("geofence-mode", finishpickingpoint.GeofenceModeFlag, "either reject or flag")
+	etaSpeed := flag.Float64("eta-average-speed-kmh", internal.DefaultETACalculator.AverageSpeed, "average speed of the gatherers, used to estimate arrivals")
+	etaServiceTime := flag.Duration("eta-service-time", internal.DefaultETACalculator.ServiceTime, "time spent at every picking point, used to estimate arrivals")
+	photosDir := flag.String("photos-dir", "./tmp/photos", "directory where uploaded photos are stored")
+	seed := flag.Bool("seed", true, "load the seed fixtures on the memory backend")
+	flag.Parse()
+
+	timeHelper, err := internal.NewTimeHelper(*timezone)
+	if err != nil {
+		log.Fatal(err)
+	}
+	uuidHelper := internal.NewUUIDHelper()
+	etaCalculator := internal.ETACalculator{
+		AverageSpeed: *etaSpeed,
+		ServiceTime:  *etaServiceTime,
+	}
+
+	var usersRepo UsersRepository
+	var locationsRepo LocationsRepository
+	var routesRepo RoutesRepository
+	var idempotencyRepo internal.IdempotencyRepository
+	var trackingRepo TrackingRepository
+	var sectorsRepo SectorsRepository
+	switch *backend {
+	case BackendDynamoDB:
+		session := session.Must(session.NewSession(&aws.Config{
+			Region:   aws.String(*region),
+			Endpoint: aws.String(*endpoint),
+		}))
+		dynamodbClient := repositories.NewRetryingClient(
+			dynamodb.New(session, aws.NewConfig().WithMaxRetries(0)),
+			repositories.DefaultRetryPolicy,
+		)
+
+		usersRepo = repositories.NewDynamoDBUsersRepository(
+			dynamodbClient,
+			*usersTable,
+		)
+		locationsRepo = repositories.NewDynamoDBLocationsRepository(
+			dynamodbClient,
+			*userLocationsTable,
+			*locationsTable,
+		)
+		routesRepo = repositories.NewDynamoDBRoutesRepository(
+			dynamodbClient,
+			*routesTable,
+			*locationsTable,
+			timeHelper,
+			uuidHelper,
+		)
+		idempotencyRepo = repositories.NewDynamoDBIdempotencyRepository(
+			dynamodbClient,
+			*idempotencyTable,
+			timeHelper,
+		)
+		trackingRepo = repositories.NewDynamoDBTrackingRepository(
+			dynamodbClient,
+			*positionsTable,
+			timeHelper,
+		)
+		sectorsRepo = repositories.NewDynamoDBSectorsRepository(
+			dynamodbClient,
+			*sectorsTable,
+		)
+	case BackendMemory:
+		memoryUsersRepo := repositories.NewInMemoryUsersRepository()
+		memoryLocationsRepo := repositories.NewInMemoryLocationsRepository()
+		memorySectorsRepo := repositories.NewInMemorySectorsRepository()
+		memoryRoutesRepo := repositories.NewInMemoryRoutesRepository(
+			memoryLocationsRepo,
+			timeHelper,
+			uuidHelper,
+		)
+		if *seed {
+			now, err := timeHelper.NowWithTimezone()
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = fixtures.Load(context.Background(), fixtures.Default(now), memoryUsersRepo, memoryLocationsRepo, memorySectorsRepo, memoryRoutesRepo)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		usersRepo = memoryUsersRepo
+		locationsRepo = memoryLocationsRepo
+		routesRepo = memoryRoutesRepo
+		idempotencyRepo = repositories.NewInMemoryIdempotencyRepository(timeHelper)
+		trackingRepo = repositories.NewInMemoryTrackingRepository(timeHelper)
+		sectorsRepo = memorySectorsRepo
+	default:
+		log.Fatalf("unknown backend (%s)\n", *backend)
+	}
+	log.Printf("devserver: using the %s backend\n", *backend)
+
+	photosStore, err := storage.NewFilesystemObjectStore(*photosDir, "http://"+*addr+"/uploads")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	router := NewRouter()
+	router.Handle(http.MethodPost, "/login/v1", LambdaHandler(
+		login.Adapter(usersRepo, locationsRepo),
+	))
+	router.Handle(http.MethodGet, "/get-open-shifts/v1", LambdaHandler(
+		getopenshifts.Adapter(routesRepo, locationsRepo, sectorsRepo, *daysOffset, timeHelper),
+	))
+	router.Handle(http.MethodGet, "/get-available-routes/v1", LambdaHandler(
+		getpickingroutes.Adapter(routesRepo, *hoursOffset, timeHelper),
+	))
+	router.Handle(http.MethodGet, "/get-assigned-routes/v1/{user_id}", LambdaHandler(
+		getassignedroutes.Adapter(routesRepo, usersRepo, timeHelper),
+	))
+	router.Handle(http.MethodGet, "/get-user-score/v1/{user_id}", LambdaHandler(
+		getlocationscore.Adapter(usersRepo, locationsRepo),
+	))
+	router.Handle(http.MethodPut, "/pin-picking-point/v1", LambdaHandler(
+		pinpickingpoint.Adapter(routesRepo, usersRepo, locationsRepo, idempotencyRepo),
+	))
+	router.Handle(http.MethodPut, "/assign-picking-route/v1", LambdaHandler(
+		assignpickingroute.Adapter(usersRepo, routesRepo, idempotencyRepo),
+	))
+	router.Handle(http.MethodPut, "/start-picking-route/v1", LambdaHandler(
+		startpickingroute.Adapter(usersRepo, routesRepo, trackingRepo, timeHelper, etaCalculator),
+	))
+	router.Handle(http.MethodPut, "/finish-picking-point/v1", LambdaHandler(
+		finishpickingpoint.Adapter(usersRepo, routesRepo, timeHelper, *geofenceRadius, *geofenceMode, etaCalculator, idempotencyRepo),
+	))
+	router.Handle(http.MethodPut, "/sync-field-work/v1", LambdaHandler(
+		syncfieldwork.Adapter(usersRepo, routesRepo, *geofenceRadius, *geofenceMode, idempotencyRepo),
+	))
+	router.Handle(http.MethodGet, "/get-pickup-code/v1/{user_id}/{route_id}/{picking_point_id}", LambdaHandler(
+		getpickupcode.Adapter(usersRepo, routesRepo, locationsRepo),
+	))
+	router.Handle(http.MethodPut, "/track-gatherer-position/v1", LambdaHandler(
+		trackgathererposition.Adapter(usersRepo, routesRepo, trackingRepo),
+	))
+	router.Handle(http.MethodGet, "/get-gatherer-position/v1/{user_id}/{route_id}/{picking_point_id}", LambdaHandler(
+		getgathererposition.Adapter(usersRepo, routesRepo, locationsRepo, trackingRepo, timeHelper, etaCalculator),
+	))
+	router.Handle(http.MethodPut, "/request-photo-upload/v1", LambdaHandler(
+		requestphotoupload.Adapter(usersRepo, routesRepo, locationsRepo, photosStore, uuidHelper),
+	))
+
+	mux := http.NewServeMux()
+	mux.Handle("/uploads/", http.StripPrefix("/uploads", photosStore))
+	mux.Handle("/", router)
+
+	log.Printf("devserver: listening on %s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-lambda-go/events"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ToProxyRequest translates an incoming http.Request into the event API
+// Gateway would hand to the Lambda function, pathParameters being still
+// escaped as they were taken from the request path
+func ToProxyRequest(
+	r *http.Request,
+	resource string,
+	pathParameters map[string]string,
+) (events.APIGatewayProxyRequest, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return events.APIGatewayProxyRequest{}, err
+	}
+
+	headers := map[string]string{}
+	for key, values := range r.Header {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+
+	queryStringParameters := map[string]string{}
+	for key, values := range r.URL.Query() {
+		if len(values) > 0 {
+			queryStringParameters[key] = values[0]
+		}
+	}
+
+	unescapedParameters := map[string]string{}
+	for key, value := range pathParameters {
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			return events.APIGatewayProxyRequest{}, err
+		}
+		unescapedParameters[key] = unescaped
+	}
+
+	return events.APIGatewayProxyRequest{
+		Resource:              resource,
+		Path:                  r.URL.Path,
+		HTTPMethod:            r.Method,
+		Headers:               headers,
+		QueryStringParameters: queryStringParameters,
+		PathParameters:        unescapedParameters,
+		Body:                  string(body),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:    uuid.NewV4().String(),
+			Stage:        "local",
+			ResourcePath: resource,
+			HTTPMethod:   r.Method,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  r.RemoteAddr,
+				UserAgent: r.UserAgent(),
+			},
+		},
+	}, nil
+}
+
+// WriteProxyResponse writes back the Lambda response the way API Gateway does
+func WriteProxyResponse(w http.ResponseWriter, resp events.APIGatewayProxyResponse) {
+	for key, value := range resp.Headers {
+		w.Header().Set(key, value)
+	}
+
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		body = decoded
+	}
+
+	statusCode := resp.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
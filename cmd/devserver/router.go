@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// LambdaHandler is the shape shared by every Adapter once it receives the
+// API Gateway request
+type LambdaHandler func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+type route struct {
+	method   string
+	resource string
+	segments []string
+	handler  LambdaHandler
+}
+
+// Router mirrors the API Gateway resources declared on every serverless.yml,
+// path parameters are declared the same way, e.g. /v1/{user_id}
+type Router struct {
+	routes []route
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+func (rt *Router) Handle(method string, resource string, handler LambdaHandler) {
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		resource: resource,
+		segments: splitPath(resource),
+		handler:  handler,
+	})
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Matched on the escaped path so an encoded slash stays inside its path
+	// parameter, ToProxyRequest decodes the parameters once
+	segments := splitPath(r.URL.EscapedPath())
+	pathMatched := false
+	for _, route := range rt.routes {
+		pathParameters, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		pathMatched = true
+		if route.method != r.Method {
+			continue
+		}
+
+		req, err := ToProxyRequest(r, route.resource, pathParameters)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := route.handler(r.Context(), req)
+		if err != nil {
+			log.Printf("devserver: %s %s failed: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		WriteProxyResponse(w, resp)
+		log.Printf("devserver: %s %s -> %v\n", r.Method, r.URL.Path, resp.StatusCode)
+		return
+	}
+
+	if pathMatched {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (r route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+	pathParameters := map[string]string{}
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			pathParameters[strings.Trim(segment, "{}")] = segments[i]
+			continue
+		}
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return pathParameters, true
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// newRecordingRouter serves GET /users/v1/{user_id} and keeps the last event
+// its handler received
+func newRecordingRouter(received *events.APIGatewayProxyRequest) *Router {
+	router := NewRouter()
+	router.Handle(http.MethodGet, "/users/v1/{user_id}", func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		*received = req
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       `{"ok":true}`,
+		}, nil
+	})
+	return router
+}
+
+func TestRouterDecodesPathParametersOnce(t *testing.T) {
+	cases := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"Plain", "/users/v1/u1", "u1"},
+		{"EncodedSpace", "/users/v1/ana%20maria", "ana maria"},
+		{"EncodedSlash", "/users/v1/a%2Fb", "a/b"},
+		{"EncodedPercent", "/users/v1/100%2525", "100%25"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var received events.APIGatewayProxyRequest
+			rec := httptest.NewRecorder()
+			newRecordingRouter(&received).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.path, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %v", rec.Code)
+			}
+			if got := received.PathParameters["user_id"]; got != c.want {
+				t.Fatalf("expected user_id %q, got %q", c.want, got)
+			}
+			if received.Resource != "/users/v1/{user_id}" {
+				t.Fatalf("expected the declared resource, got %q", received.Resource)
+			}
+		})
+	}
+}
+
+func TestRouterRejectsUnknownPathsAndMethods(t *testing.T) {
+	var received events.APIGatewayProxyRequest
+	router := newRecordingRouter(&received)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"UnknownPath", http.MethodGet, "/users/v2/u1", http.StatusNotFound},
+		{"ExtraSegment", http.MethodGet, "/users/v1/u1/extra", http.StatusNotFound},
+		{"EmptyParameter", http.MethodGet, "/users/v1/", http.StatusNotFound},
+		{"WrongMethod", http.MethodPost, "/users/v1/u1", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(c.method, c.path, nil))
+
+			if rec.Code != c.want {
+				t.Fatalf("expected status %v, got %v", c.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestToProxyRequestCarriesTheRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/routes/v1/r1?limit=2", strings.NewReader(`{"user_id":"g1"}`))
+	r.Header.Set("Idempotency-Key", "k1")
+
+	req, err := ToProxyRequest(r, "/routes/v1/{route_id}", map[string]string{"route_id": "r%201"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.HTTPMethod != http.MethodPut || req.Body != `{"user_id":"g1"}` {
+		t.Fatalf("expected the method and body, got %v %q", req.HTTPMethod, req.Body)
+	}
+	if req.Headers["Idempotency-Key"] != "k1" || req.QueryStringParameters["limit"] != "2" {
+		t.Fatalf("expected the headers and query, got %v %v", req.Headers, req.QueryStringParameters)
+	}
+	if req.PathParameters["route_id"] != "r 1" {
+		t.Fatalf("expected the decoded route_id, got %q", req.PathParameters["route_id"])
+	}
+}
+
+func TestWriteProxyResponseDecodesBase64Bodies(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteProxyResponse(rec, events.APIGatewayProxyResponse{
+		Headers:         map[string]string{"Content-Type": "image/jpeg"},
+		Body:            "aGVsbG8=",
+		IsBase64Encoded: true,
+	})
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" || rec.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("expected the decoded body, got %v %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+}
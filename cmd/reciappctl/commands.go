@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+)
+
+// StatusAvailable lists closed routes with no gatherer, the ones offered on
+// get_available_routes
+const StatusAvailable = "available"
+
+var errMissingFlag = errors.New("missing required flag")
+
+func (c *ctl) listRoutes(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("routes list", flag.ExitOnError)
+	status := flags.String("status", models.RouteStatusOpen, "route status, or available for unassigned closed routes")
+	from := flags.String("from", "", "window start as 2006-01-02T15:04:05-0700, defaults to now")
+	hours := flags.Int("hours", 24*7, "window length in hours, negative to look back")
+	flags.Parse(args)
+
+	start, err := c.timeHelper.NowWithTimezone()
+	if err != nil {
+		return err
+	}
+	if *from != "" {
+		start, err = c.timeHelper.FromISO8601(*from)
+		if err != nil {
+			return err
+		}
+	}
+	end := start.Add(time.Duration(*hours) * time.Hour)
+	if end.Before(start) {
+		start, end = end, start
+	}
+
+	var routes []models.Route
+	switch *status {
+	case models.RouteStatusOpen:
+		routes, err = c.routesRepo.FindOpenShifts(ctx, start, end)
+	case StatusAvailable:
+		routes, err = c.routesRepo.FindAvailableRoutes(ctx, start, end)
+	default:
+		routes, err = c.routesRepo.FindByStatus(ctx, *status, start, end)
+	}
+	if err != nil {
+		return err
+	}
+	return c.printer.Routes(routes)
+}
+
+func (c *ctl) showRoute(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("routes show", flag.ExitOnError)
+	routeID := flags.String("route", "", "route id")
+	flags.Parse(args)
+	if *routeID == "" {
+		return fmt.Errorf("%w: -route", errMissingFlag)
+	}
+
+	route, err := c.routesRepo.Find(ctx, *routeID)
+	if err != nil {
+		return err
+	}
+	return c.printer.Route(route)
+}
+
+func (c *ctl) assignRoute(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("routes assign", flag.ExitOnError)
+	routeID := flags.String("route", "", "route id")
+	gathererID := flags.String("gatherer", "", "gatherer user id")
+	flags.Parse(args)
+	if *routeID == "" || *gathererID == "" {
+		return fmt.Errorf("%w: -route and -gatherer", errMissingFlag)
+	}
+
+	gatherer, err := c.usersRepo.Find(ctx, *gathererID)
+	if err != nil {
+		return err
+	}
+	if gatherer.Type != models.UserTypeGatherer {
+		return fmt.Errorf("user %s is not a gatherer", gatherer.ID)
+	}
+	if _, err := c.routesRepo.Find(ctx, *routeID); err != nil {
+		return err
+	}
+	if err := c.routesRepo.ForceAssign(ctx, gatherer.ID, *routeID); err != nil {
+		return err
+	}
+
+	route, err := c.routesRepo.Find(ctx, *routeID)
+	if err != nil {
+		return err
+	}
+	return c.printer.Route(route)
+}
+
+func (c *ctl) unassignRoute(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("routes unassign", flag.ExitOnError)
+	routeID := flags.String("route", "", "route id")
+	flags.Parse(args)
+	if *routeID == "" {
+		return fmt.Errorf("%w: -route", errMissingFlag)
+	}
+
+	if _, err := c.routesRepo.Find(ctx, *routeID); err != nil {
+		return err
+	}
+	if err := c.routesRepo.Unassign(ctx, *routeID); err != nil {
+		return err
+	}
+
+	route, err := c.routesRepo.Find(ctx, *routeID)
+	if err != nil {
+		return err
+	}
+	return c.printer.Route(route)
+}
+
+func (c *ctl) adjustBalance(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("locations adjust", flag.ExitOnError)
+	locationID := flags.String("location", "", "location id")
+	amount := flags.Float64("amount", 0, "points to add, negative to subtract")
+	reason := flags.String("reason", "", "why the balance is being adjusted")
+	by := flags.String("by", "", "who is adjusting the balance, defaults to $USER")
+	flags.Parse(args)
+	if *locationID == "" || *reason == "" {
+		return fmt.Errorf("%w: -location and -reason", errMissingFlag)
+	}
+	if *amount == 0 {
+		return errors.New("the amount can not be zero")
+	}
+	if *by == "" {
+		*by = currentUser()
+	}
+
+	now, err := c.timeHelper.NowWithTimezone()
+	if err != nil {
+		return err
+	}
+	err = c.locationsRepo.AdjustBalance(ctx, *locationID, models.BalanceAdjustment{
+		Amount:    *amount,
+		Reason:    *reason,
+		CreatedBy: *by,
+		Created:   &now,
+	})
+	if err != nil {
+		return err
+	}
+
+	location, err := c.locationsRepo.Find(ctx, *locationID)
+	if err != nil {
+		return err
+	}
+	return c.printer.Location(location)
+}
+
+func (c *ctl) nearLocations(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("locations near", flag.ExitOnError)
+	lat := flags.Float64("lat", math.NaN(), "latitude of the center")
+	lon := flags.Float64("lon", math.NaN(), "longitude of the center")
+	radius := flags.Float64("radius", 500, "radius in meters")
+	flags.Parse(args)
+	if math.IsNaN(*lat) || math.IsNaN(*lon) {
+		return fmt.Errorf("%w: -lat and -lon", errMissingFlag)
+	}
+
+	locations, err := c.locationsRepo.FindWithinRadius(ctx, *lat, *lon, *radius)
+	if err != nil {
+		return err
+	}
+	return c.printer.Locations(locations)
+}
+
+func (c *ctl) locationsWithin(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("locations within", flag.ExitOnError)
+	box := geo.Box{}
+	flags.Float64Var(&box.MinLatitude, "min-lat", math.NaN(), "southern latitude")
+	flags.Float64Var(&box.MinLongitude, "min-lon", math.NaN(), "western longitude")
+	flags.Float64Var(&box.MaxLatitude, "max-lat", math.NaN(), "northern latitude")
+	flags.Float64Var(&box.MaxLongitude, "max-lon", math.NaN(), "eastern longitude")
+	flags.Parse(args)
+	for _, v := range []float64{box.MinLatitude, box.MinLongitude, box.MaxLatitude, box.MaxLongitude} {
+		if math.IsNaN(v) {
+			return fmt.Errorf("%w: -min-lat, -min-lon, -max-lat and -max-lon", errMissingFlag)
+		}
+	}
+
+	locations, err := c.locationsRepo.FindWithinBox(ctx, box)
+	if err != nil {
+		return err
+	}
+	return c.printer.Locations(locations)
+}
+
+func (c *ctl) listSectors(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("sectors list", flag.ExitOnError)
+	flags.Parse(args)
+
+	sectors, err := c.sectorsRepo.All(ctx)
+	if err != nil {
+		return err
+	}
+	return c.printer.Sectors(sectors)
+}
+
+// importSectors saves every sector of a JSON array, as written by
+// reciappctl -output json sectors list, replacing the ones with the same id
+func (c *ctl) importSectors(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("sectors import", flag.ExitOnError)
+	file := flags.String("file", "", "JSON file with an array of sectors")
+	flags.Parse(args)
+	if *file == "" {
+		return fmt.Errorf("%w: -file", errMissingFlag)
+	}
+
+	raw, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	sectors := []models.Sector{}
+	if err := json.Unmarshal(raw, &sectors); err != nil {
+		return err
+	}
+	for _, sector := range sectors {
+		if sector.ID == "" || sector.Name == "" {
+			return errors.New("every sector needs an id and a name")
+		}
+		if len(sector.Polygon) < 3 {
+			return fmt.Errorf("sector %s needs at least 3 points", sector.ID)
+		}
+	}
+	for _, sector := range sectors {
+		if err := c.sectorsRepo.Save(ctx, sector); err != nil {
+			return fmt.Errorf("saving %s: %w", sector.ID, err)
+		}
+	}
+	return c.printer.Sectors(sectors)
+}
+
+func (c *ctl) locateSector(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("sectors locate", flag.ExitOnError)
+	locationID := flags.String("location", "", "location id, instead of -lat and -lon")
+	lat := flags.Float64("lat", math.NaN(), "latitude of the point")
+	lon := flags.Float64("lon", math.NaN(), "longitude of the point")
+	flags.Parse(args)
+	if *locationID != "" {
+		location, err := c.locationsRepo.Find(ctx, *locationID)
+		if err != nil {
+			return err
+		}
+		*lat, *lon = location.Latitude, location.Longitude
+	}
+	if math.IsNaN(*lat) || math.IsNaN(*lon) {
+		return fmt.Errorf("%w: -location, or -lat and -lon", errMissingFlag)
+	}
+
+	sector, err := c.sectorsRepo.Locate(ctx, *lat, *lon)
+	if err != nil {
+		return err
+	}
+	return c.printer.Sectors([]models.Sector{sector})
+}
+
+func (c *ctl) migrateTimestamps(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate timestamps", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only count the items that would be migrated")
+	only := flags.String("table", "", "only migrate this table, required with -resume")
+	resume := flags.String("resume", "", "cursor a stopped run printed, to go on from")
+	flags.Parse(args)
+
+	tables := []string{c.tables.PickingRoutes, c.tables.Locations}
+	if *only != "" {
+		tables = []string{*only}
+	}
+	if *resume != "" && *only == "" {
+		return fmt.Errorf("%w: -table", errMissingFlag)
+	}
+	for _, table := range tables {
+		report, err := repositories.MigrateTimestamps(ctx, c.client, table, []string{"id"}, *resume, *dryRun)
+		if err := printMigration("migrate timestamps -table "+table, table, report, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ctl) migrateGeohashes(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate geohashes", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only count the items that would be migrated")
+	resume := flags.String("resume", "", "cursor a stopped run printed, to go on from")
+	flags.Parse(args)
+
+	report, err := repositories.IndexLocations(ctx, c.client, c.tables.Locations, *resume, *dryRun)
+	return printMigration("migrate geohashes", c.tables.Locations, report, err)
+}
+
+func (c *ctl) migrateRouteSectors(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate route-sectors", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only count the items that would be migrated")
+	resume := flags.String("resume", "", "cursor a stopped run printed, to go on from")
+	flags.Parse(args)
+
+	sectors, err := c.sectorsRepo.All(ctx)
+	if err != nil {
+		return err
+	}
+	report, err := repositories.LinkRouteSectors(ctx, c.client, c.tables.PickingRoutes, sectors, *resume, *dryRun)
+	return printMigration("migrate route-sectors", c.tables.PickingRoutes, report, err)
+}
+
+// printMigration prints what the migration went through on table and, when
+// it stopped on err, the command to go on from where it stopped
+func printMigration(command string, table string, report repositories.MigrationReport, err error) error {
+	fmt.Printf(
+		"%s: %d scanned, %d migrated, %d conflicts, %d throttled\n",
+		table, report.Scanned, report.Migrated, report.Conflicts, report.Throttled,
+	)
+	if err != nil {
+		if report.Resume != "" {
+			fmt.Printf("%s: stopped, go on with: reciappctl %s -resume %s\n", table, command, report.Resume)
+		}
+		return fmt.Errorf("migrating %s: %w", table, err)
+	}
+	return nil
+}
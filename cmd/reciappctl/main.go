@@ -0,0 +1,208 @@
+// Command reciappctl lets coordinators operate the backend through the same
+// repositories the Lambda functions use, instead of editing DynamoDB items by
+// hand.
+//
+//	reciappctl [flags] routes list -status closed -hours 24
+//	reciappctl [flags] routes show -route <route_id>
+//	reciappctl [flags] routes assign -route <route_id> -gatherer <user_id>
+//	reciappctl [flags] routes unassign -route <route_id>
+//	reciappctl [flags] locations adjust -location <location_id> -amount -10 -reason "..."
+//	reciappctl [flags] locations near -lat 4.6415 -lon -74.0652 -radius 500
+//	reciappctl [flags] locations within -min-lat 4.63 -min-lon -74.07 -max-lat 4.66 -max-lon -74.05
+//	reciappctl [flags] sectors list
+//	reciappctl [flags] sectors import -file sectors.json
+//	reciappctl [flags] sectors locate -location <location_id>
+//	reciappctl [flags] migrate timestamps -dry-run
+//	reciappctl [flags] migrate geohashes -dry-run
+//	reciappctl [flags] migrate route-sectors -resume <cursor>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/schema"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type LocationsRepository interface {
+	Find(ctx context.Context, id string) (models.Location, error)
+	AdjustBalance(ctx context.Context, locationID string, adjustment models.BalanceAdjustment) error
+	FindWithinBox(ctx context.Context, box geo.Box) ([]models.Location, error)
+	FindWithinRadius(ctx context.Context, lat float64, lon float64, radius float64) ([]models.Location, error)
+}
+
+type SectorsRepository interface {
+	Save(ctx context.Context, sector models.Sector) error
+	All(ctx context.Context) ([]models.Sector, error)
+	Locate(ctx context.Context, lat float64, lon float64) (models.Sector, error)
+}
+
+type RoutesRepository interface {
+	Find(ctx context.Context, routeID string) (models.Route, error)
+	FindAvailableRoutes(ctx context.Context, currentTime time.Time, maxTime time.Time) ([]models.Route, error)
+	FindOpenShifts(ctx context.Context, currentTime time.Time, maxTime time.Time) ([]models.Route, error)
+	FindByStatus(ctx context.Context, status string, currentTime time.Time, maxTime time.Time) ([]models.Route, error)
+	ForceAssign(ctx context.Context, userID string, routeID string) error
+	Unassign(ctx context.Context, routeID string) error
+}
+
+// ctl holds what every command needs
+type ctl struct {
+	client        repositories.DynamoDBClient
+	tables        schema.Names
+	usersRepo     UsersRepository
+	locationsRepo LocationsRepository
+	routesRepo    RoutesRepository
+	sectorsRepo   SectorsRepository
+	timeHelper    *internal.TimeHelper
+	printer       *printer
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = usage
+	endpoint := flag.String("dynamodb-endpoint", "", "DynamoDB endpoint, empty for AWS")
+	region := flag.String("region", "us-east-1", "AWS region")
+	usersTable := flag.String("dynamodb-users", schema.DefaultNames.Users, "users table")
+	locationsTable := flag.String("dynamodb-locations", schema.DefaultNames.Locations, "locations table")
+	userLocationsTable := flag.String("dynamodb-user-locations", schema.DefaultNames.UserLocations, "user_locations table")
+	routesTable := flag.String("dynamodb-picking-routes", schema.DefaultNames.PickingRoutes, "picking_routes table")
+	sectorsTable := flag.String("dynamodb-sectors", schema.DefaultNames.Sectors, "sectors table")
+	timezone := flag.String("timezone", "America/Bogota", "timezone used to read and render dates")
+	output := flag.String("output", OutputTable, "either table or json")
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		usage()
+		os.Exit(2)
+	}
+	if *output != OutputTable && *output != OutputJSON {
+		log.Fatalf("unknown output (%s)\n", *output)
+	}
+
+	timeHelper, err := internal.NewTimeHelper(*timezone)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config := &aws.Config{
+		Region: aws.String(*region),
+	}
+	if *endpoint != "" {
+		config.Endpoint = aws.String(*endpoint)
+	}
+	dynamodbClient := repositories.NewRetryingClient(
+		dynamodb.New(session.Must(session.NewSession(config)), aws.NewConfig().WithMaxRetries(0)),
+		repositories.DefaultRetryPolicy,
+	)
+
+	c := &ctl{
+		client: dynamodbClient,
+		tables: schema.Names{
+			Users:         *usersTable,
+			Locations:     *locationsTable,
+			UserLocations: *userLocationsTable,
+			PickingRoutes: *routesTable,
+			Sectors:       *sectorsTable,
+		},
+		usersRepo: repositories.NewDynamoDBUsersRepository(
+			dynamodbClient,
+			*usersTable,
+		),
+		locationsRepo: repositories.NewDynamoDBLocationsRepository(
+			dynamodbClient,
+			*userLocationsTable,
+			*locationsTable,
+		),
+		routesRepo: repositories.NewDynamoDBRoutesRepository(
+			dynamodbClient,
+			*routesTable,
+			*locationsTable,
+			timeHelper,
+			internal.NewUUIDHelper(),
+		),
+		sectorsRepo: repositories.NewDynamoDBSectorsRepository(
+			dynamodbClient,
+			*sectorsTable,
+		),
+		timeHelper: timeHelper,
+		printer:    newPrinter(os.Stdout, *output, timeHelper),
+	}
+
+	commands := map[string]map[string]func(ctx context.Context, args []string) error{
+		"routes": {
+			"list":     c.listRoutes,
+			"show":     c.showRoute,
+			"assign":   c.assignRoute,
+			"unassign": c.unassignRoute,
+		},
+		"locations": {
+			"adjust": c.adjustBalance,
+			"near":   c.nearLocations,
+			"within": c.locationsWithin,
+		},
+		"sectors": {
+			"list":   c.listSectors,
+			"import": c.importSectors,
+			"locate": c.locateSector,
+		},
+		"migrate": {
+			"timestamps":    c.migrateTimestamps,
+			"geohashes":     c.migrateGeohashes,
+			"route-sectors": c.migrateRouteSectors,
+		},
+	}
+	command, ok := commands[flag.Arg(0)][flag.Arg(1)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := command(context.Background(), flag.Args()[2:]); err != nil {
+		log.Fatalf("reciappctl: %v\n", err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: reciappctl [flags] <resource> <command> [command flags]
+
+Commands:
+  routes list            list routes by status starting within a time window
+  routes show            inspect a route and its picking points
+  routes assign          assign a route to a gatherer, replacing the current one
+  routes unassign        release an assigned route
+  locations adjust       add to or subtract from a location balance
+  locations near         list the locations within a radius, the closest first
+  locations within       list the locations within a bounding box
+  sectors list           list the sectors
+  sectors import         save the sectors of a JSON file, replacing existing ones
+  sectors locate         tell the sector a location or point lies in
+  migrate timestamps     rewrite the timestamps stored with a local offset as UTC
+  migrate geohashes      index the locations saved before the geohash index
+  migrate route-sectors  link the routes saved before sector ids to their sector
+
+Run a command with -h to see its flags.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
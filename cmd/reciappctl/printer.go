@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+// printer renders the command results either as aligned tables or as the
+// JSON encoding of the models
+type printer struct {
+	w          io.Writer
+	output     string
+	timeHelper *internal.TimeHelper
+}
+
+func newPrinter(w io.Writer, output string, timeHelper *internal.TimeHelper) *printer {
+	return &printer{
+		w:          w,
+		output:     output,
+		timeHelper: timeHelper,
+	}
+}
+
+func (p *printer) Routes(routes []models.Route) error {
+	if p.output == OutputJSON {
+		return p.json(routes)
+	}
+	tw := p.table()
+	fmt.Fprintln(tw, "ID\tSTATUS\tSECTOR\tSHIFT\tSTARTS AT\tGATHERER\tPOINTS\tDONE")
+	for _, route := range routes {
+		done := 0
+		for _, pp := range route.PickingPoints {
+			if pp.IsDone() {
+				done++
+			}
+		}
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n",
+			route.ID, route.Status, route.Sector, route.Shift,
+			p.time(route.StartsAt, route.Zone()), orDash(route.GathererID),
+			len(route.PickingPoints), done,
+		)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) Route(route models.Route) error {
+	if p.output == OutputJSON {
+		return p.json(route)
+	}
+	tw := p.table()
+	fmt.Fprintf(tw, "ID\t%s\n", route.ID)
+	fmt.Fprintf(tw, "STATUS\t%s\n", route.Status)
+	fmt.Fprintf(tw, "SECTOR\t%s (%s)\n", route.Sector, route.Shift)
+	fmt.Fprintf(tw, "GATHERER\t%s\n", orDash(route.GathererID))
+	fmt.Fprintf(tw, "TIMEZONE\t%s\n", orDash(route.Zone()))
+	fmt.Fprintf(tw, "STARTS AT\t%s\n", p.time(route.StartsAt, route.Zone()))
+	fmt.Fprintf(tw, "INITIATED AT\t%s\n", p.time(route.InitiatedAt, route.Zone()))
+	fmt.Fprintf(tw, "FINISHED AT\t%s\n", p.time(route.FinishedAt, route.Zone()))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(p.w)
+
+	tw = p.table()
+	fmt.Fprintln(tw, "#\tID\tLOCATION\tADDRESS\tMATERIALS\tSTATE\tAT\tDETAIL")
+	for i, pp := range route.PickingPoints {
+		state, at, detail := "pending", "-", "-"
+		switch {
+		case pp.PickedAt != nil:
+			state, at = "picked", p.time(pp.PickedAt, route.Zone())
+			detail = quantities(pp.Quantities)
+			if pp.FinishFix != nil && pp.FinishFix.Flagged {
+				detail += fmt.Sprintf(" (flagged %.0fm away)", pp.FinishFix.Distance)
+			}
+		case pp.FailedAt != nil:
+			state, at = "failed", p.time(pp.FailedAt, route.Zone())
+			detail = strings.TrimSpace(pp.FailureReason + " " + pp.FailureNote)
+		}
+		fmt.Fprintf(
+			tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			i, pp.ID, pp.LocationID, pp.Address1,
+			strings.Join(pp.Materials, ","), state, at, detail,
+		)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) Location(location models.Location) error {
+	if p.output == OutputJSON {
+		return p.json(location)
+	}
+	tw := p.table()
+	fmt.Fprintf(tw, "ID\t%s\n", location.ID)
+	fmt.Fprintf(tw, "NAME\t%s\n", location.Name)
+	fmt.Fprintf(tw, "ADDRESS\t%s %s, %s\n", location.Address1, location.Address2, location.City)
+	fmt.Fprintf(tw, "BALANCE\t%v\n", location.Balance)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(location.BalanceAdjustments) == 0 {
+		return nil
+	}
+	fmt.Fprintln(p.w)
+
+	tw = p.table()
+	fmt.Fprintln(tw, "AT\tBY\tAMOUNT\tREASON")
+	for _, adjustment := range location.BalanceAdjustments {
+		fmt.Fprintf(
+			tw, "%s\t%s\t%+v\t%s\n",
+			p.time(adjustment.Created, location.Zone()), orDash(adjustment.CreatedBy),
+			adjustment.Amount, adjustment.Reason,
+		)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) Locations(locations []models.Location) error {
+	if p.output == OutputJSON {
+		return p.json(locations)
+	}
+	tw := p.table()
+	fmt.Fprintln(tw, "ID\tNAME\tADDRESS\tLATITUDE\tLONGITUDE\tBALANCE")
+	for _, location := range locations {
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%v\t%v\t%v\n",
+			location.ID, location.Name, location.Address1,
+			location.Latitude, location.Longitude, location.Balance,
+		)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) Sectors(sectors []models.Sector) error {
+	if p.output == OutputJSON {
+		return p.json(sectors)
+	}
+	tw := p.table()
+	fmt.Fprintln(tw, "ID\tNAME\tCITY\tPOINTS")
+	for _, sector := range sectors {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", sector.ID, sector.Name, orDash(sector.City), len(sector.Polygon))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) json(v interface{}) error {
+	encoder := json.NewEncoder(p.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (p *printer) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+}
+
+// time writes t in the given zone, the process one when it is empty
+func (p *printer) time(t *time.Time, zone string) string {
+	if t == nil {
+		return "-"
+	}
+	formatted, err := p.timeHelper.ToISO8601In(*t, zone)
+	if err != nil {
+		return t.String()
+	}
+	return formatted
+}
+
+func quantities(quantities []models.MaterialQuantity) string {
+	if len(quantities) == 0 {
+		return "-"
+	}
+	formatted := make([]string, len(quantities))
+	for i, q := range quantities {
+		formatted[i] = fmt.Sprintf("%v%s %s", q.Amount, q.Unit, q.Material)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func currentUser() string {
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+	return "reciappctl"
+}
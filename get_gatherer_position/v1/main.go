@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getgathererposition"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func main() {
+	usersTable := os.Getenv("DYNAMODB_USERS")
+	if usersTable == "" {
+		panic("DYNAMODB_USERS cannot be empty")
+	}
+
+	routesTable := os.Getenv("DYNAMODB_PICKING_ROUTES")
+	if routesTable == "" {
+		panic("DYNAMODB_PICKING_ROUTES cannot be empty")
+	}
+
+	locationsTable := os.Getenv("DYNAMODB_LOCATIONS")
+	if locationsTable == "" {
+		panic("DYNAMODB_LOCATIONS cannot be empty")
+	}
+
+	userLocationsTable := os.Getenv("DYNAMODB_USER_LOCATIONS")
+	if userLocationsTable == "" {
+		panic("DYNAMODB_USER_LOCATIONS cannot be empty")
+	}
+
+	positionsTable := os.Getenv("DYNAMODB_GATHERER_POSITIONS")
+	if positionsTable == "" {
+		panic("DYNAMODB_GATHERER_POSITIONS cannot be empty")
+	}
+
+	timezone := os.Getenv("TIMEZONE")
+	if timezone == "" {
+		panic("TIMEZONE cannot be empty")
+	}
+
+	etaSpeedString := os.Getenv("ETA_AVERAGE_SPEED_KMH")
+	if etaSpeedString == "" {
+		panic("ETA_AVERAGE_SPEED_KMH cannot be empty")
+	}
+
+	etaSpeed, err := strconv.ParseFloat(etaSpeedString, 64)
+	if err != nil {
+		panic("ETA_AVERAGE_SPEED_KMH must be a number")
+	}
+
+	etaServiceTimeString := os.Getenv("ETA_SERVICE_TIME_MINUTES")
+	if etaServiceTimeString == "" {
+		panic("ETA_SERVICE_TIME_MINUTES cannot be empty")
+	}
+
+	etaServiceTime, err := strconv.ParseFloat(etaServiceTimeString, 64)
+	if err != nil {
+		panic("ETA_SERVICE_TIME_MINUTES must be a number")
+	}
+
+	etaCalculator := internal.ETACalculator{
+		AverageSpeed: etaSpeed,
+		ServiceTime:  time.Duration(etaServiceTime * float64(time.Minute)),
+	}
+
+	timeHelper, err := internal.NewTimeHelper(timezone)
+	if err != nil {
+		panic(err)
+	}
+
+	uuidHelper := internal.NewUUIDHelper()
+
+	session := session.New()
+	dynamodbClient := repositories.NewRetryingClient(
+		dynamodb.New(session, aws.NewConfig().WithMaxRetries(0)),
+		repositories.DefaultRetryPolicy,
+	)
+	usersRepo := repositories.NewDynamoDBUsersRepository(
+		dynamodbClient,
+		usersTable,
+	)
+	routesRepo := repositories.NewDynamoDBRoutesRepository(
+		dynamodbClient,
+		routesTable,
+		locationsTable,
+		timeHelper,
+		uuidHelper,
+	)
+	locationsRepo := repositories.NewDynamoDBLocationsRepository(
+		dynamodbClient,
+		userLocationsTable,
+		locationsTable,
+	)
+
+	trackingRepo := repositories.NewDynamoDBTrackingRepository(
+		dynamodbClient,
+		positionsTable,
+		timeHelper,
+	)
+
+	handler := getgathererposition.Adapter(usersRepo, routesRepo, locationsRepo, trackingRepo, timeHelper, etaCalculator)
+	lambda.Start(handler)
+}
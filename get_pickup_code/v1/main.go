@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getpickupcode"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func main() {
+	usersTable := os.Getenv("DYNAMODB_USERS")
+	if usersTable == "" {
+		panic("DYNAMODB_USERS cannot be empty")
+	}
+
+	routesTable := os.Getenv("DYNAMODB_PICKING_ROUTES")
+	if routesTable == "" {
+		panic("DYNAMODB_PICKING_ROUTES cannot be empty")
+	}
+
+	locationsTable := os.Getenv("DYNAMODB_LOCATIONS")
+	if locationsTable == "" {
+		panic("DYNAMODB_LOCATIONS cannot be empty")
+	}
+
+	userLocationsTable := os.Getenv("DYNAMODB_USER_LOCATIONS")
+	if userLocationsTable == "" {
+		panic("DYNAMODB_USER_LOCATIONS cannot be empty")
+	}
+
+	timezone := os.Getenv("TIMEZONE")
+	if timezone == "" {
+		panic("TIMEZONE cannot be empty")
+	}
+
+	timeHelper, err := internal.NewTimeHelper(timezone)
+	if err != nil {
+		panic(err)
+	}
+
+	uuidHelper := internal.NewUUIDHelper()
+
+	session := session.New()
+	dynamodbClient := repositories.NewRetryingClient(
+		dynamodb.New(session, aws.NewConfig().WithMaxRetries(0)),
+		repositories.DefaultRetryPolicy,
+	)
+	usersRepo := repositories.NewDynamoDBUsersRepository(
+		dynamodbClient,
+		usersTable,
+	)
+	routesRepo := repositories.NewDynamoDBRoutesRepository(
+		dynamodbClient,
+		routesTable,
+		locationsTable,
+		timeHelper,
+		uuidHelper,
+	)
+	locationsRepo := repositories.NewDynamoDBLocationsRepository(
+		dynamodbClient,
+		userLocationsTable,
+		locationsTable,
+	)
+
+	handler := getpickupcode.Adapter(usersRepo, routesRepo, locationsRepo)
+	lambda.Start(handler)
+}
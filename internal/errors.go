@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+)
+
+// APIError is an error clients can tell apart by its code instead of its
+// message. Handlers declare their own as sentinels with NewError
+type APIError struct {
+	Status  int                    `json:"-"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Field   string                 `json:"field,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func NewError(status int, code string, message string) *APIError {
+	return &APIError{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Is matches copies made by WithField and WithDetails against the sentinel
+// they come from
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Code == e.Code
+}
+
+func (e *APIError) WithField(field string) *APIError {
+	c := *e
+	c.Field = field
+	return &c
+}
+
+func (e *APIError) WithDetails(details map[string]interface{}) *APIError {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+var ErrInternal = NewError(http.StatusInternalServerError, "internal_error", "internal error")
+var ErrBodyTooLarge = NewError(http.StatusRequestEntityTooLarge, "body_too_large", "request body too large")
+var ErrMalformedBody = NewError(http.StatusBadRequest, "malformed_body", "request body is not valid JSON")
+var ErrInvalidField = NewError(http.StatusBadRequest, "invalid_field", "invalid field")
+var ErrUserIDEmpty = NewError(http.StatusBadRequest, "user_id_empty", "user_id cannot be empty").WithField("user_id")
+
+// registry maps the errors declared by other packages, which can not depend
+// on this one, to their code and status
+var registry = []registration{
+	register(repositories.ErrUserNotFound, http.StatusNotFound, "user_not_found"),
+	register(repositories.ErrRouteNotFound, http.StatusNotFound, "route_not_found"),
+	register(repositories.ErrLocationNotFound, http.StatusNotFound, "location_not_found"),
+	register(repositories.ErrNoLocationsFound, http.StatusNotFound, "no_locations_found"),
+	register(repositories.ErrNoAssignedRoutes, http.StatusNotFound, "no_assigned_routes"),
+	register(repositories.ErrNoOpenShifts, http.StatusNotFound, "no_open_shifts"),
+	register(repositories.ErrPickingPointNotFound, http.StatusNotFound, "picking_point_not_found"),
+	register(repositories.ErrRouteAlreadyAssigned, http.StatusUnprocessableEntity, "route_already_assigned"),
+	register(repositories.ErrPickingPointAlreadyPinned, http.StatusConflict, "picking_point_already_pinned"),
+	register(repositories.ErrPickupCodeAlreadyUsed, http.StatusConflict, "pickup_code_already_used"),
+	register(repositories.ErrRouteNotAssignable, http.StatusConflict, "route_not_assignable"),
+	register(repositories.ErrRouteNotAssigned, http.StatusConflict, "route_not_assigned"),
+	register(repositories.ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor"),
+	register(repositories.ErrThrottled, http.StatusServiceUnavailable, "throttled"),
+	register(repositories.ErrIdempotencyKeyInUse, http.StatusConflict, "idempotency_key_in_use"),
+	register(repositories.ErrNoGathererPosition, http.StatusNotFound, "no_gatherer_position"),
+	register(repositories.ErrAreaTooLarge, http.StatusBadRequest, "area_too_large"),
+	register(repositories.ErrSectorNotFound, http.StatusNotFound, "sector_not_found"),
+}
+
+type registration struct {
+	sentinel error
+	apiErr   *APIError
+}
+
+func register(sentinel error, status int, code string) registration {
+	return registration{
+		sentinel: sentinel,
+		apiErr:   NewError(status, code, sentinel.Error()),
+	}
+}
+
+// AsAPIError resolves any error to an APIError: declared with NewError,
+// registered, or an internal error carrying the original message
+func AsAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	for _, r := range registry {
+		if errors.Is(err, r.sentinel) {
+			return r.apiErr
+		}
+	}
+	internalErr := *ErrInternal
+	internalErr.Message = err.Error()
+	return &internalErr
+}
+
+// StatusOf is the HTTP status err is answered with
+func StatusOf(err error) int {
+	return AsAPIError(err).Status
+}
+
+func malformedBody(err error) *APIError {
+	return ErrMalformedBody.WithDetails(map[string]interface{}{
+		"reason": err.Error(),
+	})
+}
+
+// codeFor names the statuses errors are forced into by Error, e.g.
+// "unprocessable_entity"
+func codeFor(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
@@ -0,0 +1,114 @@
+package internal_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/finishpickingpoint"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/pinpickingpoint"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type errorsBody struct {
+	Errors []struct {
+		Code    string                 `json:"code"`
+		Message string                 `json:"message"`
+		Field   string                 `json:"field"`
+		Details map[string]interface{} `json:"details"`
+	} `json:"errors"`
+}
+
+func decodeErrors(t *testing.T, res events.APIGatewayProxyResponse) errorsBody {
+	t.Helper()
+	var body errorsBody
+	if err := json.Unmarshal([]byte(res.Body), &body); err != nil {
+		t.Fatalf("expected an errors body, got %s", res.Body)
+	}
+	return body
+}
+
+func TestFailMapsErrors(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{repositories.ErrRouteNotFound, http.StatusNotFound, "route_not_found"},
+		{fmt.Errorf("assigning: %w", repositories.ErrRouteAlreadyAssigned), http.StatusUnprocessableEntity, "route_already_assigned"},
+		{repositories.ErrPickupCodeAlreadyUsed, http.StatusConflict, "pickup_code_already_used"},
+		{pinpickingpoint.ErrShiftIsClosed, http.StatusConflict, "shift_closed"},
+		{finishpickingpoint.ErrPositionEmpty, http.StatusBadRequest, "position_empty"},
+		{errors.New("connection reset"), http.StatusInternalServerError, "internal_error"},
+	}
+	for _, c := range cases {
+		t.Run(c.code, func(t *testing.T) {
+			res := internal.Fail(c.err)
+			if res.StatusCode != c.status {
+				t.Fatalf("expected status %v, got %v", c.status, res.StatusCode)
+			}
+			body := decodeErrors(t, res)
+			if len(body.Errors) != 1 || body.Errors[0].Code != c.code || body.Errors[0].Message == "" {
+				t.Fatalf("expected a single %s error, got %s", c.code, res.Body)
+			}
+		})
+	}
+}
+
+func TestErrorForcesStatus(t *testing.T) {
+	res := internal.Error(http.StatusForbidden, errors.New("not a gatherer"))
+	body := decodeErrors(t, res)
+	if res.StatusCode != http.StatusForbidden || body.Errors[0].Code != "forbidden" {
+		t.Fatalf("expected a 403 forbidden error, got %v (%s)", res.StatusCode, res.Body)
+	}
+}
+
+func TestAPIErrorCopiesMatchTheirSentinel(t *testing.T) {
+	err := finishpickingpoint.ErrOutsideGeofence.WithDetails(map[string]interface{}{"distance": 120.0})
+	if !errors.Is(err, finishpickingpoint.ErrOutsideGeofence) {
+		t.Fatalf("expected the copy to match its sentinel")
+	}
+	if finishpickingpoint.ErrOutsideGeofence.Details != nil {
+		t.Fatalf("expected the sentinel to be left untouched")
+	}
+}
+
+func TestSchemaErrorsNameTheFields(t *testing.T) {
+	handler := internal.ValidateBody(pinpickingpoint.RequestSchema)(ok)
+
+	res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+		Body: `{"user_id":"u1","shift_id":"s1","materials":["wood"]}`,
+	})
+	body := decodeErrors(t, res)
+	rules := map[string]string{}
+	for _, e := range body.Errors {
+		if e.Code != internal.ErrInvalidField.Code {
+			t.Errorf("expected %s, got %s", internal.ErrInvalidField.Code, e.Code)
+		}
+		rules[e.Field], _ = e.Details["rule"].(string)
+	}
+	if rules["location_id"] != "required" || rules["materials.0"] != "enum" {
+		t.Fatalf("expected location_id required and materials.0 enum violations, got %s", res.Body)
+	}
+}
+
+func TestFailAsksToRetryWhenThrottled(t *testing.T) {
+	err := fmt.Errorf("finding routes: %w", &repositories.ThrottledError{
+		RetryAfter: 1500 * time.Millisecond,
+		Err:        errors.New("ProvisionedThroughputExceededException"),
+	})
+
+	res := internal.Fail(err)
+	if res.StatusCode != http.StatusServiceUnavailable || res.Headers["Retry-After"] != "2" {
+		t.Fatalf("expected a 503 to retry after 2s, got %v %q", res.StatusCode, res.Headers["Retry-After"])
+	}
+	if code := decodeErrors(t, res).Errors[0].Code; code != "throttled" {
+		t.Fatalf("expected throttled, got %s", code)
+	}
+}
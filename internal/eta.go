@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+// ETACalculator estimates when the gatherer gets to each pending picking
+// point of a route, visiting them in the route order. Distances are straight
+// lines, AverageSpeed is expected to account for the detours of the streets
+type ETACalculator struct {
+	AverageSpeed float64       // km/h
+	ServiceTime  time.Duration // spent at every picking point
+}
+
+// DefaultETACalculator fits a truck going around a neighborhood
+var DefaultETACalculator = ETACalculator{
+	AverageSpeed: 15,
+	ServiceTime:  5 * time.Minute,
+}
+
+// Origin is where the gatherer is at now, e.g. its last ping
+type Origin struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Estimate returns the ETA of every picking point not done yet, by id. With
+// no origin the gatherer is assumed to be at the first pending point at now,
+// the rest being estimated from there
+func (c ETACalculator) Estimate(origin *Origin, pickingPoints []models.PickingPoint, now time.Time) map[string]time.Time {
+	etas := map[string]time.Time{}
+	at := now
+	var lat, lon float64
+	if origin != nil {
+		lat, lon = origin.Latitude, origin.Longitude
+	}
+	for _, pp := range pickingPoints {
+		if pp.IsDone() {
+			continue
+		}
+		if origin != nil || len(etas) > 0 {
+			at = at.Add(c.travelTime(HaversineDistance(lat, lon, pp.Latitude, pp.Longitude)))
+		}
+		etas[pp.ID] = at
+		at = at.Add(c.ServiceTime)
+		lat, lon = pp.Latitude, pp.Longitude
+	}
+	return etas
+}
+
+func (c ETACalculator) travelTime(meters float64) time.Duration {
+	if c.AverageSpeed <= 0 {
+		return 0
+	}
+	metersPerSecond := c.AverageSpeed * 1000 / 3600
+	return time.Duration(meters / metersPerSecond * float64(time.Second)).Round(time.Second)
+}
@@ -0,0 +1,54 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+// pendingPoints are 1.5 km apart along a meridian, 0.0135 degrees each
+func pendingPoints() []models.PickingPoint {
+	picked := time.Now()
+	return []models.PickingPoint{
+		{ID: "pp1", Latitude: 4.6000, Longitude: -74.07, PickedAt: &picked},
+		{ID: "pp2", Latitude: 4.6135, Longitude: -74.07},
+		{ID: "pp3", Latitude: 4.6270, Longitude: -74.07},
+	}
+}
+
+func TestEstimateFromOrigin(t *testing.T) {
+	calculator := internal.ETACalculator{AverageSpeed: 18, ServiceTime: 5 * time.Minute}
+	now := time.Date(2020, 10, 5, 8, 0, 0, 0, time.UTC)
+
+	etas := calculator.Estimate(&internal.Origin{Latitude: 4.6000, Longitude: -74.07}, pendingPoints(), now)
+
+	// 1.5 km at 18 km/h is 5 minutes
+	assertETA(t, etas, "pp2", now.Add(5*time.Minute))
+	assertETA(t, etas, "pp3", now.Add(15*time.Minute))
+	if _, ok := etas["pp1"]; ok {
+		t.Fatalf("expected no ETA for the picked point, got %v", etas["pp1"])
+	}
+}
+
+func TestEstimateWithoutOrigin(t *testing.T) {
+	calculator := internal.ETACalculator{AverageSpeed: 18, ServiceTime: 5 * time.Minute}
+	now := time.Date(2020, 10, 5, 8, 0, 0, 0, time.UTC)
+
+	etas := calculator.Estimate(nil, pendingPoints(), now)
+
+	assertETA(t, etas, "pp2", now)
+	assertETA(t, etas, "pp3", now.Add(10*time.Minute))
+}
+
+func assertETA(t *testing.T, etas map[string]time.Time, id string, expected time.Time) {
+	t.Helper()
+	eta, ok := etas[id]
+	if !ok {
+		t.Fatalf("expected an ETA for %s", id)
+	}
+	if diff := eta.Sub(expected); diff < -5*time.Second || diff > 5*time.Second {
+		t.Fatalf("expected %s at %v, got %v", id, expected, eta)
+	}
+}
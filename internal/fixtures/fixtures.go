@@ -0,0 +1,231 @@
+// Package fixtures is the seed data set used on local environments: users
+// of both types, their locations, the sectors they lie in and a route on
+// every status
+package fixtures
+
+import (
+	"context"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+type UsersRepository interface {
+	Save(ctx context.Context, user models.User) error
+}
+
+type LocationsRepository interface {
+	Save(ctx context.Context, location models.Location) error
+	Link(ctx context.Context, userID string, locationID string) error
+}
+
+type RoutesRepository interface {
+	Save(ctx context.Context, route models.Route) error
+}
+
+type SectorsRepository interface {
+	Save(ctx context.Context, sector models.Sector) error
+}
+
+type Set struct {
+	Users     []models.User
+	Locations []models.Location
+	Links     map[string][]string // user id -> location ids
+	Sectors   []models.Sector
+	Routes    []models.Route
+}
+
+// Default builds the seed set relative to now, so open shifts and available
+// routes always fall within the windows queried by the handlers
+func Default(now time.Time) Set {
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d).Truncate(time.Second)
+		return &t
+	}
+
+	users := []models.User{
+		{ID: "user-1", Username: "ana", Firstname: "Ana", Lastname: "Rojas", Type: models.UserTypeUser, Country: "CO"},
+		{ID: "user-2", Username: "luis", Firstname: "Luis", Lastname: "Mejia", Type: models.UserTypeUser, Country: "CO"},
+		{ID: "gatherer-1", Username: "carlos", Firstname: "Carlos", Lastname: "Perez", Type: models.UserTypeGatherer, Country: "CO"},
+		{ID: "gatherer-2", Username: "maria", Firstname: "Maria", Lastname: "Gomez", Type: models.UserTypeGatherer, Country: "CO"},
+	}
+
+	locations := []models.Location{
+		{
+			ID: "location-1", CreatedBy: "user-1", Balance: 20, Name: "Casa",
+			Country: "CO", City: "Bogota", State: "Cundinamarca",
+			Address1: "Calle 53 # 13-40", Address2: "Apto 301",
+			Latitude: 4.6415, Longitude: -74.0652,
+		},
+		{
+			ID: "location-2", CreatedBy: "user-1", Balance: 0, Name: "Oficina",
+			Country: "CO", City: "Bogota", State: "Cundinamarca",
+			Address1: "Carrera 7 # 71-21", Address2: "Piso 5",
+			Latitude: 4.6547, Longitude: -74.0558,
+		},
+		{
+			ID: "location-3", CreatedBy: "user-2", Balance: 10, Name: "Casa",
+			Country: "CO", City: "Bogota", State: "Cundinamarca",
+			Address1: "Calle 45 # 22-10", Address2: "",
+			Latitude: 4.6361, Longitude: -74.0750,
+		},
+	}
+
+	pickingPoint := func(id string, location models.Location, materials ...string) models.PickingPoint {
+		return models.PickingPoint{
+			ID:         id,
+			LocationID: location.ID,
+			Country:    location.Country,
+			City:       location.City,
+			Latitude:   location.Latitude,
+			Longitude:  location.Longitude,
+			Address1:   location.Address1,
+			Address2:   location.Address2,
+			Materials:  materials,
+			PickupCode: "code-" + id,
+			Created:    at(-48 * time.Hour),
+		}
+	}
+
+	picked := pickingPoint("pp-initiated-1", locations[0], models.MaterialPlastic)
+	picked.PickedAt = at(-30 * time.Minute)
+	picked.CodeUsedAt = picked.PickedAt
+	picked.Quantities = []models.MaterialQuantity{
+		{Material: models.MaterialPlastic, Amount: 3.5, Unit: models.UnitKilograms},
+	}
+
+	finishedPicked := pickingPoint("pp-finished-1", locations[0], models.MaterialGlass)
+	finishedPicked.PickedAt = at(-23 * time.Hour)
+	finishedFailed := pickingPoint("pp-finished-2", locations[2], models.MaterialPaper)
+	finishedFailed.FailedAt = at(-22 * time.Hour)
+	finishedFailed.FailureReason = models.FailureReasonNobodyHome
+
+	allMaterials := []string{
+		models.MaterialPlastic,
+		models.MaterialMetal,
+		models.MaterialGlass,
+		models.MaterialPaper,
+		models.MaterialTechnology,
+	}
+
+	routes := []models.Route{
+		{
+			ID: "route-open", Sector: "Chapinero", SectorID: "sector-chapinero", Shift: "AM",
+			Materials: allMaterials, Status: models.RouteStatusOpen,
+			StartsAt: at(48 * time.Hour), Created: at(-72 * time.Hour),
+			PickingPoints: []models.PickingPoint{
+				pickingPoint("pp-open-1", locations[1], models.MaterialPaper),
+			},
+		},
+		{
+			ID: "route-closed", Sector: "Teusaquillo", SectorID: "sector-teusaquillo", Shift: "PM",
+			Materials: allMaterials, Status: models.RouteStatusClosed,
+			StartsAt: at(3 * time.Hour), Created: at(-72 * time.Hour),
+			PickingPoints: []models.PickingPoint{
+				pickingPoint("pp-closed-1", locations[2], models.MaterialGlass, models.MaterialMetal),
+			},
+		},
+		{
+			ID: "route-assigned", Sector: "Chapinero", SectorID: "sector-chapinero", Shift: "PM",
+			Materials: allMaterials, Status: models.RouteStatusAssigned,
+			GathererID: "gatherer-2",
+			StartsAt:   at(5 * time.Hour), Created: at(-72 * time.Hour),
+			PickingPoints: []models.PickingPoint{
+				pickingPoint("pp-assigned-1", locations[1], models.MaterialTechnology),
+			},
+		},
+		{
+			ID: "route-initiated", Sector: "Chapinero", SectorID: "sector-chapinero", Shift: "AM",
+			Materials: allMaterials, Status: models.RouteStatusInitiated,
+			GathererID: "gatherer-1",
+			StartsAt:   at(-1 * time.Hour), InitiatedAt: at(-1 * time.Hour), Created: at(-72 * time.Hour),
+			PickingPoints: []models.PickingPoint{
+				picked,
+				pickingPoint("pp-initiated-2", locations[2], models.MaterialGlass),
+			},
+		},
+		{
+			ID: "route-finished", Sector: "Teusaquillo", SectorID: "sector-teusaquillo", Shift: "AM",
+			Materials: allMaterials, Status: models.RouteStatusFinished,
+			GathererID: "gatherer-1",
+			StartsAt:   at(-24 * time.Hour), InitiatedAt: at(-24 * time.Hour), FinishedAt: at(-22 * time.Hour),
+			Created:       at(-96 * time.Hour),
+			PickingPoints: []models.PickingPoint{finishedPicked, finishedFailed},
+		},
+		{
+			ID: "route-cancelled", Sector: "Teusaquillo", SectorID: "sector-teusaquillo", Shift: "PM",
+			Materials: allMaterials, Status: models.RouteStatusCancelled,
+			StartsAt: at(24 * time.Hour), Created: at(-72 * time.Hour),
+		},
+	}
+
+	return Set{
+		Users:     users,
+		Locations: locations,
+		Links: map[string][]string{
+			"user-1": {"location-1", "location-2"},
+			"user-2": {"location-3"},
+		},
+		// rough outlines, enough to tell the seed locations apart
+		Sectors: []models.Sector{
+			{
+				ID: "sector-chapinero", Name: "Chapinero", City: "Bogota",
+				Polygon: geo.Polygon{
+					{Latitude: 4.628, Longitude: -74.07},
+					{Latitude: 4.67, Longitude: -74.07},
+					{Latitude: 4.67, Longitude: -74.045},
+					{Latitude: 4.628, Longitude: -74.045},
+				},
+			},
+			{
+				ID: "sector-teusaquillo", Name: "Teusaquillo", City: "Bogota",
+				Polygon: geo.Polygon{
+					{Latitude: 4.62, Longitude: -74.1},
+					{Latitude: 4.66, Longitude: -74.1},
+					{Latitude: 4.66, Longitude: -74.07},
+					{Latitude: 4.62, Longitude: -74.07},
+				},
+			},
+		},
+		Routes: routes,
+	}
+}
+
+func Load(
+	ctx context.Context,
+	set Set,
+	usersRepo UsersRepository,
+	locationsRepo LocationsRepository,
+	sectorsRepo SectorsRepository,
+	routesRepo RoutesRepository,
+) error {
+	for _, user := range set.Users {
+		if err := usersRepo.Save(ctx, user); err != nil {
+			return err
+		}
+	}
+	for _, location := range set.Locations {
+		if err := locationsRepo.Save(ctx, location); err != nil {
+			return err
+		}
+	}
+	for userID, locationIDs := range set.Links {
+		for _, locationID := range locationIDs {
+			if err := locationsRepo.Link(ctx, userID, locationID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, sector := range set.Sectors {
+		if err := sectorsRepo.Save(ctx, sector); err != nil {
+			return err
+		}
+	}
+	for _, route := range set.Routes {
+		if err := routesRepo.Save(ctx, route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
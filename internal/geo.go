@@ -0,0 +1,9 @@
+package internal
+
+import "github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+
+// HaversineDistance returns the great-circle distance in meters between two
+// points given in decimal degrees
+func HaversineDistance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	return geo.Distance(lat1, lon1, lat2, lon2)
+}
@@ -0,0 +1,23 @@
+// Package geo holds the geometry the backend needs on its own, without a
+// dependency on any other package of it: distances, geohashes to index
+// positions and polygons to tell sectors apart
+package geo
+
+import "math"
+
+const earthRadiusMeters = 6371000
+
+// Distance returns the great-circle distance in meters between two points
+// given in decimal degrees
+func Distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	deltaPhi := (lat2 - lat1) * math.Pi / 180
+	deltaLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return earthRadiusMeters * c
+}
@@ -0,0 +1,144 @@
+package geo_test
+
+import (
+	"testing"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+)
+
+func TestEncode(t *testing.T) {
+	cases := []struct {
+		lat, lon  float64
+		precision int
+		hash      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{4.6415, -74.0652, 5, "d2g66"},
+		{-23.5505, -46.6333, 6, "6gyf4b"},
+	}
+	for _, c := range cases {
+		if hash := geo.Encode(c.lat, c.lon, c.precision); hash != c.hash {
+			t.Errorf("expected %v,%v to be %s, got %s", c.lat, c.lon, c.hash, hash)
+		}
+	}
+}
+
+func TestCellsCoverTheBox(t *testing.T) {
+	lat, lon := 4.6415, -74.0652
+	box := geo.BoxAround(lat, lon, 3000)
+
+	cells, err := geo.Cells(box, 5, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, corner := range []geo.Point{
+		{Latitude: box.MinLatitude, Longitude: box.MinLongitude},
+		{Latitude: box.MaxLatitude, Longitude: box.MaxLongitude},
+		{Latitude: lat, Longitude: lon},
+	} {
+		hash := geo.Encode(corner.Latitude, corner.Longitude, 5)
+		found := false
+		for _, cell := range cells {
+			found = found || cell == hash
+		}
+		if !found {
+			t.Errorf("expected %s, the cell of %v, within %v", hash, corner, cells)
+		}
+	}
+	if geo.Distance(lat, lon, box.MaxLatitude, lon) < 2999 {
+		t.Errorf("expected the box to hold the radius, got %v", box)
+	}
+}
+
+func TestCellsRejectsLargeAreas(t *testing.T) {
+	_, err := geo.Cells(geo.BoxAround(4.6415, -74.0652, 100000), 5, 16)
+	if err != geo.ErrTooManyCells {
+		t.Fatalf("expected ErrTooManyCells, got %v", err)
+	}
+}
+
+func TestPolygonContains(t *testing.T) {
+	// a concave "L" shaped sector
+	polygon := geo.Polygon{
+		{Latitude: 0, Longitude: 0},
+		{Latitude: 0, Longitude: 2},
+		{Latitude: 1, Longitude: 2},
+		{Latitude: 1, Longitude: 1},
+		{Latitude: 2, Longitude: 1},
+		{Latitude: 2, Longitude: 0},
+	}
+	cases := []struct {
+		lat, lon float64
+		inside   bool
+	}{
+		{0.5, 0.5, true},
+		{0.5, 1.5, true},
+		{1.5, 0.5, true},
+		{1.5, 1.5, false},
+		{-0.5, 0.5, false},
+		{0.5, 2.5, false},
+	}
+	for _, c := range cases {
+		if inside := polygon.Contains(c.lat, c.lon); inside != c.inside {
+			t.Errorf("expected %v,%v inside to be %v", c.lat, c.lon, c.inside)
+		}
+	}
+	if bounds := polygon.Bounds(); bounds != (geo.Box{MaxLatitude: 2, MaxLongitude: 2}) {
+		t.Errorf("unexpected bounds %v", bounds)
+	}
+}
+
+func TestPolygonContainsSharedEdgesOnce(t *testing.T) {
+	square := func(lat float64, lon float64) geo.Polygon {
+		return geo.Polygon{{lat, lon}, {lat + 1, lon}, {lat + 1, lon + 1}, {lat, lon + 1}}
+	}
+	// four unit squares meeting at 1,1
+	squares := map[string]geo.Polygon{
+		"sw": square(0, 0),
+		"se": square(0, 1),
+		"nw": square(1, 0),
+		"ne": square(1, 1),
+	}
+	cases := []struct {
+		lat, lon float64
+		holder   string
+	}{
+		{0.5, 1, "se"},
+		{1.5, 1, "ne"},
+		{1, 0.5, "nw"},
+		{1, 1.5, "ne"},
+		{1, 1, "ne"},
+		{0.5, 0, "sw"},
+		{0, 0.5, "sw"},
+	}
+	for _, c := range cases {
+		holders := []string{}
+		for name, polygon := range squares {
+			if polygon.Contains(c.lat, c.lon) {
+				holders = append(holders, name)
+			}
+		}
+		if len(holders) != 1 || holders[0] != c.holder {
+			t.Errorf("expected %v,%v inside %v alone, got %v", c.lat, c.lon, c.holder, holders)
+		}
+	}
+}
+
+func TestPolygonArea(t *testing.T) {
+	cases := []struct {
+		name    string
+		polygon geo.Polygon
+		area    float64
+	}{
+		{"empty", geo.Polygon{}, 0},
+		{"clockwise square", geo.Polygon{{0, 0}, {1, 0}, {1, 1}, {0, 1}}, 1},
+		{"counterclockwise square", geo.Polygon{{0, 0}, {0, 1}, {1, 1}, {1, 0}}, 1},
+		{"concave L", geo.Polygon{{0, 0}, {0, 2}, {1, 2}, {1, 1}, {2, 1}, {2, 0}}, 3},
+	}
+	for _, c := range cases {
+		if area := c.polygon.Area(); area != c.area {
+			t.Errorf("%s: expected area %v, got %v", c.name, c.area, area)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+var ErrTooManyCells = errors.New("the area spans too many cells")
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Box is the area between two parallels and two meridians, in decimal degrees
+type Box struct {
+	MinLatitude  float64 `json:"min_latitude"`
+	MinLongitude float64 `json:"min_longitude"`
+	MaxLatitude  float64 `json:"max_latitude"`
+	MaxLongitude float64 `json:"max_longitude"`
+}
+
+func (b Box) Contains(lat float64, lon float64) bool {
+	return lat >= b.MinLatitude && lat <= b.MaxLatitude &&
+		lon >= b.MinLongitude && lon <= b.MaxLongitude
+}
+
+// BoxAround is the smallest box holding the circle of the given radius, in
+// meters, around the point
+func BoxAround(lat float64, lon float64, radius float64) Box {
+	deltaLat := radius / earthRadiusMeters * 180 / math.Pi
+	deltaLon := 180.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > 1e-9 {
+		deltaLon = math.Min(deltaLat/cos, 180)
+	}
+	return Box{
+		MinLatitude:  math.Max(lat-deltaLat, -90),
+		MinLongitude: math.Max(lon-deltaLon, -180),
+		MaxLatitude:  math.Min(lat+deltaLat, 90),
+		MaxLongitude: math.Min(lon+deltaLon, 180),
+	}
+}
+
+// Encode returns the geohash of the point with precision characters. Points
+// sharing a prefix lie in the same cell, 5 characters being about 5 km wide
+// and 9 about 5 m
+func Encode(lat float64, lon float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	var hash strings.Builder
+	even := true
+	bit, ch := 0, 0
+	for hash.Len() < precision {
+		if even {
+			ch = ch<<1 | bisect(&lonRange, lon)
+		} else {
+			ch = ch<<1 | bisect(&latRange, lat)
+		}
+		even = !even
+		if bit++; bit == 5 {
+			hash.WriteByte(base32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return hash.String()
+}
+
+// bisect halves the range keeping the half holding v, telling which one it
+// kept
+func bisect(r *[2]float64, v float64) int {
+	mid := (r[0] + r[1]) / 2
+	if v >= mid {
+		r[0] = mid
+		return 1
+	}
+	r[1] = mid
+	return 0
+}
+
+// cellSize is the height and width, in degrees, of the cells of a precision
+func cellSize(precision int) (float64, float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Exp2(float64(latBits)), 360 / math.Exp2(float64(lonBits))
+}
+
+// Cells returns, sorted, the geohashes of the given precision covering the
+// box. It fails with ErrTooManyCells rather than returning more than limit
+func Cells(box Box, precision int, limit int) ([]string, error) {
+	height, width := cellSize(precision)
+	minRow := math.Floor((box.MinLatitude + 90) / height)
+	maxRow := math.Min(math.Floor((box.MaxLatitude+90)/height), 180/height-1)
+	minColumn := math.Floor((box.MinLongitude + 180) / width)
+	maxColumn := math.Min(math.Floor((box.MaxLongitude+180)/width), 360/width-1)
+	if (maxRow-minRow+1)*(maxColumn-minColumn+1) > float64(limit) {
+		return nil, ErrTooManyCells
+	}
+
+	cells := []string{}
+	for row := minRow; row <= maxRow; row++ {
+		for column := minColumn; column <= maxColumn; column++ {
+			// the center of the cell, far from the edges rounding could move
+			lat := (row+0.5)*height - 90
+			lon := (column+0.5)*width - 180
+			cells = append(cells, Encode(lat, lon, precision))
+		}
+	}
+	sort.Strings(cells)
+	return cells, nil
+}
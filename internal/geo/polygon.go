@@ -0,0 +1,68 @@
+package geo
+
+import "math"
+
+// Point is a vertex of a polygon, in decimal degrees
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Polygon is a closed ring of points, the last one being joined to the first
+// one. Rings small enough to be treated as flat, like city sectors, are
+// assumed
+type Polygon []Point
+
+// Contains tells whether the point lies inside the polygon, by counting how
+// many of its edges a ray cast from the point crosses. Edges are half open,
+// so a point on the edge two adjacent polygons share lies in exactly one of
+// them: the one to its east, or to its north for east to west edges
+func (p Polygon) Contains(lat float64, lon float64) bool {
+	inside := false
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		a, b := p[i], p[j]
+		if (a.Latitude > lat) != (b.Latitude > lat) &&
+			lon < (b.Longitude-a.Longitude)*(lat-a.Latitude)/(b.Latitude-a.Latitude)+a.Longitude {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Area is the area enclosed by the polygon in square degrees, only meant to
+// compare polygons of the same city
+func (p Polygon) Area() float64 {
+	area := 0.0
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		area += p[j].Longitude*p[i].Latitude - p[i].Longitude*p[j].Latitude
+	}
+	return math.Abs(area) / 2
+}
+
+// Bounds is the smallest box holding the polygon
+func (p Polygon) Bounds() Box {
+	if len(p) == 0 {
+		return Box{}
+	}
+	box := Box{
+		MinLatitude:  p[0].Latitude,
+		MinLongitude: p[0].Longitude,
+		MaxLatitude:  p[0].Latitude,
+		MaxLongitude: p[0].Longitude,
+	}
+	for _, point := range p[1:] {
+		if point.Latitude < box.MinLatitude {
+			box.MinLatitude = point.Latitude
+		}
+		if point.Latitude > box.MaxLatitude {
+			box.MaxLatitude = point.Latitude
+		}
+		if point.Longitude < box.MinLongitude {
+			box.MinLongitude = point.Longitude
+		}
+		if point.Longitude > box.MaxLongitude {
+			box.MaxLongitude = point.Longitude
+		}
+	}
+	return box
+}
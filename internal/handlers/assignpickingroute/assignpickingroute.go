@@ -0,0 +1,65 @@
+package assignpickingroute
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrWrongUserType = internal.NewError(http.StatusForbidden, "wrong_user_type", "user must of type gatherer")
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type RoutesRepository interface {
+	Assign(ctx context.Context, userID string, routeID string) error
+	Find(ctx context.Context, routeID string) (models.Route, error)
+}
+
+type Request struct {
+	UserID  string `json:"user_id"`
+	RouteID string `json:"route_id"`
+}
+
+func (r *Request) AuthUserID() string {
+	return r.UserID
+}
+
+func Adapter(
+	usersRepo UsersRepository,
+	routesRepo RoutesRepository,
+	idempotencyRepo internal.IdempotencyRepository,
+) internal.Handler {
+	return internal.Standard(
+		internal.Idempotent(idempotencyRepo),
+		internal.ValidateBody(RequestSchema),
+		internal.DecodeJSON(func() interface{} { return &Request{} }),
+		internal.Authenticate(usersRepo, internal.UserIDFromBody),
+		internal.RequireUserType(models.UserTypeGatherer, ErrWrongUserType),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		reqBody := internal.Body(ctx).(*Request)
+		user := internal.UserFrom(ctx)
+
+		route, err := routesRepo.Find(ctx, reqBody.RouteID)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		log.Printf("route.GathererID: (%v), user.ID: (%v)\n", route.GathererID, user.ID)
+		if route.GathererID == user.ID {
+			return internal.Respond(http.StatusOK, ""), nil
+		}
+
+		err = routesRepo.Assign(ctx, user.ID, reqBody.RouteID)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, ""), nil
+	})
+}
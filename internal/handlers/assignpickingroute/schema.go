@@ -0,0 +1,11 @@
+package assignpickingroute
+
+const RequestSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/assign_picking_route/request.json",
+	"type": "object",
+	"required": ["user_id", "route_id"],
+	"properties": {
+		"user_id": {"$ref": "../definitions.json#/definitions/id"},
+		"route_id": {"$ref": "../definitions.json#/definitions/id"}
+	}
+}`
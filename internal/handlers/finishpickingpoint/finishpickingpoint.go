@@ -0,0 +1,334 @@
+package finishpickingpoint
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrPickingPointNotFoundInRoute = internal.NewError(http.StatusUnprocessableEntity, "picking_point_not_in_route", "given picking point does not exist in route")
+var ErrWrongUserType = internal.NewError(http.StatusForbidden, "wrong_user_type", "user must be of type gatherer")
+var ErrWrongGathererID = internal.NewError(http.StatusForbidden, "wrong_gatherer_id", "the route is not assigned to the given gatherer id")
+var ErrQuantityMaterialNotAllowed = internal.NewError(http.StatusUnprocessableEntity, "quantity_material_not_allowed", "one or more quantities have a material not pinned on the picking point")
+var ErrPositionEmpty = internal.NewError(http.StatusBadRequest, "position_empty", "position cannot be empty")
+var ErrOutsideGeofence = internal.NewError(http.StatusUnprocessableEntity, "outside_geofence", "the gatherer is too far from the picking point")
+var ErrPickupCodeMismatch = internal.NewError(http.StatusUnprocessableEntity, "pickup_code_mismatch", "pickup_code does not match the picking point")
+
+const (
+	GeofenceModeReject = "reject" // finishes outside the radius are refused
+	GeofenceModeFlag   = "flag"   // finishes outside the radius are stored as flagged
+)
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type RoutesRepository interface {
+	Find(ctx context.Context, routeID string) (models.Route, error)
+	FinishPickingPoint(ctx context.Context, routeID string, pickingPointIndex int, pickingPoint models.PickingPoint, score int, remaining int) error
+	FailPickingPoint(ctx context.Context, routeID string, pickingPointIndex int, pickingPoint models.PickingPoint, remaining int) error
+}
+
+type TimeHelper interface {
+	ToLatamFormat(d time.Time) (string, error)
+	ToISO8601In(d time.Time, zone string) (string, error)
+}
+
+type Request struct {
+	UserID         string            `json:"user_id"`
+	RouteID        string            `json:"route_id"`
+	PickingPointId string            `json:"picking_point_id"`
+	FailureReason  string            `json:"failure_reason"`
+	FailureNote    string            `json:"failure_note"`
+	Quantities     []RequestQuantity `json:"quantities"`
+	Position       *RequestPosition  `json:"position"`
+	PickupCode     string            `json:"pickup_code"`
+}
+
+type RequestPosition struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Accuracy  float64 `json:"accuracy"`
+}
+
+type RequestQuantity struct {
+	Material string  `json:"material"`
+	Amount   float64 `json:"amount"`
+	Unit     string  `json:"unit"`
+}
+
+type ResponseQuantity struct {
+	Material string  `json:"material"`
+	Amount   float64 `json:"amount"`
+	Unit     string  `json:"unit"`
+}
+
+type ResponsePickingPoint struct {
+	ID         string   `json:"id"`
+	LocationID string   `json:"location_id"`
+	Country    string   `json:"country"`
+	City       string   `json:"city"`
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	Address1   string   `json:"address_1"`
+	Address2   string   `json:"address_2"`
+	Materials  []string `json:"materials"`
+	ETA        string   `json:"eta,omitempty"`
+}
+
+type ResponseAssignedRoute struct {
+	ID            string                 `json:"id"`
+	Materials     []string               `json:"materials"`
+	Sector        string                 `json:"sector"`
+	Status        string                 `json:"status"`
+	Shift         string                 `json:"shift"`
+	Date          string                 `json:"date"`
+	PickingPoints []ResponsePickingPoint `json:"picking_points"`
+	Collected     []ResponseQuantity     `json:"collected"`
+}
+
+func (r *Request) AuthUserID() string {
+	return r.UserID
+}
+
+// Outcome is the route once one of its picking points was finished, Status
+// being the one the route is left in
+type Outcome struct {
+	Route        models.Route
+	PickingPoint models.PickingPoint
+	AlreadyDone  bool
+	Status       string
+}
+
+// Finish finishes, or fails when the request has a failure_reason, a picking
+// point of a route assigned to user, as it happened at now. Finishing a
+// picking point already done changes nothing and reports it as AlreadyDone
+func Finish(
+	ctx context.Context,
+	routesRepo RoutesRepository,
+	user models.User,
+	req Request,
+	now time.Time,
+	geofenceRadius float64,
+	geofenceMode string,
+) (Outcome, error) {
+	if req.Position == nil && geofenceMode == GeofenceModeReject {
+		return Outcome{}, ErrPositionEmpty
+	}
+
+	route, err := routesRepo.Find(ctx, req.RouteID)
+	if err != nil {
+		return Outcome{}, err
+	}
+
+	if user.ID != route.GathererID {
+		return Outcome{}, ErrWrongGathererID
+	}
+
+	exists := false
+	alreadyDone := false
+	pickingPointIndex := -1
+	remaining := len(route.PickingPoints)
+	log.Printf("looping through (%v) picking points\n", len(route.PickingPoints))
+	for i, pp := range route.PickingPoints {
+		if pp.IsDone() {
+			remaining--
+		}
+
+		if pp.ID == req.PickingPointId {
+			log.Printf("found match! current index is (%v)\n", i)
+			exists = true
+			pickingPointIndex = i
+			alreadyDone = pp.IsDone()
+		}
+	}
+	if !exists {
+		return Outcome{}, ErrPickingPointNotFoundInRoute
+	}
+
+	quantities := make([]models.MaterialQuantity, len(req.Quantities))
+	for i, q := range req.Quantities {
+		material := strings.TrimSpace(q.Material)
+		if !isMaterialPinned(material, route.PickingPoints[pickingPointIndex].Materials) {
+			return Outcome{}, ErrQuantityMaterialNotAllowed
+		}
+		quantities[i] = models.MaterialQuantity{
+			Material: material,
+			Amount:   q.Amount,
+			Unit:     q.Unit,
+		}
+	}
+
+	// Proof of presence, the fix is kept even when it is inside the geofence
+	pickingPoint := route.PickingPoints[pickingPointIndex]
+	if req.Position != nil {
+		distance := internal.HaversineDistance(
+			req.Position.Latitude,
+			req.Position.Longitude,
+			pickingPoint.Latitude,
+			pickingPoint.Longitude,
+		)
+		log.Printf("gatherer is (%v) meters away from the picking point\n", distance)
+		pickingPoint.FinishFix = &models.GeoFix{
+			Latitude:  req.Position.Latitude,
+			Longitude: req.Position.Longitude,
+			Accuracy:  req.Position.Accuracy,
+			Distance:  distance,
+			Flagged:   distance > geofenceRadius,
+		}
+	}
+	outsideGeofence := pickingPoint.FinishFix == nil || pickingPoint.FinishFix.Flagged
+	if !alreadyDone && outsideGeofence && geofenceMode == GeofenceModeReject {
+		details := map[string]interface{}{"radius": geofenceRadius}
+		if pickingPoint.FinishFix != nil {
+			details["distance"] = pickingPoint.FinishFix.Distance
+		}
+		return Outcome{}, ErrOutsideGeofence.WithDetails(details)
+	}
+
+	if !alreadyDone {
+		if req.FailureReason != "" {
+			pickingPoint.FailedAt = &now
+			pickingPoint.FailureReason = req.FailureReason
+			pickingPoint.FailureNote = req.FailureNote
+			err = routesRepo.FailPickingPoint(ctx, route.ID, pickingPointIndex, pickingPoint, remaining)
+		} else {
+			// The location is credited only when the household handed over
+			// its pickup code, points pinned before codes existed keep the
+			// previous behavior
+			score := internal.PickupScore(quantities)
+			if pickingPoint.PickupCode != "" {
+				if req.PickupCode == "" {
+					score = 0
+				} else if subtle.ConstantTimeCompare([]byte(req.PickupCode), []byte(pickingPoint.PickupCode)) != 1 {
+					return Outcome{}, ErrPickupCodeMismatch
+				} else {
+					pickingPoint.CodeUsedAt = &now
+				}
+			}
+
+			pickingPoint.PickedAt = &now
+			pickingPoint.Quantities = quantities
+			err = routesRepo.FinishPickingPoint(ctx, route.ID, pickingPointIndex, pickingPoint, score, remaining)
+		}
+		route.PickingPoints[pickingPointIndex] = pickingPoint
+		if err != nil {
+			return Outcome{}, err
+		}
+	}
+
+	status := route.Status
+	if !alreadyDone && remaining == 1 {
+		status = models.RouteStatusFinished
+	}
+	return Outcome{
+		Route:        route,
+		PickingPoint: route.PickingPoints[pickingPointIndex],
+		AlreadyDone:  alreadyDone,
+		Status:       status,
+	}, nil
+}
+
+func Adapter(
+	usersRepo UsersRepository,
+	routesRepo RoutesRepository,
+	timeHelper TimeHelper,
+	geofenceRadius float64,
+	geofenceMode string,
+	etaCalculator internal.ETACalculator,
+	idempotencyRepo internal.IdempotencyRepository,
+) internal.Handler {
+	return internal.Standard(
+		internal.Idempotent(idempotencyRepo),
+		internal.ValidateBody(RequestSchema),
+		internal.DecodeJSON(func() interface{} { return &Request{} }),
+		internal.Authenticate(usersRepo, internal.UserIDFromBody),
+		internal.RequireUserType(models.UserTypeGatherer, ErrWrongUserType),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		reqBody := internal.Body(ctx).(*Request)
+		user := internal.UserFrom(ctx)
+
+		outcome, err := Finish(ctx, routesRepo, user, *reqBody, time.Now(), geofenceRadius, geofenceMode)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+		route := outcome.Route
+
+		// The gatherer is leaving the picking point just finished
+		etas := etaCalculator.Estimate(&internal.Origin{
+			Latitude:  outcome.PickingPoint.Latitude,
+			Longitude: outcome.PickingPoint.Longitude,
+		}, route.PickingPoints, time.Now())
+
+		responseRoutePickingPoints := []ResponsePickingPoint{}
+		for _, pp := range route.PickingPoints {
+			if !pp.IsDone() {
+				eta, err := timeHelper.ToISO8601In(etas[pp.ID], route.Zone())
+				if err != nil {
+					return internal.Fail(err), nil
+				}
+				responseRoutePickingPoints = append(responseRoutePickingPoints, ResponsePickingPoint{
+					ID:         pp.ID,
+					LocationID: pp.LocationID,
+					Country:    pp.Country,
+					City:       pp.City,
+					Latitude:   pp.Latitude,
+					Longitude:  pp.Longitude,
+					Address1:   pp.Address1,
+					Address2:   pp.Address2,
+					Materials:  pp.Materials,
+					ETA:        eta,
+				})
+			}
+		}
+		startsAt, err := timeHelper.ToISO8601In(*route.StartsAt, route.Zone())
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		collected := route.CollectedQuantities()
+		responseCollected := make([]ResponseQuantity, len(collected))
+		for i, q := range collected {
+			responseCollected[i] = ResponseQuantity{
+				Material: q.Material,
+				Amount:   q.Amount,
+				Unit:     q.Unit,
+			}
+		}
+
+		responseAssignedRoute := ResponseAssignedRoute{
+			ID:            route.ID,
+			Materials:     route.Materials,
+			Sector:        route.Sector,
+			Status:        outcome.Status,
+			Shift:         route.Shift,
+			Date:          startsAt,
+			PickingPoints: responseRoutePickingPoints,
+			Collected:     responseCollected,
+		}
+
+		jsonResponse, err := json.Marshal(responseAssignedRoute)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+	})
+}
+
+func isMaterialPinned(material string, pinnedMaterials []string) bool {
+	for _, pinned := range pinnedMaterials {
+		if material == pinned {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package finishpickingpoint_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/finishpickingpoint"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const geofenceRadius = 100
+
+// at the picking points, and about 1.1 km north of them
+var (
+	near = body{"latitude": 4.6415, "longitude": -74.0652, "accuracy": 10}
+	far  = body{"latitude": 4.6515, "longitude": -74.0652, "accuracy": 10}
+)
+
+// body is a request body as clients send it, leaving out what they omit
+type body map[string]interface{}
+
+type backend struct {
+	handler       internal.Handler
+	routesRepo    *repositories.InMemoryRoutesRepository
+	locationsRepo *repositories.InMemoryLocationsRepository
+}
+
+// newBackend serves the initiated route r1 of gatherer g1, with the pending
+// picking points pp1 and pp2 of location l1 and their pickup codes
+func newBackend(t *testing.T, geofenceMode string) backend {
+	t.Helper()
+	ctx := context.Background()
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usersRepo := repositories.NewInMemoryUsersRepository()
+	locationsRepo := repositories.NewInMemoryLocationsRepository()
+	routesRepo := repositories.NewInMemoryRoutesRepository(locationsRepo, timeHelper, internal.NewUUIDHelper())
+
+	must(t, usersRepo.Save(ctx, models.User{ID: "g1", Username: "g1", Type: models.UserTypeGatherer, Country: "CO"}))
+	must(t, usersRepo.Save(ctx, models.User{ID: "u1", Username: "u1", Type: models.UserTypeUser, Country: "CO"}))
+	must(t, locationsRepo.Save(ctx, models.Location{ID: "l1", Country: "CO", City: "Bogota", Latitude: 4.6415, Longitude: -74.0652}))
+	startsAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	pickingPoint := func(id string, code string) models.PickingPoint {
+		return models.PickingPoint{
+			ID: id, LocationID: "l1", Country: "CO", City: "Bogota",
+			Latitude: 4.6415, Longitude: -74.0652,
+			Materials: []string{models.MaterialPlastic}, PickupCode: code,
+		}
+	}
+	must(t, routesRepo.Save(ctx, models.Route{
+		ID: "r1", Sector: "Chapinero", Shift: "AM", Materials: []string{models.MaterialPlastic},
+		Status: models.RouteStatusInitiated, GathererID: "g1", StartsAt: &startsAt, InitiatedAt: &startsAt,
+		PickingPoints: []models.PickingPoint{pickingPoint("pp1", "1111"), pickingPoint("pp2", "2222")},
+	}))
+
+	return backend{
+		handler: finishpickingpoint.Adapter(
+			usersRepo,
+			routesRepo,
+			timeHelper,
+			geofenceRadius,
+			geofenceMode,
+			internal.DefaultETACalculator,
+			repositories.NewInMemoryIdempotencyRepository(timeHelper),
+		),
+		routesRepo:    routesRepo,
+		locationsRepo: locationsRepo,
+	}
+}
+
+func TestRejectsFinishesOutsideTheGeofence(t *testing.T) {
+	b := newBackend(t, finishpickingpoint.GeofenceModeReject)
+
+	res := b.finish(t, body{"picking_point_id": "pp1", "pickup_code": "1111", "position": far})
+	assertError(t, res, http.StatusUnprocessableEntity, "outside_geofence")
+	if pp := b.pickingPoint(t, 0); pp.IsDone() {
+		t.Fatalf("expected the picking point to stay pending, got %+v", pp)
+	}
+
+	res = b.finish(t, body{"picking_point_id": "pp1", "pickup_code": "1111"})
+	assertError(t, res, http.StatusBadRequest, "position_empty")
+}
+
+func TestFlagsFinishesOutsideTheGeofence(t *testing.T) {
+	b := newBackend(t, finishpickingpoint.GeofenceModeFlag)
+
+	res := b.finish(t, body{"picking_point_id": "pp1", "pickup_code": "1111", "position": far})
+	assertStatus(t, res, http.StatusOK)
+	pp := b.pickingPoint(t, 0)
+	if pp.PickedAt == nil || pp.FinishFix == nil || !pp.FinishFix.Flagged || pp.FinishFix.Distance < 1000 {
+		t.Fatalf("expected a picked point with a flagged fix, got %+v", pp)
+	}
+
+	res = b.finish(t, body{"picking_point_id": "pp2", "pickup_code": "2222", "position": near})
+	assertStatus(t, res, http.StatusOK)
+	if pp := b.pickingPoint(t, 1); pp.FinishFix == nil || pp.FinishFix.Flagged {
+		t.Fatalf("expected an unflagged fix within the radius, got %+v", pp.FinishFix)
+	}
+}
+
+func TestRejectsMismatchedPickupCodes(t *testing.T) {
+	b := newBackend(t, finishpickingpoint.GeofenceModeReject)
+
+	res := b.finish(t, body{"picking_point_id": "pp1", "pickup_code": "2222", "position": near})
+	assertError(t, res, http.StatusUnprocessableEntity, "pickup_code_mismatch")
+	if pp := b.pickingPoint(t, 0); pp.IsDone() || pp.CodeUsedAt != nil {
+		t.Fatalf("expected the picking point to stay pending, got %+v", pp)
+	}
+	b.assertBalance(t, 0)
+}
+
+func TestCreditsThePickupScoreWithTheCode(t *testing.T) {
+	b := newBackend(t, finishpickingpoint.GeofenceModeReject)
+	quantities := []body{{"material": models.MaterialPlastic, "amount": 3.5, "unit": models.UnitKilograms}}
+
+	res := b.finish(t, body{"picking_point_id": "pp1", "pickup_code": "1111", "position": near, "quantities": quantities})
+	assertStatus(t, res, http.StatusOK)
+	if pp := b.pickingPoint(t, 0); pp.PickedAt == nil || pp.CodeUsedAt == nil {
+		t.Fatalf("expected a picked point with its code used, got %+v", pp)
+	}
+	b.assertBalance(t, float64(internal.PickupScore([]models.MaterialQuantity{
+		{Material: models.MaterialPlastic, Amount: 3.5, Unit: models.UnitKilograms},
+	})))
+}
+
+func TestEmptyPickupCodesScoreNothing(t *testing.T) {
+	b := newBackend(t, finishpickingpoint.GeofenceModeReject)
+	quantities := []body{{"material": models.MaterialPlastic, "amount": 3.5, "unit": models.UnitKilograms}}
+
+	res := b.finish(t, body{"picking_point_id": "pp1", "position": near, "quantities": quantities})
+	assertStatus(t, res, http.StatusOK)
+	pp := b.pickingPoint(t, 0)
+	if pp.PickedAt == nil || pp.CodeUsedAt != nil || len(pp.Quantities) != 1 {
+		t.Fatalf("expected a picked point with its quantities and the code unused, got %+v", pp)
+	}
+	b.assertBalance(t, 0)
+}
+
+func TestFailingDoesNotCreditAndFinishesTheRoute(t *testing.T) {
+	b := newBackend(t, finishpickingpoint.GeofenceModeReject)
+
+	res := b.finish(t, body{"picking_point_id": "pp1", "pickup_code": "1111", "position": near})
+	response := decode(t, res)
+	if response.Status != models.RouteStatusInitiated || len(response.PickingPoints) != 1 || response.PickingPoints[0].ID != "pp2" {
+		t.Fatalf("expected pp2 pending on the initiated route, got %+v", response)
+	}
+	// pp2 is where pp1 is, the gatherer gets there right away
+	eta, err := time.Parse("2006-01-02T15:04:05-0700", response.PickingPoints[0].ETA)
+	if err != nil || time.Until(eta) > time.Minute {
+		t.Fatalf("expected pp2 due now, got ETA %q", response.PickingPoints[0].ETA)
+	}
+
+	res = b.finish(t, body{
+		"picking_point_id": "pp2",
+		"failure_reason":   models.FailureReasonNobodyHome,
+		"failure_note":     "rang twice",
+		"position":         near,
+	})
+	response = decode(t, res)
+	if response.Status != models.RouteStatusFinished || len(response.PickingPoints) != 0 {
+		t.Fatalf("expected the route finished, got %+v", response)
+	}
+	pp := b.pickingPoint(t, 1)
+	if pp.FailedAt == nil || pp.PickedAt != nil || pp.FailureReason != models.FailureReasonNobodyHome || pp.FailureNote != "rang twice" {
+		t.Fatalf("expected a failed point with its reason, got %+v", pp)
+	}
+	if pp.CodeUsedAt != nil {
+		t.Fatalf("expected a failed point to leave its code unused")
+	}
+	b.assertBalance(t, float64(internal.PickupBaseScore))
+}
+
+func TestFailingRejectsQuantities(t *testing.T) {
+	b := newBackend(t, finishpickingpoint.GeofenceModeReject)
+
+	res := b.finish(t, body{
+		"picking_point_id": "pp1",
+		"failure_reason":   models.FailureReasonContaminated,
+		"position":         near,
+		"quantities":       []body{{"material": models.MaterialPlastic, "amount": 1, "unit": models.UnitKilograms}},
+	})
+	assertError(t, res, http.StatusBadRequest, "invalid_field")
+}
+
+func TestRefusesUsersOtherThanTheRouteGatherer(t *testing.T) {
+	b := newBackend(t, finishpickingpoint.GeofenceModeReject)
+
+	res := b.serve(t, body{"user_id": "u1", "route_id": "r1", "picking_point_id": "pp1", "position": near})
+	assertError(t, res, http.StatusForbidden, "wrong_user_type")
+}
+
+// finish sends req on behalf of g1 on r1
+func (b backend) finish(t *testing.T, req body) events.APIGatewayProxyResponse {
+	t.Helper()
+	req["user_id"], req["route_id"] = "g1", "r1"
+	return b.serve(t, req)
+}
+
+func (b backend) serve(t *testing.T, req body) events.APIGatewayProxyResponse {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := b.handler(context.Background(), events.APIGatewayProxyRequest{
+		Headers: map[string]string{"Accept-Language": "en-US"},
+		Body:    string(body),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func (b backend) pickingPoint(t *testing.T, index int) models.PickingPoint {
+	t.Helper()
+	route, err := b.routesRepo.Find(context.Background(), "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return route.PickingPoints[index]
+}
+
+func (b backend) assertBalance(t *testing.T, balance float64) {
+	t.Helper()
+	location, err := b.locationsRepo.Find(context.Background(), "l1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Balance != balance {
+		t.Fatalf("expected balance %v, got %v", balance, location.Balance)
+	}
+}
+
+func decode(t *testing.T, res events.APIGatewayProxyResponse) finishpickingpoint.ResponseAssignedRoute {
+	t.Helper()
+	assertStatus(t, res, http.StatusOK)
+	var response finishpickingpoint.ResponseAssignedRoute
+	if err := json.Unmarshal([]byte(res.Body), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func assertStatus(t *testing.T, res events.APIGatewayProxyResponse, status int) {
+	t.Helper()
+	if res.StatusCode != status {
+		t.Fatalf("expected status %v, got %v: %s", status, res.StatusCode, res.Body)
+	}
+}
+
+func assertError(t *testing.T, res events.APIGatewayProxyResponse, status int, code string) {
+	t.Helper()
+	if res.StatusCode != status || !strings.Contains(res.Body, `"code":"`+code+`"`) {
+		t.Fatalf("expected %v %s, got %v: %s", status, code, res.StatusCode, res.Body)
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,43 @@
+package finishpickingpoint
+
+// RequestSchema also covers the rules between fields: a failure_note needs a
+// failure_reason, and failed picking points carry no quantities
+const RequestSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/finish_picking_point/request.json",
+	"type": "object",
+	"required": ["user_id", "route_id", "picking_point_id"],
+	"properties": {
+		"user_id": {"$ref": "../definitions.json#/definitions/id"},
+		"route_id": {"$ref": "../definitions.json#/definitions/id"},
+		"picking_point_id": {"$ref": "../definitions.json#/definitions/id"},
+		"failure_reason": {"$ref": "../definitions.json#/definitions/failure_reason"},
+		"failure_note": {"type": "string"},
+		"pickup_code": {"type": "string"},
+		"quantities": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["material", "amount", "unit"],
+				"properties": {
+					"material": {"$ref": "../definitions.json#/definitions/material"},
+					"amount": {"$ref": "../definitions.json#/definitions/amount"},
+					"unit": {"$ref": "../definitions.json#/definitions/unit"}
+				}
+			}
+		},
+		"position": {
+			"type": "object",
+			"required": ["latitude", "longitude"],
+			"properties": {
+				"latitude": {"type": "number", "minimum": -90, "maximum": 90},
+				"longitude": {"type": "number", "minimum": -180, "maximum": 180},
+				"accuracy": {"type": "number", "minimum": 0}
+			}
+		}
+	},
+	"dependencies": {
+		"failure_note": ["failure_reason"]
+	},
+	"if": {"required": ["failure_reason"]},
+	"then": {"properties": {"quantities": {"maxItems": 0}}}
+}`
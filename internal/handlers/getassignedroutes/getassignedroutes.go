@@ -0,0 +1,121 @@
+package getassignedroutes
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrWrongUserType = internal.NewError(http.StatusForbidden, "wrong_user_type", "user must be of type gatherer")
+
+type RoutesRepoRepository interface {
+	FindAssignedRoutesPage(ctx context.Context, userID string, page repositories.PageQuery) (repositories.RoutesPage, error)
+}
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type TimeHelper interface {
+	ToLatamFormat(d time.Time) (string, error)
+	ToISO8601In(d time.Time, zone string) (string, error)
+}
+
+type ResponseRoutePickingPoint struct {
+	ID         string   `json:"id"`
+	LocationID string   `json:"location_id"`
+	Country    string   `json:"country"`
+	City       string   `json:"city"`
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	Address1   string   `json:"address_1"`
+	Address2   string   `json:"address_2"`
+	Materials  []string `json:"materials"`
+}
+
+type ResponseRoute struct {
+	ID            string                      `json:"id"`
+	Materials     []string                    `json:"materials"`
+	Sector        string                      `json:"sector"`
+	Shift         string                      `json:"shift"`
+	Date          string                      `json:"date"`
+	Status        string                      `json:"status"`
+	PickingPoints []ResponseRoutePickingPoint `json:"picking_points"`
+}
+
+type Response struct {
+	AssignedRoutes []ResponseRoute `json:"assigned_routes"`
+	NextCursor     string          `json:"next_cursor,omitempty"`
+}
+
+func Adapter(
+	routesRepo RoutesRepoRepository,
+	usersRepo UsersRepository,
+	timeHelper TimeHelper,
+) internal.Handler {
+	return internal.Standard(
+		internal.ValidatePath(PathSchema),
+		internal.Authenticate(usersRepo, internal.UserIDFromPath("user_id")),
+		internal.RequireUserType(models.UserTypeGatherer, ErrWrongUserType),
+		internal.Paginate(),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		user := internal.UserFrom(ctx)
+
+		log.Printf("looking for routes assigned to gatherer_id(%v)\n", user.ID)
+		page, err := routesRepo.FindAssignedRoutesPage(ctx, user.ID, internal.PageFrom(ctx))
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+		routes := page.Routes
+		log.Printf("found (%v) routes assigned\n", len(routes))
+
+		assignedresponseRoutes := make([]ResponseRoute, len(routes))
+		for i, route := range routes {
+			responseRoutesPickingPoints := make([]ResponseRoutePickingPoint, len(route.PickingPoints))
+			for j, pp := range route.PickingPoints {
+				responseRoutesPickingPoints[j] = ResponseRoutePickingPoint{
+					ID:         pp.ID,
+					LocationID: pp.LocationID,
+					Country:    pp.Country,
+					City:       pp.City,
+					Latitude:   pp.Latitude,
+					Longitude:  pp.Longitude,
+					Address1:   pp.Address1,
+					Address2:   pp.Address2,
+					Materials:  pp.Materials,
+				}
+			}
+
+			startsAt, err := timeHelper.ToISO8601In(*route.StartsAt, route.Zone())
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+			assignedresponseRoutes[i] = ResponseRoute{
+				ID:            route.ID,
+				Materials:     route.Materials,
+				Sector:        route.Sector,
+				Shift:         route.Shift,
+				Date:          startsAt,
+				PickingPoints: responseRoutesPickingPoints,
+				Status:        route.Status,
+			}
+		}
+		response := Response{
+			AssignedRoutes: assignedresponseRoutes,
+			NextCursor:     page.Cursor,
+		}
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+	})
+}
@@ -0,0 +1,10 @@
+package getassignedroutes
+
+const PathSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/get_assigned_routes/path.json",
+	"type": "object",
+	"required": ["user_id"],
+	"properties": {
+		"user_id": {"$ref": "../definitions.json#/definitions/id"}
+	}
+}`
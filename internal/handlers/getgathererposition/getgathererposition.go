@@ -0,0 +1,144 @@
+package getgathererposition
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrPickingPointNotFoundInRoute = internal.NewError(http.StatusNotFound, "picking_point_not_in_route", "given picking point does not exist in route")
+var ErrWrongLocationOwner = internal.NewError(http.StatusForbidden, "wrong_location_owner", "the picking point belongs to a location of another user")
+var ErrTrackingNotAllowed = internal.NewError(http.StatusForbidden, "tracking_not_allowed", "the gatherer position is only shared while the route is on its way to the picking point")
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type RoutesRepository interface {
+	Find(ctx context.Context, routeID string) (models.Route, error)
+}
+
+type LocationsRepository interface {
+	FindByUserID(ctx context.Context, id string) ([]models.Location, error)
+}
+
+type TrackingRepository interface {
+	Latest(ctx context.Context, routeID string) (models.GathererPosition, error)
+}
+
+type TimeHelper interface {
+	ToISO8601In(d time.Time, zone string) (string, error)
+}
+
+type Response struct {
+	RouteID    string  `json:"route_id"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Accuracy   float64 `json:"accuracy"`
+	Distance   float64 `json:"distance"` // meters to the picking point
+	RecordedAt string  `json:"recorded_at"`
+	ETA        string  `json:"eta"`
+}
+
+// Adapter shows a household where the gatherer coming to their picking point
+// is and when it should get there, only while the route is initiated and the
+// point not picked yet
+func Adapter(
+	usersRepo UsersRepository,
+	routesRepo RoutesRepository,
+	locationsRepo LocationsRepository,
+	trackingRepo TrackingRepository,
+	timeHelper TimeHelper,
+	etaCalculator internal.ETACalculator,
+) internal.Handler {
+	return internal.Standard(
+		internal.ValidatePath(PathSchema),
+		internal.Authenticate(usersRepo, internal.UserIDFromPath("user_id")),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		user := internal.UserFrom(ctx)
+
+		routeID := req.PathParameters["route_id"]
+		pickingPointID := req.PathParameters["picking_point_id"]
+
+		route, err := routesRepo.Find(ctx, routeID)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		var pickingPoint *models.PickingPoint
+		for i, pp := range route.PickingPoints {
+			if pp.ID == pickingPointID {
+				pickingPoint = &route.PickingPoints[i]
+				break
+			}
+		}
+		if pickingPoint == nil {
+			return internal.Fail(ErrPickingPointNotFoundInRoute), nil
+		}
+
+		// Only the household owning the pinned location gets to follow the
+		// gatherer
+		locations, err := locationsRepo.FindByUserID(ctx, user.ID)
+		if err != nil && err != repositories.ErrNoLocationsFound {
+			return internal.Fail(err), nil
+		}
+		isOwner := false
+		for _, location := range locations {
+			if location.ID == pickingPoint.LocationID {
+				isOwner = true
+				break
+			}
+		}
+		if !isOwner {
+			return internal.Fail(ErrWrongLocationOwner), nil
+		}
+
+		if route.Status != models.RouteStatusInitiated || pickingPoint.IsDone() {
+			return internal.Fail(ErrTrackingNotAllowed), nil
+		}
+
+		position, err := trackingRepo.Latest(ctx, route.ID)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+		recordedAt, err := timeHelper.ToISO8601In(position.RecordedAt, route.Zone())
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+		etas := etaCalculator.Estimate(&internal.Origin{
+			Latitude:  position.Latitude,
+			Longitude: position.Longitude,
+		}, route.PickingPoints, time.Now())
+		eta, err := timeHelper.ToISO8601In(etas[pickingPoint.ID], route.Zone())
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		response := Response{
+			RouteID:   route.ID,
+			Latitude:  position.Latitude,
+			Longitude: position.Longitude,
+			Accuracy:  position.Accuracy,
+			Distance: internal.HaversineDistance(
+				position.Latitude,
+				position.Longitude,
+				pickingPoint.Latitude,
+				pickingPoint.Longitude,
+			),
+			RecordedAt: recordedAt,
+			ETA:        eta,
+		}
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+	})
+}
@@ -0,0 +1,135 @@
+package getgathererposition_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getgathererposition"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// newHandler serves two initiated routes with the gatherer tracked on both,
+// r1 coming to pp1 of u1 and r2 to pp2 of u2, and r3 with pp3 of u1 not
+// started yet. pp4 of u1 on r1 was already picked
+func newHandler(t *testing.T) internal.Handler {
+	t.Helper()
+	ctx := context.Background()
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usersRepo := repositories.NewInMemoryUsersRepository()
+	locationsRepo := repositories.NewInMemoryLocationsRepository()
+	routesRepo := repositories.NewInMemoryRoutesRepository(locationsRepo, timeHelper, internal.NewUUIDHelper())
+	trackingRepo := repositories.NewInMemoryTrackingRepository(timeHelper)
+
+	for _, id := range []string{"u1", "u2"} {
+		must(t, usersRepo.Save(ctx, models.User{ID: id, Username: id, Type: models.UserTypeUser, Country: "CO"}))
+	}
+	for _, link := range []struct{ userID, locationID string }{{"u1", "l1"}, {"u2", "l2"}} {
+		must(t, locationsRepo.Save(ctx, models.Location{ID: link.locationID, Country: "CO", City: "Bogota", Latitude: 4.6415, Longitude: -74.0652}))
+		must(t, locationsRepo.Link(ctx, link.userID, link.locationID))
+	}
+
+	now := time.Now().Truncate(time.Second)
+	pickingPoint := func(id string, locationID string) models.PickingPoint {
+		return models.PickingPoint{
+			ID: id, LocationID: locationID, Country: "CO", City: "Bogota",
+			Latitude: 4.6415, Longitude: -74.0652, Materials: []string{models.MaterialPlastic},
+		}
+	}
+	picked := pickingPoint("pp4", "l1")
+	picked.PickedAt = &now
+	for _, route := range []models.Route{
+		{ID: "r1", Status: models.RouteStatusInitiated, GathererID: "g1", PickingPoints: []models.PickingPoint{picked, pickingPoint("pp1", "l1")}},
+		{ID: "r2", Status: models.RouteStatusInitiated, GathererID: "g2", PickingPoints: []models.PickingPoint{pickingPoint("pp2", "l2")}},
+		{ID: "r3", Status: models.RouteStatusAssigned, GathererID: "g1", PickingPoints: []models.PickingPoint{pickingPoint("pp3", "l1")}},
+	} {
+		route.Sector, route.Shift, route.StartsAt = "Chapinero", "AM", &now
+		if route.Status == models.RouteStatusInitiated {
+			route.InitiatedAt = &now
+		}
+		must(t, routesRepo.Save(ctx, route))
+	}
+	must(t, trackingRepo.Track(ctx, models.GathererPosition{RouteID: "r1", GathererID: "g1", Latitude: 4.6515, Longitude: -74.0652, RecordedAt: now}, time.Hour))
+	must(t, trackingRepo.Track(ctx, models.GathererPosition{RouteID: "r2", GathererID: "g2", Latitude: 4.6315, Longitude: -74.0652, RecordedAt: now}, time.Hour))
+
+	return getgathererposition.Adapter(usersRepo, routesRepo, locationsRepo, trackingRepo, timeHelper, internal.DefaultETACalculator)
+}
+
+func TestShowsTheGathererComingToTheHousehold(t *testing.T) {
+	res := serve(t, newHandler(t), "u1", "r1", "pp1")
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %v: %s", res.StatusCode, res.Body)
+	}
+	var response getgathererposition.Response
+	if err := json.Unmarshal([]byte(res.Body), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.RouteID != "r1" || response.Latitude != 4.6515 || response.Distance < 1000 || response.ETA == "" {
+		t.Fatalf("expected the position of g1 and an ETA, got %+v", response)
+	}
+}
+
+func TestRefusesHouseholdsOnAnotherRoute(t *testing.T) {
+	handler := newHandler(t)
+
+	// pp2 is pinned by u2, u1 has no business following its gatherer
+	res := serve(t, handler, "u1", "r2", "pp2")
+	assertError(t, res, http.StatusForbidden, "wrong_location_owner")
+
+	// u1 has no picking point on r2
+	res = serve(t, handler, "u1", "r2", "pp1")
+	assertError(t, res, http.StatusNotFound, "picking_point_not_in_route")
+}
+
+func TestRefusesOutsideTheWayToThePickingPoint(t *testing.T) {
+	handler := newHandler(t)
+
+	res := serve(t, handler, "u1", "r1", "pp4")
+	assertError(t, res, http.StatusForbidden, "tracking_not_allowed")
+
+	res = serve(t, handler, "u1", "r3", "pp3")
+	assertError(t, res, http.StatusForbidden, "tracking_not_allowed")
+}
+
+func serve(t *testing.T, handler internal.Handler, userID string, routeID string, pickingPointID string) events.APIGatewayProxyResponse {
+	t.Helper()
+	res, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		Headers: map[string]string{"Accept-Language": "en-US"},
+		PathParameters: map[string]string{
+			"user_id":          userID,
+			"route_id":         routeID,
+			"picking_point_id": pickingPointID,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func assertError(t *testing.T, res events.APIGatewayProxyResponse, status int, code string) {
+	t.Helper()
+	if res.StatusCode != status || !strings.Contains(res.Body, `"code":"`+code+`"`) {
+		t.Fatalf("expected %v %s, got %v: %s", status, code, res.StatusCode, res.Body)
+	}
+	if strings.Contains(res.Body, "latitude") {
+		t.Fatalf("expected no position to be disclosed, got %s", res.Body)
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
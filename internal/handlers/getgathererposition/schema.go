@@ -0,0 +1,12 @@
+package getgathererposition
+
+const PathSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/get_gatherer_position/path.json",
+	"type": "object",
+	"required": ["user_id", "route_id", "picking_point_id"],
+	"properties": {
+		"user_id": {"$ref": "../definitions.json#/definitions/id"},
+		"route_id": {"$ref": "../definitions.json#/definitions/id"},
+		"picking_point_id": {"$ref": "../definitions.json#/definitions/id"}
+	}
+}`
@@ -0,0 +1,62 @@
+package getlocationscore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrUserIDNotFound = internal.NewError(http.StatusNotFound, "user_id_not_found", "user_id not found")
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type LocationsRepository interface {
+	GetScoreByUserID(ctx context.Context, userID string) (int, error)
+}
+
+type Response struct {
+	Username string `json:"username"`
+	Score    int    `json:"score"`
+}
+
+func Adapter(
+	usersRepo UsersRepository,
+	locationsRepo LocationsRepository,
+) internal.Handler {
+	return internal.Standard(
+		internal.ValidatePath(PathSchema),
+		internal.Authenticate(usersRepo, internal.UserIDFromPath("user_id")),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		user := internal.UserFrom(ctx)
+
+		score, err := locationsRepo.GetScoreByUserID(ctx, user.ID)
+		if err != nil {
+			if err == repositories.ErrNoLocationsFound {
+				jsonResponse, _ := json.Marshal(Response{
+					Username: user.Username,
+					Score:    score,
+				})
+				return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+			}
+			return internal.Fail(err), nil
+		}
+
+		response := Response{
+			Username: user.Username,
+			Score:    score,
+		}
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+	})
+}
@@ -0,0 +1,10 @@
+package getlocationscore
+
+const PathSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/get_user_score/path.json",
+	"type": "object",
+	"required": ["user_id"],
+	"properties": {
+		"user_id": {"$ref": "../definitions.json#/definitions/id"}
+	}
+}`
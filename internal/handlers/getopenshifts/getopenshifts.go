@@ -0,0 +1,165 @@
+package getopenshifts
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrUsernameEmpty = internal.NewError(http.StatusBadRequest, "username_empty", "username cannot be empty")
+
+type RoutesRepoRepository interface {
+	FindOpenShiftsPage(ctx context.Context, currentTime time.Time, maxTime time.Time, page repositories.PageQuery) (repositories.RoutesPage, error)
+	FindOpenShiftsInSectorPage(ctx context.Context, sectorID string, currentTime time.Time, maxTime time.Time, page repositories.PageQuery) (repositories.RoutesPage, error)
+}
+
+type LocationsRepository interface {
+	Find(ctx context.Context, id string) (models.Location, error)
+}
+
+type SectorsRepository interface {
+	Locate(ctx context.Context, lat float64, lon float64) (models.Sector, error)
+}
+
+type TimeHelper interface {
+	NowWithTimezone() (time.Time, error)
+	ToISO8601In(d time.Time, zone string) (string, error)
+	EndOfDayAfter(d time.Time, days int, zone string) (time.Time, error)
+	FormatDate(d time.Time, zone string, locale *internal.Locale) (string, error)
+}
+
+type ResponseShift struct {
+	ID            string   `json:"id"`
+	Materials     []string `json:"materials"`
+	Sector        string   `json:"sector"`
+	Shift         string   `json:"shift"`
+	Date          string   `json:"date"`
+	FormattedDate string   `json:"formatted_date"`
+}
+
+type Response struct {
+	Shifts     []ResponseShift `json:"shifts"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// Adapter lists the open shifts up to the end of the day daysOffset days
+// ahead, only the ones of the sector a location lies in when the location_id
+// query parameter is given, none if it lies in no sector. Days are those of
+// the location zone, or of the helper one without a location
+func Adapter(
+	routesRepo RoutesRepoRepository,
+	locationsRepo LocationsRepository,
+	sectorsRepo SectorsRepository,
+	daysOffset int,
+	timeHelper TimeHelper,
+) internal.Handler {
+	return internal.Standard(
+		internal.Paginate(),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+		// Find the sector and the zone of the location, if any
+		sectorID := ""
+		zone := ""
+		if locationID := req.QueryStringParameters["location_id"]; locationID != "" {
+			location, err := locationsRepo.Find(ctx, locationID)
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+			located, err := sectorsRepo.Locate(ctx, location.Latitude, location.Longitude)
+			if err == repositories.ErrSectorNotFound {
+				// no routes go outside the sectors, the same as a sector
+				// with none scheduled
+				log.Printf("location (%s) lies in no sector\n", locationID)
+				return respond(Response{Shifts: []ResponseShift{}})
+			}
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+			log.Printf("location (%s) lies in sector (%s)\n", locationID, located.ID)
+			sectorID = located.ID
+			zone = location.Zone()
+		}
+
+		// Calculate window time to query for shifts, the one of the first
+		// page when resuming from a cursor
+		pageQuery := internal.PageFrom(ctx)
+		var window internal.Window
+		if pageQuery.Cursor != "" {
+			resumed, cursor, err := internal.ResumeWindow(pageQuery.Cursor)
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+			window = resumed
+			pageQuery.Cursor = cursor
+		} else {
+			now, err := timeHelper.NowWithTimezone()
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+			maxTime, err := timeHelper.EndOfDayAfter(now, daysOffset, zone)
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+			window = internal.Window{From: now, To: maxTime}
+		}
+
+		// Query for routes
+		log.Printf("finding shifts between (%v) and (%v)\n", window.From, window.To)
+		var page repositories.RoutesPage
+		var err error
+		if sectorID != "" {
+			page, err = routesRepo.FindOpenShiftsInSectorPage(ctx, sectorID, window.From, window.To, pageQuery)
+		} else {
+			page, err = routesRepo.FindOpenShiftsPage(ctx, window.From, window.To, pageQuery)
+		}
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+		shifts := page.Routes
+		log.Printf("got %v shifts\n", len(shifts))
+
+		// Prepare response
+		locale := internal.LocaleFrom(ctx)
+		responseRoutes := make([]ResponseShift, len(shifts))
+		for i, route := range shifts {
+			startsAt, err := timeHelper.ToISO8601In(*route.StartsAt, route.Zone())
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+
+			formattedDate, err := timeHelper.FormatDate(*route.StartsAt, route.Zone(), locale)
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+
+			responseRoutes[i] = ResponseShift{
+				ID:            route.ID,
+				Materials:     route.Materials,
+				Sector:        route.Sector,
+				Shift:         route.Shift,
+				Date:          startsAt,
+				FormattedDate: formattedDate,
+			}
+		}
+		return respond(Response{
+			Shifts:     responseRoutes,
+			NextCursor: internal.WindowCursor(window, page.Cursor),
+		})
+	})
+}
+
+func respond(response Response) (events.APIGatewayProxyResponse, error) {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		return internal.Fail(err), nil
+	}
+
+	return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+}
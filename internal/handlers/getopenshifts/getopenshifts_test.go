@@ -0,0 +1,219 @@
+package getopenshifts_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getopenshifts"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// newHandler serves r1 to r6 starting an hour apart, the odd ones on
+// Chapinero and the even ones on Teusaquillo, along with a location in each
+// sector and one out of both
+func newHandler(t *testing.T) internal.Handler {
+	t.Helper()
+	handler, _ := newClockedHandler(t)
+	return handler
+}
+
+// movingClock is the time helper with a clock that can be moved ahead
+type movingClock struct {
+	*internal.TimeHelper
+	ahead time.Duration
+}
+
+func (c *movingClock) NowWithTimezone() (time.Time, error) {
+	now, err := c.TimeHelper.NowWithTimezone()
+	return now.Add(c.ahead), err
+}
+
+// newClockedHandler is newHandler along with the clock it reads
+func newClockedHandler(t *testing.T) (internal.Handler, *movingClock) {
+	t.Helper()
+	ctx := context.Background()
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locationsRepo := repositories.NewInMemoryLocationsRepository()
+	routesRepo := repositories.NewInMemoryRoutesRepository(locationsRepo, timeHelper, internal.NewUUIDHelper())
+	sectorsRepo := repositories.NewInMemorySectorsRepository()
+
+	sectors := []models.Sector{
+		{ID: "sector-chapinero", Name: "Chapinero", City: "Bogota", Polygon: square(4.628, -74.07, 4.67, -74.045)},
+		{ID: "sector-teusaquillo", Name: "Teusaquillo", City: "Bogota", Polygon: square(4.62, -74.1, 4.66, -74.07)},
+	}
+	for _, sector := range sectors {
+		must(t, sectorsRepo.Save(ctx, sector))
+	}
+	for _, location := range []models.Location{
+		{ID: "in-chapinero", Country: "CO", City: "Bogota", Latitude: 4.6415, Longitude: -74.0652},
+		{ID: "in-teusaquillo", Country: "CO", City: "Bogota", Latitude: 4.6361, Longitude: -74.0750},
+		{ID: "nowhere", Country: "CO", City: "Bogota", Latitude: 4.7, Longitude: -74.2},
+	} {
+		must(t, locationsRepo.Save(ctx, location))
+	}
+	for i, id := range []string{"r1", "r2", "r3", "r4", "r5", "r6"} {
+		sector := sectors[i%2]
+		startsAt := time.Now().Add(time.Duration(i+1) * time.Hour).Truncate(time.Second)
+		must(t, routesRepo.Save(ctx, models.Route{
+			ID: id, Sector: sector.Name, SectorID: sector.ID, Shift: "AM",
+			Materials: []string{models.MaterialPaper}, Status: models.RouteStatusOpen,
+			StartsAt: &startsAt,
+		}))
+	}
+
+	clock := &movingClock{TimeHelper: timeHelper}
+	return getopenshifts.Adapter(routesRepo, locationsRepo, sectorsRepo, 1, clock), clock
+}
+
+func TestListsEveryOpenShiftWithoutLocation(t *testing.T) {
+	res := serve(t, newHandler(t), nil)
+
+	response := decode(t, res)
+	assertShifts(t, response, "r1", "r2", "r3", "r4", "r5", "r6")
+}
+
+func TestListsTheShiftsOfTheLocationSector(t *testing.T) {
+	handler := newHandler(t)
+
+	response := decode(t, serve(t, handler, map[string]string{"location_id": "in-chapinero"}))
+	assertShifts(t, response, "r1", "r3", "r5")
+	if response.Shifts[0].Sector != "Chapinero" {
+		t.Fatalf("expected the sector name, got %q", response.Shifts[0].Sector)
+	}
+
+	response = decode(t, serve(t, handler, map[string]string{"location_id": "in-teusaquillo"}))
+	assertShifts(t, response, "r2", "r4", "r6")
+}
+
+func TestSectorPagesComeFull(t *testing.T) {
+	handler := newHandler(t)
+
+	response := decode(t, serve(t, handler, map[string]string{"location_id": "in-teusaquillo", "limit": "2"}))
+	assertShifts(t, response, "r2", "r4")
+	if response.NextCursor == "" {
+		t.Fatalf("expected a cursor after a full page")
+	}
+
+	response = decode(t, serve(t, handler, map[string]string{"location_id": "in-teusaquillo", "limit": "2", "cursor": response.NextCursor}))
+	assertShifts(t, response, "r6")
+	if response.NextCursor != "" {
+		t.Fatalf("expected the last page, got cursor %q", response.NextCursor)
+	}
+}
+
+func TestPagesKeepTheWindowOfTheFirstOne(t *testing.T) {
+	handler, clock := newClockedHandler(t)
+
+	response := decode(t, serve(t, handler, map[string]string{"limit": "2"}))
+	assertShifts(t, response, "r1", "r2")
+
+	// r1 and r2 start while the client reads the first page
+	clock.ahead = 150 * time.Minute
+	response = decode(t, serve(t, handler, map[string]string{"limit": "2", "cursor": response.NextCursor}))
+	assertShifts(t, response, "r3", "r4")
+	response = decode(t, serve(t, handler, map[string]string{"limit": "2", "cursor": response.NextCursor}))
+	assertShifts(t, response, "r5", "r6")
+	if response.NextCursor != "" {
+		t.Fatalf("expected the last page, got cursor %q", response.NextCursor)
+	}
+
+	// a new listing starts from the clock again
+	response = decode(t, serve(t, handler, nil))
+	assertShifts(t, response, "r3", "r4", "r5", "r6")
+}
+
+func TestForgedCursorIsABadRequest(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "e30", "MQ"} {
+		res := serve(t, newHandler(t), map[string]string{"cursor": cursor})
+		assertError(t, res, http.StatusBadRequest, "invalid_cursor")
+	}
+}
+
+func TestLocationOutsideEverySectorHasNoShifts(t *testing.T) {
+	res := serve(t, newHandler(t), map[string]string{"location_id": "nowhere"})
+
+	if !strings.Contains(res.Body, `"shifts":[]`) {
+		t.Fatalf("expected an empty list of shifts, got %s", res.Body)
+	}
+	response := decode(t, res)
+	assertShifts(t, response)
+	if response.NextCursor != "" {
+		t.Fatalf("expected no cursor, got %q", response.NextCursor)
+	}
+}
+
+func TestUnknownLocationIsNotFound(t *testing.T) {
+	res := serve(t, newHandler(t), map[string]string{"location_id": "missing"})
+
+	assertError(t, res, http.StatusNotFound, "location_not_found")
+}
+
+func serve(t *testing.T, handler internal.Handler, query map[string]string) events.APIGatewayProxyResponse {
+	t.Helper()
+	res, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		Headers:               map[string]string{"Accept-Language": "en-US"},
+		QueryStringParameters: query,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func decode(t *testing.T, res events.APIGatewayProxyResponse) getopenshifts.Response {
+	t.Helper()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %v: %s", res.StatusCode, res.Body)
+	}
+	var response getopenshifts.Response
+	if err := json.Unmarshal([]byte(res.Body), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func assertShifts(t *testing.T, response getopenshifts.Response, ids ...string) {
+	t.Helper()
+	got := []string{}
+	for _, shift := range response.Shifts {
+		got = append(got, shift.ID)
+	}
+	if len(got) != len(ids) || (len(ids) > 0 && !reflect.DeepEqual(got, ids)) {
+		t.Fatalf("expected shifts %v, got %v", ids, got)
+	}
+}
+
+func assertError(t *testing.T, res events.APIGatewayProxyResponse, status int, code string) {
+	t.Helper()
+	if res.StatusCode != status || !strings.Contains(res.Body, `"code":"`+code+`"`) {
+		t.Fatalf("expected %v %s, got %v: %s", status, code, res.StatusCode, res.Body)
+	}
+}
+
+func square(minLat float64, minLon float64, maxLat float64, maxLon float64) geo.Polygon {
+	return geo.Polygon{
+		{Latitude: minLat, Longitude: minLon},
+		{Latitude: maxLat, Longitude: minLon},
+		{Latitude: maxLat, Longitude: maxLon},
+		{Latitude: minLat, Longitude: maxLon},
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,132 @@
+package getpickingroutes
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrUsernameEmpty = internal.NewError(http.StatusBadRequest, "username_empty", "username cannot be empty")
+
+type RoutesRepoRepository interface {
+	FindAvailableRoutesPage(ctx context.Context, currentTime time.Time, maxTime time.Time, page repositories.PageQuery) (repositories.RoutesPage, error)
+}
+
+type TimeHelper interface {
+	NowWithTimezone() (time.Time, error)
+	FormatDate(d time.Time, zone string, locale *internal.Locale) (string, error)
+	ToISO8601In(d time.Time, zone string) (string, error)
+}
+
+type ResponseRoutePickingPoint struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	LocationID string   `json:"location_id"`
+	Country    string   `json:"country"`
+	City       string   `json:"city"`
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	Address1   string   `json:"address_1"`
+	Address2   string   `json:"address_2"`
+	Materials  []string `json:"materials"`
+}
+
+type ResponseRoute struct {
+	ID            string                      `json:"id"`
+	Materials     []string                    `json:"materials"`
+	Sector        string                      `json:"sector"`
+	Status        string                      `json:"status"`
+	Shift         string                      `json:"shift"`
+	Date          string                      `json:"date"`
+	FormattedDate string                      `json:"formatted_date"`
+	PickingPoints []ResponseRoutePickingPoint `json:"picking_points"`
+}
+
+type Response struct {
+	Routes     []ResponseRoute `json:"routes"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+func Adapter(
+	routesRepo RoutesRepoRepository,
+	hoursOffset int,
+	timeHelper TimeHelper,
+) internal.Handler {
+	return internal.Standard(
+		internal.Paginate(),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+
+		// Calculate window time to query for routes
+		now, err := timeHelper.NowWithTimezone()
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+		maxTime := now.Add(time.Hour * time.Duration(hoursOffset))
+
+		// Query for routes
+		log.Printf("finding routes between (%v) and (%v)\n", now, maxTime)
+		page, err := routesRepo.FindAvailableRoutesPage(ctx, now, maxTime, internal.PageFrom(ctx))
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+		routes := page.Routes
+		log.Printf("got %v routes\n", len(routes))
+
+		// Prepare response
+		locale := internal.LocaleFrom(ctx)
+		responseRoutes := make([]ResponseRoute, len(routes))
+		for i, route := range routes {
+			responseRoutesPickingPoints := make([]ResponseRoutePickingPoint, len(route.PickingPoints))
+			for j, pp := range route.PickingPoints {
+				log.Printf("pickingPoint.Materials: %#v", pp.Materials)
+				responseRoutesPickingPoints[j] = ResponseRoutePickingPoint{
+					ID:         pp.ID,
+					LocationID: pp.LocationID,
+					Country:    pp.Country,
+					City:       pp.City,
+					Latitude:   pp.Latitude,
+					Longitude:  pp.Longitude,
+					Address1:   pp.Address1,
+					Address2:   pp.Address2,
+					Materials:  pp.Materials,
+				}
+			}
+
+			startsAt, err := timeHelper.ToISO8601In(*route.StartsAt, route.Zone())
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+
+			formattedDate, err := timeHelper.FormatDate(*route.StartsAt, route.Zone(), locale)
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+			responseRoutes[i] = ResponseRoute{
+				ID:            route.ID,
+				Materials:     route.Materials,
+				Sector:        route.Sector,
+				Shift:         route.Shift,
+				Status:        route.Status,
+				Date:          startsAt,
+				FormattedDate: formattedDate,
+				PickingPoints: responseRoutesPickingPoints,
+			}
+		}
+		response := Response{
+			Routes:     responseRoutes,
+			NextCursor: page.Cursor,
+		}
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+	})
+}
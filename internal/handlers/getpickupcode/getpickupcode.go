@@ -0,0 +1,114 @@
+package getpickupcode
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrPickingPointNotFoundInRoute = internal.NewError(http.StatusNotFound, "picking_point_not_in_route", "given picking point does not exist in route")
+var ErrWrongLocationOwner = internal.NewError(http.StatusForbidden, "wrong_location_owner", "the picking point belongs to a location of another user")
+var ErrPickupCodeNotFound = internal.NewError(http.StatusNotFound, "pickup_code_not_found", "the picking point has no pickup code")
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type RoutesRepository interface {
+	Find(ctx context.Context, routeID string) (models.Route, error)
+}
+
+type LocationsRepository interface {
+	FindByUserID(ctx context.Context, id string) ([]models.Location, error)
+}
+
+type Response struct {
+	RouteID        string `json:"route_id"`
+	PickingPointID string `json:"picking_point_id"`
+	Code           string `json:"code"`
+	QRPayload      string `json:"qr_payload"`
+}
+
+func Adapter(
+	usersRepo UsersRepository,
+	routesRepo RoutesRepository,
+	locationsRepo LocationsRepository,
+) internal.Handler {
+	return internal.Standard(
+		internal.ValidatePath(PathSchema),
+		internal.Authenticate(usersRepo, internal.UserIDFromPath("user_id")),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		user := internal.UserFrom(ctx)
+
+		routeID := req.PathParameters["route_id"]
+		pickingPointID := req.PathParameters["picking_point_id"]
+
+		route, err := routesRepo.Find(ctx, routeID)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		var pickingPoint *models.PickingPoint
+		for i, pp := range route.PickingPoints {
+			if pp.ID == pickingPointID {
+				pickingPoint = &route.PickingPoints[i]
+				break
+			}
+		}
+		if pickingPoint == nil {
+			return internal.Fail(ErrPickingPointNotFoundInRoute), nil
+		}
+
+		// Only the household owning the pinned location gets to see the code
+		locations, err := locationsRepo.FindByUserID(ctx, user.ID)
+		if err != nil && err != repositories.ErrNoLocationsFound {
+			return internal.Fail(err), nil
+		}
+		isOwner := false
+		for _, location := range locations {
+			if location.ID == pickingPoint.LocationID {
+				isOwner = true
+				break
+			}
+		}
+		if !isOwner {
+			return internal.Fail(ErrWrongLocationOwner), nil
+		}
+
+		if pickingPoint.PickupCode == "" {
+			return internal.Fail(ErrPickupCodeNotFound), nil
+		}
+		if pickingPoint.CodeUsedAt != nil {
+			return internal.Fail(repositories.ErrPickupCodeAlreadyUsed), nil
+		}
+
+		response := Response{
+			RouteID:        route.ID,
+			PickingPointID: pickingPoint.ID,
+			Code:           pickingPoint.PickupCode,
+			QRPayload:      qrPayload(route.ID, pickingPoint.ID, pickingPoint.PickupCode),
+		}
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+	})
+}
+
+// qrPayload builds the content to be rendered as a QR code by the household
+// app and scanned by the gatherer app before finishing the picking point
+func qrPayload(routeID string, pickingPointID string, code string) string {
+	query := url.Values{}
+	query.Set("route_id", routeID)
+	query.Set("picking_point_id", pickingPointID)
+	query.Set("pickup_code", code)
+	return "reciapp://pickup?" + query.Encode()
+}
@@ -0,0 +1,92 @@
+package login
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type UsersRepository interface {
+	FindByUsername(ctx context.Context, username string) (models.User, error)
+}
+
+type LocationsRepository interface {
+	FindByUserID(ctx context.Context, id string) ([]models.Location, error)
+}
+
+type Request struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type Response struct {
+	ID        string            `json:"id"`
+	Username  string            `json:"username"`
+	FirstName string            `json:"firstname"`
+	LastName  string            `json:"lastname"`
+	Type      string            `json:"type"`
+	Locations []models.Location `json:"locations"`
+}
+
+type ResponseLocation struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Country   string  `json:"country"`
+	City      string  `json:"city"`
+	Address1  string  `json:"address_1"`
+	Address2  string  `json:"address_2"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+func Adapter(usersRepo UsersRepository, locationsRepo LocationsRepository) internal.Handler {
+	return internal.Standard(
+		internal.ValidateBody(RequestSchema),
+		internal.DecodeJSON(func() interface{} { return &Request{} }),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		reqBody := internal.Body(ctx).(*Request)
+
+		user, err := usersRepo.FindByUsername(ctx, reqBody.Username)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		locations, err := locationsRepo.FindByUserID(ctx, user.ID)
+		if err != nil && err != repositories.ErrNoLocationsFound {
+			return internal.Fail(err), nil
+		}
+		responseLocations := make([]ResponseLocation, len(locations))
+		for i, location := range locations {
+			responseLocations[i] = ResponseLocation{
+				ID:        location.ID,
+				Name:      location.Name,
+				Country:   location.Country,
+				City:      location.City,
+				Address1:  location.Address1,
+				Address2:  location.Address2,
+				Latitude:  location.Latitude,
+				Longitude: location.Longitude,
+			}
+		}
+
+		response := Response{
+			ID:        user.ID,
+			Username:  user.Username,
+			FirstName: user.Firstname,
+			LastName:  user.Lastname,
+			Type:      user.Type,
+			Locations: locations,
+		}
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+	})
+}
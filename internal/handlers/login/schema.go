@@ -0,0 +1,11 @@
+package login
+
+const RequestSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/login/request.json",
+	"type": "object",
+	"required": ["username"],
+	"properties": {
+		"username": {"type": "string", "minLength": 1},
+		"password": {"type": "string"}
+	}
+}`
@@ -0,0 +1,109 @@
+package pinpickingpoint
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrShiftNotFound = internal.NewError(http.StatusNotFound, "shift_not_found", "shift not found")
+var ErrMaterialNotAllowed = internal.NewError(http.StatusUnprocessableEntity, "material_not_allowed", "one or more materials are not allowed")
+var ErrShiftIsClosed = internal.NewError(http.StatusConflict, "shift_closed", "the shift has been closed and it's not receiving more picking_points")
+
+type RoutesRepository interface {
+	Pin(ctx context.Context, userID string, location models.Location, shiftID string, Materials []string) error
+	Find(ctx context.Context, routeID string) (models.Route, error)
+}
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type LocationssRepository interface {
+	Find(ctx context.Context, locationID string) (models.Location, error)
+}
+
+type Request struct {
+	UserID     string   `json:"user_id"`
+	ShiftID    string   `json:"shift_id"`
+	LocationID string   `json:"location_id"`
+	Materials  []string `json:"materials"`
+}
+
+func (r *Request) AuthUserID() string {
+	return r.UserID
+}
+
+func Adapter(
+	routesRepo RoutesRepository,
+	userRepo UsersRepository,
+	locationRepo LocationssRepository,
+	idempotencyRepo internal.IdempotencyRepository,
+) internal.Handler {
+	return internal.Standard(
+		internal.Idempotent(idempotencyRepo),
+		internal.ValidateBody(RequestSchema),
+		internal.DecodeJSON(func() interface{} { return &Request{} }),
+		internal.Authenticate(userRepo, internal.UserIDFromBody),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		reqBody := internal.Body(ctx).(*Request)
+
+		route, err := routesRepo.Find(ctx, reqBody.ShiftID)
+		if err != nil {
+			if err == repositories.ErrRouteNotFound {
+				return internal.Fail(ErrShiftNotFound), nil
+			}
+			return internal.Fail(err), nil
+		}
+
+		// material validation
+		for _, material := range reqBody.Materials {
+			if !isMaterialAllowed(strings.TrimSpace(material), route.Materials) {
+				return internal.Fail(ErrMaterialNotAllowed), nil
+			}
+		}
+
+		// Check if the shift (picking_route) is still open
+		if route.Status != models.RouteStatusOpen {
+			return internal.Fail(ErrShiftIsClosed), nil
+		}
+
+		location, err := locationRepo.Find(ctx, reqBody.LocationID)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		// Check if the location is already on the route.picking_points
+		log.Printf("checking if location is already on route.picking_points\n")
+		for _, pickingPoint := range route.PickingPoints {
+
+			log.Printf("pickingPoint.LocationID (%v) == location.ID(%v)\n", pickingPoint.LocationID, location.ID)
+			if pickingPoint.LocationID == location.ID {
+				log.Printf("match! returning 200\n")
+				return internal.Respond(http.StatusOK, ""), nil
+			}
+		}
+
+		err = routesRepo.Pin(ctx, reqBody.UserID, location, reqBody.ShiftID, reqBody.Materials)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, ""), nil
+	})
+}
+
+func isMaterialAllowed(material string, allowedMaterials []string) bool {
+	for _, allowed := range allowedMaterials {
+		if material == allowed {
+			return true
+		}
+	}
+	return false
+}
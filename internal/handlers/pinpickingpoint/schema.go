@@ -0,0 +1,18 @@
+package pinpickingpoint
+
+const RequestSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/pin_picking_point/request.json",
+	"type": "object",
+	"required": ["user_id", "shift_id", "location_id", "materials"],
+	"properties": {
+		"user_id": {"$ref": "../definitions.json#/definitions/id"},
+		"shift_id": {"$ref": "../definitions.json#/definitions/id"},
+		"location_id": {"$ref": "../definitions.json#/definitions/id"},
+		"materials": {
+			"type": "array",
+			"minItems": 1,
+			"uniqueItems": true,
+			"items": {"$ref": "../definitions.json#/definitions/material"}
+		}
+	}
+}`
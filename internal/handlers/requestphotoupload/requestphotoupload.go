@@ -0,0 +1,178 @@
+package requestphotoupload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/storage"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const UploadExpiration = 15 * time.Minute
+
+var ErrPickingPointNotFoundInRoute = internal.NewError(http.StatusUnprocessableEntity, "picking_point_not_in_route", "given picking point does not exist in route")
+var ErrNotAllowedToAttach = internal.NewError(http.StatusForbidden, "not_allowed_to_attach", "only the assigned gatherer or the location owner can attach photos")
+var ErrInvalidPhotoKey = internal.NewError(http.StatusBadRequest, "invalid_photo_key", "the key was not issued for this picking point, kind and content type")
+var ErrPhotoNotUploaded = internal.NewError(http.StatusConflict, "photo_not_uploaded", "nothing was uploaded with the given key yet")
+
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+}
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type RoutesRepository interface {
+	Find(ctx context.Context, routeID string) (models.Route, error)
+	AttachPhoto(ctx context.Context, routeID string, pickingPointIndex int, photo models.Photo) error
+}
+
+type LocationsRepository interface {
+	FindByUserID(ctx context.Context, id string) ([]models.Location, error)
+}
+
+type UUIDHelper interface {
+	New() string
+}
+
+type Request struct {
+	UserID         string `json:"user_id"`
+	RouteID        string `json:"route_id"`
+	PickingPointID string `json:"picking_point_id"`
+	Kind           string `json:"kind"`
+	ContentType    string `json:"content_type"`
+	Key            string `json:"key"`
+}
+
+// Response is the upload slot issued, or just the key once the upload to it
+// is confirmed
+type Response struct {
+	Key       string `json:"key"`
+	UploadURL string `json:"upload_url,omitempty"`
+	ExpiresIn int    `json:"expires_in,omitempty"`
+}
+
+func (r *Request) AuthUserID() string {
+	return r.UserID
+}
+
+// Adapter issues a slot to upload a photo of a picking point to. The photo is
+// linked to the picking point only once the client confirms the upload,
+// sending the same request again along with the key of the slot
+func Adapter(
+	usersRepo UsersRepository,
+	routesRepo RoutesRepository,
+	locationsRepo LocationsRepository,
+	objectStore storage.ObjectStore,
+	uuidHelper UUIDHelper,
+) internal.Handler {
+	return internal.Standard(
+		internal.ValidateBody(RequestSchema),
+		internal.DecodeJSON(func() interface{} { return &Request{} }),
+		internal.Authenticate(usersRepo, internal.UserIDFromBody),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		reqBody := internal.Body(ctx).(*Request)
+		user := internal.UserFrom(ctx)
+		extension := extensions[reqBody.ContentType]
+
+		route, err := routesRepo.Find(ctx, reqBody.RouteID)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		pickingPointIndex := -1
+		for i, pp := range route.PickingPoints {
+			if pp.ID == reqBody.PickingPointID {
+				pickingPointIndex = i
+				break
+			}
+		}
+		if pickingPointIndex == -1 {
+			return internal.Fail(ErrPickingPointNotFoundInRoute), nil
+		}
+
+		allowed := user.Type == models.UserTypeGatherer && route.GathererID == user.ID
+		if !allowed {
+			locations, err := locationsRepo.FindByUserID(ctx, user.ID)
+			if err != nil && err != repositories.ErrNoLocationsFound {
+				return internal.Fail(err), nil
+			}
+			for _, location := range locations {
+				if location.ID == route.PickingPoints[pickingPointIndex].LocationID {
+					allowed = true
+					break
+				}
+			}
+		}
+		if !allowed {
+			return internal.Fail(ErrNotAllowedToAttach), nil
+		}
+
+		// The kind is part of the key, a slot only confirms photos of the
+		// kind it was issued for
+		prefix := fmt.Sprintf("picking_points/%s/%s/%s/", route.ID, reqBody.PickingPointID, reqBody.Kind)
+		if reqBody.Key == "" {
+			key := prefix + uuidHelper.New() + "." + extension
+			uploadURL, err := objectStore.UploadURL(key, reqBody.ContentType, UploadExpiration)
+			if err != nil {
+				return internal.Fail(err), nil
+			}
+			return respond(Response{
+				Key:       key,
+				UploadURL: uploadURL,
+				ExpiresIn: int(UploadExpiration.Seconds()),
+			})
+		}
+
+		// Confirming the upload, keys are checked against the ones this
+		// picking point and kind could have been issued before the store is
+		// asked
+		suffix := "." + extension
+		id := strings.TrimSuffix(strings.TrimPrefix(reqBody.Key, prefix), suffix)
+		if !strings.HasPrefix(reqBody.Key, prefix) || !strings.HasSuffix(reqBody.Key, suffix) || id == "" || strings.ContainsAny(id, "/.") {
+			return internal.Fail(ErrInvalidPhotoKey), nil
+		}
+		for _, photo := range route.PickingPoints[pickingPointIndex].Photos {
+			if photo.Key == reqBody.Key {
+				return respond(Response{Key: reqBody.Key})
+			}
+		}
+		uploaded, err := objectStore.Exists(ctx, reqBody.Key)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+		if !uploaded {
+			return internal.Fail(ErrPhotoNotUploaded), nil
+		}
+
+		// Confirms racing this one got past the check above too, the
+		// repository links the key once
+		err = routesRepo.AttachPhoto(ctx, route.ID, pickingPointIndex, models.Photo{
+			Key:        reqBody.Key,
+			Kind:       reqBody.Kind,
+			UploadedBy: user.ID,
+		})
+		if err != nil && err != repositories.ErrPhotoAlreadyAttached {
+			return internal.Fail(err), nil
+		}
+		return respond(Response{Key: reqBody.Key})
+	})
+}
+
+func respond(response Response) (events.APIGatewayProxyResponse, error) {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		return internal.Fail(err), nil
+	}
+
+	return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+}
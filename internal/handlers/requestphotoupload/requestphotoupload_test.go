@@ -0,0 +1,238 @@
+package requestphotoupload_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/requestphotoupload"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/storage"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// body is a request body as clients send it, leaving out what they omit
+type body map[string]interface{}
+
+type backend struct {
+	handler       internal.Handler
+	usersRepo     *repositories.InMemoryUsersRepository
+	routesRepo    *repositories.InMemoryRoutesRepository
+	locationsRepo *repositories.InMemoryLocationsRepository
+	store         *storage.FilesystemObjectStore
+}
+
+// newBackend serves the initiated route r1 of gatherer g1 with pp1 of l1,
+// which belongs to u1, and a store kept in a fresh directory
+func newBackend(t *testing.T) backend {
+	t.Helper()
+	ctx := context.Background()
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usersRepo := repositories.NewInMemoryUsersRepository()
+	locationsRepo := repositories.NewInMemoryLocationsRepository()
+	routesRepo := repositories.NewInMemoryRoutesRepository(locationsRepo, timeHelper, internal.NewUUIDHelper())
+	dir, err := ioutil.TempDir("", "photos-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	store, err := storage.NewFilesystemObjectStore(dir, "http://localhost:8080/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	must(t, usersRepo.Save(ctx, models.User{ID: "g1", Username: "g1", Type: models.UserTypeGatherer, Country: "CO"}))
+	for _, id := range []string{"u1", "u2"} {
+		must(t, usersRepo.Save(ctx, models.User{ID: id, Username: id, Type: models.UserTypeUser, Country: "CO"}))
+	}
+	must(t, locationsRepo.Save(ctx, models.Location{ID: "l1", Country: "CO", City: "Bogota", Latitude: 4.6415, Longitude: -74.0652}))
+	must(t, locationsRepo.Link(ctx, "u1", "l1"))
+	now := time.Now().Truncate(time.Second)
+	must(t, routesRepo.Save(ctx, models.Route{
+		ID: "r1", Sector: "Chapinero", Shift: "AM", Materials: []string{models.MaterialPlastic},
+		Status: models.RouteStatusInitiated, GathererID: "g1", StartsAt: &now, InitiatedAt: &now,
+		PickingPoints: []models.PickingPoint{{
+			ID: "pp1", LocationID: "l1", Country: "CO", City: "Bogota",
+			Latitude: 4.6415, Longitude: -74.0652, Materials: []string{models.MaterialPlastic},
+		}},
+	}))
+
+	return backend{
+		handler:       requestphotoupload.Adapter(usersRepo, routesRepo, locationsRepo, store, internal.NewUUIDHelper()),
+		usersRepo:     usersRepo,
+		routesRepo:    routesRepo,
+		locationsRepo: locationsRepo,
+		store:         store,
+	}
+}
+
+func TestLinksPhotosOnlyOnceUploaded(t *testing.T) {
+	b := newBackend(t)
+
+	slot := decode(t, b.serve(t, "g1", ""))
+	if !strings.HasPrefix(slot.Key, "picking_points/r1/pp1/before/") || !strings.HasSuffix(slot.Key, ".jpg") {
+		t.Fatalf("expected a key under the picking point, got %q", slot.Key)
+	}
+	if slot.UploadURL != "http://localhost:8080/uploads/"+slot.Key || slot.ExpiresIn == 0 {
+		t.Fatalf("expected an upload slot, got %+v", slot)
+	}
+	b.assertPhotos(t)
+
+	// the client comes back without having uploaded anything
+	res := b.serve(t, "g1", slot.Key)
+	assertError(t, res, http.StatusConflict, "photo_not_uploaded")
+	b.assertPhotos(t)
+
+	b.upload(t, slot.Key)
+	confirmed := decode(t, b.serve(t, "g1", slot.Key))
+	if confirmed.Key != slot.Key || confirmed.UploadURL != "" {
+		t.Fatalf("expected the confirmed key alone, got %+v", confirmed)
+	}
+	b.assertPhotos(t, slot.Key)
+
+	// confirming twice links the photo once
+	decode(t, b.serve(t, "g1", slot.Key))
+	b.assertPhotos(t, slot.Key)
+}
+
+func TestLetsTheLocationOwnerAttachPhotos(t *testing.T) {
+	b := newBackend(t)
+
+	slot := decode(t, b.serve(t, "u1", ""))
+	b.upload(t, slot.Key)
+	decode(t, b.serve(t, "u1", slot.Key))
+	b.assertPhotos(t, slot.Key)
+
+	res := b.serve(t, "u2", "")
+	assertError(t, res, http.StatusForbidden, "not_allowed_to_attach")
+}
+
+func TestRefusesKeysNotIssuedForThePickingPoint(t *testing.T) {
+	b := newBackend(t)
+
+	for _, key := range []string{
+		"picking_points/r2/pp1/before/photo.jpg",
+		"picking_points/r1/pp1/before/photo.png",
+		"picking_points/r1/pp1/after/photo.jpg",
+		"picking_points/r1/pp1/photo.jpg",
+		"picking_points/r1/pp1/before/.jpg",
+		"picking_points/r1/pp1/before/nested/photo.jpg",
+		"picking_points/r1/pp1/before/../after/photo.jpg",
+		"photo.jpg",
+	} {
+		t.Run(key, func(t *testing.T) {
+			b.upload(t, strings.Replace(key, "before/../", "", 1))
+			res := b.serve(t, "g1", key)
+			assertError(t, res, http.StatusBadRequest, "invalid_photo_key")
+		})
+	}
+	b.assertPhotos(t)
+}
+
+// staleRoutes keeps answering with the route as it was before any photo was
+// attached, the way a confirm racing another one reads it
+type staleRoutes struct {
+	*repositories.InMemoryRoutesRepository
+	route models.Route
+}
+
+func (r staleRoutes) Find(ctx context.Context, routeID string) (models.Route, error) {
+	return r.route, nil
+}
+
+func TestLinksPhotosConfirmedConcurrentlyOnce(t *testing.T) {
+	b := newBackend(t)
+	route, err := b.routesRepo.Find(context.Background(), "r1")
+	must(t, err)
+	slot := decode(t, b.serve(t, "g1", ""))
+	b.upload(t, slot.Key)
+	b.handler = requestphotoupload.Adapter(b.usersRepo, staleRoutes{b.routesRepo, route}, b.locationsRepo, b.store, internal.NewUUIDHelper())
+
+	decode(t, b.serve(t, "g1", slot.Key))
+	decode(t, b.serve(t, "g1", slot.Key))
+	b.assertPhotos(t, slot.Key)
+}
+
+func (b backend) serve(t *testing.T, userID string, key string) events.APIGatewayProxyResponse {
+	t.Helper()
+	req := body{"user_id": userID, "route_id": "r1", "picking_point_id": "pp1", "kind": models.PhotoKindBefore, "content_type": "image/jpeg"}
+	if key != "" {
+		req["key"] = key
+	}
+	raw, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := b.handler(context.Background(), events.APIGatewayProxyRequest{
+		Headers: map[string]string{"Accept-Language": "en-US"},
+		Body:    string(raw),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// upload does what clients do with the slot issued for key
+func (b backend) upload(t *testing.T, key string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	b.store.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/"+key, strings.NewReader("jpeg")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %s uploaded, got %v: %s", key, rec.Code, rec.Body.String())
+	}
+}
+
+func (b backend) assertPhotos(t *testing.T, keys ...string) {
+	t.Helper()
+	route, err := b.routesRepo.Find(context.Background(), "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	photos := route.PickingPoints[0].Photos
+	if len(photos) != len(keys) {
+		t.Fatalf("expected photos %v, got %+v", keys, photos)
+	}
+	for i, photo := range photos {
+		if photo.Key != keys[i] || photo.Kind != models.PhotoKindBefore {
+			t.Fatalf("expected photos %v, got %+v", keys, photos)
+		}
+	}
+}
+
+func decode(t *testing.T, res events.APIGatewayProxyResponse) requestphotoupload.Response {
+	t.Helper()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %v: %s", res.StatusCode, res.Body)
+	}
+	var response requestphotoupload.Response
+	if err := json.Unmarshal([]byte(res.Body), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func assertError(t *testing.T, res events.APIGatewayProxyResponse, status int, code string) {
+	t.Helper()
+	if res.StatusCode != status || !strings.Contains(res.Body, `"code":"`+code+`"`) {
+		t.Fatalf("expected %v %s, got %v: %s", status, code, res.StatusCode, res.Body)
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
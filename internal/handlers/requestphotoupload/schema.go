@@ -0,0 +1,15 @@
+package requestphotoupload
+
+const RequestSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/request_photo_upload/request.json",
+	"type": "object",
+	"required": ["user_id", "route_id", "picking_point_id", "kind", "content_type"],
+	"properties": {
+		"user_id": {"$ref": "../definitions.json#/definitions/id"},
+		"route_id": {"$ref": "../definitions.json#/definitions/id"},
+		"picking_point_id": {"$ref": "../definitions.json#/definitions/id"},
+		"kind": {"$ref": "../definitions.json#/definitions/photo_kind"},
+		"content_type": {"type": "string", "enum": ["image/jpeg", "image/png"]},
+		"key": {"type": "string", "minLength": 1}
+	}
+}`
@@ -0,0 +1,11 @@
+package startpickingroute
+
+const RequestSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/start_picking_route/request.json",
+	"type": "object",
+	"required": ["user_id", "route_id"],
+	"properties": {
+		"user_id": {"$ref": "../definitions.json#/definitions/id"},
+		"route_id": {"$ref": "../definitions.json#/definitions/id"}
+	}
+}`
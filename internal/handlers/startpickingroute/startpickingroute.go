@@ -0,0 +1,178 @@
+package startpickingroute
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrWrongGathererID = internal.NewError(http.StatusForbidden, "wrong_gatherer_id", "this route is assigned to another gatherer")
+var ErrWrongUserType = internal.NewError(http.StatusForbidden, "wrong_user_type", "user must be of type gatherer")
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type RouteRepository interface {
+	Find(ctx context.Context, routeID string) (models.Route, error)
+	Initiate(ctx context.Context, routeID string, at time.Time) error
+}
+
+type TrackingRepository interface {
+	Latest(ctx context.Context, routeID string) (models.GathererPosition, error)
+}
+
+type TimeHelper interface {
+	ToLatamFormat(d time.Time) (string, error)
+	ToISO8601In(d time.Time, zone string) (string, error)
+}
+
+type Request struct {
+	UserID  string `json:"user_id"`
+	RouteID string `json:"route_id"`
+}
+
+type ResponsePickingPoint struct {
+	ID         string   `json:"id"`
+	Country    string   `json:"country"`
+	City       string   `json:"city"`
+	Address1   string   `json:"address_1"`
+	Address2   string   `json:"address_2"`
+	LocationID string   `json:"location_id"`
+	Name       string   `json:"name"`
+	Latitude   float64  `json:"latitude"`
+	Longitude  float64  `json:"longitude"`
+	Materials  []string `json:"materials"`
+	ETA        string   `json:"eta,omitempty"`
+}
+
+type ResponseRoute struct {
+	ID            string                 `json:"id"`
+	Materials     []string               `json:"materials"`
+	Sector        string                 `json:"sector"`
+	Status        string                 `json:"status"`
+	Shift         string                 `json:"shift"`
+	Date          string                 `json:"date"`
+	PickingPoints []ResponsePickingPoint `json:"picking_points"`
+}
+
+type Response struct {
+	AssignedRoute ResponseRoute `json:"assigned_route"`
+}
+
+func (r *Request) AuthUserID() string {
+	return r.UserID
+}
+
+// Start initiates the route assigned to user, at being when the gatherer
+// started it. started tells whether it was initiated now or had been already
+func Start(ctx context.Context, routeRepo RouteRepository, user models.User, routeID string, at time.Time) (route models.Route, started bool, err error) {
+	route, err = routeRepo.Find(ctx, routeID)
+	if err != nil {
+		return models.Route{}, false, err
+	}
+
+	if route.GathererID != user.ID {
+		return models.Route{}, false, ErrWrongGathererID
+	}
+
+	log.Printf("route.InitiatedAt: (%v)\n", route.InitiatedAt)
+	if route.InitiatedAt != nil {
+		return route, false, nil
+	}
+	log.Printf("Initiating route\n")
+	if err := routeRepo.Initiate(ctx, route.ID, at); err != nil {
+		return models.Route{}, false, err
+	}
+	route.Status = models.RouteStatusInitiated
+	route.InitiatedAt = &at
+	return route, true, nil
+}
+
+func Adapter(
+	usersRepo UsersRepository,
+	routeRepo RouteRepository,
+	trackingRepo TrackingRepository,
+	timeHelper TimeHelper,
+	etaCalculator internal.ETACalculator,
+) internal.Handler {
+	return internal.Standard(
+		internal.ValidateBody(RequestSchema),
+		internal.DecodeJSON(func() interface{} { return &Request{} }),
+		internal.Authenticate(usersRepo, internal.UserIDFromBody),
+		internal.RequireUserType(models.UserTypeGatherer, ErrWrongUserType),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		reqBody := internal.Body(ctx).(*Request)
+		user := internal.UserFrom(ctx)
+
+		route, _, err := Start(ctx, routeRepo, user, reqBody.RouteID, time.Now())
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		// The gatherer may not have pinged yet right after starting, the
+		// ETAs are then counted from the first picking point
+		var origin *internal.Origin
+		position, err := trackingRepo.Latest(ctx, route.ID)
+		if err == nil {
+			origin = &internal.Origin{Latitude: position.Latitude, Longitude: position.Longitude}
+		} else if err != repositories.ErrNoGathererPosition {
+			log.Printf("could not get the position of the gatherer of route (%s): %v\n", route.ID, err)
+		}
+		etas := etaCalculator.Estimate(origin, route.PickingPoints, time.Now())
+
+		responseRoutePickingPoints := make([]ResponsePickingPoint, len(route.PickingPoints))
+		for i, pp := range route.PickingPoints {
+			eta := ""
+			if at, ok := etas[pp.ID]; ok {
+				eta, err = timeHelper.ToISO8601In(at, route.Zone())
+				if err != nil {
+					return internal.Fail(err), nil
+				}
+			}
+			responseRoutePickingPoints[i] = ResponsePickingPoint{
+				ID:         pp.ID,
+				Country:    pp.Country,
+				City:       pp.City,
+				Address1:   pp.Address1,
+				Address2:   pp.Address2,
+				LocationID: pp.LocationID,
+				Latitude:   pp.Latitude,
+				Longitude:  pp.Longitude,
+				Materials:  pp.Materials,
+				ETA:        eta,
+			}
+		}
+
+		startsAt, err := timeHelper.ToISO8601In(*route.StartsAt, route.Zone())
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+		responseAssignedRoute := ResponseRoute{
+			ID:            route.ID,
+			Materials:     route.Materials,
+			Sector:        route.Sector,
+			Status:        models.RouteStatusInitiated,
+			Shift:         route.Shift,
+			Date:          startsAt,
+			PickingPoints: responseRoutePickingPoints,
+		}
+
+		response := Response{
+			AssignedRoute: responseAssignedRoute,
+		}
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+	})
+}
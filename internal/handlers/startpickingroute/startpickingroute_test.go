@@ -0,0 +1,140 @@
+package startpickingroute_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/startpickingroute"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// etaCalculator covers a kilometer a minute and stays ten minutes at every
+// picking point, round numbers to check the ETAs against
+var etaCalculator = internal.ETACalculator{AverageSpeed: 60, ServiceTime: 10 * time.Minute}
+
+type backend struct {
+	handler      internal.Handler
+	trackingRepo *repositories.InMemoryTrackingRepository
+}
+
+// newBackend serves r1, assigned to g1, with pp1 already picked, pp2 and pp3
+// about a kilometer north of pp2
+func newBackend(t *testing.T) backend {
+	t.Helper()
+	ctx := context.Background()
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usersRepo := repositories.NewInMemoryUsersRepository()
+	locationsRepo := repositories.NewInMemoryLocationsRepository()
+	routesRepo := repositories.NewInMemoryRoutesRepository(locationsRepo, timeHelper, internal.NewUUIDHelper())
+	trackingRepo := repositories.NewInMemoryTrackingRepository(timeHelper)
+
+	must(t, usersRepo.Save(ctx, models.User{ID: "g1", Username: "g1", Type: models.UserTypeGatherer, Country: "CO"}))
+	now := time.Now().Truncate(time.Second)
+	pickingPoint := func(id string, lat float64) models.PickingPoint {
+		return models.PickingPoint{
+			ID: id, LocationID: "l-" + id, Country: "CO", City: "Bogota",
+			Latitude: lat, Longitude: -74.0652, Materials: []string{models.MaterialPlastic},
+		}
+	}
+	picked := pickingPoint("pp1", 4.6315)
+	picked.PickedAt = &now
+	must(t, routesRepo.Save(ctx, models.Route{
+		ID: "r1", Sector: "Chapinero", Shift: "AM", Materials: []string{models.MaterialPlastic},
+		Status: models.RouteStatusAssigned, GathererID: "g1", StartsAt: &now,
+		PickingPoints: []models.PickingPoint{picked, pickingPoint("pp2", 4.6415), pickingPoint("pp3", 4.6505)},
+	}))
+
+	return backend{
+		handler:      startpickingroute.Adapter(usersRepo, routesRepo, trackingRepo, timeHelper, etaCalculator),
+		trackingRepo: trackingRepo,
+	}
+}
+
+func TestEstimatesThePendingPickingPoints(t *testing.T) {
+	b := newBackend(t)
+
+	before := time.Now().Truncate(time.Second)
+	route := decode(t, b.serve(t))
+	if route.Status != models.RouteStatusInitiated || len(route.PickingPoints) != 3 {
+		t.Fatalf("expected the initiated route, got %+v", route)
+	}
+	if route.PickingPoints[0].ETA != "" {
+		t.Fatalf("expected no ETA for the picked point, got %q", route.PickingPoints[0].ETA)
+	}
+
+	// without a ping the gatherer is taken to be at pp2
+	pp2, pp3 := eta(t, route.PickingPoints[1]), eta(t, route.PickingPoints[2])
+	assertWithin(t, "pp2", pp2.Sub(before), 0, 2*time.Second)
+	assertWithin(t, "pp3 after pp2", pp3.Sub(pp2), 10*time.Minute+55*time.Second, 11*time.Minute+5*time.Second)
+}
+
+func TestEstimatesFromTheLastPing(t *testing.T) {
+	b := newBackend(t)
+	// about two kilometers south of pp2
+	must(t, b.trackingRepo.Track(context.Background(), models.GathererPosition{
+		RouteID: "r1", GathererID: "g1", Latitude: 4.6235, Longitude: -74.0652, RecordedAt: time.Now(),
+	}, time.Hour))
+
+	before := time.Now().Truncate(time.Second)
+	route := decode(t, b.serve(t))
+
+	pp2, pp3 := eta(t, route.PickingPoints[1]), eta(t, route.PickingPoints[2])
+	assertWithin(t, "pp2", pp2.Sub(before), 1*time.Minute+55*time.Second, 2*time.Minute+5*time.Second)
+	assertWithin(t, "pp3 after pp2", pp3.Sub(pp2), 10*time.Minute+55*time.Second, 11*time.Minute+5*time.Second)
+}
+
+func (b backend) serve(t *testing.T) events.APIGatewayProxyResponse {
+	t.Helper()
+	res, err := b.handler(context.Background(), events.APIGatewayProxyRequest{
+		Headers: map[string]string{"Accept-Language": "en-US"},
+		Body:    `{"user_id":"g1","route_id":"r1"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func decode(t *testing.T, res events.APIGatewayProxyResponse) startpickingroute.ResponseRoute {
+	t.Helper()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %v: %s", res.StatusCode, res.Body)
+	}
+	var response startpickingroute.Response
+	if err := json.Unmarshal([]byte(res.Body), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response.AssignedRoute
+}
+
+func eta(t *testing.T, pp startpickingroute.ResponsePickingPoint) time.Time {
+	t.Helper()
+	at, err := time.Parse("2006-01-02T15:04:05-0700", pp.ETA)
+	if err != nil {
+		t.Fatalf("expected an ETA for %s, got %q", pp.ID, pp.ETA)
+	}
+	return at
+}
+
+func assertWithin(t *testing.T, name string, got time.Duration, min time.Duration, max time.Duration) {
+	t.Helper()
+	if got < min || got > max {
+		t.Fatalf("%s: expected between %v and %v, got %v", name, min, max, got)
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,81 @@
+package syncfieldwork
+
+// RequestSchema checks every action carries what its type needs, they are
+// applied one by one so a single invalid action would otherwise only show up
+// halfway through the queue
+const RequestSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/sync_field_work/request.json",
+	"type": "object",
+	"required": ["user_id", "actions"],
+	"properties": {
+		"user_id": {"$ref": "../definitions.json#/definitions/id"},
+		"actions": {
+			"type": "array",
+			"minItems": 1,
+			"maxItems": 100,
+			"items": {"$ref": "#/definitions/action"}
+		}
+	},
+	"definitions": {
+		"position": {
+			"type": "object",
+			"required": ["latitude", "longitude"],
+			"properties": {
+				"latitude": {"type": "number", "minimum": -90, "maximum": 90},
+				"longitude": {"type": "number", "minimum": -180, "maximum": 180},
+				"accuracy": {"type": "number", "minimum": 0}
+			}
+		},
+		"action": {
+			"type": "object",
+			"required": ["id", "type", "recorded_at"],
+			"properties": {
+				"id": {"$ref": "../definitions.json#/definitions/id"},
+				"type": {"enum": ["start_route", "finish_picking_point", "fail_picking_point", "gps_fix"]},
+				"recorded_at": {"type": "string", "format": "date-time"},
+				"route_id": {"$ref": "../definitions.json#/definitions/id"},
+				"picking_point_id": {"$ref": "../definitions.json#/definitions/id"},
+				"failure_reason": {"$ref": "../definitions.json#/definitions/failure_reason"},
+				"failure_note": {"type": "string"},
+				"pickup_code": {"type": "string"},
+				"quantities": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"required": ["material", "amount", "unit"],
+						"properties": {
+							"material": {"$ref": "../definitions.json#/definitions/material"},
+							"amount": {"$ref": "../definitions.json#/definitions/amount"},
+							"unit": {"$ref": "../definitions.json#/definitions/unit"}
+						}
+					}
+				},
+				"position": {"$ref": "#/definitions/position"}
+			},
+			"allOf": [
+				{
+					"if": {"properties": {"type": {"const": "start_route"}}},
+					"then": {"required": ["route_id"]}
+				},
+				{
+					"if": {"properties": {"type": {"const": "finish_picking_point"}}},
+					"then": {
+						"required": ["route_id", "picking_point_id"],
+						"not": {"required": ["failure_reason"]}
+					}
+				},
+				{
+					"if": {"properties": {"type": {"const": "fail_picking_point"}}},
+					"then": {
+						"required": ["route_id", "picking_point_id", "failure_reason"],
+						"properties": {"quantities": {"maxItems": 0}}
+					}
+				},
+				{
+					"if": {"properties": {"type": {"const": "gps_fix"}}},
+					"then": {"required": ["position"]}
+				}
+			]
+		}
+	}
+}`
@@ -0,0 +1,241 @@
+package syncfieldwork
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/finishpickingpoint"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/startpickingroute"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrWrongUserType = internal.NewError(http.StatusForbidden, "wrong_user_type", "user must be of type gatherer")
+
+const (
+	ActionStartRoute         = "start_route"
+	ActionFinishPickingPoint = "finish_picking_point"
+	ActionFailPickingPoint   = "fail_picking_point"
+	ActionGPSFix             = "gps_fix"
+)
+
+const (
+	ResultApplied        = "applied"         // the action changed the route
+	ResultAlreadyApplied = "already_applied" // the route already reflected the action, e.g. a resent queue
+	ResultConflict       = "conflict"        // the route changed while offline, e.g. it was reassigned
+	ResultRejected       = "rejected"        // the action is wrong on its own, it would fail online too
+	ResultFailed         = "failed"          // the server could not apply it, retry it
+	ResultSkipped        = "skipped"         // not tried after a failed action, retry it
+)
+
+// FixMaxAge is how old the last GPS fix of the queue can be to serve as the
+// position of a picking point finished without one
+const FixMaxAge = 5 * time.Minute
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type RoutesRepository interface {
+	Find(ctx context.Context, routeID string) (models.Route, error)
+	Initiate(ctx context.Context, routeID string, at time.Time) error
+	FinishPickingPoint(ctx context.Context, routeID string, pickingPointIndex int, pickingPoint models.PickingPoint, score int, remaining int) error
+	FailPickingPoint(ctx context.Context, routeID string, pickingPointIndex int, pickingPoint models.PickingPoint, remaining int) error
+}
+
+type Request struct {
+	UserID  string          `json:"user_id"`
+	Actions []RequestAction `json:"actions"`
+}
+
+// RequestAction is something the gatherer did while offline, RecordedAt
+// being when it happened according to the device
+type RequestAction struct {
+	ID             string                               `json:"id"`
+	Type           string                               `json:"type"`
+	RecordedAt     string                               `json:"recorded_at"`
+	RouteID        string                               `json:"route_id"`
+	PickingPointID string                               `json:"picking_point_id"`
+	FailureReason  string                               `json:"failure_reason"`
+	FailureNote    string                               `json:"failure_note"`
+	Quantities     []finishpickingpoint.RequestQuantity `json:"quantities"`
+	Position       *finishpickingpoint.RequestPosition  `json:"position"`
+	PickupCode     string                               `json:"pickup_code"`
+}
+
+type ResponseResult struct {
+	ID          string             `json:"id"`
+	Type        string             `json:"type"`
+	Result      string             `json:"result"`
+	RouteStatus string             `json:"route_status,omitempty"`
+	Error       *internal.APIError `json:"error,omitempty"`
+}
+
+type Response struct {
+	Results []ResponseResult `json:"results"`
+}
+
+func (r *Request) AuthUserID() string {
+	return r.UserID
+}
+
+// fix is the last GPS fix seen in the queue
+type fix struct {
+	position   finishpickingpoint.RequestPosition
+	recordedAt time.Time
+}
+
+// Adapter applies a queue of actions recorded offline, in order, through the
+// same logic as start_picking_route and finish_picking_point. Every action
+// gets its own result; once one fails on the server side the rest are
+// skipped, so the queue can be resent from there
+func Adapter(
+	usersRepo UsersRepository,
+	routesRepo RoutesRepository,
+	geofenceRadius float64,
+	geofenceMode string,
+	idempotencyRepo internal.IdempotencyRepository,
+) internal.Handler {
+	return internal.Standard(
+		internal.Idempotent(idempotencyRepo),
+		internal.ValidateBody(RequestSchema),
+		internal.DecodeJSON(func() interface{} { return &Request{} }),
+		internal.Authenticate(usersRepo, internal.UserIDFromBody),
+		internal.RequireUserType(models.UserTypeGatherer, ErrWrongUserType),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		reqBody := internal.Body(ctx).(*Request)
+		user := internal.UserFrom(ctx)
+		locale := internal.LocaleFrom(ctx)
+		now := time.Now()
+
+		results := make([]ResponseResult, len(reqBody.Actions))
+		var lastFix *fix
+		failed := false
+		for i, action := range reqBody.Actions {
+			results[i] = ResponseResult{
+				ID:   action.ID,
+				Type: action.Type,
+			}
+			if failed {
+				results[i].Result = ResultSkipped
+				continue
+			}
+
+			recordedAt, err := recordedAt(action, now)
+			if err != nil {
+				results[i].Result = ResultRejected
+				results[i].Error = localized(locale, internal.ErrInvalidField.WithField("recorded_at"))
+				continue
+			}
+
+			var routeStatus string
+			alreadyApplied := false
+			switch action.Type {
+			case ActionGPSFix:
+				lastFix = &fix{position: *action.Position, recordedAt: recordedAt}
+			case ActionStartRoute:
+				var route models.Route
+				var started bool
+				route, started, err = startpickingroute.Start(ctx, routesRepo, user, action.RouteID, recordedAt)
+				routeStatus = route.Status
+				alreadyApplied = !started
+			case ActionFinishPickingPoint, ActionFailPickingPoint:
+				finishReq := finishpickingpoint.Request{
+					UserID:         user.ID,
+					RouteID:        action.RouteID,
+					PickingPointId: action.PickingPointID,
+					FailureReason:  action.FailureReason,
+					FailureNote:    action.FailureNote,
+					Quantities:     action.Quantities,
+					Position:       positionAt(action, lastFix, recordedAt),
+					PickupCode:     action.PickupCode,
+				}
+				var outcome finishpickingpoint.Outcome
+				outcome, err = finishpickingpoint.Finish(ctx, routesRepo, user, finishReq, recordedAt, geofenceRadius, geofenceMode)
+				routeStatus = outcome.Status
+				alreadyApplied = outcome.AlreadyDone
+			}
+
+			switch {
+			case err != nil:
+				apiErr := internal.AsAPIError(err)
+				results[i].Result = resultOf(err, apiErr)
+				results[i].Error = localized(locale, apiErr)
+				if results[i].Result == ResultFailed {
+					log.Printf("could not apply offline action (%s) of user (%s): %v\n", action.ID, user.ID, err)
+					failed = true
+				}
+			case alreadyApplied:
+				results[i].Result = ResultAlreadyApplied
+				results[i].RouteStatus = routeStatus
+			default:
+				results[i].Result = ResultApplied
+				results[i].RouteStatus = routeStatus
+			}
+		}
+
+		jsonResponse, err := json.Marshal(Response{Results: results})
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, string(jsonResponse)), nil
+	})
+}
+
+// recordedAt is when the action happened, device clocks running ahead of the
+// server are brought back to now
+func recordedAt(action RequestAction, now time.Time) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, action.RecordedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.After(now) {
+		log.Printf("offline action (%s) recorded in the future (%v), using now\n", action.ID, t)
+		return now, nil
+	}
+	return t, nil
+}
+
+// positionAt is the position of a finish, the one sent with it or else the
+// last GPS fix taken shortly before. Devices without signal often cannot
+// attach a fresh fix to the action itself
+func positionAt(action RequestAction, lastFix *fix, recordedAt time.Time) *finishpickingpoint.RequestPosition {
+	if action.Position != nil {
+		return action.Position
+	}
+	if lastFix == nil || recordedAt.Before(lastFix.recordedAt) || recordedAt.Sub(lastFix.recordedAt) > FixMaxAge {
+		return nil
+	}
+	position := lastFix.position
+	return &position
+}
+
+// resultOf tells apart the actions made obsolete by changes on the server
+// from the ones that were wrong to begin with
+func resultOf(err error, apiErr *internal.APIError) string {
+	switch {
+	case apiErr.Status >= http.StatusInternalServerError:
+		return ResultFailed
+	case errors.Is(err, startpickingroute.ErrWrongGathererID),
+		errors.Is(err, finishpickingpoint.ErrWrongGathererID),
+		errors.Is(err, finishpickingpoint.ErrPickingPointNotFoundInRoute),
+		errors.Is(err, repositories.ErrRouteNotFound),
+		errors.Is(err, repositories.ErrPickupCodeAlreadyUsed):
+		return ResultConflict
+	default:
+		return ResultRejected
+	}
+}
+
+func localized(locale *internal.Locale, apiErr *internal.APIError) *internal.APIError {
+	c := *apiErr
+	c.Message = locale.Message(apiErr)
+	return &c
+}
@@ -0,0 +1,253 @@
+package syncfieldwork_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/finishpickingpoint"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/syncfieldwork"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// at the picking points
+var near = body{"latitude": 4.6415, "longitude": -74.0652, "accuracy": 10}
+
+// body is a request body as clients send it, leaving out what they omit
+type body map[string]interface{}
+
+// brokenRoutes fails to finish picking points, the way the table does when
+// it cannot be reached
+type brokenRoutes struct {
+	*repositories.InMemoryRoutesRepository
+}
+
+func (r brokenRoutes) FinishPickingPoint(ctx context.Context, routeID string, pickingPointIndex int, pickingPoint models.PickingPoint, score int, remaining int) error {
+	return errors.New("connection reset by peer")
+}
+
+// newRoutes holds r1, assigned to gathererID and not started yet, with the
+// pending picking points pp1 and pp2 and their pickup codes, and pp3
+func newRoutes(t *testing.T, gathererID string) (*repositories.InMemoryRoutesRepository, *repositories.InMemoryUsersRepository) {
+	t.Helper()
+	ctx := context.Background()
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usersRepo := repositories.NewInMemoryUsersRepository()
+	locationsRepo := repositories.NewInMemoryLocationsRepository()
+	routesRepo := repositories.NewInMemoryRoutesRepository(locationsRepo, timeHelper, internal.NewUUIDHelper())
+
+	for _, id := range []string{"g1", "g2"} {
+		must(t, usersRepo.Save(ctx, models.User{ID: id, Username: id, Type: models.UserTypeGatherer, Country: "CO"}))
+	}
+	must(t, locationsRepo.Save(ctx, models.Location{ID: "l1", Country: "CO", City: "Bogota", Latitude: 4.6415, Longitude: -74.0652}))
+	pickingPoint := func(id string, code string) models.PickingPoint {
+		return models.PickingPoint{
+			ID: id, LocationID: "l1", Country: "CO", City: "Bogota",
+			Latitude: 4.6415, Longitude: -74.0652,
+			Materials: []string{models.MaterialPlastic}, PickupCode: code,
+		}
+	}
+	startsAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	must(t, routesRepo.Save(ctx, models.Route{
+		ID: "r1", Sector: "Chapinero", Shift: "AM", Materials: []string{models.MaterialPlastic},
+		Status: models.RouteStatusAssigned, GathererID: gathererID, StartsAt: &startsAt,
+		PickingPoints: []models.PickingPoint{pickingPoint("pp1", "1111"), pickingPoint("pp2", "2222"), pickingPoint("pp3", "")},
+	}))
+	return routesRepo, usersRepo
+}
+
+func newHandler(usersRepo *repositories.InMemoryUsersRepository, routesRepo syncfieldwork.RoutesRepository) internal.Handler {
+	timeHelper, _ := internal.NewTimeHelper("America/Bogota")
+	return syncfieldwork.Adapter(
+		usersRepo,
+		routesRepo,
+		100,
+		finishpickingpoint.GeofenceModeReject,
+		repositories.NewInMemoryIdempotencyRepository(timeHelper),
+	)
+}
+
+func TestAppliesWhatItCanOfTheQueue(t *testing.T) {
+	routesRepo, usersRepo := newRoutes(t, "g1")
+	handler := newHandler(usersRepo, routesRepo)
+	actions := []body{
+		{"id": "a1", "type": syncfieldwork.ActionGPSFix, "recorded_at": ago(10), "position": near},
+		{"id": "a2", "type": syncfieldwork.ActionStartRoute, "recorded_at": ago(9), "route_id": "r1"},
+		// no position of its own, the fix of two minutes before stands for it
+		{"id": "a3", "type": syncfieldwork.ActionFinishPickingPoint, "recorded_at": ago(8), "route_id": "r1", "picking_point_id": "pp1", "pickup_code": "1111"},
+		{"id": "a4", "type": syncfieldwork.ActionFinishPickingPoint, "recorded_at": ago(7), "route_id": "r1", "picking_point_id": "pp2", "pickup_code": "9999", "position": near},
+		{"id": "a5", "type": syncfieldwork.ActionFailPickingPoint, "recorded_at": ago(6), "route_id": "r1", "picking_point_id": "pp3", "failure_reason": models.FailureReasonNobodyHome, "position": near},
+		// the last fix is too old to stand for this one
+		{"id": "a6", "type": syncfieldwork.ActionFinishPickingPoint, "recorded_at": ago(1), "route_id": "r1", "picking_point_id": "pp2", "pickup_code": "2222"},
+	}
+
+	response := decode(t, serve(t, handler, actions))
+	assertResults(t, response,
+		syncfieldwork.ResultApplied,
+		syncfieldwork.ResultApplied,
+		syncfieldwork.ResultApplied,
+		syncfieldwork.ResultRejected,
+		syncfieldwork.ResultApplied,
+		syncfieldwork.ResultRejected,
+	)
+	assertErrorCode(t, response.Results[3], "pickup_code_mismatch")
+	assertErrorCode(t, response.Results[5], "position_empty")
+	if response.Results[1].RouteStatus != models.RouteStatusInitiated || response.Results[4].RouteStatus != models.RouteStatusInitiated {
+		t.Fatalf("expected the route initiated, got %+v", response.Results)
+	}
+
+	route, err := routesRepo.Find(context.Background(), "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp1, pp2, pp3 := route.PickingPoints[0], route.PickingPoints[1], route.PickingPoints[2]
+	if pp1.PickedAt == nil || pp1.FinishFix == nil || pp1.FinishFix.Flagged {
+		t.Fatalf("expected pp1 picked with the fix of the queue, got %+v", pp1)
+	}
+	if pp2.IsDone() || pp3.FailedAt == nil {
+		t.Fatalf("expected pp2 pending and pp3 failed, got %+v %+v", pp2, pp3)
+	}
+	// stored with the time they were recorded at, not the time of the sync
+	assertAgo(t, "initiated_at", route.InitiatedAt, 9)
+	assertAgo(t, "picked_at", pp1.PickedAt, 8)
+	assertAgo(t, "failed_at", pp3.FailedAt, 6)
+
+	// resending the queue only repeats what was rejected
+	response = decode(t, serve(t, handler, actions))
+	assertResults(t, response,
+		syncfieldwork.ResultApplied,
+		syncfieldwork.ResultAlreadyApplied,
+		syncfieldwork.ResultAlreadyApplied,
+		syncfieldwork.ResultRejected,
+		syncfieldwork.ResultAlreadyApplied,
+		syncfieldwork.ResultRejected,
+	)
+}
+
+func TestReportsConflictsWithARouteReassignedWhileOffline(t *testing.T) {
+	routesRepo, usersRepo := newRoutes(t, "g2")
+	handler := newHandler(usersRepo, routesRepo)
+
+	response := decode(t, serve(t, handler, []body{
+		{"id": "a1", "type": syncfieldwork.ActionStartRoute, "recorded_at": ago(9), "route_id": "r1"},
+		{"id": "a2", "type": syncfieldwork.ActionFinishPickingPoint, "recorded_at": ago(8), "route_id": "r1", "picking_point_id": "pp1", "pickup_code": "1111", "position": near},
+		{"id": "a3", "type": syncfieldwork.ActionStartRoute, "recorded_at": ago(7), "route_id": "deleted"},
+	}))
+
+	assertResults(t, response, syncfieldwork.ResultConflict, syncfieldwork.ResultConflict, syncfieldwork.ResultConflict)
+	assertErrorCode(t, response.Results[0], "wrong_gatherer_id")
+	assertErrorCode(t, response.Results[1], "wrong_gatherer_id")
+	assertErrorCode(t, response.Results[2], "route_not_found")
+
+	route, err := routesRepo.Find(context.Background(), "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.InitiatedAt != nil || route.PickingPoints[0].IsDone() {
+		t.Fatalf("expected the route of g2 untouched, got %+v", route)
+	}
+}
+
+func TestSkipsTheRestOfTheQueueAfterAServerFailure(t *testing.T) {
+	routesRepo, usersRepo := newRoutes(t, "g1")
+	handler := newHandler(usersRepo, brokenRoutes{routesRepo})
+
+	response := decode(t, serve(t, handler, []body{
+		{"id": "a1", "type": syncfieldwork.ActionStartRoute, "recorded_at": ago(9), "route_id": "r1"},
+		{"id": "a2", "type": syncfieldwork.ActionFinishPickingPoint, "recorded_at": ago(8), "route_id": "r1", "picking_point_id": "pp1", "pickup_code": "1111", "position": near},
+		{"id": "a3", "type": syncfieldwork.ActionFailPickingPoint, "recorded_at": ago(7), "route_id": "r1", "picking_point_id": "pp3", "failure_reason": models.FailureReasonNobodyHome, "position": near},
+		{"id": "a4", "type": syncfieldwork.ActionGPSFix, "recorded_at": ago(6), "position": near},
+	}))
+
+	assertResults(t, response,
+		syncfieldwork.ResultApplied,
+		syncfieldwork.ResultFailed,
+		syncfieldwork.ResultSkipped,
+		syncfieldwork.ResultSkipped,
+	)
+	assertErrorCode(t, response.Results[1], "internal_error")
+
+	route, err := routesRepo.Find(context.Background(), "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.PickingPoints[2].IsDone() {
+		t.Fatalf("expected the skipped failure not to be applied, got %+v", route.PickingPoints[2])
+	}
+}
+
+// ago is the recorded_at of an action taken minutes ago
+func ago(minutes int) string {
+	return time.Now().Add(-time.Duration(minutes) * time.Minute).UTC().Format(time.RFC3339)
+}
+
+func assertAgo(t *testing.T, name string, at *time.Time, minutes int) {
+	t.Helper()
+	want := time.Now().Add(-time.Duration(minutes) * time.Minute)
+	if at == nil || at.Before(want.Add(-5*time.Second)) || at.After(want.Add(5*time.Second)) {
+		t.Fatalf("expected %s %v minutes ago, got %v", name, minutes, at)
+	}
+}
+
+func serve(t *testing.T, handler internal.Handler, actions []body) events.APIGatewayProxyResponse {
+	t.Helper()
+	raw, err := json.Marshal(body{"user_id": "g1", "actions": actions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		Headers: map[string]string{"Accept-Language": "en-US"},
+		Body:    string(raw),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func decode(t *testing.T, res events.APIGatewayProxyResponse) syncfieldwork.Response {
+	t.Helper()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %v: %s", res.StatusCode, res.Body)
+	}
+	var response syncfieldwork.Response
+	if err := json.Unmarshal([]byte(res.Body), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func assertResults(t *testing.T, response syncfieldwork.Response, results ...string) {
+	t.Helper()
+	got := []string{}
+	for _, result := range response.Results {
+		got = append(got, result.Result)
+	}
+	if !reflect.DeepEqual(got, results) {
+		t.Fatalf("expected results %v, got %v", results, got)
+	}
+}
+
+func assertErrorCode(t *testing.T, result syncfieldwork.ResponseResult, code string) {
+	t.Helper()
+	if result.Error == nil || result.Error.Code != code {
+		t.Fatalf("expected %s on action %s, got %+v", code, result.ID, result.Error)
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,15 @@
+package trackgathererposition
+
+const RequestSchema = `{
+	"$id": "https://reciapp.quartrino.com/schemas/track_gatherer_position/request.json",
+	"type": "object",
+	"required": ["user_id", "route_id", "latitude", "longitude"],
+	"properties": {
+		"user_id": {"$ref": "../definitions.json#/definitions/id"},
+		"route_id": {"$ref": "../definitions.json#/definitions/id"},
+		"latitude": {"type": "number", "minimum": -90, "maximum": 90},
+		"longitude": {"type": "number", "minimum": -180, "maximum": 180},
+		"accuracy": {"type": "number", "minimum": 0},
+		"recorded_at": {"type": "string", "format": "date-time"}
+	}
+}`
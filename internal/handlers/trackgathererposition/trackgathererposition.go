@@ -0,0 +1,112 @@
+package trackgathererposition
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var ErrWrongUserType = internal.NewError(http.StatusForbidden, "wrong_user_type", "user must be of type gatherer")
+var ErrWrongGathererID = internal.NewError(http.StatusForbidden, "wrong_gatherer_id", "the route is not assigned to the given gatherer id")
+var ErrRouteNotInitiated = internal.NewError(http.StatusConflict, "route_not_initiated", "the route has not been initiated")
+
+// PositionTTL is how long a ping is shown to households, a gatherer whose
+// app stopped pinging disappears from the map instead of looking stuck
+const PositionTTL = 10 * time.Minute
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type RoutesRepository interface {
+	Find(ctx context.Context, routeID string) (models.Route, error)
+}
+
+type TrackingRepository interface {
+	Track(ctx context.Context, position models.GathererPosition, ttl time.Duration) error
+}
+
+type Request struct {
+	UserID    string  `json:"user_id"`
+	RouteID   string  `json:"route_id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Accuracy  float64 `json:"accuracy"`
+	// RecordedAt is when the device took the fix, the time it is received
+	// at when left out
+	RecordedAt string `json:"recorded_at,omitempty"`
+}
+
+func (r *Request) AuthUserID() string {
+	return r.UserID
+}
+
+// Adapter stores the periodic GPS pings of the gatherer working an initiated
+// route. Pings arriving out of order never replace a newer one
+func Adapter(
+	usersRepo UsersRepository,
+	routesRepo RoutesRepository,
+	trackingRepo TrackingRepository,
+) internal.Handler {
+	return internal.Standard(
+		internal.ValidateBody(RequestSchema),
+		internal.DecodeJSON(func() interface{} { return &Request{} }),
+		internal.Authenticate(usersRepo, internal.UserIDFromBody),
+		internal.RequireUserType(models.UserTypeGatherer, ErrWrongUserType),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		reqBody := internal.Body(ctx).(*Request)
+		user := internal.UserFrom(ctx)
+
+		route, err := routesRepo.Find(ctx, reqBody.RouteID)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+		if route.GathererID != user.ID {
+			return internal.Fail(ErrWrongGathererID), nil
+		}
+		if route.Status != models.RouteStatusInitiated {
+			return internal.Fail(ErrRouteNotInitiated), nil
+		}
+
+		recordedAt, err := recordedAt(reqBody.RecordedAt, time.Now())
+		if err != nil {
+			return internal.Fail(internal.ErrInvalidField.WithField("recorded_at")), nil
+		}
+
+		err = trackingRepo.Track(ctx, models.GathererPosition{
+			RouteID:    route.ID,
+			GathererID: user.ID,
+			Latitude:   reqBody.Latitude,
+			Longitude:  reqBody.Longitude,
+			Accuracy:   reqBody.Accuracy,
+			RecordedAt: recordedAt,
+		}, PositionTTL)
+		if err != nil {
+			return internal.Fail(err), nil
+		}
+
+		return internal.Respond(http.StatusOK, ""), nil
+	})
+}
+
+// recordedAt is when the fix was taken, device clocks running ahead of the
+// server are brought back to now
+func recordedAt(raw string, now time.Time) (time.Time, error) {
+	if raw == "" {
+		return now, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.After(now) {
+		log.Printf("position recorded in the future (%v), using now\n", t)
+		return now, nil
+	}
+	return t, nil
+}
@@ -0,0 +1,141 @@
+package trackgathererposition_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/trackgathererposition"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// body is a request body as clients send it, leaving out what they omit
+type body map[string]interface{}
+
+type backend struct {
+	handler      internal.Handler
+	trackingRepo *repositories.InMemoryTrackingRepository
+}
+
+// newBackend serves the route r1 initiated by the gatherer g1
+func newBackend(t *testing.T) backend {
+	t.Helper()
+	ctx := context.Background()
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usersRepo := repositories.NewInMemoryUsersRepository()
+	locationsRepo := repositories.NewInMemoryLocationsRepository()
+	routesRepo := repositories.NewInMemoryRoutesRepository(locationsRepo, timeHelper, internal.NewUUIDHelper())
+	trackingRepo := repositories.NewInMemoryTrackingRepository(timeHelper)
+
+	must(t, usersRepo.Save(ctx, models.User{ID: "g1", Username: "g1", Type: models.UserTypeGatherer, Country: "CO"}))
+	now := time.Now().Truncate(time.Second)
+	must(t, routesRepo.Save(ctx, models.Route{
+		ID: "r1", Sector: "Chapinero", Shift: "AM", Materials: []string{models.MaterialPlastic},
+		Status: models.RouteStatusInitiated, GathererID: "g1", StartsAt: &now, InitiatedAt: &now,
+	}))
+
+	return backend{
+		handler:      trackgathererposition.Adapter(usersRepo, routesRepo, trackingRepo),
+		trackingRepo: trackingRepo,
+	}
+}
+
+func TestKeepsTheLatestFixWhenPingsArriveOutOfOrder(t *testing.T) {
+	b := newBackend(t)
+
+	b.assertTracked(t, b.serve(t, body{"latitude": 4.65, "recorded_at": ago(1)}))
+	// a ping held back by the network comes in after the newer one
+	b.assertTracked(t, b.serve(t, body{"latitude": 4.64, "recorded_at": ago(2)}))
+
+	b.assertLatest(t, 4.65, time.Now().Add(-time.Minute))
+}
+
+func TestStampsPingsWithoutRecordedAtOnArrival(t *testing.T) {
+	b := newBackend(t)
+
+	b.assertTracked(t, b.serve(t, body{"latitude": 4.65}))
+
+	b.assertLatest(t, 4.65, time.Now())
+}
+
+func TestBringsFixesFromTheFutureBackToNow(t *testing.T) {
+	b := newBackend(t)
+
+	b.assertTracked(t, b.serve(t, body{"latitude": 4.65, "recorded_at": ago(-30)}))
+
+	b.assertLatest(t, 4.65, time.Now())
+}
+
+func TestRefusesMalformedRecordedAt(t *testing.T) {
+	b := newBackend(t)
+
+	res := b.serve(t, body{"latitude": 4.65, "recorded_at": "yesterday"})
+
+	if res.StatusCode != http.StatusBadRequest || !strings.Contains(res.Body, `"field":"recorded_at"`) {
+		t.Fatalf("expected a 400 on recorded_at, got %v: %s", res.StatusCode, res.Body)
+	}
+}
+
+func (b backend) serve(t *testing.T, ping body) events.APIGatewayProxyResponse {
+	t.Helper()
+	req := body{"user_id": "g1", "route_id": "r1", "longitude": -74.0652}
+	for key, value := range ping {
+		req[key] = value
+	}
+	raw, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := b.handler(context.Background(), events.APIGatewayProxyRequest{
+		Headers: map[string]string{"Accept-Language": "en-US"},
+		Body:    string(raw),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func (b backend) assertTracked(t *testing.T, res events.APIGatewayProxyResponse) {
+	t.Helper()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %v: %s", res.StatusCode, res.Body)
+	}
+}
+
+// assertLatest checks the position households see, recorded within a few
+// seconds of recordedAt
+func (b backend) assertLatest(t *testing.T, latitude float64, recordedAt time.Time) {
+	t.Helper()
+	position, err := b.trackingRepo.Latest(context.Background(), "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position.Latitude != latitude {
+		t.Fatalf("expected the fix at %v, got %+v", latitude, position)
+	}
+	if d := position.RecordedAt.Sub(recordedAt); d < -5*time.Second || d > 5*time.Second {
+		t.Fatalf("expected the fix recorded at %v, got %v", recordedAt, position.RecordedAt)
+	}
+}
+
+// ago is the recorded_at of a fix taken minutes ago
+func ago(minutes int) string {
+	return time.Now().Add(-time.Duration(minutes) * time.Minute).Format(time.RFC3339)
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
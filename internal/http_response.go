@@ -2,8 +2,12 @@ package internal
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
 
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/xeipuuv/gojsonschema"
 )
@@ -18,25 +22,80 @@ func Respond(statusCode int, body string) events.APIGatewayProxyResponse {
 	}
 }
 
-func Error(statusCode int, err error) events.APIGatewayProxyResponse {
-	responseBytes, _ := json.Marshal(map[string]interface{}{
-		"errors": []string{err.Error()},
-	})
+// Fail answers with the status and code err maps to, see AsAPIError. When
+// the database throttled the request it tells when to retry on Retry-After
+func Fail(err error) events.APIGatewayProxyResponse {
+	apiErr := AsAPIError(err)
+	res := respondErrors(apiErr.Status, []*APIError{apiErr})
+	var throttled *repositories.ThrottledError
+	if errors.As(err, &throttled) {
+		seconds := int(math.Ceil(throttled.RetryAfter.Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		res = withHeader(res, "Retry-After", strconv.Itoa(seconds))
+	}
+	return res
+}
 
-	return Respond(statusCode, string(responseBytes))
+// Error answers with the given status regardless of the one err maps to,
+// errors unknown to the registry get a code named after the status
+func Error(statusCode int, err error) events.APIGatewayProxyResponse {
+	apiErr := AsAPIError(err)
+	if apiErr.Code == ErrInternal.Code {
+		c := *apiErr
+		c.Code = codeFor(statusCode)
+		apiErr = &c
+	}
+	return respondErrors(statusCode, []*APIError{apiErr})
 }
 
+// SchemaErrors answers with one invalid_field error per violation, the rule
+// broken and its parameters go in the details
 func SchemaErrors(statusCode int, schemaErrors []gojsonschema.ResultError) events.APIGatewayProxyResponse {
-	errors := []string{}
-
-	for _, error := range schemaErrors {
-		errString := fmt.Sprintf("%v", error)
-		errors = append(errors, errString)
+	errors := make([]*APIError, len(schemaErrors))
+	for i, schemaError := range schemaErrors {
+		details := map[string]interface{}{
+			"rule": schemaError.Type(),
+		}
+		for k, v := range schemaError.Details() {
+			if k != "field" && k != "context" {
+				details[k] = v
+			}
+		}
+		field := schemaError.Field()
+		if property, ok := schemaError.Details()["property"].(string); ok && schemaError.Type() == "required" {
+			field = strings.TrimPrefix(field+"."+property, gojsonschema.STRING_ROOT_SCHEMA_PROPERTY+".")
+		}
+		if field == gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+			field = ""
+		}
+		errors[i] = ErrInvalidField.WithField(field).WithDetails(details)
+		errors[i].Message = schemaError.Description()
 	}
+	return respondErrors(statusCode, errors)
+}
 
+func respondErrors(statusCode int, errors []*APIError) events.APIGatewayProxyResponse {
 	body, _ := json.Marshal(map[string]interface{}{
 		"errors": errors,
 	})
-
 	return Respond(statusCode, string(body))
 }
+
+// localizeErrors rewrites the messages of an errors body, any other body is
+// left as is
+func localizeErrors(res events.APIGatewayProxyResponse, locale *Locale) events.APIGatewayProxyResponse {
+	var body struct {
+		Errors []*APIError `json:"errors"`
+	}
+	if err := json.Unmarshal([]byte(res.Body), &body); err != nil || len(body.Errors) == 0 {
+		return res
+	}
+	for _, apiErr := range body.Errors {
+		apiErr.Message = locale.Message(apiErr)
+	}
+	localized, _ := json.Marshal(body)
+	res.Body = string(localized)
+	return res
+}
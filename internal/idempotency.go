@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// IdempotencyKeyHeader is sent by clients retrying a mutating request, a
+// retry with the same key gets the response of the first request replayed
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on replayed responses
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// IdempotencyTTL is how long responses are remembered, way longer than any
+// client keeps retrying
+const IdempotencyTTL = 24 * time.Hour
+
+// IdempotencyLease is how long a key is held while its request runs, a bit
+// longer than the 29 seconds API Gateway waits for a function. A request
+// that timed out or crashed without releasing its key frees it then
+const IdempotencyLease = 30 * time.Second
+
+// idempotencyWriteTimeout bounds releasing and completing keys, which is done
+// apart from the request context since it may be over by then
+const idempotencyWriteTimeout = 5 * time.Second
+
+// maxIdempotencyKeyLength fits a UUID with plenty of room for other formats
+const maxIdempotencyKeyLength = 255
+
+var ErrIdempotencyKeyReused = NewError(http.StatusUnprocessableEntity, "idempotency_key_reused", "idempotency key was already used with a different request")
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, key string, requestHash string, lease time.Duration) (repositories.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, record repositories.IdempotencyRecord, ttl time.Duration) error
+	Release(ctx context.Context, key string) error
+}
+
+// Idempotent makes the request safe to retry when it carries an
+// Idempotency-Key: the first request with a key runs and its response is
+// stored, later ones replay it. A key reused with another method, path or
+// body is rejected with a 422, and one whose request is still running with a
+// 409. Server errors are not stored so the request can be retried for real
+func Idempotent(repo IdempotencyRepository) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			key := header(req, IdempotencyKeyHeader)
+			if key == "" {
+				return next(ctx, req)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return Fail(ErrInvalidField.WithField(IdempotencyKeyHeader)), nil
+			}
+
+			hash := requestHash(req)
+			record, reserved, err := repo.Reserve(ctx, key, hash, IdempotencyLease)
+			if err != nil {
+				return Fail(err), nil
+			}
+			if !reserved {
+				switch {
+				case record.RequestHash != hash:
+					return Fail(ErrIdempotencyKeyReused), nil
+				case !record.Completed:
+					return Fail(repositories.ErrIdempotencyKeyInUse), nil
+				}
+				log.Printf("replaying the response of idempotency key (%s)\n", key)
+				return replay(record), nil
+			}
+
+			res, err := next(ctx, req)
+			writeCtx, cancel := context.WithTimeout(context.Background(), idempotencyWriteTimeout)
+			defer cancel()
+			if err != nil || res.StatusCode >= http.StatusInternalServerError {
+				if releaseErr := repo.Release(writeCtx, key); releaseErr != nil {
+					log.Printf("could not release idempotency key (%s): %v\n", key, releaseErr)
+				}
+				return res, err
+			}
+
+			record.StatusCode = res.StatusCode
+			record.Headers = res.Headers
+			record.Body = res.Body
+			if err := repo.Complete(writeCtx, record, IdempotencyTTL); err != nil {
+				// the request did happen, a retry will be answered with a 409
+				// until the lease ends and then run again
+				log.Printf("could not store the response of idempotency key (%s): %v\n", key, err)
+			}
+			return res, nil
+		}
+	}
+}
+
+// requestHash tells apart the requests made with the same key
+func requestHash(req events.APIGatewayProxyRequest) string {
+	sum := sha256.Sum256([]byte(req.HTTPMethod + "\n" + req.Path + "\n" + req.Body))
+	return hex.EncodeToString(sum[:])
+}
+
+func replay(record repositories.IdempotencyRecord) events.APIGatewayProxyResponse {
+	headers := make(map[string]string, len(record.Headers)+1)
+	for name, value := range record.Headers {
+		headers[name] = value
+	}
+	headers[IdempotentReplayedHeader] = "true"
+	return events.APIGatewayProxyResponse{
+		StatusCode: record.StatusCode,
+		Headers:    headers,
+		Body:       record.Body,
+	}
+}
@@ -0,0 +1,157 @@
+package internal_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// countingHandler answers with the statuses in turn and counts the calls
+func countingHandler(calls *int, statuses ...int) internal.Handler {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		status := statuses[*calls]
+		*calls++
+		return internal.Respond(status, `{"call":`+strconv.Itoa(*calls)+`}`), nil
+	}
+}
+
+// contextBoundRepository refuses to write with a context that is over, the
+// way the DynamoDB client does
+type contextBoundRepository struct {
+	*repositories.InMemoryIdempotencyRepository
+}
+
+func (r contextBoundRepository) Complete(ctx context.Context, record repositories.IdempotencyRecord, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.InMemoryIdempotencyRepository.Complete(ctx, record, ttl)
+}
+
+func (r contextBoundRepository) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.InMemoryIdempotencyRepository.Release(ctx, key)
+}
+
+func newIdempotencyRepository(t *testing.T) *repositories.InMemoryIdempotencyRepository {
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repositories.NewInMemoryIdempotencyRepository(timeHelper)
+}
+
+func idempotentRequest(key string, body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod: http.MethodPut,
+		Path:       "/assign-picking-route/v1",
+		Headers:    map[string]string{"idempotency-key": key},
+		Body:       body,
+	}
+}
+
+func TestIdempotentReplaysTheResponse(t *testing.T) {
+	calls := 0
+	handler := internal.Standard(internal.Idempotent(newIdempotencyRepository(t)))(countingHandler(&calls, http.StatusOK))
+
+	first, _ := handler(context.Background(), idempotentRequest("k1", `{"route_id":"r1"}`))
+	retry, _ := handler(context.Background(), idempotentRequest("k1", `{"route_id":"r1"}`))
+
+	if calls != 1 {
+		t.Fatalf("expected the handler to run once, ran %v times", calls)
+	}
+	if retry.StatusCode != first.StatusCode || retry.Body != first.Body {
+		t.Fatalf("expected %v %s replayed, got %v %s", first.StatusCode, first.Body, retry.StatusCode, retry.Body)
+	}
+	if retry.Headers[internal.IdempotentReplayedHeader] != "true" || first.Headers[internal.IdempotentReplayedHeader] != "" {
+		t.Fatalf("expected only the retry to be marked as replayed")
+	}
+}
+
+func TestIdempotentRejectsReusedKeys(t *testing.T) {
+	calls := 0
+	handler := internal.Standard(internal.Idempotent(newIdempotencyRepository(t)))(countingHandler(&calls, http.StatusOK, http.StatusOK))
+
+	handler(context.Background(), idempotentRequest("k1", `{"route_id":"r1"}`))
+	res, _ := handler(context.Background(), idempotentRequest("k1", `{"route_id":"r2"}`))
+
+	if res.StatusCode != http.StatusUnprocessableEntity || decodeErrors(t, res).Errors[0].Code != "idempotency_key_reused" {
+		t.Fatalf("expected a 422 idempotency_key_reused, got %v %s", res.StatusCode, res.Body)
+	}
+	if calls != 1 {
+		t.Fatalf("expected the handler to run once, ran %v times", calls)
+	}
+}
+
+func TestIdempotentRejectsKeysInProgress(t *testing.T) {
+	repo := newIdempotencyRepository(t)
+	calls := 0
+	handler := internal.Standard(internal.Idempotent(repo))(countingHandler(&calls, http.StatusOK))
+
+	var res events.APIGatewayProxyResponse
+	inner := internal.Idempotent(repo)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		res, _ = handler(ctx, req)
+		return internal.Respond(http.StatusOK, ""), nil
+	})
+	inner(context.Background(), idempotentRequest("k1", `{}`))
+
+	if res.StatusCode != http.StatusConflict || decodeErrors(t, res).Errors[0].Code != "idempotency_key_in_use" {
+		t.Fatalf("expected a 409 idempotency_key_in_use, got %v %s", res.StatusCode, res.Body)
+	}
+}
+
+func TestIdempotentDoesNotKeepServerErrors(t *testing.T) {
+	calls := 0
+	handler := internal.Standard(internal.Idempotent(newIdempotencyRepository(t)))(countingHandler(&calls, http.StatusServiceUnavailable, http.StatusOK))
+
+	handler(context.Background(), idempotentRequest("k1", `{}`))
+	res, _ := handler(context.Background(), idempotentRequest("k1", `{}`))
+
+	if calls != 2 || res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the retry to run, got %v calls and a %v", calls, res.StatusCode)
+	}
+}
+
+func TestIdempotentSettlesKeysAfterTheRequestContextIsOver(t *testing.T) {
+	repo := contextBoundRepository{newIdempotencyRepository(t)}
+	calls := 0
+	handler := internal.Standard(internal.Idempotent(repo))(countingHandler(&calls, http.StatusGatewayTimeout, http.StatusOK, http.StatusOK))
+	// the function ran out of time while handling the request
+	timedOut := func() context.Context {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return ctx
+	}
+
+	handler(timedOut(), idempotentRequest("k1", `{}`))
+	res, _ := handler(context.Background(), idempotentRequest("k1", `{}`))
+	if calls != 2 || res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the key released for the retry, got %v calls and a %v", calls, res.StatusCode)
+	}
+
+	handler(timedOut(), idempotentRequest("k2", `{}`))
+	res, _ = handler(context.Background(), idempotentRequest("k2", `{}`))
+	if calls != 3 || res.Headers[internal.IdempotentReplayedHeader] != "true" {
+		t.Fatalf("expected the response stored and replayed, got %v calls and %v %s", calls, res.StatusCode, res.Body)
+	}
+}
+
+func TestIdempotentIgnoresRequestsWithoutKey(t *testing.T) {
+	calls := 0
+	handler := internal.Standard(internal.Idempotent(newIdempotencyRepository(t)))(countingHandler(&calls, http.StatusOK, http.StatusOK))
+
+	handler(context.Background(), idempotentRequest("", `{}`))
+	handler(context.Background(), idempotentRequest("", `{}`))
+
+	if calls != 2 {
+		t.Fatalf("expected the handler to run twice, ran %v times", calls)
+	}
+}
@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale holds what is needed to talk to a user in their language: how dates
+// are written and the error messages by code. Codes missing from messages
+// keep the English message they were declared with
+type Locale struct {
+	Tag     string
+	Country string
+
+	months [12]string
+	days   [7]string
+	// datePattern receives the weekday, the day of the month and the month,
+	// in that order
+	datePattern string
+	messages    map[string]string
+}
+
+var spanishMonths = [12]string{
+	"Enero", "Febrero", "Marzo", "Abril", "Mayo", "Junio",
+	"Julio", "Agosto", "Septiembre", "Octubre", "Noviembre", "Diciembre",
+}
+
+var spanishDays = [7]string{
+	"Domingo", "Lunes", "Martes", "Miércoles", "Jueves", "Viernes", "Sábado",
+}
+
+var spanishMessages = map[string]string{
+	"internal_error":                "error interno",
+	"body_too_large":                "el cuerpo de la solicitud es demasiado grande",
+	"malformed_body":                "el cuerpo de la solicitud no es un JSON válido",
+	"invalid_field":                 "el campo {field} no es válido",
+	"invalid_cursor":                "el cursor no es válido",
+	"throttled":                     "el servicio está ocupado, intenta de nuevo más tarde",
+	"idempotency_key_in_use":        "una solicitud con la misma clave de idempotencia está en curso",
+	"idempotency_key_reused":        "la clave de idempotencia ya fue usada con otra solicitud",
+	"user_id_empty":                 "user_id no puede estar vacío",
+	"user_not_found":                "usuario no encontrado",
+	"route_not_found":               "ruta no encontrada",
+	"location_not_found":            "ubicación no encontrada",
+	"no_locations_found":            "no se encontraron ubicaciones",
+	"no_assigned_routes":            "no hay rutas asignadas",
+	"no_open_shifts":                "no hay turnos abiertos",
+	"picking_point_not_found":       "punto de recolección no encontrado",
+	"route_already_assigned":        "la ruta ya fue asignada",
+	"picking_point_already_pinned":  "la ubicación ya está en la ruta",
+	"pickup_code_already_used":      "el código de recolección ya fue usado",
+	"route_not_assignable":          "la ruta no se puede asignar",
+	"route_not_assigned":            "la ruta no está asignada",
+	"wrong_user_type":               "el usuario debe ser recolector",
+	"wrong_gatherer_id":             "la ruta está asignada a otro recolector",
+	"picking_point_not_in_route":    "el punto de recolección no existe en la ruta",
+	"quantity_material_not_allowed": "una o más cantidades tienen un material que no fue marcado en el punto de recolección",
+	"position_empty":                "la posición no puede estar vacía",
+	"outside_geofence":              "el recolector está demasiado lejos del punto de recolección",
+	"pickup_code_mismatch":          "el código de recolección no coincide",
+	"pickup_code_not_found":         "el punto de recolección no tiene código de recolección",
+	"wrong_location_owner":          "el punto de recolección pertenece a una ubicación de otro usuario",
+	"shift_not_found":               "turno no encontrado",
+	"material_not_allowed":          "uno o más materiales no están permitidos",
+	"shift_closed":                  "el turno está cerrado y no recibe más puntos de recolección",
+	"not_allowed_to_attach":         "solo el recolector asignado o el dueño de la ubicación pueden adjuntar fotos",
+	"invalid_photo_key":             "la clave no fue emitida para este punto de recolección, tipo de foto y tipo de contenido",
+	"photo_not_uploaded":            "aún no se ha subido nada con la clave dada",
+	"route_not_initiated":           "la ruta no ha sido iniciada",
+	"tracking_not_allowed":          "la ubicación del recolector solo se comparte mientras la ruta va hacia el punto de recolección",
+	"no_gatherer_position":          "no hay una ubicación reciente del recolector",
+	"area_too_large":                "el área de búsqueda es demasiado grande",
+	"sector_not_found":              "la ubicación no está dentro de ningún sector",
+}
+
+var LocaleEsCO = &Locale{
+	Tag:         "es-CO",
+	Country:     "CO",
+	months:      spanishMonths,
+	days:        spanishDays,
+	datePattern: "%[1]s %[2]d de %[3]s",
+	messages:    spanishMessages,
+}
+
+var LocaleEsMX = &Locale{
+	Tag:         "es-MX",
+	Country:     "MX",
+	months:      spanishMonths,
+	days:        spanishDays,
+	datePattern: "%[1]s %[2]d de %[3]s",
+	messages:    spanishMessages,
+}
+
+var LocalePtBR = &Locale{
+	Tag:     "pt-BR",
+	Country: "BR",
+	months: [12]string{
+		"Janeiro", "Fevereiro", "Março", "Abril", "Maio", "Junho",
+		"Julho", "Agosto", "Setembro", "Outubro", "Novembro", "Dezembro",
+	},
+	days: [7]string{
+		"Domingo", "Segunda-feira", "Terça-feira", "Quarta-feira", "Quinta-feira", "Sexta-feira", "Sábado",
+	},
+	datePattern: "%[1]s, %[2]d de %[3]s",
+	messages: map[string]string{
+		"internal_error":                "erro interno",
+		"body_too_large":                "o corpo da requisição é grande demais",
+		"malformed_body":                "o corpo da requisição não é um JSON válido",
+		"invalid_field":                 "o campo {field} não é válido",
+		"invalid_cursor":                "o cursor não é válido",
+		"throttled":                     "o serviço está ocupado, tente novamente mais tarde",
+		"idempotency_key_in_use":        "uma requisição com a mesma chave de idempotência está em andamento",
+		"idempotency_key_reused":        "a chave de idempotência já foi usada com outra requisição",
+		"user_id_empty":                 "user_id não pode estar vazio",
+		"user_not_found":                "usuário não encontrado",
+		"route_not_found":               "rota não encontrada",
+		"location_not_found":            "endereço não encontrado",
+		"no_locations_found":            "nenhum endereço encontrado",
+		"no_assigned_routes":            "não há rotas atribuídas",
+		"no_open_shifts":                "não há turnos abertos",
+		"picking_point_not_found":       "ponto de coleta não encontrado",
+		"route_already_assigned":        "a rota já foi atribuída",
+		"picking_point_already_pinned":  "o endereço já está na rota",
+		"pickup_code_already_used":      "o código de coleta já foi usado",
+		"route_not_assignable":          "a rota não pode ser atribuída",
+		"route_not_assigned":            "a rota não está atribuída",
+		"wrong_user_type":               "o usuário deve ser um coletor",
+		"wrong_gatherer_id":             "a rota está atribuída a outro coletor",
+		"picking_point_not_in_route":    "o ponto de coleta não existe na rota",
+		"quantity_material_not_allowed": "uma ou mais quantidades têm um material não marcado no ponto de coleta",
+		"position_empty":                "a posição não pode estar vazia",
+		"outside_geofence":              "o coletor está longe demais do ponto de coleta",
+		"pickup_code_mismatch":          "o código de coleta não confere",
+		"pickup_code_not_found":         "o ponto de coleta não tem código de coleta",
+		"wrong_location_owner":          "o ponto de coleta pertence a um endereço de outro usuário",
+		"shift_not_found":               "turno não encontrado",
+		"material_not_allowed":          "um ou mais materiais não são permitidos",
+		"shift_closed":                  "o turno está fechado e não recebe mais pontos de coleta",
+		"not_allowed_to_attach":         "somente o coletor atribuído ou o dono do endereço podem anexar fotos",
+		"invalid_photo_key":             "a chave não foi emitida para este ponto de coleta, tipo de foto e tipo de conteúdo",
+		"photo_not_uploaded":            "ainda não foi enviado nada com a chave informada",
+		"route_not_initiated":           "a rota não foi iniciada",
+		"tracking_not_allowed":          "a localização do coletor só é compartilhada enquanto a rota vai até o ponto de coleta",
+		"no_gatherer_position":          "não há uma localização recente do coletor",
+		"area_too_large":                "a área de busca é grande demais",
+		"sector_not_found":              "o endereço não está dentro de nenhum setor",
+	},
+}
+
+var LocaleEnUS = &Locale{
+	Tag:     "en-US",
+	Country: "US",
+	months: [12]string{
+		"January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December",
+	},
+	days: [7]string{
+		"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday",
+	},
+	datePattern: "%[1]s, %[3]s %[2]d",
+}
+
+// DefaultLocale is used when neither the request nor the user tell which one
+// to use, the app launched in Colombia
+var DefaultLocale = LocaleEsCO
+
+// Locales are the supported locales, the first one of each language is the
+// one picked when only the language is requested
+var Locales = []*Locale{LocaleEsCO, LocaleEsMX, LocalePtBR, LocaleEnUS}
+
+// FormatDate writes d, already in the timezone it is shown in, e.g.
+// "Lunes 5 de Octubre"
+func (l *Locale) FormatDate(d time.Time) string {
+	return fmt.Sprintf(l.datePattern, l.days[d.Weekday()], d.Day(), l.months[d.Month()-1])
+}
+
+// Message is the localized message for err, falling back to its own
+func (l *Locale) Message(err *APIError) string {
+	message, ok := l.messages[err.Code]
+	if !ok || (strings.Contains(message, "{field}") && err.Field == "") {
+		return err.Message
+	}
+	return strings.ReplaceAll(message, "{field}", err.Field)
+}
+
+func (l *Locale) language() string {
+	return strings.SplitN(l.Tag, "-", 2)[0]
+}
+
+// ResolveLocale picks the locale from the Accept-Language header, honoring
+// its weights, then from the user country. A bare language, like "es",
+// resolves to the user country variant when there is one
+func ResolveLocale(acceptLanguage string, country string) *Locale {
+	byCountry := localeForCountry(country)
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		for _, l := range Locales {
+			if strings.EqualFold(l.Tag, tag) {
+				return l
+			}
+		}
+		language := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if byCountry != nil && byCountry.language() == language {
+			return byCountry
+		}
+		for _, l := range Locales {
+			if l.language() == language {
+				return l
+			}
+		}
+	}
+	if byCountry != nil {
+		return byCountry
+	}
+	return DefaultLocale
+}
+
+func localeForCountry(country string) *Locale {
+	for _, l := range Locales {
+		if strings.EqualFold(l.Country, country) {
+			return l
+		}
+	}
+	return nil
+}
+
+// parseAcceptLanguage returns the tags by descending weight, dropping the
+// wildcard and the ones weighted 0
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
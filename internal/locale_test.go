@@ -0,0 +1,90 @@
+package internal_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestResolveLocale(t *testing.T) {
+	cases := []struct {
+		acceptLanguage string
+		country        string
+		tag            string
+	}{
+		{"", "", "es-CO"},
+		{"", "BR", "pt-BR"},
+		{"en-US,en;q=0.9", "CO", "en-US"},
+		{"fr-FR, pt;q=0.8, en;q=0.9", "", "en-US"},
+		{"es", "MX", "es-MX"},
+		{"es", "BR", "es-CO"},
+		{"pt-PT", "", "pt-BR"},
+		{"fr, *;q=0.5", "MX", "es-MX"},
+		{"en;q=0", "US", "en-US"},
+	}
+	for _, c := range cases {
+		if l := internal.ResolveLocale(c.acceptLanguage, c.country); l.Tag != c.tag {
+			t.Errorf("%q from %q: expected %s, got %s", c.acceptLanguage, c.country, c.tag, l.Tag)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	d := time.Date(2020, time.October, 5, 8, 0, 0, 0, time.UTC)
+	expected := map[*internal.Locale]string{
+		internal.LocaleEsCO: "Lunes 5 de Octubre",
+		internal.LocaleEsMX: "Lunes 5 de Octubre",
+		internal.LocalePtBR: "Segunda-feira, 5 de Outubro",
+		internal.LocaleEnUS: "Monday, October 5",
+	}
+	for locale, formatted := range expected {
+		if got := locale.FormatDate(d); got != formatted {
+			t.Errorf("%s: expected %q, got %q", locale.Tag, formatted, got)
+		}
+	}
+}
+
+func TestLocalizeTranslatesErrors(t *testing.T) {
+	ctx := context.Background()
+	usersRepo := repositories.NewInMemoryUsersRepository()
+	usersRepo.Save(ctx, models.User{ID: "u1", Username: "u1", Type: models.UserTypeUser, Country: "BR"})
+
+	handler := internal.Standard(
+		internal.Authenticate(usersRepo, internal.UserIDFromPath("user_id")),
+	)(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return internal.Fail(repositories.ErrRouteNotFound), nil
+	})
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		userID  string
+		tag     string
+		message string
+	}{
+		{"Default", nil, "missing", "es-CO", "usuario no encontrado"},
+		{"AcceptLanguage", map[string]string{"accept-language": "en-US"}, "missing", "en-US", repositories.ErrUserNotFound.Error()},
+		{"UserCountry", nil, "u1", "pt-BR", "rota não encontrada"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+				Headers:        c.headers,
+				PathParameters: map[string]string{"user_id": c.userID},
+			})
+			if res.StatusCode != http.StatusNotFound || res.Headers["Content-Language"] != c.tag {
+				t.Fatalf("expected a 404 in %s, got %v in %q", c.tag, res.StatusCode, res.Headers["Content-Language"])
+			}
+			body := decodeErrors(t, res)
+			if body.Errors[0].Message != c.message {
+				t.Fatalf("expected %q, got %q", c.message, body.Errors[0].Message)
+			}
+		})
+	}
+}
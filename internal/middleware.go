@@ -0,0 +1,315 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/aws/aws-lambda-go/events"
+	uuid "github.com/satori/go.uuid"
+)
+
+// DefaultMaxBodyBytes is the body size limit applied by Standard, picking
+// points requests are the largest ones and stay way below it
+const DefaultMaxBodyBytes = 64 * 1024
+
+// RequestIDHeader is read from the request, when the client sends it, and
+// always set on the response
+const RequestIDHeader = "X-Request-Id"
+
+type Handler func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+type Middleware func(next Handler) Handler
+
+// Validator is implemented by the request structs with required fields, the
+// error is returned to the client with a 400 status
+type Validator interface {
+	Validate() error
+}
+
+// AuthenticatedRequest is implemented by the request structs carrying the
+// id of the user making the request
+type AuthenticatedRequest interface {
+	AuthUserID() string
+}
+
+// UserIDExtractor tells Authenticate where the user id is on the request
+type UserIDExtractor func(ctx context.Context, req events.APIGatewayProxyRequest) string
+
+type UsersRepository interface {
+	Find(ctx context.Context, userID string) (models.User, error)
+}
+
+type contextKey int
+
+const (
+	requestStateKey contextKey = iota
+	bodyKey
+	userKey
+	pageKey
+)
+
+// requestState is shared by pointer so the outer middlewares, like the access
+// log, can read what the inner ones found out
+type requestState struct {
+	id             string
+	userID         string
+	acceptLanguage string
+	country        string
+}
+
+// Chain composes the middlewares, the first one being the outermost
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// Standard is the chain every adapter starts with: requests are identified
+// and logged, errors are localized, panics are recovered, and bodies are size
+// limited. The given middlewares run after those
+func Standard(middlewares ...Middleware) Middleware {
+	return Chain(append([]Middleware{
+		RequestID(),
+		AccessLog(),
+		Localize(),
+		Recover(),
+		BodyLimit(DefaultMaxBodyBytes),
+	}, middlewares...)...)
+}
+
+// Recover turns a panic on the handler into a 500 response, logging the stack
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (res events.APIGatewayProxyResponse, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("panic serving %s %s (%s): %v\n%s", req.HTTPMethod, req.Path, RequestIDFrom(ctx), r, debug.Stack())
+					res = Fail(ErrInternal)
+					err = nil
+				}
+			}()
+			return next(ctx, req)
+		}
+	}
+}
+
+// RequestID propagates the X-Request-Id sent by the client, or the API
+// Gateway request id, generating one when there is none
+func RequestID() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			id := header(req, RequestIDHeader)
+			if id == "" {
+				id = req.RequestContext.RequestID
+			}
+			if id == "" {
+				id = uuid.NewV4().String()
+			}
+			ctx = context.WithValue(ctx, requestStateKey, &requestState{id: id})
+
+			res, err := next(ctx, req)
+			return withRequestID(ctx, res), err
+		}
+	}
+}
+
+func RequestIDFrom(ctx context.Context) string {
+	if state, ok := ctx.Value(requestStateKey).(*requestState); ok {
+		return state.id
+	}
+	return ""
+}
+
+// AccessLog writes a JSON line per request once it is served
+func AccessLog() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			start := time.Now()
+			res, err := next(ctx, req)
+
+			entry := map[string]interface{}{
+				"request_id":  RequestIDFrom(ctx),
+				"method":      req.HTTPMethod,
+				"path":        req.Path,
+				"status":      res.StatusCode,
+				"duration_ms": time.Since(start).Milliseconds(),
+				"body_bytes":  len(req.Body),
+			}
+			if state, ok := ctx.Value(requestStateKey).(*requestState); ok && state.userID != "" {
+				entry["user_id"] = state.userID
+			}
+			if err != nil {
+				entry["error"] = err.Error()
+			}
+			line, _ := json.Marshal(entry)
+			log.Println(string(line))
+			return res, err
+		}
+	}
+}
+
+// Localize resolves the locale of the request, see LocaleFrom, and translates
+// the messages of the errors answered by the next handlers. The locale used
+// is set as the Content-Language of the response
+func Localize() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			state, ok := ctx.Value(requestStateKey).(*requestState)
+			if !ok {
+				state = &requestState{}
+				ctx = context.WithValue(ctx, requestStateKey, state)
+			}
+			state.acceptLanguage = header(req, "Accept-Language")
+
+			res, err := next(ctx, req)
+			locale := LocaleFrom(ctx)
+			if res.StatusCode >= http.StatusBadRequest {
+				res = localizeErrors(res, locale)
+			}
+			return withHeader(res, "Content-Language", locale.Tag), err
+		}
+	}
+}
+
+// LocaleFrom resolves the locale from the Accept-Language header and, once
+// Authenticate ran, the user country
+func LocaleFrom(ctx context.Context) *Locale {
+	if state, ok := ctx.Value(requestStateKey).(*requestState); ok {
+		return ResolveLocale(state.acceptLanguage, state.country)
+	}
+	return DefaultLocale
+}
+
+// BodyLimit rejects bodies larger than maxBytes with a 413
+func BodyLimit(maxBytes int) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			if len(req.Body) > maxBytes {
+				return Fail(ErrBodyTooLarge), nil
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// DecodeJSON unmarshals the body into the struct returned by newRequest,
+// which must be a pointer, and validates it when it implements Validator.
+// Handlers read it back with Body
+func DecodeJSON(newRequest func() interface{}) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			body := newRequest()
+			if err := json.Unmarshal([]byte(req.Body), body); err != nil {
+				return Fail(malformedBody(err)), nil
+			}
+			if validator, ok := body.(Validator); ok {
+				if err := validator.Validate(); err != nil {
+					return Error(http.StatusBadRequest, err), nil
+				}
+			}
+			return next(context.WithValue(ctx, bodyKey, body), req)
+		}
+	}
+}
+
+// Body returns the request decoded by DecodeJSON
+func Body(ctx context.Context) interface{} {
+	return ctx.Value(bodyKey)
+}
+
+// Authenticate looks up the user making the request and injects it into the
+// context, answering 404 when it does not exist. Handlers read it back with
+// UserFrom
+func Authenticate(usersRepo UsersRepository, userID UserIDExtractor) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			id := userID(ctx, req)
+			if id == "" {
+				return Fail(ErrUserIDEmpty), nil
+			}
+			user, err := usersRepo.Find(ctx, id)
+			if err != nil {
+				return Fail(err), nil
+			}
+			if state, ok := ctx.Value(requestStateKey).(*requestState); ok {
+				state.userID = user.ID
+				state.country = user.Country
+			}
+			return next(context.WithValue(ctx, userKey, user), req)
+		}
+	}
+}
+
+// UserIDFromPath reads the user id from a path parameter
+func UserIDFromPath(name string) UserIDExtractor {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) string {
+		return req.PathParameters[name]
+	}
+}
+
+// UserIDFromBody reads the user id from the request decoded by DecodeJSON
+func UserIDFromBody(ctx context.Context, req events.APIGatewayProxyRequest) string {
+	if body, ok := Body(ctx).(AuthenticatedRequest); ok {
+		return body.AuthUserID()
+	}
+	return ""
+}
+
+// RequireUserType answers 403 with err when the authenticated user is not of
+// the given type
+func RequireUserType(userType string, err error) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			if UserFrom(ctx).Type != userType {
+				return Error(http.StatusForbidden, err), nil
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// UserFrom returns the user injected by Authenticate
+func UserFrom(ctx context.Context) models.User {
+	user, _ := ctx.Value(userKey).(models.User)
+	return user
+}
+
+func withRequestID(ctx context.Context, res events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	id := RequestIDFrom(ctx)
+	if id == "" {
+		return res
+	}
+	return withHeader(res, RequestIDHeader, id)
+}
+
+// withHeader copies the headers, responses may share the map they were
+// built with
+func withHeader(res events.APIGatewayProxyResponse, name string, value string) events.APIGatewayProxyResponse {
+	headers := make(map[string]string, len(res.Headers)+1)
+	for k, v := range res.Headers {
+		headers[k] = v
+	}
+	headers[name] = value
+	res.Headers = headers
+	return res
+}
+
+// header looks the name up case-insensitively, API Gateway keeps the casing
+// sent by the client
+func header(req events.APIGatewayProxyRequest, name string) string {
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
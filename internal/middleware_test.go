@@ -0,0 +1,140 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var errNotGatherer = errors.New("not a gatherer")
+
+type request struct {
+	UserID string `json:"user_id"`
+}
+
+func (r *request) Validate() error {
+	if r.UserID == "" {
+		return internal.ErrUserIDEmpty
+	}
+	return nil
+}
+
+func (r *request) AuthUserID() string {
+	return r.UserID
+}
+
+func ok(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return internal.Respond(http.StatusOK, internal.UserFrom(ctx).ID), nil
+}
+
+func TestStandardRecoversFromPanic(t *testing.T) {
+	handler := internal.Standard()(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		panic("boom")
+	})
+
+	res, err := handler(context.Background(), events.APIGatewayProxyRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %v", res.StatusCode)
+	}
+	if res.Headers[internal.RequestIDHeader] == "" {
+		t.Fatalf("expected a request id on the response")
+	}
+}
+
+func TestStandardPropagatesRequestID(t *testing.T) {
+	var seen string
+	handler := internal.Standard()(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		seen = internal.RequestIDFrom(ctx)
+		return internal.Respond(http.StatusOK, ""), nil
+	})
+
+	res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+		Headers: map[string]string{"x-request-id": "req-1"},
+	})
+	if seen != "req-1" || res.Headers[internal.RequestIDHeader] != "req-1" {
+		t.Fatalf("expected req-1 on the context and response, got %q and %q", seen, res.Headers[internal.RequestIDHeader])
+	}
+}
+
+func TestStandardLimitsBodySize(t *testing.T) {
+	handler := internal.Standard()(ok)
+
+	res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+		Body: strings.Repeat("a", internal.DefaultMaxBodyBytes+1),
+	})
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status 413, got %v", res.StatusCode)
+	}
+}
+
+func TestAuthenticateFromBody(t *testing.T) {
+	ctx := context.Background()
+	usersRepo := repositories.NewInMemoryUsersRepository()
+	usersRepo.Save(ctx, models.User{ID: "g1", Username: "g1", Type: models.UserTypeGatherer})
+	usersRepo.Save(ctx, models.User{ID: "u1", Username: "u1", Type: models.UserTypeUser})
+
+	handler := internal.Standard(
+		internal.DecodeJSON(func() interface{} { return &request{} }),
+		internal.Authenticate(usersRepo, internal.UserIDFromBody),
+		internal.RequireUserType(models.UserTypeGatherer, errNotGatherer),
+	)(ok)
+
+	cases := []struct {
+		name    string
+		body    string
+		status  int
+		resBody string
+	}{
+		{"MalformedBody", `{`, http.StatusBadRequest, ""},
+		{"FailedValidation", `{}`, http.StatusBadRequest, internal.ErrUserIDEmpty.Code},
+		{"UnknownUser", `{"user_id":"missing"}`, http.StatusNotFound, `"user_not_found"`},
+		{"WrongUserType", `{"user_id":"u1"}`, http.StatusForbidden, errNotGatherer.Error()},
+		{"Gatherer", `{"user_id":"g1"}`, http.StatusOK, "g1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := handler(context.Background(), events.APIGatewayProxyRequest{Body: c.body})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.StatusCode != c.status {
+				t.Fatalf("expected status %v, got %v (%s)", c.status, res.StatusCode, res.Body)
+			}
+			if !strings.Contains(res.Body, c.resBody) {
+				t.Fatalf("expected %q in body, got %s", c.resBody, res.Body)
+			}
+		})
+	}
+}
+
+func TestAuthenticateFromPath(t *testing.T) {
+	ctx := context.Background()
+	usersRepo := repositories.NewInMemoryUsersRepository()
+	usersRepo.Save(ctx, models.User{ID: "u1", Username: "u1", Type: models.UserTypeUser})
+
+	handler := internal.Standard(
+		internal.Authenticate(usersRepo, internal.UserIDFromPath("user_id")),
+	)(ok)
+
+	res, _ := handler(context.Background(), events.APIGatewayProxyRequest{})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without user_id, got %v", res.StatusCode)
+	}
+
+	res, _ = handler(context.Background(), events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"user_id": "u1"},
+	})
+	if res.StatusCode != http.StatusOK || res.Body != "u1" {
+		t.Fatalf("expected u1 to be authenticated, got %v (%s)", res.StatusCode, res.Body)
+	}
+}
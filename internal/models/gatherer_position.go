@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// GathererPosition is the last GPS ping of a gatherer working an initiated
+// route, shown to the households waiting on it
+type GathererPosition struct {
+	RouteID    string    `json:"route_id"`
+	GathererID string    `json:"gatherer_id"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Accuracy   float64   `json:"accuracy"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
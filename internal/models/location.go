@@ -1,16 +1,29 @@
 package models
 
+import "time"
+
 type Location struct {
-	ID        string  `json:"id"`
-	CreatedBy string  `json:"created_by"`
-	Balance   float64 `json:"balance"`
-	Name      string  `json:"name"`
-	Country   string  `json:"country"`
-	City      string  `json:"city"`
-	State     string  `json:"state"`
-	Score     int     `json:"score"`
-	Address1  string  `json:"address1"`
-	Address2  string  `json:"address2"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
+	ID                 string              `json:"id"`
+	CreatedBy          string              `json:"created_by"`
+	Balance            float64             `json:"balance"`
+	Name               string              `json:"name"`
+	Country            string              `json:"country"`
+	City               string              `json:"city"`
+	State              string              `json:"state"`
+	Score              int                 `json:"score"`
+	Address1           string              `json:"address1"`
+	Address2           string              `json:"address2"`
+	Latitude           float64             `json:"latitude"`
+	Longitude          float64             `json:"longitude"`
+	Timezone           string              `json:"timezone,omitempty"`
+	BalanceAdjustments []BalanceAdjustment `json:"balance_adjustments,omitempty"`
+}
+
+// BalanceAdjustment is a manual change of a location balance, made by a
+// coordinator outside of the picking flow
+type BalanceAdjustment struct {
+	Amount    float64    `json:"amount"`
+	Reason    string     `json:"reason"`
+	CreatedBy string     `json:"created_by"`
+	Created   *time.Time `json:"created"`
 }
@@ -15,8 +15,73 @@ const (
 	RouteStatusInitiated = "initiated" // Shows up only to the assigned gatherer when it's been initiated
 	RouteStatusFinished  = "finished"  // Gatherer has finished all the picking points
 	RouteStatusCancelled = "cancelled" // to be defined
+
+	FailureReasonNobodyHome    = "nobody_home"
+	FailureReasonWrongMaterial = "wrong_material"
+	FailureReasonContaminated  = "contaminated"
+	FailureReasonUnsafeAccess  = "unsafe_access"
+
+	PhotoKindBefore        = "before"
+	PhotoKindAfter         = "after"
+	PhotoKindContamination = "contamination"
+
+	UnitKilograms = "kg"
+	UnitUnits     = "units"
 )
 
+var Materials = []string{
+	MaterialPlastic,
+	MaterialMetal,
+	MaterialGlass,
+	MaterialPaper,
+	MaterialTechnology,
+}
+
+var Units = []string{
+	UnitKilograms,
+	UnitUnits,
+}
+
+var FailureReasons = []string{
+	FailureReasonNobodyHome,
+	FailureReasonWrongMaterial,
+	FailureReasonContaminated,
+	FailureReasonUnsafeAccess,
+}
+
+var PhotoKinds = []string{
+	PhotoKindBefore,
+	PhotoKindAfter,
+	PhotoKindContamination,
+}
+
+// MaxQuantityAmount bounds a single recorded quantity, in either unit, well
+// above anything a household hands over at once
+const MaxQuantityAmount = 1000
+
+type MaterialQuantity struct {
+	Material string  `json:"material"`
+	Amount   float64 `json:"amount"`
+	Unit     string  `json:"unit"`
+}
+
+// GeoFix is the position reported by the gatherer when finishing (or failing)
+// a picking point, kept for audits
+type GeoFix struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Accuracy  float64 `json:"accuracy"`
+	Distance  float64 `json:"distance"` // meters to the picking point
+	Flagged   bool    `json:"flagged"`  // reported outside the geofence
+}
+
+type Photo struct {
+	Key        string     `json:"key"`
+	Kind       string     `json:"kind"`
+	UploadedBy string     `json:"uploaded_by"`
+	Created    *time.Time `json:"created"`
+}
+
 type PickingPoint struct {
 	ID         string     `json:"id"`
 	LocationID string     `json:"locationid"`
@@ -29,18 +94,63 @@ type PickingPoint struct {
 	Materials  []string   `json:"materials"`
 	PickedAt   *time.Time `json:"picked"`
 	Created    *time.Time `json:"created"`
+
+	FailedAt      *time.Time `json:"failed_at"`
+	FailureReason string     `json:"failure_reason"`
+	FailureNote   string     `json:"failure_note"`
+
+	Quantities []MaterialQuantity `json:"quantities"`
+	FinishFix  *GeoFix            `json:"finish_fix"`
+
+	PickupCode string     `json:"pickup_code"`  // one-time code handed by the household to the gatherer
+	CodeUsedAt *time.Time `json:"code_used_at"` // set once the pickup code has been redeemed
+
+	Photos []Photo `json:"photos"`
+}
+
+// IsDone tells whether the picking point has been either picked or failed,
+// both of them count toward the route completion
+func (pp PickingPoint) IsDone() bool {
+	return pp.PickedAt != nil || pp.FailedAt != nil
 }
 
 type Route struct {
 	ID            string         `json:"id"`
-	Sector        string         `json:"sector"`
+	Sector        string         `json:"sector"`              // name of the Sector the route goes around, as shown to users
+	SectorID      string         `json:"sector_id,omitempty"` // id of that Sector, the one locations are matched against
 	Shift         string         `json:"shift"`
 	Materials     []string       `json:"materials"`
 	Status        string         `json:"status"`
 	GathererID    string         `json:"gatherer_id"`
+	Timezone      string         `json:"timezone,omitempty"`
 	StartsAt      *time.Time     `json:"starts_at"`
 	InitiatedAt   *time.Time     `json:"initiated_at"`
 	FinishedAt    *time.Time     `json:"finished_at"`
 	Created       *time.Time     `json:"created"`
 	PickingPoints []PickingPoint `json:"picking_points"`
 }
+
+// CollectedQuantities sums up the quantities recorded on every picked point
+// of the route, grouped by material and unit
+func (r Route) CollectedQuantities() []MaterialQuantity {
+	collected := []MaterialQuantity{}
+	for _, pp := range r.PickingPoints {
+		if pp.PickedAt == nil {
+			continue
+		}
+		for _, q := range pp.Quantities {
+			found := false
+			for i := range collected {
+				if collected[i].Material == q.Material && collected[i].Unit == q.Unit {
+					collected[i].Amount += q.Amount
+					found = true
+					break
+				}
+			}
+			if !found {
+				collected = append(collected, q)
+			}
+		}
+	}
+	return collected
+}
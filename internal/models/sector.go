@@ -0,0 +1,17 @@
+package models
+
+import "github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+
+// Sector is an area of a city worked by the same routes. Routes refer to the
+// sector they go around by its ID, and the sector of a location is the one
+// whose polygon holds it
+type Sector struct {
+	ID      string      `json:"id"`
+	Name    string      `json:"name"`
+	City    string      `json:"city"`
+	Polygon geo.Polygon `json:"polygon"`
+}
+
+func (s Sector) Contains(lat float64, lon float64) bool {
+	return s.Polygon.Contains(lat, lon)
+}
@@ -0,0 +1,85 @@
+package models
+
+import "strings"
+
+// CountryTimezones is the IANA zone used for a country, by its ISO 3166
+// alpha-2 code, when the city does not tell otherwise
+var CountryTimezones = map[string]string{
+	"AR": "America/Argentina/Buenos_Aires",
+	"BR": "America/Sao_Paulo",
+	"CL": "America/Santiago",
+	"CO": "America/Bogota",
+	"EC": "America/Guayaquil",
+	"MX": "America/Mexico_City",
+	"PE": "America/Lima",
+	"US": "America/New_York",
+}
+
+// CityTimezones lists the cities off their country zone, keyed by country
+// and then by the city name lowercased and without accents
+var CityTimezones = map[string]map[string]string{
+	"BR": {
+		"belem":       "America/Belem",
+		"cuiaba":      "America/Cuiaba",
+		"fortaleza":   "America/Fortaleza",
+		"manaus":      "America/Manaus",
+		"porto velho": "America/Porto_Velho",
+		"recife":      "America/Recife",
+	},
+	"MX": {
+		"cancun":     "America/Cancun",
+		"chihuahua":  "America/Chihuahua",
+		"hermosillo": "America/Hermosillo",
+		"mexicali":   "America/Tijuana",
+		"tijuana":    "America/Tijuana",
+	},
+	"US": {
+		"chicago":       "America/Chicago",
+		"denver":        "America/Denver",
+		"houston":       "America/Chicago",
+		"los angeles":   "America/Los_Angeles",
+		"phoenix":       "America/Phoenix",
+		"san francisco": "America/Los_Angeles",
+		"seattle":       "America/Los_Angeles",
+	},
+}
+
+var accents = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u",
+	"ã", "a", "õ", "o", "â", "a", "ê", "e", "ô", "o", "ç", "c",
+)
+
+// TimezoneFor derives the IANA zone of a place, it is empty for countries
+// the app does not run in
+func TimezoneFor(country string, city string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	city = accents.Replace(strings.ToLower(strings.TrimSpace(city)))
+	if zone, ok := CityTimezones[country][city]; ok {
+		return zone
+	}
+	return CountryTimezones[country]
+}
+
+// Zone is the location timezone, when it is not set it is derived from the
+// country and city
+func (l Location) Zone() string {
+	if l.Timezone != "" {
+		return l.Timezone
+	}
+	return TimezoneFor(l.Country, l.City)
+}
+
+// Zone is the route timezone, when it is not set it is derived from the first
+// picking point on a known place. Routes with neither are left to the caller
+// default
+func (r Route) Zone() string {
+	if r.Timezone != "" {
+		return r.Timezone
+	}
+	for _, pp := range r.PickingPoints {
+		if zone := TimezoneFor(pp.Country, pp.City); zone != "" {
+			return zone
+		}
+	}
+	return ""
+}
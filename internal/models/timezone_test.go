@@ -0,0 +1,52 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+func TestTimezoneFor(t *testing.T) {
+	cases := []struct {
+		country  string
+		city     string
+		expected string
+	}{
+		{"CO", "Bogota", "America/Bogota"},
+		{"co", " Medellín ", "America/Bogota"},
+		{"BR", "São Paulo", "America/Sao_Paulo"},
+		{"BR", "Belém", "America/Belem"},
+		{"MX", "Tijuana", "America/Tijuana"},
+		{"US", "Los Angeles", "America/Los_Angeles"},
+		{"US", "", "America/New_York"},
+		{"FR", "Paris", ""},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		if got := models.TimezoneFor(c.country, c.city); got != c.expected {
+			t.Errorf("%q %q: expected %q, got %q", c.country, c.city, c.expected, got)
+		}
+	}
+}
+
+func TestZonesPreferTheExplicitOne(t *testing.T) {
+	location := models.Location{Country: "US", City: "Denver", Timezone: "America/Phoenix"}
+	if got := location.Zone(); got != "America/Phoenix" {
+		t.Fatalf("expected the explicit zone, got %q", got)
+	}
+	location.Timezone = ""
+	if got := location.Zone(); got != "America/Denver" {
+		t.Fatalf("expected the city zone, got %q", got)
+	}
+
+	route := models.Route{PickingPoints: []models.PickingPoint{
+		{Country: "FR", City: "Paris"},
+		{Country: "BR", City: "Manaus"},
+	}}
+	if got := route.Zone(); got != "America/Manaus" {
+		t.Fatalf("expected the zone of the first known place, got %q", got)
+	}
+	if got := (models.Route{}).Zone(); got != "" {
+		t.Fatalf("expected no zone without places, got %q", got)
+	}
+}
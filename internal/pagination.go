@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// DefaultPageLimit is the page size of the list endpoints when the client
+// does not send a limit, MaxPageLimit the largest one it can ask for
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 100
+)
+
+// Paginate reads the limit and cursor query parameters, answering 400 when
+// the limit is not a number between 1 and MaxPageLimit. Handlers read them
+// back with PageFrom and return the next cursor as next_cursor
+func Paginate() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			page := repositories.PageQuery{
+				Limit:  DefaultPageLimit,
+				Cursor: req.QueryStringParameters["cursor"],
+			}
+			if raw, ok := req.QueryStringParameters["limit"]; ok {
+				limit, err := strconv.Atoi(raw)
+				if err != nil || limit < 1 || limit > MaxPageLimit {
+					return Fail(ErrInvalidField.WithField("limit")), nil
+				}
+				page.Limit = limit
+			}
+			return next(context.WithValue(ctx, pageKey, page), req)
+		}
+	}
+}
+
+// PageFrom returns the page asked for, as read by Paginate
+func PageFrom(ctx context.Context) repositories.PageQuery {
+	if page, ok := ctx.Value(pageKey).(repositories.PageQuery); ok {
+		return page
+	}
+	return repositories.PageQuery{Limit: DefaultPageLimit}
+}
+
+// Window is the time range a listing pages through. Its cursors carry it, so
+// the pages after the first are read with the same bounds even once the
+// clock has moved past some of the items
+type Window struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type windowCursor struct {
+	Window
+	Cursor string `json:"cursor"`
+}
+
+// WindowCursor wraps the cursor of a page read within window, it is empty
+// when cursor is, on the last page
+func WindowCursor(window Window, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	raw, _ := json.Marshal(windowCursor{Window: window, Cursor: cursor})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// ResumeWindow unwraps a cursor made by WindowCursor, returning the window
+// the listing started with and the cursor of the repository
+func ResumeWindow(cursor string) (Window, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Window{}, "", repositories.ErrInvalidCursor
+	}
+	var wrapped windowCursor
+	if err := json.Unmarshal(raw, &wrapped); err != nil ||
+		wrapped.Cursor == "" || wrapped.From.IsZero() || wrapped.To.Before(wrapped.From) {
+		return Window{}, "", repositories.ErrInvalidCursor
+	}
+	return wrapped.Window, wrapped.Cursor, nil
+}
@@ -0,0 +1,57 @@
+package internal_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestPaginateReadsTheQuery(t *testing.T) {
+	var seen repositories.PageQuery
+	handler := internal.Standard(internal.Paginate())(func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		seen = internal.PageFrom(ctx)
+		return internal.Respond(http.StatusOK, ""), nil
+	})
+
+	cases := []struct {
+		query    map[string]string
+		expected repositories.PageQuery
+	}{
+		{nil, repositories.PageQuery{Limit: internal.DefaultPageLimit}},
+		{map[string]string{"limit": "10", "cursor": "abc"}, repositories.PageQuery{Limit: 10, Cursor: "abc"}},
+	}
+	for _, c := range cases {
+		res, _ := handler(context.Background(), events.APIGatewayProxyRequest{QueryStringParameters: c.query})
+		if res.StatusCode != http.StatusOK || seen != c.expected {
+			t.Fatalf("%v: expected %+v, got %v %+v", c.query, c.expected, res.StatusCode, seen)
+		}
+	}
+}
+
+func TestPaginateRejectsInvalidLimits(t *testing.T) {
+	handler := internal.Standard(internal.Paginate())(ok)
+
+	for _, limit := range []string{"0", "-1", "101", "ten"} {
+		res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"limit": limit},
+		})
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("limit %q: expected a 400, got %v", limit, res.StatusCode)
+		}
+		body := decodeErrors(t, res)
+		if body.Errors[0].Code != "invalid_field" || body.Errors[0].Field != "limit" {
+			t.Fatalf("limit %q: unexpected error %+v", limit, body.Errors[0])
+		}
+	}
+}
+
+func TestInvalidCursorIsABadRequest(t *testing.T) {
+	res := internal.Fail(repositories.ErrInvalidCursor)
+	if res.StatusCode != http.StatusBadRequest || decodeErrors(t, res).Errors[0].Code != "invalid_cursor" {
+		t.Fatalf("expected a 400 invalid_cursor, got %v %s", res.StatusCode, res.Body)
+	}
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ErrBatchIncomplete is returned, as a ThrottledError, when DynamoDB keeps
+// leaving keys unprocessed after every retry, which it does when the table
+// is being throttled
+var ErrBatchIncomplete = errors.New("batch get left unprocessed keys")
+
+// batchGetLimit is the most keys BatchGetItem accepts on a single request
+const batchGetLimit = 100
+
+// batchGetPolicy bounds how many times the unprocessed keys of a chunk are
+// requested and how long to wait between attempts, the same full jitter
+// backoff throttled requests get
+var batchGetPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   25 * time.Millisecond,
+	MaxDelay:    400 * time.Millisecond,
+}
+
+// batchGetItems gets the items with the given keys from the table, in chunks
+// of batchGetLimit. Items are returned in no particular order and the keys
+// with no item are simply missing from the result
+func batchGetItems(
+	ctx context.Context,
+	client DynamoDBClient,
+	table string,
+	keys []map[string]*dynamodb.AttributeValue,
+) ([]map[string]*dynamodb.AttributeValue, error) {
+	items := []map[string]*dynamodb.AttributeValue{}
+	for start := 0; start < len(keys); start += batchGetLimit {
+		end := start + batchGetLimit
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunk, err := batchGetChunk(ctx, client, table, keys[start:end])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, chunk...)
+	}
+	return items, nil
+}
+
+func batchGetChunk(
+	ctx context.Context,
+	client DynamoDBClient,
+	table string,
+	keys []map[string]*dynamodb.AttributeValue,
+) ([]map[string]*dynamodb.AttributeValue, error) {
+	items := []map[string]*dynamodb.AttributeValue{}
+	requests := map[string]*dynamodb.KeysAndAttributes{
+		table: {Keys: keys},
+	}
+	for attempt := 1; ; attempt++ {
+		out, err := client.BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: requests,
+		})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, out.Responses[table]...)
+
+		unprocessed, ok := out.UnprocessedKeys[table]
+		if !ok || len(unprocessed.Keys) == 0 {
+			return items, nil
+		}
+		if attempt == batchGetPolicy.MaxAttempts {
+			return nil, &ThrottledError{RetryAfter: time.Second, Err: ErrBatchIncomplete}
+		}
+		if err := sleep(ctx, batchGetPolicy.delay(attempt)); err != nil {
+			return nil, err
+		}
+		requests = map[string]*dynamodb.KeysAndAttributes{
+			table: {Keys: unprocessed.Keys},
+		}
+	}
+}
+
+// stringKeys builds the keys of a table whose only key attribute is name,
+// leaving out repeated values since BatchGetItem rejects duplicated keys
+func stringKeys(name string, values []string) []map[string]*dynamodb.AttributeValue {
+	seen := map[string]bool{}
+	keys := []map[string]*dynamodb.AttributeValue{}
+	for _, v := range values {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		keys = append(keys, map[string]*dynamodb.AttributeValue{
+			name: {S: aws.String(v)},
+		})
+	}
+	return keys
+}
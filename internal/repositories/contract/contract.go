@@ -0,0 +1,1160 @@
+// Package contract holds the behavior every repositories backend must share,
+// it is run against the in-memory repositories and, when an endpoint is
+// configured, against DynamoDB Local
+package contract
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+)
+
+type UsersRepository interface {
+	Save(ctx context.Context, user models.User) error
+	Find(ctx context.Context, userID string) (models.User, error)
+	FindByUsername(ctx context.Context, username string) (models.User, error)
+}
+
+type LocationsRepository interface {
+	Save(ctx context.Context, location models.Location) error
+	Link(ctx context.Context, userID string, locationID string) error
+	Find(ctx context.Context, id string) (models.Location, error)
+	FindByUserID(ctx context.Context, id string) ([]models.Location, error)
+	GetScoreByUserID(ctx context.Context, userID string) (int, error)
+	AdjustBalance(ctx context.Context, locationID string, adjustment models.BalanceAdjustment) error
+	FindWithinBox(ctx context.Context, box geo.Box) ([]models.Location, error)
+	FindWithinRadius(ctx context.Context, lat float64, lon float64, radius float64) ([]models.Location, error)
+}
+
+type RoutesRepository interface {
+	Save(ctx context.Context, route models.Route) error
+	Find(ctx context.Context, routeID string) (models.Route, error)
+	Initiate(ctx context.Context, routeID string, at time.Time) error
+	FinishPickingPoint(ctx context.Context, routeID string, pickingPointIndex int, pickingPoint models.PickingPoint, score int, remaining int) error
+	FailPickingPoint(ctx context.Context, routeID string, pickingPointIndex int, pickingPoint models.PickingPoint, remaining int) error
+	AttachPhoto(ctx context.Context, routeID string, pickingPointIndex int, photo models.Photo) error
+	GetAssignedRoutesbyUserID(ctx context.Context, userID string) ([]models.Route, error)
+	FindAvailableRoutes(ctx context.Context, currentTime time.Time, maxTime time.Time) ([]models.Route, error)
+	FindOpenShifts(ctx context.Context, currentTime time.Time, maxTime time.Time) ([]models.Route, error)
+	FindByStatus(ctx context.Context, status string, currentTime time.Time, maxTime time.Time) ([]models.Route, error)
+	FindAssignedRoutesPage(ctx context.Context, userID string, page repositories.PageQuery) (repositories.RoutesPage, error)
+	FindAvailableRoutesPage(ctx context.Context, currentTime time.Time, maxTime time.Time, page repositories.PageQuery) (repositories.RoutesPage, error)
+	FindOpenShiftsPage(ctx context.Context, currentTime time.Time, maxTime time.Time, page repositories.PageQuery) (repositories.RoutesPage, error)
+	FindOpenShiftsInSectorPage(ctx context.Context, sectorID string, currentTime time.Time, maxTime time.Time, page repositories.PageQuery) (repositories.RoutesPage, error)
+	Assign(ctx context.Context, userID string, routeID string) error
+	ForceAssign(ctx context.Context, userID string, routeID string) error
+	Unassign(ctx context.Context, routeID string) error
+	Pin(ctx context.Context, userID string, location models.Location, shiftID string, materials []string) error
+}
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, key string, requestHash string, lease time.Duration) (repositories.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, record repositories.IdempotencyRecord, ttl time.Duration) error
+	Release(ctx context.Context, key string) error
+}
+
+type TrackingRepository interface {
+	Track(ctx context.Context, position models.GathererPosition, ttl time.Duration) error
+	Latest(ctx context.Context, routeID string) (models.GathererPosition, error)
+}
+
+type SectorsRepository interface {
+	Save(ctx context.Context, sector models.Sector) error
+	Find(ctx context.Context, id string) (models.Sector, error)
+	All(ctx context.Context) ([]models.Sector, error)
+	Locate(ctx context.Context, lat float64, lon float64) (models.Sector, error)
+}
+
+// Backend is a fresh, empty set of repositories sharing the same storage
+type Backend struct {
+	Users       UsersRepository
+	Locations   LocationsRepository
+	Routes      RoutesRepository
+	Idempotency IdempotencyRepository
+	Tracking    TrackingRepository
+	Sectors     SectorsRepository
+}
+
+// NewBackend must return an empty backend on every call, cleanup is up to
+// the caller (e.g. through t.Cleanup)
+type NewBackend func(t *testing.T) Backend
+
+func Run(t *testing.T, newBackend NewBackend) {
+	t.Run("Users", func(t *testing.T) {
+		RunUsers(t, newBackend)
+	})
+	t.Run("Locations", func(t *testing.T) {
+		RunLocations(t, newBackend)
+	})
+	t.Run("LocationsByArea", func(t *testing.T) {
+		RunLocationsByArea(t, newBackend)
+	})
+	t.Run("Routes", func(t *testing.T) {
+		RunRoutes(t, newBackend)
+	})
+	t.Run("Idempotency", func(t *testing.T) {
+		RunIdempotency(t, newBackend)
+	})
+	t.Run("Tracking", func(t *testing.T) {
+		RunTracking(t, newBackend)
+	})
+	t.Run("Sectors", func(t *testing.T) {
+		RunSectors(t, newBackend)
+	})
+}
+
+func RunUsers(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+
+	t.Run("FindReturnsErrUserNotFound", func(t *testing.T) {
+		b := newBackend(t)
+		_, err := b.Users.Find(ctx, "missing")
+		if err != repositories.ErrUserNotFound {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("FindByUsernameReturnsErrUserNotFound", func(t *testing.T) {
+		b := newBackend(t)
+		_, err := b.Users.FindByUsername(ctx, "missing")
+		if err != repositories.ErrUserNotFound {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+	})
+
+	t.Run("FindReturnsSavedUser", func(t *testing.T) {
+		b := newBackend(t)
+		user := gatherer("u1")
+		mustSucceed(t, b.Users.Save(ctx, user))
+
+		found, err := b.Users.Find(ctx, user.ID)
+		mustSucceed(t, err)
+		if found != user {
+			t.Fatalf("expected %#v, got %#v", user, found)
+		}
+
+		found, err = b.Users.FindByUsername(ctx, user.Username)
+		mustSucceed(t, err)
+		if found != user {
+			t.Fatalf("expected %#v, got %#v", user, found)
+		}
+	})
+}
+
+func RunLocations(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+
+	t.Run("AdjustBalanceKeepsAdjustments", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 10)))
+
+		created := *hoursFromNow(0)
+		mustSucceed(t, b.Locations.AdjustBalance(ctx, "l1", models.BalanceAdjustment{
+			Amount: -4, Reason: "duplicated pickup", CreatedBy: "coordinator", Created: &created,
+		}))
+		mustSucceed(t, b.Locations.AdjustBalance(ctx, "l1", models.BalanceAdjustment{
+			Amount: 1.5, Reason: "missing glass", Created: &created,
+		}))
+
+		found, err := b.Locations.Find(ctx, "l1")
+		mustSucceed(t, err)
+		if found.Balance != 7.5 {
+			t.Fatalf("expected a balance of 7.5, got %v", found.Balance)
+		}
+		adjustments := found.BalanceAdjustments
+		if len(adjustments) != 2 || adjustments[0].Reason != "duplicated pickup" ||
+			adjustments[0].CreatedBy != "coordinator" || !adjustments[1].Created.Equal(created) {
+			t.Fatalf("unexpected adjustments %#v", adjustments)
+		}
+
+		err = b.Locations.AdjustBalance(ctx, "missing", models.BalanceAdjustment{Amount: 1, Reason: "none"})
+		if err != repositories.ErrLocationNotFound {
+			t.Fatalf("expected ErrLocationNotFound, got %v", err)
+		}
+	})
+
+	t.Run("FindReturnsErrLocationNotFound", func(t *testing.T) {
+		b := newBackend(t)
+		_, err := b.Locations.Find(ctx, "missing")
+		if err != repositories.ErrLocationNotFound {
+			t.Fatalf("expected ErrLocationNotFound, got %v", err)
+		}
+	})
+
+	t.Run("FindByUserIDReturnsErrNoLocationsFound", func(t *testing.T) {
+		b := newBackend(t)
+		_, err := b.Locations.FindByUserID(ctx, "u1")
+		if err != repositories.ErrNoLocationsFound {
+			t.Fatalf("expected ErrNoLocationsFound, got %v", err)
+		}
+	})
+
+	t.Run("FindByUserIDSkipsDanglingLinks", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 0)))
+		mustSucceed(t, b.Locations.Link(ctx, "u1", "l1"))
+		mustSucceed(t, b.Locations.Link(ctx, "u1", "missing"))
+
+		locations, err := b.Locations.FindByUserID(ctx, "u1")
+		mustSucceed(t, err)
+		if len(locations) != 1 || locations[0].ID != "l1" {
+			t.Fatalf("expected only l1, got %#v", locations)
+		}
+	})
+
+	t.Run("FindByUserIDWithOnlyDanglingLinksReturnsErrNoLocationsFound", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Link(ctx, "u1", "missing"))
+
+		_, err := b.Locations.FindByUserID(ctx, "u1")
+		if err != repositories.ErrNoLocationsFound {
+			t.Fatalf("expected ErrNoLocationsFound, got %v", err)
+		}
+	})
+
+	t.Run("FindByUserIDReturnsLinkedLocations", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 0)))
+		mustSucceed(t, b.Locations.Save(ctx, location("l2", 0)))
+		mustSucceed(t, b.Locations.Save(ctx, location("l3", 0)))
+		mustSucceed(t, b.Locations.Link(ctx, "u1", "l1"))
+		mustSucceed(t, b.Locations.Link(ctx, "u1", "l2"))
+		mustSucceed(t, b.Locations.Link(ctx, "u2", "l3"))
+
+		locations, err := b.Locations.FindByUserID(ctx, "u1")
+		mustSucceed(t, err)
+		if len(locations) != 2 {
+			t.Fatalf("expected 2 locations, got %v", len(locations))
+		}
+		for _, l := range locations {
+			if l.ID != "l1" && l.ID != "l2" {
+				t.Fatalf("unexpected location %v", l.ID)
+			}
+			if !reflect.DeepEqual(l, location(l.ID, 0)) {
+				t.Fatalf("expected %#v, got %#v", location(l.ID, 0), l)
+			}
+		}
+	})
+
+	t.Run("GetScoreByUserIDSumsBalances", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 10)))
+		mustSucceed(t, b.Locations.Save(ctx, location("l2", 25)))
+		mustSucceed(t, b.Locations.Link(ctx, "u1", "l1"))
+		mustSucceed(t, b.Locations.Link(ctx, "u1", "l2"))
+
+		score, err := b.Locations.GetScoreByUserID(ctx, "u1")
+		mustSucceed(t, err)
+		if score != 35 {
+			t.Fatalf("expected a score of 35, got %v", score)
+		}
+	})
+}
+
+func RunLocationsByArea(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+
+	at := func(id string, lat float64, lon float64) models.Location {
+		l := location(id, 0)
+		l.Latitude = lat
+		l.Longitude = lon
+		return l
+	}
+	seed := func(t *testing.T, b Backend) {
+		// a few blocks apart in Chapinero, and one in Suba
+		mustSucceed(t, b.Locations.Save(ctx, at("l1", 4.6415, -74.0652)))
+		mustSucceed(t, b.Locations.Save(ctx, at("l2", 4.6547, -74.0558)))
+		mustSucceed(t, b.Locations.Save(ctx, at("l3", 4.6361, -74.075)))
+		mustSucceed(t, b.Locations.Save(ctx, at("l4", 4.7411, -74.0837)))
+	}
+
+	t.Run("FindWithinBoxReturnsLocationsInside", func(t *testing.T) {
+		b := newBackend(t)
+		seed(t, b)
+
+		locations, err := b.Locations.FindWithinBox(ctx, geo.Box{
+			MinLatitude: 4.63, MinLongitude: -74.07, MaxLatitude: 4.66, MaxLongitude: -74.05,
+		})
+		mustSucceed(t, err)
+		assertLocationIDs(t, locations, "l1", "l2")
+		if !reflect.DeepEqual(locations[0], at("l1", 4.6415, -74.0652)) {
+			t.Fatalf("expected %#v, got %#v", at("l1", 4.6415, -74.0652), locations[0])
+		}
+	})
+
+	t.Run("FindWithinRadiusSortsByDistance", func(t *testing.T) {
+		b := newBackend(t)
+		seed(t, b)
+
+		locations, err := b.Locations.FindWithinRadius(ctx, 4.6400, -74.0680, 2500)
+		mustSucceed(t, err)
+		assertLocationIDs(t, locations, "l1", "l3", "l2")
+
+		locations, err = b.Locations.FindWithinRadius(ctx, 4.6400, -74.0680, 500)
+		mustSucceed(t, err)
+		assertLocationIDs(t, locations, "l1")
+	})
+
+	t.Run("LargeAreasAreRejected", func(t *testing.T) {
+		b := newBackend(t)
+		_, err := b.Locations.FindWithinRadius(ctx, 4.64, -74.06, 100000)
+		if err != repositories.ErrAreaTooLarge {
+			t.Fatalf("expected ErrAreaTooLarge, got %v", err)
+		}
+	})
+}
+
+func RunRoutes(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+
+	t.Run("FindByStatusWithinWindow", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Routes.Save(ctx, route("r1", models.RouteStatusInitiated, hoursFromNow(-1))))
+		mustSucceed(t, b.Routes.Save(ctx, route("r2", models.RouteStatusInitiated, hoursFromNow(-3))))
+		mustSucceed(t, b.Routes.Save(ctx, route("r3", models.RouteStatusInitiated, hoursFromNow(-48))))
+		mustSucceed(t, b.Routes.Save(ctx, route("r4", models.RouteStatusFinished, hoursFromNow(-1))))
+
+		routes, err := b.Routes.FindByStatus(ctx, models.RouteStatusInitiated, time.Now().Add(-24*time.Hour), time.Now())
+		mustSucceed(t, err)
+		assertRouteIDs(t, routes, "r2", "r1")
+	})
+
+	t.Run("ForceAssignReplacesGatherer", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Routes.Save(ctx, route("r1", models.RouteStatusClosed, hoursFromNow(2))))
+		mustSucceed(t, b.Routes.Assign(ctx, "g1", "r1"))
+		mustSucceed(t, b.Routes.ForceAssign(ctx, "g2", "r1"))
+
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		if found.GathererID != "g2" || found.Status != models.RouteStatusAssigned {
+			t.Fatalf("expected route assigned to g2, got %v (%v)", found.GathererID, found.Status)
+		}
+	})
+
+	t.Run("ForceAssignReturnsErrRouteNotAssignable", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Routes.Save(ctx, route("r1", models.RouteStatusInitiated, hoursFromNow(-1))))
+		err := b.Routes.ForceAssign(ctx, "g1", "r1")
+		if err != repositories.ErrRouteNotAssignable {
+			t.Fatalf("expected ErrRouteNotAssignable, got %v", err)
+		}
+	})
+
+	t.Run("UnassignReleasesRoute", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Routes.Save(ctx, route("r1", models.RouteStatusClosed, hoursFromNow(2))))
+		mustSucceed(t, b.Routes.Assign(ctx, "g1", "r1"))
+		mustSucceed(t, b.Routes.Unassign(ctx, "r1"))
+
+		routes, err := b.Routes.FindAvailableRoutes(ctx, time.Now(), time.Now().Add(12*time.Hour))
+		mustSucceed(t, err)
+		assertRouteIDs(t, routes, "r1")
+
+		err = b.Routes.Unassign(ctx, "r1")
+		if err != repositories.ErrRouteNotAssigned {
+			t.Fatalf("expected ErrRouteNotAssigned, got %v", err)
+		}
+	})
+
+	t.Run("FindReturnsErrRouteNotFound", func(t *testing.T) {
+		b := newBackend(t)
+		_, err := b.Routes.Find(ctx, "missing")
+		if err != repositories.ErrRouteNotFound {
+			t.Fatalf("expected ErrRouteNotFound, got %v", err)
+		}
+	})
+
+	t.Run("FindReturnsSavedRouteWithUnsetSentinels", func(t *testing.T) {
+		b := newBackend(t)
+		r := route("r1", models.RouteStatusOpen, hoursFromNow(2))
+		mustSucceed(t, b.Routes.Save(ctx, r))
+
+		found, err := b.Routes.Find(ctx, r.ID)
+		mustSucceed(t, err)
+		if found.GathererID != "" || found.InitiatedAt != nil || found.FinishedAt != nil {
+			t.Fatalf("expected unset gatherer_id, initiated_at and finished_at, got %#v", found)
+		}
+		if !found.StartsAt.Equal(*r.StartsAt) {
+			t.Fatalf("expected starts_at %v, got %v", r.StartsAt, found.StartsAt)
+		}
+	})
+
+	t.Run("AssignTwiceReturnsErrRouteAlreadyAssigned", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Routes.Save(ctx, route("r1", models.RouteStatusClosed, hoursFromNow(2))))
+
+		mustSucceed(t, b.Routes.Assign(ctx, "g1", "r1"))
+		err := b.Routes.Assign(ctx, "g2", "r1")
+		if err != repositories.ErrRouteAlreadyAssigned {
+			t.Fatalf("expected ErrRouteAlreadyAssigned, got %v", err)
+		}
+
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		if found.GathererID != "g1" || found.Status != models.RouteStatusAssigned {
+			t.Fatalf("expected route assigned to g1, got (%v, %v)", found.GathererID, found.Status)
+		}
+	})
+
+	t.Run("InitiateSetsStatusAndInitiatedAt", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Routes.Save(ctx, route("r1", models.RouteStatusAssigned, hoursFromNow(2))))
+
+		mustSucceed(t, b.Routes.Initiate(ctx, "r1", time.Now()))
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		if found.Status != models.RouteStatusInitiated || found.InitiatedAt == nil {
+			t.Fatalf("expected an initiated route, got (%v, %v)", found.Status, found.InitiatedAt)
+		}
+	})
+
+	t.Run("SyncedActionsKeepTheTimeTheyHappenedAt", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 0)))
+		mustSucceed(t, b.Locations.Save(ctx, location("l2", 0)))
+		r := routeWithPoints("r1", "l1", "l2")
+		r.Status, r.InitiatedAt = models.RouteStatusAssigned, nil
+		mustSucceed(t, b.Routes.Save(ctx, r))
+		startedAt, pickedAt, failedAt := *hoursFromNow(-3), *hoursFromNow(-2), *hoursFromNow(-1)
+
+		mustSucceed(t, b.Routes.Initiate(ctx, "r1", startedAt))
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		picked, failed := found.PickingPoints[0], found.PickingPoints[1]
+		picked.PickedAt, picked.CodeUsedAt = &pickedAt, &pickedAt
+		mustSucceed(t, b.Routes.FinishPickingPoint(ctx, "r1", 0, picked, 10, 2))
+		failed.FailedAt, failed.FailureReason = &failedAt, models.FailureReasonNobodyHome
+		mustSucceed(t, b.Routes.FailPickingPoint(ctx, "r1", 1, failed, 1))
+
+		found, err = b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		for name, c := range map[string]struct {
+			got  *time.Time
+			want time.Time
+		}{
+			"initiated_at": {found.InitiatedAt, startedAt},
+			"picked_at":    {found.PickingPoints[0].PickedAt, pickedAt},
+			"code_used_at": {found.PickingPoints[0].CodeUsedAt, pickedAt},
+			"failed_at":    {found.PickingPoints[1].FailedAt, failedAt},
+			"finished_at":  {found.FinishedAt, failedAt},
+		} {
+			if c.got == nil || !c.got.Equal(c.want) {
+				t.Fatalf("expected %s to be %v, got %v", name, c.want, c.got)
+			}
+		}
+	})
+
+	t.Run("PinAppendsPickingPoint", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Routes.Save(ctx, route("r1", models.RouteStatusOpen, hoursFromNow(2))))
+		l := location("l1", 0)
+
+		mustSucceed(t, b.Routes.Pin(ctx, "u1", l, "r1", []string{models.MaterialGlass}))
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		if len(found.PickingPoints) != 1 {
+			t.Fatalf("expected 1 picking point, got %v", len(found.PickingPoints))
+		}
+		pp := found.PickingPoints[0]
+		if pp.ID == "" || pp.PickupCode == "" || pp.LocationID != l.ID || pp.Latitude != l.Latitude {
+			t.Fatalf("unexpected picking point %#v", pp)
+		}
+		if pp.PickedAt != nil || pp.FailedAt != nil || pp.CodeUsedAt != nil || pp.Created == nil {
+			t.Fatalf("expected a pending picking point, got %#v", pp)
+		}
+	})
+
+	t.Run("PinReturnsErrRouteNotFound", func(t *testing.T) {
+		b := newBackend(t)
+		err := b.Routes.Pin(ctx, "u1", location("l1", 0), "missing", []string{models.MaterialGlass})
+		if err != repositories.ErrRouteNotFound {
+			t.Fatalf("expected ErrRouteNotFound, got %v", err)
+		}
+	})
+
+	t.Run("PinKeepsRedeemedPickupCodes", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 0)))
+		mustSucceed(t, b.Routes.Save(ctx, routeWithPoints("r1", "l1")))
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		pp := found.PickingPoints[0]
+		now := time.Now()
+		pp.CodeUsedAt = &now
+		mustSucceed(t, b.Routes.FinishPickingPoint(ctx, "r1", 0, pp, 10, 2))
+
+		mustSucceed(t, b.Routes.Pin(ctx, "u2", location("l2", 0), "r1", []string{models.MaterialGlass}))
+		found, err = b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		kept := found.PickingPoints[0]
+		if kept.PickedAt == nil || kept.CodeUsedAt == nil {
+			t.Fatalf("expected the picked point to keep its state, got %#v", kept)
+		}
+		err = b.Routes.FinishPickingPoint(ctx, "r1", 0, pp, 10, 2)
+		if err != repositories.ErrPickupCodeAlreadyUsed {
+			t.Fatalf("expected ErrPickupCodeAlreadyUsed, got %v", err)
+		}
+	})
+
+	t.Run("FinishPickingPointWithRemainingOneFinishesRoute", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 5)))
+		mustSucceed(t, b.Routes.Save(ctx, routeWithPoints("r1", "l1")))
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+
+		pp := found.PickingPoints[0]
+		pp.Quantities = []models.MaterialQuantity{
+			{Material: models.MaterialGlass, Amount: 2.5, Unit: models.UnitKilograms},
+		}
+		mustSucceed(t, b.Routes.FinishPickingPoint(ctx, "r1", 0, pp, 10, 1))
+
+		found, err = b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		if found.Status != models.RouteStatusFinished || found.FinishedAt == nil {
+			t.Fatalf("expected a finished route, got (%v, %v)", found.Status, found.FinishedAt)
+		}
+		if found.PickingPoints[0].PickedAt == nil || len(found.PickingPoints[0].Quantities) != 1 {
+			t.Fatalf("expected a picked point with quantities, got %#v", found.PickingPoints[0])
+		}
+		credited, err := b.Locations.Find(ctx, "l1")
+		mustSucceed(t, err)
+		if credited.Balance != 15 {
+			t.Fatalf("expected a balance of 15, got %v", credited.Balance)
+		}
+	})
+
+	t.Run("FinishPickingPointWithRemainingKeepsStatus", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 0)))
+		mustSucceed(t, b.Locations.Save(ctx, location("l2", 0)))
+		mustSucceed(t, b.Routes.Save(ctx, routeWithPoints("r1", "l1", "l2")))
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+
+		mustSucceed(t, b.Routes.FinishPickingPoint(ctx, "r1", 0, found.PickingPoints[0], 10, 2))
+		found, err = b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		if found.Status != models.RouteStatusInitiated || found.FinishedAt != nil {
+			t.Fatalf("expected an initiated route, got (%v, %v)", found.Status, found.FinishedAt)
+		}
+	})
+
+	t.Run("FinishPickingPointRejectsReplayedPickupCode", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 0)))
+		mustSucceed(t, b.Routes.Save(ctx, routeWithPoints("r1", "l1")))
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+
+		pp := found.PickingPoints[0]
+		now := time.Now()
+		pp.CodeUsedAt = &now
+		mustSucceed(t, b.Routes.FinishPickingPoint(ctx, "r1", 0, pp, 10, 2))
+		err = b.Routes.FinishPickingPoint(ctx, "r1", 0, pp, 10, 2)
+		if err != repositories.ErrPickupCodeAlreadyUsed {
+			t.Fatalf("expected ErrPickupCodeAlreadyUsed, got %v", err)
+		}
+	})
+
+	t.Run("FailPickingPointDoesNotCredit", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 5)))
+		mustSucceed(t, b.Routes.Save(ctx, routeWithPoints("r1", "l1")))
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+
+		pp := found.PickingPoints[0]
+		pp.FailureReason = models.FailureReasonNobodyHome
+		pp.FailureNote = "rang twice"
+		mustSucceed(t, b.Routes.FailPickingPoint(ctx, "r1", 0, pp, 1))
+
+		found, err = b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		failed := found.PickingPoints[0]
+		if failed.FailedAt == nil || failed.FailureReason != pp.FailureReason || failed.FailureNote != pp.FailureNote {
+			t.Fatalf("expected a failed picking point, got %#v", failed)
+		}
+		if found.Status != models.RouteStatusFinished {
+			t.Fatalf("expected a finished route, got %v", found.Status)
+		}
+		notCredited, err := b.Locations.Find(ctx, "l1")
+		mustSucceed(t, err)
+		if notCredited.Balance != 5 {
+			t.Fatalf("expected the balance to stay at 5, got %v", notCredited.Balance)
+		}
+	})
+
+	t.Run("AttachPhotoAppendsPhoto", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Routes.Save(ctx, routeWithPoints("r1", "l1")))
+
+		photo := models.Photo{Key: "k1", Kind: models.PhotoKindBefore, UploadedBy: "g1"}
+		mustSucceed(t, b.Routes.AttachPhoto(ctx, "r1", 0, photo))
+		photo.Key = "k2"
+		mustSucceed(t, b.Routes.AttachPhoto(ctx, "r1", 0, photo))
+
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		photos := found.PickingPoints[0].Photos
+		if len(photos) != 2 || photos[0].Key != "k1" || photos[1].Key != "k2" || photos[0].Created == nil {
+			t.Fatalf("unexpected photos %#v", photos)
+		}
+	})
+
+	t.Run("AttachPhotoReturnsErrPhotoAlreadyAttached", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Locations.Save(ctx, location("l1", 0)))
+		mustSucceed(t, b.Locations.Save(ctx, location("l2", 0)))
+		mustSucceed(t, b.Routes.Save(ctx, routeWithPoints("r1", "l1", "l2")))
+
+		photo := models.Photo{Key: "k1", Kind: models.PhotoKindBefore, UploadedBy: "g1"}
+		mustSucceed(t, b.Routes.AttachPhoto(ctx, "r1", 0, photo))
+		for _, index := range []int{0, 1} {
+			if err := b.Routes.AttachPhoto(ctx, "r1", index, photo); err != repositories.ErrPhotoAlreadyAttached {
+				t.Fatalf("expected ErrPhotoAlreadyAttached on picking point %v, got %v", index, err)
+			}
+		}
+
+		found, err := b.Routes.Find(ctx, "r1")
+		mustSucceed(t, err)
+		if len(found.PickingPoints[0].Photos) != 1 || len(found.PickingPoints[1].Photos) != 0 {
+			t.Fatalf("expected the photo attached once, got %#v", found.PickingPoints)
+		}
+	})
+
+	t.Run("GetAssignedRoutesbyUserID", func(t *testing.T) {
+		b := newBackend(t)
+		_, err := b.Routes.GetAssignedRoutesbyUserID(ctx, "g1")
+		if err != repositories.ErrNoAssignedRoutes {
+			t.Fatalf("expected ErrNoAssignedRoutes, got %v", err)
+		}
+
+		assigned := route("r1", models.RouteStatusAssigned, hoursFromNow(2))
+		assigned.GathererID = "g1"
+		finished := route("r2", models.RouteStatusFinished, hoursFromNow(-2))
+		finished.GathererID = "g1"
+		finished.FinishedAt = finished.StartsAt
+		other := route("r3", models.RouteStatusAssigned, hoursFromNow(2))
+		other.GathererID = "g2"
+		mustSucceed(t, b.Routes.Save(ctx, assigned))
+		mustSucceed(t, b.Routes.Save(ctx, finished))
+		mustSucceed(t, b.Routes.Save(ctx, other))
+
+		routes, err := b.Routes.GetAssignedRoutesbyUserID(ctx, "g1")
+		mustSucceed(t, err)
+		assertRouteIDs(t, routes, "r1")
+	})
+
+	t.Run("FindOpenShiftsWithinWindow", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Routes.Save(ctx, route("r1", models.RouteStatusOpen, hoursFromNow(2))))
+		mustSucceed(t, b.Routes.Save(ctx, route("r2", models.RouteStatusOpen, hoursFromNow(1))))
+		mustSucceed(t, b.Routes.Save(ctx, route("r3", models.RouteStatusOpen, hoursFromNow(48))))
+		mustSucceed(t, b.Routes.Save(ctx, route("r4", models.RouteStatusClosed, hoursFromNow(2))))
+		mustSucceed(t, b.Routes.Save(ctx, route("r5", models.RouteStatusOpen, hoursFromNow(-1))))
+
+		routes, err := b.Routes.FindOpenShifts(ctx, time.Now(), time.Now().Add(24*time.Hour))
+		mustSucceed(t, err)
+		assertRouteIDs(t, routes, "r2", "r1")
+	})
+
+	t.Run("FindOpenShiftsWithinWindowAcrossZones", func(t *testing.T) {
+		b := newBackend(t)
+		tokyo := route("r1", models.RouteStatusOpen, hoursFromNow(12))
+		tokyo.Timezone = "Asia/Tokyo"
+		losAngeles := route("r2", models.RouteStatusOpen, hoursFromNow(1))
+		losAngeles.Timezone = "America/Los_Angeles"
+		late := route("r3", models.RouteStatusOpen, hoursFromNow(30))
+		late.Timezone = "Pacific/Kiritimati"
+		mustSucceed(t, b.Routes.Save(ctx, tokyo))
+		mustSucceed(t, b.Routes.Save(ctx, losAngeles))
+		mustSucceed(t, b.Routes.Save(ctx, late))
+
+		routes, err := b.Routes.FindOpenShifts(ctx, time.Now(), time.Now().Add(24*time.Hour))
+		mustSucceed(t, err)
+		assertRouteIDs(t, routes, "r2", "r1")
+		if routes[1].Timezone != "Asia/Tokyo" {
+			t.Fatalf("expected the route timezone to be kept, got %q", routes[1].Timezone)
+		}
+	})
+
+	t.Run("FindAvailableRoutesOnlyUnassigned", func(t *testing.T) {
+		b := newBackend(t)
+		assigned := route("r2", models.RouteStatusClosed, hoursFromNow(3))
+		assigned.GathererID = "g1"
+		mustSucceed(t, b.Routes.Save(ctx, route("r1", models.RouteStatusClosed, hoursFromNow(2))))
+		mustSucceed(t, b.Routes.Save(ctx, assigned))
+		mustSucceed(t, b.Routes.Save(ctx, route("r3", models.RouteStatusOpen, hoursFromNow(2))))
+		mustSucceed(t, b.Routes.Save(ctx, route("r4", models.RouteStatusClosed, hoursFromNow(30))))
+
+		routes, err := b.Routes.FindAvailableRoutes(ctx, time.Now(), time.Now().Add(12*time.Hour))
+		mustSucceed(t, err)
+		assertRouteIDs(t, routes, "r1")
+	})
+
+	t.Run("FindOpenShiftsPageFollowsCursors", func(t *testing.T) {
+		b := newBackend(t)
+		for i, id := range []string{"r1", "r2", "r3", "r4", "r5"} {
+			mustSucceed(t, b.Routes.Save(ctx, route(id, models.RouteStatusOpen, hoursFromNow(i+1))))
+		}
+
+		ids := []string{}
+		page := repositories.PageQuery{Limit: 2}
+		for pages := 1; ; pages++ {
+			result, err := b.Routes.FindOpenShiftsPage(ctx, time.Now(), time.Now().Add(24*time.Hour), page)
+			mustSucceed(t, err)
+			if len(result.Routes) > 2 {
+				t.Fatalf("expected at most 2 routes, got %v", len(result.Routes))
+			}
+			for _, r := range result.Routes {
+				ids = append(ids, r.ID)
+			}
+			if result.Cursor == "" {
+				break
+			}
+			if pages == 3 {
+				t.Fatalf("expected 3 pages at most, got a cursor on the third")
+			}
+			page.Cursor = result.Cursor
+		}
+		if !reflect.DeepEqual(ids, []string{"r1", "r2", "r3", "r4", "r5"}) {
+			t.Fatalf("unexpected routes %v", ids)
+		}
+	})
+
+	t.Run("FindOpenShiftsInSectorPageFillsPages", func(t *testing.T) {
+		b := newBackend(t)
+		for i, id := range []string{"r1", "r2", "r3", "r4", "r5", "r6"} {
+			r := route(id, models.RouteStatusOpen, hoursFromNow(i+1))
+			if i%2 == 1 {
+				r.Sector, r.SectorID = "Teusaquillo", "sector-teusaquillo"
+			}
+			mustSucceed(t, b.Routes.Save(ctx, r))
+		}
+		unlinked := route("r7", models.RouteStatusOpen, hoursFromNow(7))
+		unlinked.SectorID = ""
+		mustSucceed(t, b.Routes.Save(ctx, unlinked))
+
+		result, err := b.Routes.FindOpenShiftsInSectorPage(ctx, "sector-chapinero", time.Now(), time.Now().Add(24*time.Hour), repositories.PageQuery{Limit: 2})
+		mustSucceed(t, err)
+		assertRouteIDs(t, result.Routes, "r1", "r3")
+		if result.Cursor == "" {
+			t.Fatalf("expected a cursor after a full page")
+		}
+
+		result, err = b.Routes.FindOpenShiftsInSectorPage(ctx, "sector-chapinero", time.Now(), time.Now().Add(24*time.Hour), repositories.PageQuery{Limit: 2, Cursor: result.Cursor})
+		mustSucceed(t, err)
+		assertRouteIDs(t, result.Routes, "r5")
+		if result.Cursor != "" {
+			t.Fatalf("expected the last page, got cursor %q", result.Cursor)
+		}
+	})
+
+	t.Run("FindAvailableRoutesPageSkipsFilteredRoutes", func(t *testing.T) {
+		b := newBackend(t)
+		for i, id := range []string{"r1", "r2", "r3", "r4"} {
+			r := route(id, models.RouteStatusClosed, hoursFromNow(i+1))
+			if id != "r4" {
+				r.GathererID = "g1"
+			}
+			mustSucceed(t, b.Routes.Save(ctx, r))
+		}
+
+		result, err := b.Routes.FindAvailableRoutesPage(ctx, time.Now(), time.Now().Add(12*time.Hour), repositories.PageQuery{Limit: 1})
+		mustSucceed(t, err)
+		assertRouteIDs(t, result.Routes, "r4")
+		if result.Cursor != "" {
+			t.Fatalf("expected the last page, got cursor %q", result.Cursor)
+		}
+	})
+
+	t.Run("FindAssignedRoutesPageIsEmptyWithoutRoutes", func(t *testing.T) {
+		b := newBackend(t)
+		result, err := b.Routes.FindAssignedRoutesPage(ctx, "g1", repositories.PageQuery{Limit: 10})
+		mustSucceed(t, err)
+		if len(result.Routes) != 0 || result.Cursor != "" {
+			t.Fatalf("expected an empty last page, got %+v", result)
+		}
+	})
+
+	t.Run("FindOpenShiftsPageRejectsInvalidCursors", func(t *testing.T) {
+		b := newBackend(t)
+		_, err := b.Routes.FindOpenShiftsPage(ctx, time.Now(), time.Now().Add(24*time.Hour), repositories.PageQuery{Cursor: "not a cursor"})
+		if err != repositories.ErrInvalidCursor {
+			t.Fatalf("expected ErrInvalidCursor, got %v", err)
+		}
+	})
+}
+
+func RunIdempotency(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+
+	t.Run("ReserveOnce", func(t *testing.T) {
+		b := newBackend(t)
+		record, reserved, err := b.Idempotency.Reserve(ctx, "k1", "h1", time.Hour)
+		mustSucceed(t, err)
+		if !reserved || record.Key != "k1" || record.Completed {
+			t.Fatalf("expected k1 to be reserved, got %v %#v", reserved, record)
+		}
+
+		existing, reserved, err := b.Idempotency.Reserve(ctx, "k1", "h2", time.Hour)
+		mustSucceed(t, err)
+		if reserved || existing.RequestHash != "h1" || existing.Completed {
+			t.Fatalf("expected the in progress k1 back, got %v %#v", reserved, existing)
+		}
+	})
+
+	t.Run("ReserveReturnsTheCompletedResponse", func(t *testing.T) {
+		b := newBackend(t)
+		record, _, err := b.Idempotency.Reserve(ctx, "k1", "h1", time.Hour)
+		mustSucceed(t, err)
+		record.StatusCode = 200
+		record.Headers = map[string]string{"Content-Type": "application/json"}
+		record.Body = `{"ok":true}`
+		mustSucceed(t, b.Idempotency.Complete(ctx, record, time.Hour))
+
+		existing, reserved, err := b.Idempotency.Reserve(ctx, "k1", "h1", time.Hour)
+		mustSucceed(t, err)
+		record.Completed = true
+		record.ExpiresAt = existing.ExpiresAt
+		if reserved || !reflect.DeepEqual(existing, record) {
+			t.Fatalf("expected %#v, got %v %#v", record, reserved, existing)
+		}
+	})
+
+	t.Run("ReleaseAllowsReservingAgain", func(t *testing.T) {
+		b := newBackend(t)
+		_, _, err := b.Idempotency.Reserve(ctx, "k1", "h1", time.Hour)
+		mustSucceed(t, err)
+		mustSucceed(t, b.Idempotency.Release(ctx, "k1"))
+
+		_, reserved, err := b.Idempotency.Reserve(ctx, "k1", "h2", time.Hour)
+		mustSucceed(t, err)
+		if !reserved {
+			t.Fatalf("expected k1 to be reserved again")
+		}
+	})
+
+	t.Run("CompleteOutlivesTheLease", func(t *testing.T) {
+		b := newBackend(t)
+		record, _, err := b.Idempotency.Reserve(ctx, "k1", "h1", -time.Hour)
+		mustSucceed(t, err)
+		record.StatusCode = 200
+		mustSucceed(t, b.Idempotency.Complete(ctx, record, time.Hour))
+
+		existing, reserved, err := b.Idempotency.Reserve(ctx, "k1", "h2", time.Hour)
+		mustSucceed(t, err)
+		if reserved || !existing.Completed || existing.RequestHash != "h1" {
+			t.Fatalf("expected the completed k1 to be kept past its lease, got %v %#v", reserved, existing)
+		}
+	})
+
+	t.Run("ExpiredKeysAreTakenOver", func(t *testing.T) {
+		b := newBackend(t)
+		_, _, err := b.Idempotency.Reserve(ctx, "k1", "h1", -time.Hour)
+		mustSucceed(t, err)
+
+		record, reserved, err := b.Idempotency.Reserve(ctx, "k1", "h2", time.Hour)
+		mustSucceed(t, err)
+		if !reserved || record.RequestHash != "h2" {
+			t.Fatalf("expected the expired k1 to be taken over, got %v %#v", reserved, record)
+		}
+	})
+}
+
+func RunTracking(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+
+	ping := func(routeID string, latitude float64, recordedAt time.Time) models.GathererPosition {
+		return models.GathererPosition{
+			RouteID:    routeID,
+			GathererID: "gatherer-1",
+			Latitude:   latitude,
+			Longitude:  -74.0652,
+			Accuracy:   12.5,
+			RecordedAt: recordedAt.UTC().Truncate(time.Second),
+		}
+	}
+
+	t.Run("LatestIsTheLastPing", func(t *testing.T) {
+		b := newBackend(t)
+		now := time.Now()
+		mustSucceed(t, b.Tracking.Track(ctx, ping("r1", 4.64, now.Add(-time.Minute)), time.Hour))
+		last := ping("r1", 4.65, now)
+		mustSucceed(t, b.Tracking.Track(ctx, last, time.Hour))
+		mustSucceed(t, b.Tracking.Track(ctx, ping("r2", 4.66, now), time.Hour))
+
+		position, err := b.Tracking.Latest(ctx, "r1")
+		mustSucceed(t, err)
+		if !reflect.DeepEqual(position, last) {
+			t.Fatalf("expected %#v, got %#v", last, position)
+		}
+	})
+
+	t.Run("LatePingsAreIgnored", func(t *testing.T) {
+		b := newBackend(t)
+		now := time.Now()
+		last := ping("r1", 4.65, now)
+		mustSucceed(t, b.Tracking.Track(ctx, last, time.Hour))
+		mustSucceed(t, b.Tracking.Track(ctx, ping("r1", 4.64, now.Add(-time.Minute)), time.Hour))
+
+		position, err := b.Tracking.Latest(ctx, "r1")
+		mustSucceed(t, err)
+		if position.Latitude != last.Latitude {
+			t.Fatalf("expected the latest ping to be kept, got %#v", position)
+		}
+	})
+
+	t.Run("ExpiredPositionsAreGone", func(t *testing.T) {
+		b := newBackend(t)
+		now := time.Now()
+		mustSucceed(t, b.Tracking.Track(ctx, ping("r1", 4.65, now), -time.Hour))
+
+		_, err := b.Tracking.Latest(ctx, "r1")
+		if err != repositories.ErrNoGathererPosition {
+			t.Fatalf("expected ErrNoGathererPosition, got %v", err)
+		}
+		_, err = b.Tracking.Latest(ctx, "unknown")
+		if err != repositories.ErrNoGathererPosition {
+			t.Fatalf("expected ErrNoGathererPosition, got %v", err)
+		}
+
+		older := ping("r1", 4.64, now.Add(-time.Minute))
+		mustSucceed(t, b.Tracking.Track(ctx, older, time.Hour))
+		position, err := b.Tracking.Latest(ctx, "r1")
+		mustSucceed(t, err)
+		if position.Latitude != older.Latitude {
+			t.Fatalf("expected the expired position to be replaced, got %#v", position)
+		}
+	})
+}
+
+func RunSectors(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+
+	t.Run("FindReturnsSavedSector", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Sectors.Save(ctx, chapinero))
+
+		found, err := b.Sectors.Find(ctx, chapinero.ID)
+		mustSucceed(t, err)
+		if !reflect.DeepEqual(found, chapinero) {
+			t.Fatalf("expected %#v, got %#v", chapinero, found)
+		}
+
+		_, err = b.Sectors.Find(ctx, "missing")
+		if err != repositories.ErrSectorNotFound {
+			t.Fatalf("expected ErrSectorNotFound, got %v", err)
+		}
+	})
+
+	t.Run("AllIsSortedByID", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Sectors.Save(ctx, teusaquillo))
+		mustSucceed(t, b.Sectors.Save(ctx, chapinero))
+
+		sectors, err := b.Sectors.All(ctx)
+		mustSucceed(t, err)
+		if len(sectors) != 2 || sectors[0].ID != chapinero.ID || sectors[1].ID != teusaquillo.ID {
+			t.Fatalf("expected chapinero and teusaquillo, got %#v", sectors)
+		}
+	})
+
+	t.Run("LocateFindsTheSectorHoldingThePoint", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Sectors.Save(ctx, chapinero))
+		mustSucceed(t, b.Sectors.Save(ctx, teusaquillo))
+
+		sector, err := b.Sectors.Locate(ctx, 4.6415, -74.0652)
+		mustSucceed(t, err)
+		if sector.Name != "Chapinero" {
+			t.Fatalf("expected Chapinero, got %v", sector.Name)
+		}
+		sector, err = b.Sectors.Locate(ctx, 4.6361, -74.075)
+		mustSucceed(t, err)
+		if sector.Name != "Teusaquillo" {
+			t.Fatalf("expected Teusaquillo, got %v", sector.Name)
+		}
+		_, err = b.Sectors.Locate(ctx, 4.7411, -74.0837)
+		if err != repositories.ErrSectorNotFound {
+			t.Fatalf("expected ErrSectorNotFound, got %v", err)
+		}
+	})
+
+	t.Run("LocateOnASharedEdgeFindsASingleSector", func(t *testing.T) {
+		b := newBackend(t)
+		mustSucceed(t, b.Sectors.Save(ctx, chapinero))
+		mustSucceed(t, b.Sectors.Save(ctx, teusaquillo))
+
+		// Chapinero lies east of the edge, Teusaquillo west of it
+		sector, err := b.Sectors.Locate(ctx, 4.64, -74.07)
+		mustSucceed(t, err)
+		if sector.ID != chapinero.ID {
+			t.Fatalf("expected Chapinero, got %v", sector.Name)
+		}
+	})
+
+	t.Run("LocatePrefersTheSmallestOverlappingSector", func(t *testing.T) {
+		b := newBackend(t)
+		// sorted first by id, so the area decides rather than the order
+		bogota := models.Sector{
+			ID:   "s0",
+			Name: "Bogota",
+			City: "Bogota",
+			Polygon: geo.Polygon{
+				{Latitude: 4.5, Longitude: -74.2},
+				{Latitude: 4.8, Longitude: -74.2},
+				{Latitude: 4.8, Longitude: -74.0},
+				{Latitude: 4.5, Longitude: -74.0},
+			},
+		}
+		mustSucceed(t, b.Sectors.Save(ctx, bogota))
+		mustSucceed(t, b.Sectors.Save(ctx, chapinero))
+		duplicate := chapinero
+		duplicate.ID, duplicate.Name = "s3", "Chapinero copy"
+		mustSucceed(t, b.Sectors.Save(ctx, duplicate))
+
+		sector, err := b.Sectors.Locate(ctx, 4.6415, -74.0652)
+		mustSucceed(t, err)
+		if sector.ID != chapinero.ID {
+			t.Fatalf("expected Chapinero, got %v", sector.Name)
+		}
+		sector, err = b.Sectors.Locate(ctx, 4.7411, -74.0837)
+		mustSucceed(t, err)
+		if sector.ID != bogota.ID {
+			t.Fatalf("expected Bogota, got %v", sector.Name)
+		}
+	})
+}
+
+var chapinero = models.Sector{
+	ID:   "s1",
+	Name: "Chapinero",
+	City: "Bogota",
+	Polygon: geo.Polygon{
+		{Latitude: 4.628, Longitude: -74.07},
+		{Latitude: 4.67, Longitude: -74.07},
+		{Latitude: 4.67, Longitude: -74.045},
+		{Latitude: 4.628, Longitude: -74.045},
+	},
+}
+
+var teusaquillo = models.Sector{
+	ID:   "s2",
+	Name: "Teusaquillo",
+	City: "Bogota",
+	Polygon: geo.Polygon{
+		{Latitude: 4.62, Longitude: -74.1},
+		{Latitude: 4.66, Longitude: -74.1},
+		{Latitude: 4.66, Longitude: -74.07},
+		{Latitude: 4.62, Longitude: -74.07},
+	},
+}
+
+func mustSucceed(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func assertRouteIDs(t *testing.T, routes []models.Route, ids ...string) {
+	t.Helper()
+	if len(routes) != len(ids) {
+		t.Fatalf("expected routes %v, got %v routes", ids, len(routes))
+	}
+	for i, id := range ids {
+		if routes[i].ID != id {
+			t.Fatalf("expected route %v at position %v, got %v", id, i, routes[i].ID)
+		}
+	}
+}
+
+func assertLocationIDs(t *testing.T, locations []models.Location, ids ...string) {
+	t.Helper()
+	if len(locations) != len(ids) {
+		t.Fatalf("expected locations %v, got %v locations", ids, len(locations))
+	}
+	for i, id := range ids {
+		if locations[i].ID != id {
+			t.Fatalf("expected location %v at position %v, got %v", id, i, locations[i].ID)
+		}
+	}
+}
+
+// hoursFromNow is truncated to seconds, the precision timestamps are stored with
+func hoursFromNow(hours int) *time.Time {
+	t := time.Now().Add(time.Duration(hours) * time.Hour).Truncate(time.Second)
+	return &t
+}
+
+func gatherer(id string) models.User {
+	return models.User{
+		ID:        id,
+		Username:  id + "@reciapp.co",
+		Firstname: "Gabriel",
+		Lastname:  "Gatherer",
+		Type:      models.UserTypeGatherer,
+		Country:   "CO",
+	}
+}
+
+func location(id string, balance float64) models.Location {
+	return models.Location{
+		ID:        id,
+		CreatedBy: "u1",
+		Balance:   balance,
+		Name:      "Home " + id,
+		Country:   "CO",
+		City:      "Bogota",
+		State:     "Cundinamarca",
+		Address1:  "Calle 1 # 2-3",
+		Address2:  "Apto 101",
+		Latitude:  4.711,
+		Longitude: -74.0721,
+	}
+}
+
+func route(id string, status string, startsAt *time.Time) models.Route {
+	created := hoursFromNow(-24)
+	return models.Route{
+		ID:        id,
+		Sector:    "Chapinero",
+		SectorID:  "sector-chapinero",
+		Shift:     "AM",
+		Materials: []string{models.MaterialGlass, models.MaterialPaper},
+		Status:    status,
+		StartsAt:  startsAt,
+		Created:   created,
+	}
+}
+
+// routeWithPoints returns an initiated route with one pending picking point
+// per given location
+func routeWithPoints(id string, locationIDs ...string) models.Route {
+	r := route(id, models.RouteStatusInitiated, hoursFromNow(-1))
+	r.GathererID = "g1"
+	r.InitiatedAt = r.StartsAt
+	for i, locationID := range locationIDs {
+		r.PickingPoints = append(r.PickingPoints, models.PickingPoint{
+			ID:         id + "-pp" + string(rune('0'+i)),
+			LocationID: locationID,
+			Country:    "CO",
+			City:       "Bogota",
+			Latitude:   4.711,
+			Longitude:  -74.0721,
+			Address1:   "Calle 1 # 2-3",
+			Materials:  []string{models.MaterialGlass},
+			PickupCode: "code-" + locationID,
+			Created:    hoursFromNow(-24),
+		})
+	}
+	return r
+}
@@ -0,0 +1,81 @@
+package repositories_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories/contract"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/schema"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	uuid "github.com/satori/go.uuid"
+)
+
+// TestDynamoDBRepositoriesContract runs only when DYNAMODB_ENDPOINT points to
+// a DynamoDB Local instance, e.g. DYNAMODB_ENDPOINT=http://localhost:8000
+func TestDynamoDBRepositoriesContract(t *testing.T) {
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_ENDPOINT is not set")
+	}
+
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(endpoint),
+		Credentials: credentials.NewStaticCredentials("local", "local", ""),
+	}))
+	client := dynamodb.New(session)
+
+	contract.Run(t, func(t *testing.T) contract.Backend {
+		names := schema.DefaultNames.WithPrefix(uuid.NewV4().String() + "_")
+		err := schema.Create(client, names)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			schema.Drop(client, names)
+		})
+
+		return contract.Backend{
+			Users: repositories.NewDynamoDBUsersRepository(
+				client,
+				names.Users,
+			),
+			Locations: repositories.NewDynamoDBLocationsRepository(
+				client,
+				names.UserLocations,
+				names.Locations,
+			),
+			Routes: repositories.NewDynamoDBRoutesRepository(
+				client,
+				names.PickingRoutes,
+				names.Locations,
+				timeHelper,
+				internal.NewUUIDHelper(),
+			),
+			Idempotency: repositories.NewDynamoDBIdempotencyRepository(
+				client,
+				names.IdempotencyKeys,
+				timeHelper,
+			),
+			Tracking: repositories.NewDynamoDBTrackingRepository(
+				client,
+				names.GathererPositions,
+				timeHelper,
+			),
+			Sectors: repositories.NewDynamoDBSectorsRepository(
+				client,
+				names.Sectors,
+			),
+		}
+	})
+}
@@ -0,0 +1,117 @@
+// Package dynamodbtest provides a recording repositories.DynamoDBClient so
+// the exact requests issued by a repository can be asserted without AWS
+package dynamodbtest
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Recorder records every request it receives and answers them through the
+// optional On* hooks, requests without a hook get an empty output
+type Recorder struct {
+	mu sync.Mutex
+
+	Queries      []*dynamodb.QueryInput
+	BatchGets    []*dynamodb.BatchGetItemInput
+	Scans        []*dynamodb.ScanInput
+	Puts         []*dynamodb.PutItemInput
+	Updates      []*dynamodb.UpdateItemInput
+	Deletes      []*dynamodb.DeleteItemInput
+	Transactions []*dynamodb.TransactWriteItemsInput
+
+	OnQuery              func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	OnBatchGetItem       func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error)
+	OnScan               func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
+	OnPutItem            func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	OnUpdateItem         func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
+	OnDeleteItem         func(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+	OnTransactWriteItems func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	r.mu.Lock()
+	r.Queries = append(r.Queries, input)
+	r.mu.Unlock()
+	if r.OnQuery != nil {
+		return r.OnQuery(input)
+	}
+	return &dynamodb.QueryOutput{}, nil
+}
+
+func (r *Recorder) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	r.mu.Lock()
+	r.BatchGets = append(r.BatchGets, input)
+	r.mu.Unlock()
+	if r.OnBatchGetItem != nil {
+		return r.OnBatchGetItem(input)
+	}
+	return &dynamodb.BatchGetItemOutput{}, nil
+}
+
+func (r *Recorder) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	r.mu.Lock()
+	r.Scans = append(r.Scans, input)
+	r.mu.Unlock()
+	if r.OnScan != nil {
+		return r.OnScan(input)
+	}
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func (r *Recorder) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	r.mu.Lock()
+	r.Puts = append(r.Puts, input)
+	r.mu.Unlock()
+	if r.OnPutItem != nil {
+		return r.OnPutItem(input)
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (r *Recorder) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	r.mu.Lock()
+	r.Updates = append(r.Updates, input)
+	r.mu.Unlock()
+	if r.OnUpdateItem != nil {
+		return r.OnUpdateItem(input)
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (r *Recorder) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	r.mu.Lock()
+	r.Deletes = append(r.Deletes, input)
+	r.mu.Unlock()
+	if r.OnDeleteItem != nil {
+		return r.OnDeleteItem(input)
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (r *Recorder) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	r.mu.Lock()
+	r.Transactions = append(r.Transactions, input)
+	r.mu.Unlock()
+	if r.OnTransactWriteItems != nil {
+		return r.OnTransactWriteItems(input)
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// Expression collapses the whitespace of an expression so it can be compared
+// regardless of how it was indented on the source
+func Expression(expression *string) string {
+	if expression == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(*expression), " ")
+}
@@ -0,0 +1,200 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var ErrIdempotencyKeyInUse = errors.New("a request with the same idempotency key is in progress")
+
+// IdempotencyRecord is what is kept of a request made with an idempotency
+// key: a hash telling requests apart and, once Completed, the response to
+// replay. Records are forgotten after ExpiresAt
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	Completed   bool
+	StatusCode  int
+	Headers     map[string]string
+	Body        string
+	ExpiresAt   time.Time
+}
+
+func (r IdempotencyRecord) expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+type DynamoDBIdempotencyRepository struct {
+	client    DynamoDBClient
+	tableKeys string
+	clock     Clock
+}
+
+func NewDynamoDBIdempotencyRepository(client DynamoDBClient, tableKeys string, clock Clock) *DynamoDBIdempotencyRepository {
+	return &DynamoDBIdempotencyRepository{
+		client:    client,
+		tableKeys: tableKeys,
+		clock:     clock,
+	}
+}
+
+// Reserve records the key as in progress for lease. When the key is already
+// recorded nothing is written and the existing record is returned, reserved
+// being false. Expired records, which DynamoDB removes with some delay, are
+// taken over, so a request that died without releasing its key holds it only
+// until the lease ends
+func (r *DynamoDBIdempotencyRepository) Reserve(ctx context.Context, key string, requestHash string, lease time.Duration) (IdempotencyRecord, bool, error) {
+	now, err := nowFrom(r.clock)
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	record := IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(lease),
+	}
+
+	_, err = r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(r.tableKeys),
+		Item:                r.hydrateItem(record),
+		ConditionExpression: aws.String("attribute_not_exists(id) OR expires_at <= :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {
+				N: aws.String(strconv.FormatInt(now.Unix(), 10)),
+			},
+		},
+	})
+	if err == nil {
+		return record, true, nil
+	}
+	if !isConditionFailed(err) {
+		return IdempotencyRecord{}, false, err
+	}
+
+	existing, err := r.find(ctx, key)
+	return existing, false, err
+}
+
+// Complete stores the response of a reserved key, to be replayed for ttl
+func (r *DynamoDBIdempotencyRepository) Complete(ctx context.Context, record IdempotencyRecord, ttl time.Duration) error {
+	now, err := nowFrom(r.clock)
+	if err != nil {
+		return err
+	}
+	record.Completed = true
+	record.ExpiresAt = now.Add(ttl)
+	_, err = r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableKeys),
+		Item:      r.hydrateItem(record),
+	})
+	return err
+}
+
+// Release forgets a reserved key, so the request can be made again with it
+func (r *DynamoDBIdempotencyRepository) Release(ctx context.Context, key string) error {
+	_, err := r.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tableKeys),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(key),
+			},
+		},
+	})
+	return err
+}
+
+func (r *DynamoDBIdempotencyRepository) find(ctx context.Context, key string) (IdempotencyRecord, error) {
+	out, err := r.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableKeys),
+		KeyConditionExpression: aws.String("id = :id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {
+				S: aws.String(key),
+			},
+		},
+	})
+	if err != nil {
+		return IdempotencyRecord{}, err
+	}
+	if len(out.Items) == 0 {
+		// released right after the reservation failed, the request is
+		// still being made by someone else as far as the caller can tell
+		return IdempotencyRecord{}, ErrIdempotencyKeyInUse
+	}
+	return r.hydrateRecord(out.Items[0])
+}
+
+// hydrateItem stores expires_at as epoch seconds, the format DynamoDB TTL
+// expects
+func (r *DynamoDBIdempotencyRepository) hydrateItem(record IdempotencyRecord) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"id": {
+			S: aws.String(record.Key),
+		},
+		"request_hash": {
+			S: aws.String(record.RequestHash),
+		},
+		"completed": {
+			BOOL: aws.Bool(record.Completed),
+		},
+		"expires_at": {
+			N: aws.String(strconv.FormatInt(record.ExpiresAt.Unix(), 10)),
+		},
+	}
+	if !record.Completed {
+		return item
+	}
+
+	headers := map[string]*dynamodb.AttributeValue{}
+	for name, value := range record.Headers {
+		headers[name] = &dynamodb.AttributeValue{S: aws.String(value)}
+	}
+	item["status_code"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(record.StatusCode))}
+	item["headers"] = &dynamodb.AttributeValue{M: headers}
+	if record.Body != "" {
+		item["body"] = &dynamodb.AttributeValue{S: aws.String(record.Body)}
+	}
+	return item
+}
+
+func (r *DynamoDBIdempotencyRepository) hydrateRecord(item map[string]*dynamodb.AttributeValue) (IdempotencyRecord, error) {
+	record := IdempotencyRecord{}
+	if v, ok := item["id"]; ok {
+		record.Key = *v.S
+	}
+	if v, ok := item["request_hash"]; ok {
+		record.RequestHash = *v.S
+	}
+	if v, ok := item["completed"]; ok {
+		record.Completed = aws.BoolValue(v.BOOL)
+	}
+	if v, ok := item["expires_at"]; ok {
+		seconds, err := strconv.ParseInt(*v.N, 10, 64)
+		if err != nil {
+			return IdempotencyRecord{}, err
+		}
+		record.ExpiresAt = time.Unix(seconds, 0).UTC()
+	}
+	if v, ok := item["status_code"]; ok {
+		statusCode, err := strconv.Atoi(*v.N)
+		if err != nil {
+			return IdempotencyRecord{}, err
+		}
+		record.StatusCode = statusCode
+	}
+	if v, ok := item["headers"]; ok {
+		record.Headers = map[string]string{}
+		for name, value := range v.M {
+			record.Headers[name] = aws.StringValue(value.S)
+		}
+	}
+	if v, ok := item["body"]; ok {
+		record.Body = *v.S
+	}
+	return record, nil
+}
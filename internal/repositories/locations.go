@@ -1,10 +1,14 @@
 package repositories
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"strconv"
 
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
 	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
@@ -14,13 +18,25 @@ var ErrNoLocationsFound = errors.New("no_locations_found")
 
 var ErrLocationNotFound = errors.New("location_not_found")
 
+var ErrAreaTooLarge = errors.New("the search area is too large")
+
+const (
+	// geohashPrecision is the one locations are stored with, about 5 m wide
+	geohashPrecision = 9
+	// geohashCellPrecision is the one of the cells locations are indexed by,
+	// about 5 km wide, so a neighborhood is queried with a handful of them
+	geohashCellPrecision = 5
+	// maxGeohashCells bounds the queries run for a single area
+	maxGeohashCells = 64
+)
+
 type DynamoDBLocationsRespository struct {
-	client             *dynamodb.DynamoDB
+	client             DynamoDBClient
 	tableUserLocations string
 	tableLocations     string
 }
 
-func NewDynamoDBLocationsRepository(client *dynamodb.DynamoDB, tableUserLocations string, tableLocations string) *DynamoDBLocationsRespository {
+func NewDynamoDBLocationsRepository(client DynamoDBClient, tableUserLocations string, tableLocations string) *DynamoDBLocationsRespository {
 	return &DynamoDBLocationsRespository{
 		client:             client,
 		tableUserLocations: tableUserLocations,
@@ -28,8 +44,8 @@ func NewDynamoDBLocationsRepository(client *dynamodb.DynamoDB, tableUserLocation
 	}
 }
 
-func (r *DynamoDBLocationsRespository) Find(id string) (models.Location, error) {
-	out, err := r.client.Query(&dynamodb.QueryInput{
+func (r *DynamoDBLocationsRespository) Find(ctx context.Context, id string) (models.Location, error) {
+	out, err := r.client.QueryWithContext(ctx, &dynamodb.QueryInput{
 		TableName: aws.String(r.tableLocations),
 		KeyConditions: map[string]*dynamodb.Condition{
 			"id": {
@@ -51,8 +67,116 @@ func (r *DynamoDBLocationsRespository) Find(id string) (models.Location, error)
 	return r.hydrateLocation(out.Items[0])
 }
 
-func (r *DynamoDBLocationsRespository) GetScoreByUserID(userID string) (int, error) {
-	locations, err := r.FindByUserID(userID)
+// Save puts the whole location item, it is meant for seeding and admin tasks
+func (r *DynamoDBLocationsRespository) Save(ctx context.Context, location models.Location) error {
+	item := map[string]*dynamodb.AttributeValue{
+		"id": {
+			S: aws.String(location.ID),
+		},
+		"created_by": {
+			S: aws.String(location.CreatedBy),
+		},
+		"balance": {
+			N: aws.String(strconv.FormatFloat(location.Balance, 'f', -1, 64)),
+		},
+		"name": {
+			S: aws.String(location.Name),
+		},
+		"country": {
+			S: aws.String(location.Country),
+		},
+		"city": {
+			S: aws.String(location.City),
+		},
+		"state": {
+			S: aws.String(location.State),
+		},
+		"address_1": {
+			S: aws.String(location.Address1),
+		},
+		"address_2": {
+			S: aws.String(location.Address2),
+		},
+		"latitude": {
+			N: aws.String(fmt.Sprintf("%f", location.Latitude)),
+		},
+		"longitude": {
+			N: aws.String(fmt.Sprintf("%f", location.Longitude)),
+		},
+	}
+	for name, value := range geohashAttributes(location.Latitude, location.Longitude) {
+		item[name] = value
+	}
+	if location.Timezone != "" {
+		item["timezone"] = &dynamodb.AttributeValue{S: aws.String(location.Timezone)}
+	}
+	if len(location.BalanceAdjustments) > 0 {
+		item["balance_adjustments"] = r.hydrateBalanceAdjustments(location.BalanceAdjustments)
+	}
+	_, err := r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableLocations),
+		Item:      item,
+	})
+	return err
+}
+
+// AdjustBalance adds the amount of the adjustment, negative to debit, to the
+// location balance and keeps the adjustment on the location item as audit
+// trail
+func (r *DynamoDBLocationsRespository) AdjustBalance(ctx context.Context, locationID string, adjustment models.BalanceAdjustment) error {
+	_, err := r.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableLocations),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(locationID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		UpdateExpression: aws.String(
+			"set balance = balance + :amount, " +
+				"balance_adjustments = list_append(if_not_exists(balance_adjustments, :empty), :adjustments)",
+		),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":amount": {
+				N: aws.String(strconv.FormatFloat(adjustment.Amount, 'f', -1, 64)),
+			},
+			":empty": {
+				L: []*dynamodb.AttributeValue{},
+			},
+			":adjustments": r.hydrateBalanceAdjustments([]models.BalanceAdjustment{adjustment}),
+		},
+	})
+	if err != nil {
+		log.Printf("locationsRepo AdjustBalance error: %v\n", err)
+		if isConditionFailed(err) {
+			return ErrLocationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Link relates a location to a user through a user_locations item
+func (r *DynamoDBLocationsRespository) Link(ctx context.Context, userID string, locationID string) error {
+	_, err := r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableUserLocations),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(userID + "#" + locationID),
+			},
+			"user_id": {
+				S: aws.String(userID),
+			},
+			"location_id": {
+				S: aws.String(locationID),
+			},
+		},
+	})
+	return err
+}
+
+func (r *DynamoDBLocationsRespository) GetScoreByUserID(ctx context.Context, userID string) (int, error) {
+	locations, err := r.FindByUserID(ctx, userID)
 	if err != nil {
 		return 0, err
 	}
@@ -63,9 +187,9 @@ func (r *DynamoDBLocationsRespository) GetScoreByUserID(userID string) (int, err
 	return score, nil
 }
 
-func (r *DynamoDBLocationsRespository) FindByUserID(id string) ([]models.Location, error) {
+func (r *DynamoDBLocationsRespository) FindByUserID(ctx context.Context, id string) ([]models.Location, error) {
 	log.Printf("Finding user_locations by user id (%s)\n", id)
-	out, err := r.client.Query(&dynamodb.QueryInput{
+	items, _, err := queryPages(ctx, r.client, &dynamodb.QueryInput{
 		TableName:              aws.String(r.tableUserLocations),
 		IndexName:              aws.String("by_user_id"),
 		KeyConditionExpression: aws.String("user_id = :userID"),
@@ -74,42 +198,154 @@ func (r *DynamoDBLocationsRespository) FindByUserID(id string) ([]models.Locatio
 				S: aws.String(id),
 			},
 		},
-	})
+	}, PageQuery{})
 	if err != nil {
 		return nil, err
 	}
-	if len(out.Items) == 0 {
+	if len(items) == 0 {
 		return nil, ErrNoLocationsFound
 	}
 
-	log.Printf("Finding locations..\n")
-	userLocations := make([]models.Location, len(out.Items))
-	for i, item := range out.Items {
-		locationID := item["location_id"].S
-		out, err := r.client.Query(&dynamodb.QueryInput{
-			TableName: aws.String(r.tableLocations),
-			KeyConditions: map[string]*dynamodb.Condition{
-				"id": {
-					ComparisonOperator: aws.String("EQ"),
-					AttributeValueList: []*dynamodb.AttributeValue{
-						{
-							S: locationID,
-						},
-					},
-				},
-			},
-		})
+	// Links without a string location_id point nowhere, they are skipped
+	// like the ones to missing locations
+	locationIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		locationID := item["location_id"]
+		if locationID == nil || locationID.S == nil || *locationID.S == "" {
+			warnDanglingLocation(id, "")
+			continue
+		}
+		locationIDs = append(locationIDs, *locationID.S)
+	}
+
+	log.Printf("Finding %v locations..\n", len(locationIDs))
+	locationItems, err := batchGetItems(ctx, r.client, r.tableLocations, stringKeys("id", locationIDs))
+	if err != nil {
+		return nil, err
+	}
+	locations := make(map[string]models.Location, len(locationItems))
+	for _, item := range locationItems {
+		location, err := r.hydrateLocation(item)
 		if err != nil {
 			return nil, err
 		}
+		locations[location.ID] = location
+	}
+
+	// Links to locations that no longer exist are skipped, the user keeps
+	// seeing the rest of them. With none left the user has no locations,
+	// same as without links
+	userLocations := []models.Location{}
+	for _, locationID := range locationIDs {
+		location, ok := locations[locationID]
+		if !ok {
+			warnDanglingLocation(id, locationID)
+			continue
+		}
+		userLocations = append(userLocations, location)
+	}
+	if len(userLocations) == 0 {
+		return nil, ErrNoLocationsFound
+	}
+
+	return userLocations, nil
+}
 
-		userLocations[i], err = r.hydrateLocation(out.Items[0])
+// FindWithinBox returns the locations inside the box sorted by id, querying
+// the by_geohash_cell index once per cell the box spans. Boxes spanning too
+// many cells fail with ErrAreaTooLarge
+func (r *DynamoDBLocationsRespository) FindWithinBox(ctx context.Context, box geo.Box) ([]models.Location, error) {
+	cells, err := geo.Cells(box, geohashCellPrecision, maxGeohashCells)
+	if err == geo.ErrTooManyCells {
+		return nil, ErrAreaTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Finding locations within %v geohash cells..\n", len(cells))
+	locations := []models.Location{}
+	for _, cell := range cells {
+		items, _, err := queryPages(ctx, r.client, &dynamodb.QueryInput{
+			TableName:              aws.String(r.tableLocations),
+			IndexName:              aws.String("by_geohash_cell"),
+			KeyConditionExpression: aws.String("geohash_cell = :cell"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":cell": {
+					S: aws.String(cell),
+				},
+			},
+		}, PageQuery{})
 		if err != nil {
 			return nil, err
 		}
+		for _, item := range items {
+			location, err := r.hydrateLocation(item)
+			if err != nil {
+				return nil, err
+			}
+			if box.Contains(location.Latitude, location.Longitude) {
+				locations = append(locations, location)
+			}
+		}
 	}
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i].ID < locations[j].ID
+	})
+	return locations, nil
+}
 
-	return userLocations, nil
+// FindWithinRadius returns the locations at most radius meters away from the
+// point, the closest first
+func (r *DynamoDBLocationsRespository) FindWithinRadius(ctx context.Context, lat float64, lon float64, radius float64) ([]models.Location, error) {
+	locations, err := r.FindWithinBox(ctx, geo.BoxAround(lat, lon, radius))
+	if err != nil {
+		return nil, err
+	}
+	return withinRadius(locations, lat, lon, radius), nil
+}
+
+// withinRadius keeps the locations at most radius meters away from the
+// point, sorted by distance and then by id
+func withinRadius(locations []models.Location, lat float64, lon float64, radius float64) []models.Location {
+	distances := map[string]float64{}
+	near := []models.Location{}
+	for _, location := range locations {
+		distance := geo.Distance(lat, lon, location.Latitude, location.Longitude)
+		if distance <= radius {
+			distances[location.ID] = distance
+			near = append(near, location)
+		}
+	}
+	sort.Slice(near, func(i, j int) bool {
+		di, dj := distances[near[i].ID], distances[near[j].ID]
+		if di != dj {
+			return di < dj
+		}
+		return near[i].ID < near[j].ID
+	})
+	return near
+}
+
+// geohashAttributes are the attributes locations are indexed by on
+// by_geohash_cell: the cell as hash key and the full geohash as range key
+func geohashAttributes(lat float64, lon float64) map[string]*dynamodb.AttributeValue {
+	hash := geo.Encode(lat, lon, geohashPrecision)
+	return map[string]*dynamodb.AttributeValue{
+		"geohash": {
+			S: aws.String(hash),
+		},
+		"geohash_cell": {
+			S: aws.String(hash[:geohashCellPrecision]),
+		},
+	}
+}
+
+// warnDanglingLocation reports a user_locations item pointing to a missing
+// location, or to none when locationID is empty, it is a data integrity
+// issue to be fixed on the table
+func warnDanglingLocation(userID string, locationID string) {
+	log.Printf("WARNING data integrity: user (%s) is linked to missing location (%s)\n", userID, locationID)
 }
 
 func (r *DynamoDBLocationsRespository) hydrateLocation(
@@ -162,5 +398,73 @@ func (r *DynamoDBLocationsRespository) hydrateLocation(
 		location.Longitude = floatVal
 
 	}
+	if v, ok := item["timezone"]; ok {
+		location.Timezone = *v.S
+	}
+	if v, ok := item["balance_adjustments"]; ok {
+		for _, adjustmentItem := range v.L {
+			adjustment, err := r.hydrateBalanceAdjustment(adjustmentItem.M)
+			if err != nil {
+				return models.Location{}, err
+			}
+			location.BalanceAdjustments = append(location.BalanceAdjustments, adjustment)
+		}
+	}
 	return location, nil
 }
+
+func (r *DynamoDBLocationsRespository) hydrateBalanceAdjustments(
+	adjustments []models.BalanceAdjustment,
+) *dynamodb.AttributeValue {
+	list := make([]*dynamodb.AttributeValue, len(adjustments))
+	for i, adjustment := range adjustments {
+		created := "-"
+		if adjustment.Created != nil {
+			created = formatTime(*adjustment.Created)
+		}
+		list[i] = &dynamodb.AttributeValue{
+			M: map[string]*dynamodb.AttributeValue{
+				"amount": {
+					N: aws.String(strconv.FormatFloat(adjustment.Amount, 'f', -1, 64)),
+				},
+				"reason": {
+					S: aws.String(adjustment.Reason),
+				},
+				"created_by": {
+					S: aws.String(orUnset(adjustment.CreatedBy)),
+				},
+				"created_at": {
+					S: aws.String(created),
+				},
+			},
+		}
+	}
+	return &dynamodb.AttributeValue{L: list}
+}
+
+func (r *DynamoDBLocationsRespository) hydrateBalanceAdjustment(
+	item map[string]*dynamodb.AttributeValue,
+) (models.BalanceAdjustment, error) {
+	adjustment := models.BalanceAdjustment{}
+	if v, ok := item["amount"]; ok {
+		floatVal, err := strconv.ParseFloat(*v.N, 64)
+		if err != nil {
+			return models.BalanceAdjustment{}, err
+		}
+		adjustment.Amount = floatVal
+	}
+	if v, ok := item["reason"]; ok {
+		adjustment.Reason = *v.S
+	}
+	if v, ok := item["created_by"]; ok && *v.S != "-" {
+		adjustment.CreatedBy = *v.S
+	}
+	if v, ok := item["created_at"]; ok && *v.S != "-" {
+		created, err := parseTime(*v.S)
+		if err != nil {
+			return models.BalanceAdjustment{}, err
+		}
+		adjustment.Created = &created
+	}
+	return adjustment, nil
+}
@@ -0,0 +1,243 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories/dynamodbtest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// linkedLocations answers the user_locations query with a link to each id
+// and the batch gets with the locations present reports as existing
+func linkedLocations(recorder *dynamodbtest.Recorder, ids []string, present func(id string) bool) {
+	recorder.OnQuery = func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		items := make([]map[string]*dynamodb.AttributeValue, len(ids))
+		for i, id := range ids {
+			items[i] = map[string]*dynamodb.AttributeValue{"location_id": {S: aws.String(id)}}
+		}
+		return &dynamodb.QueryOutput{Items: items}, nil
+	}
+	recorder.OnBatchGetItem = func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		items := []map[string]*dynamodb.AttributeValue{}
+		for _, key := range input.RequestItems["locations"].Keys {
+			if present(*key["id"].S) {
+				items = append(items, map[string]*dynamodb.AttributeValue{"id": key["id"]})
+			}
+		}
+		return &dynamodb.BatchGetItemOutput{
+			Responses: map[string][]map[string]*dynamodb.AttributeValue{"locations": items},
+		}, nil
+	}
+}
+
+func TestFindByUserIDBatchesLocations(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	repo := repositories.NewDynamoDBLocationsRepository(recorder, "user_locations", "locations")
+	ids := make([]string, 150)
+	for i := range ids {
+		ids[i] = "l" + strconv.Itoa(i)
+	}
+	linkedLocations(recorder, ids, func(id string) bool { return true })
+
+	locations, err := repo.FindByUserID(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.BatchGets) != 2 {
+		t.Fatalf("expected 2 batch gets, got %v", len(recorder.BatchGets))
+	}
+	if n := len(recorder.BatchGets[0].RequestItems["locations"].Keys); n != 100 {
+		t.Fatalf("expected a first chunk of 100 keys, got %v", n)
+	}
+	if len(recorder.Queries) != 1 {
+		t.Fatalf("expected only the user_locations query, got %v queries", len(recorder.Queries))
+	}
+	if len(locations) != 150 || locations[0].ID != "l0" || locations[149].ID != "l149" {
+		t.Fatalf("expected the 150 locations in link order, got %v", len(locations))
+	}
+}
+
+func TestFindByUserIDRetriesUnprocessedKeys(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	repo := repositories.NewDynamoDBLocationsRepository(recorder, "user_locations", "locations")
+	linkedLocations(recorder, []string{"l1", "l2"}, func(id string) bool { return true })
+	answer := recorder.OnBatchGetItem
+	recorder.OnBatchGetItem = func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		if len(recorder.BatchGets) > 1 {
+			return answer(input)
+		}
+		keys := input.RequestItems["locations"].Keys
+		return &dynamodb.BatchGetItemOutput{
+			Responses: map[string][]map[string]*dynamodb.AttributeValue{
+				"locations": {{"id": keys[0]["id"]}},
+			},
+			UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{
+				"locations": {Keys: keys[1:]},
+			},
+		}, nil
+	}
+
+	locations, err := repo.FindByUserID(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retried := recorder.BatchGets[1].RequestItems["locations"].Keys
+	if len(retried) != 1 {
+		t.Fatalf("expected only the unprocessed key to be retried, got %v", len(retried))
+	}
+	assertS(t, "retried key", "l2", retried[0]["id"])
+	if len(locations) != 2 {
+		t.Fatalf("expected 2 locations, got %v", len(locations))
+	}
+}
+
+func TestFindByUserIDGivesUpOnPersistentUnprocessedKeys(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	repo := repositories.NewDynamoDBLocationsRepository(recorder, "user_locations", "locations")
+	linkedLocations(recorder, []string{"l1"}, func(id string) bool { return true })
+	recorder.OnBatchGetItem = func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		return &dynamodb.BatchGetItemOutput{UnprocessedKeys: input.RequestItems}, nil
+	}
+
+	_, err := repo.FindByUserID(ctx, "u1")
+	if !errors.Is(err, repositories.ErrBatchIncomplete) {
+		t.Fatalf("expected ErrBatchIncomplete, got %v", err)
+	}
+}
+
+func TestFindByUserIDStopsRetryingOnceCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorder := dynamodbtest.NewRecorder()
+	repo := repositories.NewDynamoDBLocationsRepository(recorder, "user_locations", "locations")
+	linkedLocations(recorder, []string{"l1"}, func(id string) bool { return true })
+	recorder.OnBatchGetItem = func(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		// the client gave up on the request while the keys were unprocessed
+		cancel()
+		return &dynamodb.BatchGetItemOutput{UnprocessedKeys: input.RequestItems}, nil
+	}
+
+	_, err := repo.FindByUserID(ctx, "u1")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(recorder.BatchGets) != 1 {
+		t.Fatalf("expected no retry after the cancellation, got %v batch gets", len(recorder.BatchGets))
+	}
+}
+
+func TestFindByUserIDSkipsDanglingLinks(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	repo := repositories.NewDynamoDBLocationsRepository(recorder, "user_locations", "locations")
+	linkedLocations(recorder, []string{"l1", "missing", "l2"}, func(id string) bool { return id != "missing" })
+
+	locations, err := repo.FindByUserID(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2 || locations[0].ID != "l1" || locations[1].ID != "l2" {
+		t.Fatalf("expected l1 and l2, got %#v", locations)
+	}
+}
+
+func TestSaveIndexesLocationsByGeohash(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	repo := repositories.NewDynamoDBLocationsRepository(recorder, "user_locations", "locations")
+
+	err := repo.Save(ctx, models.Location{ID: "l1", Latitude: 4.6415, Longitude: -74.0652})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := recorder.Puts[0].Item
+	assertS(t, "geohash", "d2g66sgqe", item["geohash"])
+	assertS(t, "geohash_cell", "d2g66", item["geohash_cell"])
+}
+
+func TestFindWithinBoxQueriesEveryCell(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	repo := repositories.NewDynamoDBLocationsRepository(recorder, "user_locations", "locations")
+	recorder.OnQuery = func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		if *input.ExpressionAttributeValues[":cell"].S != "d2g66" {
+			return &dynamodb.QueryOutput{}, nil
+		}
+		return &dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{
+			{"id": {S: aws.String("inside")}, "latitude": {N: aws.String("4.6415")}, "longitude": {N: aws.String("-74.0652")}},
+			{"id": {S: aws.String("outside")}, "latitude": {N: aws.String("4.6300")}, "longitude": {N: aws.String("-74.0652")}},
+		}}, nil
+	}
+
+	locations, err := repo.FindWithinBox(ctx, geo.Box{
+		MinLatitude: 4.64, MinLongitude: -74.07, MaxLatitude: 4.66, MaxLongitude: -74.05,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cells, _ := geo.Cells(geo.Box{
+		MinLatitude: 4.64, MinLongitude: -74.07, MaxLatitude: 4.66, MaxLongitude: -74.05,
+	}, 5, 64)
+	if len(recorder.Queries) != len(cells) {
+		t.Fatalf("expected a query per cell (%v), got %v", len(cells), len(recorder.Queries))
+	}
+	assertString(t, "index", "by_geohash_cell", recorder.Queries[0].IndexName)
+	if len(locations) != 1 || locations[0].ID != "inside" {
+		t.Fatalf("expected only the location inside the box, got %#v", locations)
+	}
+}
+
+func TestFindWithinBoxRejectsLargeAreas(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	repo := repositories.NewDynamoDBLocationsRepository(recorder, "user_locations", "locations")
+
+	_, err := repo.FindWithinBox(ctx, geo.Box{MinLatitude: 4, MinLongitude: -75, MaxLatitude: 5, MaxLongitude: -74})
+	if err != repositories.ErrAreaTooLarge {
+		t.Fatalf("expected ErrAreaTooLarge, got %v", err)
+	}
+	if len(recorder.Queries) != 0 {
+		t.Fatalf("expected no queries, got %v", len(recorder.Queries))
+	}
+}
+
+func TestFindByUserIDSkipsLinksWithoutLocationID(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	repo := repositories.NewDynamoDBLocationsRepository(recorder, "user_locations", "locations")
+	linkedLocations(recorder, []string{"l1", "l2"}, func(id string) bool { return true })
+	recorder.OnQuery = func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		return &dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{
+			{"location_id": {S: aws.String("l1")}},
+			{"user_id": {S: aws.String("u1")}},
+			{"location_id": {N: aws.String("7")}},
+			{"location_id": {S: aws.String("")}},
+			{"location_id": {S: aws.String("l2")}},
+		}}, nil
+	}
+
+	locations, err := repo.FindByUserID(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2 || locations[0].ID != "l1" || locations[1].ID != "l2" {
+		t.Fatalf("expected l1 and l2, got %#v", locations)
+	}
+	if n := len(recorder.BatchGets[0].RequestItems["locations"].Keys); n != 2 {
+		t.Fatalf("expected only the 2 linked ids to be requested, got %v", n)
+	}
+}
@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// InMemoryIdempotencyRepository is a thread-safe, non persistent replacement
+// of DynamoDBIdempotencyRepository, meant for tests and local runs
+type InMemoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+	clock   Clock
+}
+
+func NewInMemoryIdempotencyRepository(clock Clock) *InMemoryIdempotencyRepository {
+	return &InMemoryIdempotencyRepository{
+		records: map[string]IdempotencyRecord{},
+		clock:   clock,
+	}
+}
+
+func (r *InMemoryIdempotencyRepository) Reserve(ctx context.Context, key string, requestHash string, lease time.Duration) (IdempotencyRecord, bool, error) {
+	now, err := nowFrom(r.clock)
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.records[key]; ok && !existing.expired(now) {
+		return copyRecord(existing), false, nil
+	}
+	record := IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(lease),
+	}
+	r.records[key] = record
+	return record, true, nil
+}
+
+func (r *InMemoryIdempotencyRepository) Complete(ctx context.Context, record IdempotencyRecord, ttl time.Duration) error {
+	now, err := nowFrom(r.clock)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record.Completed = true
+	record.ExpiresAt = now.Add(ttl)
+	r.records[record.Key] = copyRecord(record)
+	return nil
+}
+
+func (r *InMemoryIdempotencyRepository) Release(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, key)
+	return nil
+}
+
+func copyRecord(record IdempotencyRecord) IdempotencyRecord {
+	if record.Headers != nil {
+		headers := make(map[string]string, len(record.Headers))
+		for name, value := range record.Headers {
+			headers[name] = value
+		}
+		record.Headers = headers
+	}
+	return record
+}
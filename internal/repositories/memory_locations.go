@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+// InMemoryLocationsRepository is a thread-safe, non persistent replacement of
+// DynamoDBLocationsRespository, meant for tests and local runs
+type InMemoryLocationsRepository struct {
+	mu            sync.RWMutex
+	locations     map[string]models.Location
+	userLocations map[string][]string
+}
+
+func NewInMemoryLocationsRepository() *InMemoryLocationsRepository {
+	return &InMemoryLocationsRepository{
+		locations:     map[string]models.Location{},
+		userLocations: map[string][]string{},
+	}
+}
+
+func (r *InMemoryLocationsRepository) Save(ctx context.Context, location models.Location) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.locations[location.ID] = location
+	return nil
+}
+
+// Link relates a location to a user, the same way a user_locations item does
+func (r *InMemoryLocationsRepository) Link(ctx context.Context, userID string, locationID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range r.userLocations[userID] {
+		if id == locationID {
+			return nil
+		}
+	}
+	r.userLocations[userID] = append(r.userLocations[userID], locationID)
+	return nil
+}
+
+func (r *InMemoryLocationsRepository) Find(ctx context.Context, id string) (models.Location, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	location, ok := r.locations[id]
+	if !ok {
+		return models.Location{}, ErrLocationNotFound
+	}
+	return location, nil
+}
+
+func (r *InMemoryLocationsRepository) GetScoreByUserID(ctx context.Context, userID string) (int, error) {
+	locations, err := r.FindByUserID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	score := 0
+	for _, l := range locations {
+		score += int(l.Balance)
+	}
+	return score, nil
+}
+
+func (r *InMemoryLocationsRepository) FindByUserID(ctx context.Context, id string) ([]models.Location, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	locationIDs := r.userLocations[id]
+	if len(locationIDs) == 0 {
+		return nil, ErrNoLocationsFound
+	}
+	userLocations := []models.Location{}
+	for _, locationID := range locationIDs {
+		location, ok := r.locations[locationID]
+		if !ok {
+			warnDanglingLocation(id, locationID)
+			continue
+		}
+		userLocations = append(userLocations, location)
+	}
+	if len(userLocations) == 0 {
+		return nil, ErrNoLocationsFound
+	}
+	sort.Slice(userLocations, func(i, j int) bool {
+		return userLocations[i].ID < userLocations[j].ID
+	})
+	return userLocations, nil
+}
+
+// FindWithinBox scans every location, areas are still limited the way
+// DynamoDBLocationsRespository limits them
+func (r *InMemoryLocationsRepository) FindWithinBox(ctx context.Context, box geo.Box) ([]models.Location, error) {
+	_, err := geo.Cells(box, geohashCellPrecision, maxGeohashCells)
+	if err == geo.ErrTooManyCells {
+		return nil, ErrAreaTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	locations := []models.Location{}
+	for _, location := range r.locations {
+		if box.Contains(location.Latitude, location.Longitude) {
+			locations = append(locations, location)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i].ID < locations[j].ID
+	})
+	return locations, nil
+}
+
+func (r *InMemoryLocationsRepository) FindWithinRadius(ctx context.Context, lat float64, lon float64, radius float64) ([]models.Location, error) {
+	locations, err := r.FindWithinBox(ctx, geo.BoxAround(lat, lon, radius))
+	if err != nil {
+		return nil, err
+	}
+	return withinRadius(locations, lat, lon, radius), nil
+}
+
+func (r *InMemoryLocationsRepository) AdjustBalance(ctx context.Context, locationID string, adjustment models.BalanceAdjustment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	location, ok := r.locations[locationID]
+	if !ok {
+		return ErrLocationNotFound
+	}
+	location.Balance += adjustment.Amount
+	location.BalanceAdjustments = append(
+		append([]models.BalanceAdjustment{}, location.BalanceAdjustments...),
+		adjustment,
+	)
+	r.locations[locationID] = location
+	return nil
+}
+
+func (r *InMemoryLocationsRepository) credit(locationID string, score int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	location, ok := r.locations[locationID]
+	if !ok {
+		return ErrLocationNotFound
+	}
+	location.Balance += float64(score)
+	r.locations[locationID] = location
+	return nil
+}
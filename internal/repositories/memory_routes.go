@@ -0,0 +1,421 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+// InMemoryRoutesRepository is a thread-safe, non persistent replacement of
+// DynamoDBRoutesRepository, meant for tests and local runs. Finishing a
+// picking point credits the balance on the given locations repository, the
+// same way the DynamoDB transaction does
+type InMemoryRoutesRepository struct {
+	mu            sync.RWMutex
+	routes        map[string]models.Route
+	locationsRepo *InMemoryLocationsRepository
+	clock         Clock
+	uuidHelper    UUIDHelper
+}
+
+func NewInMemoryRoutesRepository(
+	locationsRepo *InMemoryLocationsRepository,
+	clock Clock,
+	uuidHelper UUIDHelper,
+) *InMemoryRoutesRepository {
+	return &InMemoryRoutesRepository{
+		routes:        map[string]models.Route{},
+		locationsRepo: locationsRepo,
+		clock:         clock,
+		uuidHelper:    uuidHelper,
+	}
+}
+
+// Save stores the route as is, a "-" gatherer id is taken as unassigned the
+// same way it is on the picking_routes table
+func (r *InMemoryRoutesRepository) Save(ctx context.Context, route models.Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if route.GathererID == "-" {
+		route.GathererID = ""
+	}
+	r.routes[route.ID] = copyRoute(route)
+	return nil
+}
+
+func (r *InMemoryRoutesRepository) Find(ctx context.Context, routeID string) (models.Route, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	route, ok := r.routes[routeID]
+	if !ok {
+		return models.Route{}, ErrRouteNotFound
+	}
+	return copyRoute(route), nil
+}
+
+func (r *InMemoryRoutesRepository) Initiate(ctx context.Context, routeID string, at time.Time) error {
+	now, err := timeOrNow(&at, r.clock)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	route, ok := r.routes[routeID]
+	if !ok {
+		return ErrRouteNotFound
+	}
+	route.InitiatedAt = &now
+	route.Status = models.RouteStatusInitiated
+	r.routes[routeID] = route
+	return nil
+}
+
+func (r *InMemoryRoutesRepository) FinishPickingPoint(
+	ctx context.Context,
+	routeID string,
+	pickingPointIndex int,
+	pickingPoint models.PickingPoint,
+	score int,
+	remaining int,
+) error {
+	now, err := timeOrNow(pickingPoint.PickedAt, r.clock)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	route, ok := r.routes[routeID]
+	if !ok {
+		return ErrRouteNotFound
+	}
+	if pickingPointIndex < 0 || pickingPointIndex >= len(route.PickingPoints) {
+		return ErrPickingPointNotFound
+	}
+
+	stored := route.PickingPoints[pickingPointIndex]
+	if pickingPoint.CodeUsedAt != nil {
+		if stored.PickupCode != pickingPoint.PickupCode || stored.CodeUsedAt != nil {
+			return ErrPickupCodeAlreadyUsed
+		}
+		stored.CodeUsedAt = &now
+	}
+	if score > 0 {
+		if _, err := r.locationsRepo.Find(ctx, stored.LocationID); err != nil {
+			return err
+		}
+	}
+
+	stored.PickedAt = &now
+	stored.Quantities = copyQuantities(pickingPoint.Quantities)
+	if pickingPoint.FinishFix != nil {
+		fix := *pickingPoint.FinishFix
+		stored.FinishFix = &fix
+	}
+	route.PickingPoints[pickingPointIndex] = stored
+	if remaining == 1 {
+		route.Status = models.RouteStatusFinished
+		route.FinishedAt = &now
+	}
+	r.routes[routeID] = route
+
+	if score > 0 {
+		return r.locationsRepo.credit(stored.LocationID, score)
+	}
+	return nil
+}
+
+func (r *InMemoryRoutesRepository) FailPickingPoint(
+	ctx context.Context,
+	routeID string,
+	pickingPointIndex int,
+	pickingPoint models.PickingPoint,
+	remaining int,
+) error {
+	now, err := timeOrNow(pickingPoint.FailedAt, r.clock)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	route, ok := r.routes[routeID]
+	if !ok {
+		return ErrRouteNotFound
+	}
+	if pickingPointIndex < 0 || pickingPointIndex >= len(route.PickingPoints) {
+		return ErrPickingPointNotFound
+	}
+
+	stored := route.PickingPoints[pickingPointIndex]
+	stored.FailedAt = &now
+	stored.FailureReason = pickingPoint.FailureReason
+	stored.FailureNote = strings.TrimSpace(pickingPoint.FailureNote)
+	if pickingPoint.FinishFix != nil {
+		fix := *pickingPoint.FinishFix
+		stored.FinishFix = &fix
+	}
+	route.PickingPoints[pickingPointIndex] = stored
+	if remaining == 1 {
+		route.Status = models.RouteStatusFinished
+		route.FinishedAt = &now
+	}
+	r.routes[routeID] = route
+	return nil
+}
+
+func (r *InMemoryRoutesRepository) AttachPhoto(ctx context.Context, routeID string, pickingPointIndex int, photo models.Photo) error {
+	now, err := r.now()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	route, ok := r.routes[routeID]
+	if !ok {
+		return ErrRouteNotFound
+	}
+	if pickingPointIndex < 0 || pickingPointIndex >= len(route.PickingPoints) {
+		return ErrPickingPointNotFound
+	}
+	for _, pickingPoint := range route.PickingPoints {
+		for _, attached := range pickingPoint.Photos {
+			if attached.Key == photo.Key {
+				return ErrPhotoAlreadyAttached
+			}
+		}
+	}
+	photo.Created = &now
+	route.PickingPoints[pickingPointIndex].Photos = append(route.PickingPoints[pickingPointIndex].Photos, photo)
+	r.routes[routeID] = route
+	return nil
+}
+
+func (r *InMemoryRoutesRepository) GetAssignedRoutesbyUserID(ctx context.Context, userID string) ([]models.Route, error) {
+	routes := r.filter(func(route models.Route) bool {
+		return route.GathererID == userID && route.FinishedAt == nil
+	})
+	if len(routes) == 0 {
+		return nil, ErrNoAssignedRoutes
+	}
+	return routes, nil
+}
+
+func (r *InMemoryRoutesRepository) FindAssignedRoutesPage(ctx context.Context, userID string, page PageQuery) (RoutesPage, error) {
+	return pageRoutes(r.filter(func(route models.Route) bool {
+		return route.GathererID == userID && route.FinishedAt == nil
+	}), page)
+}
+
+func (r *InMemoryRoutesRepository) FindAvailableRoutes(
+	ctx context.Context,
+	currentTime time.Time,
+	maxTime time.Time,
+) ([]models.Route, error) {
+	page, err := r.FindAvailableRoutesPage(ctx, currentTime, maxTime, PageQuery{})
+	return page.Routes, err
+}
+
+func (r *InMemoryRoutesRepository) FindAvailableRoutesPage(
+	ctx context.Context,
+	currentTime time.Time,
+	maxTime time.Time,
+	page PageQuery,
+) (RoutesPage, error) {
+	return pageRoutes(r.filter(func(route models.Route) bool {
+		return route.Status == models.RouteStatusClosed &&
+			route.GathererID == "" &&
+			isBetween(route.StartsAt, currentTime, maxTime)
+	}), page)
+}
+
+func (r *InMemoryRoutesRepository) FindOpenShifts(
+	ctx context.Context,
+	currentTime time.Time,
+	maxTime time.Time,
+) ([]models.Route, error) {
+	return r.FindByStatus(ctx, models.RouteStatusOpen, currentTime, maxTime)
+}
+
+func (r *InMemoryRoutesRepository) FindOpenShiftsPage(
+	ctx context.Context,
+	currentTime time.Time,
+	maxTime time.Time,
+	page PageQuery,
+) (RoutesPage, error) {
+	return r.FindByStatusPage(ctx, models.RouteStatusOpen, currentTime, maxTime, page)
+}
+
+func (r *InMemoryRoutesRepository) FindOpenShiftsInSectorPage(
+	ctx context.Context,
+	sectorID string,
+	currentTime time.Time,
+	maxTime time.Time,
+	page PageQuery,
+) (RoutesPage, error) {
+	return pageRoutes(r.filter(func(route models.Route) bool {
+		return route.Status == models.RouteStatusOpen &&
+			route.SectorID == sectorID &&
+			isBetween(route.StartsAt, currentTime, maxTime)
+	}), page)
+}
+
+func (r *InMemoryRoutesRepository) FindByStatus(
+	ctx context.Context,
+	status string,
+	currentTime time.Time,
+	maxTime time.Time,
+) ([]models.Route, error) {
+	page, err := r.FindByStatusPage(ctx, status, currentTime, maxTime, PageQuery{})
+	return page.Routes, err
+}
+
+func (r *InMemoryRoutesRepository) FindByStatusPage(
+	ctx context.Context,
+	status string,
+	currentTime time.Time,
+	maxTime time.Time,
+	page PageQuery,
+) (RoutesPage, error) {
+	return pageRoutes(r.filter(func(route models.Route) bool {
+		return route.Status == status &&
+			isBetween(route.StartsAt, currentTime, maxTime)
+	}), page)
+}
+
+func (r *InMemoryRoutesRepository) Assign(ctx context.Context, userID string, routeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	route, ok := r.routes[routeID]
+	if !ok {
+		return ErrRouteNotFound
+	}
+	if route.GathererID != "" {
+		return ErrRouteAlreadyAssigned
+	}
+	route.GathererID = userID
+	route.Status = models.RouteStatusAssigned
+	r.routes[routeID] = route
+	return nil
+}
+
+func (r *InMemoryRoutesRepository) ForceAssign(ctx context.Context, userID string, routeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	route, ok := r.routes[routeID]
+	if !ok {
+		return ErrRouteNotAssignable
+	}
+	switch route.Status {
+	case models.RouteStatusOpen, models.RouteStatusClosed, models.RouteStatusAssigned:
+	default:
+		return ErrRouteNotAssignable
+	}
+	route.GathererID = userID
+	route.Status = models.RouteStatusAssigned
+	r.routes[routeID] = route
+	return nil
+}
+
+func (r *InMemoryRoutesRepository) Unassign(ctx context.Context, routeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	route, ok := r.routes[routeID]
+	if !ok || route.Status != models.RouteStatusAssigned {
+		return ErrRouteNotAssigned
+	}
+	route.GathererID = ""
+	route.Status = models.RouteStatusClosed
+	r.routes[routeID] = route
+	return nil
+}
+
+func (r *InMemoryRoutesRepository) Pin(ctx context.Context, userID string, location models.Location, shiftID string, materials []string) error {
+	now, err := r.now()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	route, ok := r.routes[shiftID]
+	if !ok {
+		return ErrRouteNotFound
+	}
+	route.PickingPoints = append(route.PickingPoints, models.PickingPoint{
+		ID:         r.uuidHelper.New(),
+		PickupCode: r.uuidHelper.New(),
+		LocationID: location.ID,
+		Country:    location.Country,
+		City:       location.City,
+		Latitude:   location.Latitude,
+		Longitude:  location.Longitude,
+		Address1:   location.Address1,
+		Address2:   location.Address2,
+		Materials:  append([]string{}, materials...),
+		Created:    &now,
+	})
+	r.routes[shiftID] = route
+	return nil
+}
+
+// now keeps the same precision and zone as the timestamps read back from
+// DynamoDB
+func (r *InMemoryRoutesRepository) now() (time.Time, error) {
+	return nowFrom(r.clock)
+}
+
+// filter returns copies of the matching routes sorted by starts_at, the order
+// of the by_status_and_starts_at index
+func (r *InMemoryRoutesRepository) filter(match func(route models.Route) bool) []models.Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	routes := []models.Route{}
+	for _, route := range r.routes {
+		if match(route) {
+			routes = append(routes, copyRoute(route))
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].StartsAt == nil || routes[j].StartsAt == nil {
+			return routes[i].ID < routes[j].ID
+		}
+		// ties broken by id so offset cursors see the same order every time
+		if routes[i].StartsAt.Equal(*routes[j].StartsAt) {
+			return routes[i].ID < routes[j].ID
+		}
+		return routes[i].StartsAt.Before(*routes[j].StartsAt)
+	})
+	return routes
+}
+
+func isBetween(t *time.Time, from time.Time, to time.Time) bool {
+	return t != nil && !t.Before(from) && !t.After(to)
+}
+
+func copyRoute(route models.Route) models.Route {
+	route.Materials = append([]string{}, route.Materials...)
+	pickingPoints := make([]models.PickingPoint, len(route.PickingPoints))
+	for i, pp := range route.PickingPoints {
+		pp.Materials = append([]string{}, pp.Materials...)
+		pp.Quantities = copyQuantities(pp.Quantities)
+		pp.Photos = append([]models.Photo{}, pp.Photos...)
+		if pp.FinishFix != nil {
+			fix := *pp.FinishFix
+			pp.FinishFix = &fix
+		}
+		pickingPoints[i] = pp
+	}
+	route.PickingPoints = pickingPoints
+	return route
+}
+
+func copyQuantities(quantities []models.MaterialQuantity) []models.MaterialQuantity {
+	return append([]models.MaterialQuantity{}, quantities...)
+}
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+// InMemorySectorsRepository is a thread-safe, non persistent replacement of
+// DynamoDBSectorsRepository, meant for tests and local runs
+type InMemorySectorsRepository struct {
+	mu      sync.RWMutex
+	sectors map[string]models.Sector
+}
+
+func NewInMemorySectorsRepository() *InMemorySectorsRepository {
+	return &InMemorySectorsRepository{
+		sectors: map[string]models.Sector{},
+	}
+}
+
+func (r *InMemorySectorsRepository) Save(ctx context.Context, sector models.Sector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sector.Polygon = append(geo.Polygon{}, sector.Polygon...)
+	r.sectors[sector.ID] = sector
+	return nil
+}
+
+func (r *InMemorySectorsRepository) Find(ctx context.Context, id string) (models.Sector, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sector, ok := r.sectors[id]
+	if !ok {
+		return models.Sector{}, ErrSectorNotFound
+	}
+	return sector, nil
+}
+
+func (r *InMemorySectorsRepository) All(ctx context.Context) ([]models.Sector, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sectors := []models.Sector{}
+	for _, sector := range r.sectors {
+		sectors = append(sectors, sector)
+	}
+	sort.Slice(sectors, func(i, j int) bool {
+		return sectors[i].ID < sectors[j].ID
+	})
+	return sectors, nil
+}
+
+func (r *InMemorySectorsRepository) Locate(ctx context.Context, lat float64, lon float64) (models.Sector, error) {
+	sectors, err := r.All(ctx)
+	if err != nil {
+		return models.Sector{}, err
+	}
+	return locateSector(sectors, lat, lon)
+}
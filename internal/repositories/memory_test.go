@@ -0,0 +1,32 @@
+package repositories_test
+
+import (
+	"testing"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories/contract"
+)
+
+func TestInMemoryRepositoriesContract(t *testing.T) {
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contract.Run(t, func(t *testing.T) contract.Backend {
+		locationsRepo := repositories.NewInMemoryLocationsRepository()
+		return contract.Backend{
+			Users:     repositories.NewInMemoryUsersRepository(),
+			Locations: locationsRepo,
+			Routes: repositories.NewInMemoryRoutesRepository(
+				locationsRepo,
+				timeHelper,
+				internal.NewUUIDHelper(),
+			),
+			Idempotency: repositories.NewInMemoryIdempotencyRepository(timeHelper),
+			Tracking:    repositories.NewInMemoryTrackingRepository(timeHelper),
+			Sectors:     repositories.NewInMemorySectorsRepository(),
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+// InMemoryTrackingRepository is a thread-safe, non persistent replacement of
+// DynamoDBTrackingRepository, meant for tests and local runs
+type InMemoryTrackingRepository struct {
+	mu        sync.Mutex
+	positions map[string]trackedPosition
+	clock     Clock
+}
+
+type trackedPosition struct {
+	position  models.GathererPosition
+	expiresAt time.Time
+}
+
+func NewInMemoryTrackingRepository(clock Clock) *InMemoryTrackingRepository {
+	return &InMemoryTrackingRepository{
+		positions: map[string]trackedPosition{},
+		clock:     clock,
+	}
+}
+
+func (r *InMemoryTrackingRepository) Track(ctx context.Context, position models.GathererPosition, ttl time.Duration) error {
+	now, err := nowFrom(r.clock)
+	if err != nil {
+		return err
+	}
+	position.RecordedAt = position.RecordedAt.UTC().Truncate(time.Second)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tracked, ok := r.positions[position.RouteID]; ok && now.Before(tracked.expiresAt) && tracked.position.RecordedAt.After(position.RecordedAt) {
+		return nil
+	}
+	r.positions[position.RouteID] = trackedPosition{
+		position:  position,
+		expiresAt: now.Add(ttl),
+	}
+	return nil
+}
+
+func (r *InMemoryTrackingRepository) Latest(ctx context.Context, routeID string) (models.GathererPosition, error) {
+	now, err := nowFrom(r.clock)
+	if err != nil {
+		return models.GathererPosition{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tracked, ok := r.positions[routeID]
+	if !ok || !now.Before(tracked.expiresAt) {
+		return models.GathererPosition{}, ErrNoGathererPosition
+	}
+	return tracked.position, nil
+}
@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+// InMemoryUsersRepository is a thread-safe, non persistent replacement of
+// DynamoDBUsersRepository, meant for tests and local runs
+type InMemoryUsersRepository struct {
+	mu    sync.RWMutex
+	users map[string]models.User
+}
+
+func NewInMemoryUsersRepository() *InMemoryUsersRepository {
+	return &InMemoryUsersRepository{
+		users: map[string]models.User{},
+	}
+}
+
+func (r *InMemoryUsersRepository) Save(ctx context.Context, user models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *InMemoryUsersRepository) Find(ctx context.Context, userID string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	user, ok := r.users[userID]
+	if !ok {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (r *InMemoryUsersRepository) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, user := range r.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrUserNotFound
+}
@@ -0,0 +1,314 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// MigrationReport counts what a migration went through. Conflicts are items
+// written by someone else while being migrated, and Throttled the ones
+// DynamoDB kept throttling for as long as the retry policy allows, running
+// it again picks both up. When a migration stops on an error Resume is the
+// cursor to run it again from, it is empty when it has to start over
+type MigrationReport struct {
+	Scanned   int
+	Migrated  int
+	Conflicts int
+	Throttled int
+	Resume    string
+}
+
+// migrateItems scans the table, from the resume cursor when given, and
+// issues the update migrate returns for every item, items it returns no
+// update for being left alone. With dryRun the updates are only counted
+func migrateItems(
+	ctx context.Context,
+	client DynamoDBClient,
+	table string,
+	resume string,
+	dryRun bool,
+	migrate func(item map[string]*dynamodb.AttributeValue) (*dynamodb.UpdateItemInput, error),
+) (MigrationReport, error) {
+	report := MigrationReport{}
+	startKey, err := decodeCursor(resume)
+	if err != nil {
+		return report, err
+	}
+	input := &dynamodb.ScanInput{
+		TableName:         aws.String(table),
+		ExclusiveStartKey: startKey,
+	}
+	for {
+		out, err := client.ScanWithContext(ctx, input)
+		if err != nil {
+			return report.stoppedAt(input.ExclusiveStartKey), err
+		}
+		for _, item := range out.Items {
+			report.Scanned++
+			update, err := migrate(item)
+			if err != nil {
+				return report.stoppedAt(input.ExclusiveStartKey), err
+			}
+			if update == nil {
+				continue
+			}
+			if dryRun {
+				report.Migrated++
+				continue
+			}
+
+			_, err = client.UpdateItemWithContext(ctx, update)
+			switch {
+			case err == nil:
+				report.Migrated++
+			case isConditionFailed(err):
+				report.Conflicts++
+			case errors.Is(err, ErrThrottled):
+				log.Printf("migrating (%s) on (%s) was throttled, left for the next run\n", keyString(update.Key), table)
+				report.Throttled++
+			default:
+				return report.stoppedAt(input.ExclusiveStartKey), err
+			}
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return report, nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// stoppedAt sets the cursor to resume from the scan page starting at
+// startKey, the items of the page already migrated are left alone then
+func (r MigrationReport) stoppedAt(startKey map[string]*dynamodb.AttributeValue) MigrationReport {
+	if len(startKey) > 0 {
+		r.Resume = encodeCursor(startKey)
+	}
+	return r
+}
+
+func keyString(key map[string]*dynamodb.AttributeValue) string {
+	parts := make([]string, 0, len(key))
+	for name, value := range key {
+		parts = append(parts, name+"="+aws.StringValue(value.S)+aws.StringValue(value.N))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// MigrateTimestamps rewrites every timestamp stored with the legacy layout on
+// the table, at any depth, as UTC RFC 3339. Items are updated only when they
+// are still the way they were scanned, and already migrated ones are left
+// alone, so it is safe to run it more than once and while the functions
+// keep serving. With dryRun nothing is written
+func MigrateTimestamps(ctx context.Context, client DynamoDBClient, table string, keyNames []string, resume string, dryRun bool) (MigrationReport, error) {
+	return migrateItems(ctx, client, table, resume, dryRun, func(item map[string]*dynamodb.AttributeValue) (*dynamodb.UpdateItemInput, error) {
+		changed := map[string]*dynamodb.AttributeValue{}
+		for name, value := range item {
+			if isKey(name, keyNames) {
+				continue
+			}
+			if normalized, ok := normalizeTimestamps(value); ok {
+				changed[name] = normalized
+			}
+		}
+		if len(changed) == 0 {
+			return nil, nil
+		}
+		return migrationUpdate(table, keyNames, item, changed), nil
+	})
+}
+
+// migrationUpdate sets the changed attributes on the condition that they
+// still have their scanned values
+func migrationUpdate(
+	table string,
+	keyNames []string,
+	item map[string]*dynamodb.AttributeValue,
+	changed map[string]*dynamodb.AttributeValue,
+) *dynamodb.UpdateItemInput {
+	key := map[string]*dynamodb.AttributeValue{}
+	for _, name := range keyNames {
+		key[name] = item[name]
+	}
+
+	// sorted so the expressions are stable
+	attributes := make([]string, 0, len(changed))
+	for name := range changed {
+		attributes = append(attributes, name)
+	}
+	sort.Strings(attributes)
+
+	names := map[string]*string{}
+	values := map[string]*dynamodb.AttributeValue{}
+	sets := make([]string, len(attributes))
+	conditions := make([]string, len(attributes))
+	for i, name := range attributes {
+		names[fmt.Sprintf("#a%d", i)] = aws.String(name)
+		values[fmt.Sprintf(":new%d", i)] = changed[name]
+		values[fmt.Sprintf(":old%d", i)] = item[name]
+		sets[i] = fmt.Sprintf("#a%d = :new%d", i, i)
+		conditions[i] = fmt.Sprintf("#a%d = :old%d", i, i)
+	}
+
+	return &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(table),
+		Key:                       key,
+		UpdateExpression:          aws.String("set " + strings.Join(sets, ", ")),
+		ConditionExpression:       aws.String(strings.Join(conditions, " AND ")),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+}
+
+// normalizeTimestamps returns a copy of value with the legacy timestamps
+// rewritten, and whether there was any
+func normalizeTimestamps(value *dynamodb.AttributeValue) (*dynamodb.AttributeValue, bool) {
+	switch {
+	case value.S != nil:
+		if t, ok := parseLegacyTime(*value.S); ok {
+			return &dynamodb.AttributeValue{S: aws.String(formatTime(t))}, true
+		}
+	case value.L != nil:
+		list := make([]*dynamodb.AttributeValue, len(value.L))
+		changed := false
+		for i, v := range value.L {
+			normalized, ok := normalizeTimestamps(v)
+			list[i] = normalized
+			changed = changed || ok
+		}
+		if changed {
+			return &dynamodb.AttributeValue{L: list}, true
+		}
+	case value.M != nil:
+		m := make(map[string]*dynamodb.AttributeValue, len(value.M))
+		changed := false
+		for k, v := range value.M {
+			normalized, ok := normalizeTimestamps(v)
+			m[k] = normalized
+			changed = changed || ok
+		}
+		if changed {
+			return &dynamodb.AttributeValue{M: m}, true
+		}
+	}
+	return value, false
+}
+
+// parseLegacyTime only accepts the exact legacy layout, so free text
+// attributes are never mistaken for timestamps
+func parseLegacyTime(s string) (time.Time, bool) {
+	if len(s) != len(legacyTimeLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(legacyTimeLayout, s)
+	return t, err == nil
+}
+
+func isKey(name string, keyNames []string) bool {
+	for _, key := range keyNames {
+		if name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexLocations sets the geohash attributes the by_geohash_cell index needs
+// on every location saved before it existed, or whose coordinates changed
+// without them. Items are updated only when their coordinates are still the
+// scanned ones, so it is safe to run it more than once and while the
+// functions keep serving. With dryRun nothing is written
+func IndexLocations(ctx context.Context, client DynamoDBClient, table string, resume string, dryRun bool) (MigrationReport, error) {
+	return migrateItems(ctx, client, table, resume, dryRun, func(item map[string]*dynamodb.AttributeValue) (*dynamodb.UpdateItemInput, error) {
+		latitude, longitude := item["latitude"], item["longitude"]
+		if latitude == nil || latitude.N == nil || longitude == nil || longitude.N == nil {
+			return nil, nil
+		}
+		lat, err := strconv.ParseFloat(*latitude.N, 64)
+		if err != nil {
+			return nil, err
+		}
+		lon, err := strconv.ParseFloat(*longitude.N, 64)
+		if err != nil {
+			return nil, err
+		}
+		attributes := geohashAttributes(lat, lon)
+		if sameS(item["geohash"], attributes["geohash"]) && sameS(item["geohash_cell"], attributes["geohash_cell"]) {
+			return nil, nil
+		}
+
+		return &dynamodb.UpdateItemInput{
+			TableName: aws.String(table),
+			Key: map[string]*dynamodb.AttributeValue{
+				"id": item["id"],
+			},
+			UpdateExpression:    aws.String("set geohash = :geohash, geohash_cell = :geohash_cell"),
+			ConditionExpression: aws.String("latitude = :latitude AND longitude = :longitude"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":geohash":      attributes["geohash"],
+				":geohash_cell": attributes["geohash_cell"],
+				":latitude":     latitude,
+				":longitude":    longitude,
+			},
+		}, nil
+	})
+}
+
+// LinkRouteSectors sets the sector_id of every route saved before routes
+// referred to their sector by id, from the sector with the name the route
+// has. Routes whose name matches no sector, or more than one, are logged and
+// left alone. Items are updated only when they still have the scanned name
+// and no sector_id, so it is safe to run it more than once and while the
+// functions keep serving. With dryRun nothing is written
+func LinkRouteSectors(ctx context.Context, client DynamoDBClient, table string, sectors []models.Sector, resume string, dryRun bool) (MigrationReport, error) {
+	idsByName := map[string][]string{}
+	for _, sector := range sectors {
+		idsByName[sector.Name] = append(idsByName[sector.Name], sector.ID)
+	}
+
+	return migrateItems(ctx, client, table, resume, dryRun, func(item map[string]*dynamodb.AttributeValue) (*dynamodb.UpdateItemInput, error) {
+		if v := item["sector_id"]; v != nil && v.S != nil && *v.S != "-" {
+			return nil, nil
+		}
+		sector := item["sector"]
+		if sector == nil || sector.S == nil {
+			return nil, nil
+		}
+		ids := idsByName[*sector.S]
+		if len(ids) != 1 {
+			log.Printf("route (%s) sector (%s) matches %v sectors, left unlinked\n", aws.StringValue(item["id"].S), *sector.S, len(ids))
+			return nil, nil
+		}
+
+		return &dynamodb.UpdateItemInput{
+			TableName: aws.String(table),
+			Key: map[string]*dynamodb.AttributeValue{
+				"id": item["id"],
+			},
+			UpdateExpression:    aws.String("set sector_id = :sector_id"),
+			ConditionExpression: aws.String("#sector = :sector AND (attribute_not_exists(sector_id) OR sector_id = :unset)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#sector": aws.String("sector"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":sector_id": {S: aws.String(ids[0])},
+				":sector":    sector,
+				":unset":     {S: aws.String("-")},
+			},
+		}, nil
+	})
+}
+
+func sameS(a *dynamodb.AttributeValue, b *dynamodb.AttributeValue) bool {
+	return a != nil && a.S != nil && b != nil && b.S != nil && *a.S == *b.S
+}
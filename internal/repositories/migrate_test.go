@@ -0,0 +1,234 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories/dynamodbtest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestMigrateTimestampsRewritesLegacyItems(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	pages := []*dynamodb.ScanOutput{
+		{
+			Items: []map[string]*dynamodb.AttributeValue{
+				{
+					"id":          {S: aws.String("r1")},
+					"starts_at":   {S: aws.String("2020-06-01T08:00:00-0500")},
+					"finished_at": {S: aws.String("-")},
+					"sector":      {S: aws.String("Chapinero")},
+					"picking_points": {L: []*dynamodb.AttributeValue{
+						{M: map[string]*dynamodb.AttributeValue{
+							"created":      {S: aws.String("2020-05-30T10:00:00-0500")},
+							"failure_note": {S: aws.String("gate closed at 10:00")},
+						}},
+					}},
+				},
+			},
+			LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"id": {S: aws.String("r1")}},
+		},
+		{
+			Items: []map[string]*dynamodb.AttributeValue{
+				{
+					"id":        {S: aws.String("r2")},
+					"starts_at": {S: aws.String("2020-06-01T13:00:00Z")},
+				},
+			},
+		},
+	}
+	recorder.OnScan = func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		page := pages[0]
+		pages = pages[1:]
+		return page, nil
+	}
+
+	report, err := repositories.MigrateTimestamps(ctx, recorder, "picking_routes", []string{"id"}, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report != (repositories.MigrationReport{Scanned: 2, Migrated: 1}) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	assertS(t, "exclusive start key", "r1", recorder.Scans[1].ExclusiveStartKey["id"])
+	if len(recorder.Updates) != 1 {
+		t.Fatalf("expected a single update, got %v", len(recorder.Updates))
+	}
+	update := recorder.Updates[0]
+	assertS(t, "key", "r1", update.Key["id"])
+	assertExpression(t, "update expression", "set #a0 = :new0, #a1 = :new1", update.UpdateExpression)
+	assertExpression(t, "condition", "#a0 = :old0 AND #a1 = :old1", update.ConditionExpression)
+	assertString(t, "#a0", "picking_points", update.ExpressionAttributeNames["#a0"])
+	assertString(t, "#a1", "starts_at", update.ExpressionAttributeNames["#a1"])
+	assertS(t, ":new1", "2020-06-01T13:00:00Z", update.ExpressionAttributeValues[":new1"])
+	pickingPoint := update.ExpressionAttributeValues[":new0"].L[0].M
+	assertS(t, "picking point created", "2020-05-30T15:00:00Z", pickingPoint["created"])
+	assertS(t, "failure note", "gate closed at 10:00", pickingPoint["failure_note"])
+}
+
+func TestMigrateTimestampsCountsConflicts(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	recorder.OnScan = func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		return &dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{
+			{"id": {S: aws.String("l1")}, "created": {S: aws.String("2020-06-01T08:00:00-0500")}},
+		}}, nil
+	}
+	recorder.OnUpdateItem = func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+
+	report, err := repositories.MigrateTimestamps(ctx, recorder, "locations", []string{"id"}, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report != (repositories.MigrationReport{Scanned: 1, Conflicts: 1}) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestMigrateTimestampsLeavesThrottledItemsForTheNextRun(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	recorder.OnScan = func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		return &dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{
+			{"id": {S: aws.String("l1")}, "created": {S: aws.String("2020-06-01T08:00:00-0500")}},
+			{"id": {S: aws.String("l2")}, "created": {S: aws.String("2020-06-01T09:00:00-0500")}},
+		}}, nil
+	}
+	recorder.OnUpdateItem = func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		if *input.Key["id"].S == "l1" {
+			return nil, &repositories.ThrottledError{
+				Err: awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "throughput exceeded", nil),
+			}
+		}
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+
+	report, err := repositories.MigrateTimestamps(ctx, recorder, "locations", []string{"id"}, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report != (repositories.MigrationReport{Scanned: 2, Migrated: 1, Throttled: 1}) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestMigrateTimestampsResumesWhereItStopped(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	legacy := func(id string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}, "created": {S: aws.String("2020-06-01T08:00:00-0500")}}
+	}
+	throttled := &repositories.ThrottledError{
+		Err: awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "throughput exceeded", nil),
+	}
+	recorder.OnScan = func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		if input.ExclusiveStartKey == nil {
+			return &dynamodb.ScanOutput{
+				Items:            []map[string]*dynamodb.AttributeValue{legacy("l1")},
+				LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"id": {S: aws.String("l1")}},
+			}, nil
+		}
+		if throttled != nil {
+			return nil, throttled
+		}
+		return &dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{legacy("l2")}}, nil
+	}
+
+	report, err := repositories.MigrateTimestamps(ctx, recorder, "locations", []string{"id"}, "", false)
+	if !errors.Is(err, repositories.ErrThrottled) {
+		t.Fatalf("expected the scan to stop throttled, got %v", err)
+	}
+	if report.Migrated != 1 || report.Resume == "" {
+		t.Fatalf("expected l1 migrated and a cursor to resume from, got %+v", report)
+	}
+
+	throttled = nil
+	report, err = repositories.MigrateTimestamps(ctx, recorder, "locations", []string{"id"}, report.Resume, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report != (repositories.MigrationReport{Scanned: 1, Migrated: 1}) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	last := recorder.Scans[len(recorder.Scans)-1]
+	assertS(t, "resumed start key", "l1", last.ExclusiveStartKey["id"])
+	assertS(t, "resumed update", "l2", recorder.Updates[len(recorder.Updates)-1].Key["id"])
+
+	_, err = repositories.MigrateTimestamps(ctx, recorder, "locations", []string{"id"}, "not a cursor", false)
+	if err != repositories.ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestIndexLocationsBackfillsGeohashes(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	recorder.OnScan = func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		return &dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{
+			{"id": {S: aws.String("l1")}, "latitude": {N: aws.String("4.641500")}, "longitude": {N: aws.String("-74.065200")}},
+			{
+				"id": {S: aws.String("l2")}, "latitude": {N: aws.String("4.641500")}, "longitude": {N: aws.String("-74.065200")},
+				"geohash": {S: aws.String("d2g66sgqe")}, "geohash_cell": {S: aws.String("d2g66")},
+			},
+			{"id": {S: aws.String("l3")}},
+		}}, nil
+	}
+
+	report, err := repositories.IndexLocations(ctx, recorder, "locations", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report != (repositories.MigrationReport{Scanned: 3, Migrated: 1}) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if len(recorder.Updates) != 1 {
+		t.Fatalf("expected a single update, got %v", len(recorder.Updates))
+	}
+	update := recorder.Updates[0]
+	assertS(t, "key", "l1", update.Key["id"])
+	assertExpression(t, "condition", "latitude = :latitude AND longitude = :longitude", update.ConditionExpression)
+	assertS(t, ":geohash", "d2g66sgqe", update.ExpressionAttributeValues[":geohash"])
+	assertS(t, ":geohash_cell", "d2g66", update.ExpressionAttributeValues[":geohash_cell"])
+}
+
+func TestLinkRouteSectorsMatchesByName(t *testing.T) {
+	ctx := context.Background()
+	recorder := dynamodbtest.NewRecorder()
+	recorder.OnScan = func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		return &dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{
+			{"id": {S: aws.String("r1")}, "sector": {S: aws.String("Chapinero")}},
+			{"id": {S: aws.String("r2")}, "sector": {S: aws.String("Teusaquillo")}, "sector_id": {S: aws.String("sector-teusaquillo")}},
+			{"id": {S: aws.String("r3")}, "sector": {S: aws.String("Usaquen")}, "sector_id": {S: aws.String("-")}},
+		}}, nil
+	}
+	sectors := []models.Sector{
+		{ID: "sector-chapinero", Name: "Chapinero"},
+		{ID: "sector-teusaquillo", Name: "Teusaquillo"},
+	}
+
+	report, err := repositories.LinkRouteSectors(ctx, recorder, "picking_routes", sectors, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report != (repositories.MigrationReport{Scanned: 3, Migrated: 1}) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if len(recorder.Updates) != 1 {
+		t.Fatalf("expected a single update, got %v", len(recorder.Updates))
+	}
+	update := recorder.Updates[0]
+	assertS(t, "key", "r1", update.Key["id"])
+	assertExpression(t, "condition", "#sector = :sector AND (attribute_not_exists(sector_id) OR sector_id = :unset)", update.ConditionExpression)
+	assertS(t, ":sector_id", "sector-chapinero", update.ExpressionAttributeValues[":sector_id"])
+}
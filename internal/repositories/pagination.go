@@ -0,0 +1,141 @@
+package repositories
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// errCodeValidation is what DynamoDB answers, among others, to a start key
+// that does not fit the key schema of the table or index being queried
+const errCodeValidation = "ValidationException"
+
+// PageQuery asks for at most Limit items, all of them when it is 0, starting
+// right after the page Cursor was returned with
+type PageQuery struct {
+	Limit  int
+	Cursor string
+}
+
+// RoutesPage is a page of routes, Cursor is empty on the last one
+type RoutesPage struct {
+	Routes []models.Route
+	Cursor string
+}
+
+// queryPages runs the query following LastEvaluatedKey until the page is
+// full, a single DynamoDB page is capped at 1 MB and the ones filtered by a
+// FilterExpression can come back short or even empty. The returned cursor
+// is empty once there is nothing left
+func queryPages(ctx context.Context, client DynamoDBClient, input *dynamodb.QueryInput, page PageQuery) ([]map[string]*dynamodb.AttributeValue, string, error) {
+	startKey, err := decodeCursor(page.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	items := []map[string]*dynamodb.AttributeValue{}
+	resuming := startKey != nil
+	for {
+		query := *input
+		query.ExclusiveStartKey = startKey
+		if page.Limit > 0 {
+			query.Limit = aws.Int64(int64(page.Limit - len(items)))
+		}
+		out, err := client.QueryWithContext(ctx, &query)
+		if err != nil {
+			// A cursor of another query or a forged one still decodes, it
+			// is the first query that finds its key does not fit
+			if aerr, ok := err.(awserr.Error); ok && resuming && aerr.Code() == errCodeValidation {
+				return nil, "", ErrInvalidCursor
+			}
+			return nil, "", err
+		}
+		resuming = false
+		items = append(items, out.Items...)
+		startKey = out.LastEvaluatedKey
+		if len(startKey) == 0 {
+			return items, "", nil
+		}
+		if page.Limit > 0 && len(items) >= page.Limit {
+			return items, encodeCursor(startKey), nil
+		}
+	}
+}
+
+// encodeCursor keeps the cursor opaque to clients, it is the key DynamoDB
+// resumes the query from
+func encodeCursor(key map[string]*dynamodb.AttributeValue) string {
+	raw, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string) (map[string]*dynamodb.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var key map[string]*dynamodb.AttributeValue
+	if err := json.Unmarshal(raw, &key); err != nil || len(key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	for _, value := range key {
+		if !isKeyAttribute(value) {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return key, nil
+}
+
+// isKeyAttribute tells whether value could be part of a key, key attributes
+// being a single string, number or binary
+func isKeyAttribute(value *dynamodb.AttributeValue) bool {
+	if value == nil || value.BOOL != nil || value.NULL != nil || value.L != nil || value.M != nil ||
+		value.SS != nil || value.NS != nil || value.BS != nil {
+		return false
+	}
+	set := 0
+	for _, present := range []bool{value.S != nil, value.N != nil, value.B != nil} {
+		if present {
+			set++
+		}
+	}
+	return set == 1
+}
+
+// pageRoutes slices the routes the in-memory repositories match, their
+// cursor being the offset of the next page
+func pageRoutes(routes []models.Route, page PageQuery) (RoutesPage, error) {
+	offset := 0
+	if page.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+		if err != nil {
+			return RoutesPage{}, ErrInvalidCursor
+		}
+		offset, err = strconv.Atoi(string(raw))
+		if err != nil || offset < 0 || offset > len(routes) {
+			return RoutesPage{}, ErrInvalidCursor
+		}
+	}
+
+	end := len(routes)
+	if page.Limit > 0 && offset+page.Limit < end {
+		end = offset + page.Limit
+	}
+	result := RoutesPage{Routes: routes[offset:end]}
+	if end < len(routes) {
+		result.Cursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+	return result, nil
+}
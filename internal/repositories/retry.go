@@ -0,0 +1,234 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var ErrThrottled = errors.New("the database is busy, try again later")
+
+// ThrottledError is returned once DynamoDB kept throttling a request for as
+// long as the retry policy allows, RetryAfter hints when it is worth trying
+// again
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrThrottled, e.Err)
+}
+
+func (e *ThrottledError) Is(target error) bool {
+	return target == ErrThrottled
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// RetryPolicy tells how throttled requests are retried: up to MaxAttempts
+// times, waiting a random time up to BaseDelay doubled on every attempt and
+// capped at MaxDelay, and never for longer than Timeout in total
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Timeout     time.Duration
+}
+
+// DefaultRetryPolicy fits the tables provisioned capacity and the functions
+// timeout, leaving time to answer before the function is killed
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 6,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    time.Second,
+	Timeout:     4 * time.Second,
+}
+
+// delay is the full jitter backoff before the given retry, starting at 1
+func (p RetryPolicy) delay(retry int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := uint(retry - 1); shift < 32 && p.BaseDelay<<shift < ceiling {
+		ceiling = p.BaseDelay << shift
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// RetryingClient is a DynamoDBClient retrying throttled requests according
+// to its policy. Every request runs under the context it is given with the
+// policy Timeout as deadline, whichever comes first, so a request is cancelled
+// rather than outliving the function or the request that issued it
+type RetryingClient struct {
+	client DynamoDBClient
+	policy RetryPolicy
+}
+
+// NewRetryingClient wraps client, which should have the SDK retries disabled
+// (aws.Config.MaxRetries set to 0) so they do not add up with the policy ones
+func NewRetryingClient(client DynamoDBClient, policy RetryPolicy) *RetryingClient {
+	return &RetryingClient{
+		client: client,
+		policy: policy,
+	}
+}
+
+func (c *RetryingClient) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	var out *dynamodb.QueryOutput
+	err := c.do(ctx, "Query", func(ctx context.Context) (err error) {
+		out, err = c.client.QueryWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c *RetryingClient) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	var out *dynamodb.BatchGetItemOutput
+	err := c.do(ctx, "BatchGetItem", func(ctx context.Context) (err error) {
+		out, err = c.client.BatchGetItemWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c *RetryingClient) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	var out *dynamodb.ScanOutput
+	err := c.do(ctx, "Scan", func(ctx context.Context) (err error) {
+		out, err = c.client.ScanWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c *RetryingClient) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	var out *dynamodb.PutItemOutput
+	err := c.do(ctx, "PutItem", func(ctx context.Context) (err error) {
+		out, err = c.client.PutItemWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c *RetryingClient) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	var out *dynamodb.UpdateItemOutput
+	err := c.do(ctx, "UpdateItem", func(ctx context.Context) (err error) {
+		out, err = c.client.UpdateItemWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c *RetryingClient) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	var out *dynamodb.DeleteItemOutput
+	err := c.do(ctx, "DeleteItem", func(ctx context.Context) (err error) {
+		out, err = c.client.DeleteItemWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+func (c *RetryingClient) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	var out *dynamodb.TransactWriteItemsOutput
+	err := c.do(ctx, "TransactWriteItems", func(ctx context.Context) (err error) {
+		out, err = c.client.TransactWriteItemsWithContext(ctx, input, opts...)
+		return err
+	})
+	return out, err
+}
+
+// do runs the request until it is not throttled, the attempts run out or
+// the next wait would go past the deadline, be it the policy one or the one
+// of parent. Errors other than throttling are returned right away
+func (c *RetryingClient) do(parent context.Context, operation string, call func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(parent, c.policy.Timeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		err := call(ctx)
+		if err == nil || !isThrottle(err) {
+			return err
+		}
+		if attempt >= c.policy.MaxAttempts {
+			return c.throttled(operation, attempt, err)
+		}
+
+		delay := c.policy.delay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return c.throttled(operation, attempt, err)
+		}
+		if sleep(ctx, delay) != nil {
+			return c.throttled(operation, attempt, err)
+		}
+	}
+}
+
+// sleep waits for d unless ctx is done first, in which case its error is
+// returned right away
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *RetryingClient) throttled(operation string, attempts int, err error) error {
+	log.Printf("dynamodb %s throttled after %v attempts: %v\n", operation, attempts, err)
+	return &ThrottledError{
+		RetryAfter: c.policy.MaxDelay,
+		Err:        err,
+	}
+}
+
+// isThrottle tells throttling apart from real errors, including transactions
+// cancelled because one of their items was throttled
+func isThrottle(err error) bool {
+	if request.IsErrorThrottle(err) {
+		return true
+	}
+	var canceled *dynamodb.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for _, reason := range canceled.CancellationReasons {
+			switch aws.StringValue(reason.Code) {
+			case "ThrottlingError", "ProvisionedThroughputExceeded":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isConditionFailed tells writes rejected by their condition expression apart
+// from any other error, for transactions by the cancellation reason of each
+// item. Throttled requests never are, whatever the transaction reports
+func isConditionFailed(err error) bool {
+	if err == nil || errors.Is(err, ErrThrottled) {
+		return false
+	}
+	var canceled *dynamodb.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for _, reason := range canceled.CancellationReasons {
+			if aws.StringValue(reason.Code) == "ConditionalCheckFailed" {
+				return true
+			}
+		}
+		return false
+	}
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
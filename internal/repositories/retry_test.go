@@ -0,0 +1,209 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories/dynamodbtest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var testRetryPolicy = repositories.RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    2 * time.Millisecond,
+	Timeout:     time.Second,
+}
+
+func throttling() error {
+	return awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "rate exceeded", nil)
+}
+
+// throttleQueries throttles the first n queries
+func throttleQueries(recorder *dynamodbtest.Recorder, n int) {
+	recorder.OnQuery = func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		if len(recorder.Queries) <= n {
+			return nil, throttling()
+		}
+		return &dynamodb.QueryOutput{}, nil
+	}
+}
+
+func TestRetryingClientRetriesThrottledRequests(t *testing.T) {
+	recorder := dynamodbtest.NewRecorder()
+	throttleQueries(recorder, 2)
+	client := repositories.NewRetryingClient(recorder, testRetryPolicy)
+
+	if _, err := client.QueryWithContext(context.Background(), &dynamodb.QueryInput{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.Queries) != 3 {
+		t.Fatalf("expected 3 attempts, got %v", len(recorder.Queries))
+	}
+}
+
+func TestRetryingClientGivesUpOnPersistentThrottling(t *testing.T) {
+	recorder := dynamodbtest.NewRecorder()
+	throttleQueries(recorder, 10)
+	client := repositories.NewRetryingClient(recorder, testRetryPolicy)
+
+	_, err := client.QueryWithContext(context.Background(), &dynamodb.QueryInput{})
+	var throttled *repositories.ThrottledError
+	if !errors.As(err, &throttled) || !errors.Is(err, repositories.ErrThrottled) {
+		t.Fatalf("expected a ThrottledError, got %v", err)
+	}
+	if throttled.RetryAfter != testRetryPolicy.MaxDelay {
+		t.Fatalf("expected to retry after %v, got %v", testRetryPolicy.MaxDelay, throttled.RetryAfter)
+	}
+	if len(recorder.Queries) != testRetryPolicy.MaxAttempts {
+		t.Fatalf("expected %v attempts, got %v", testRetryPolicy.MaxAttempts, len(recorder.Queries))
+	}
+}
+
+func TestRetryingClientStopsAtTheDeadline(t *testing.T) {
+	recorder := dynamodbtest.NewRecorder()
+	throttleQueries(recorder, 10)
+	client := repositories.NewRetryingClient(recorder, repositories.RetryPolicy{
+		MaxAttempts: 10,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Minute,
+		Timeout:     10 * time.Millisecond,
+	})
+
+	start := time.Now()
+	_, err := client.QueryWithContext(context.Background(), &dynamodb.QueryInput{})
+	if !errors.Is(err, repositories.ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected to give up by the deadline, took %v", elapsed)
+	}
+}
+
+func TestRetryingClientStopsAtTheRequestDeadline(t *testing.T) {
+	recorder := dynamodbtest.NewRecorder()
+	throttleQueries(recorder, 10)
+	client := repositories.NewRetryingClient(recorder, repositories.RetryPolicy{
+		MaxAttempts: 10,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Minute,
+		Timeout:     time.Hour,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.QueryWithContext(ctx, &dynamodb.QueryInput{})
+	if !errors.Is(err, repositories.ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected to give up by the request deadline, took %v", elapsed)
+	}
+}
+
+func TestRetryingClientReturnsOtherErrorsRightAway(t *testing.T) {
+	recorder := dynamodbtest.NewRecorder()
+	recorder.OnPutItem = func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+	}
+	client := repositories.NewRetryingClient(recorder, testRetryPolicy)
+
+	_, err := client.PutItemWithContext(context.Background(), &dynamodb.PutItemInput{})
+	if err == nil || errors.Is(err, repositories.ErrThrottled) {
+		t.Fatalf("expected the conditional check error, got %v", err)
+	}
+	if len(recorder.Puts) != 1 {
+		t.Fatalf("expected a single attempt, got %v", len(recorder.Puts))
+	}
+}
+
+func TestFinishPickingPointTellsThrottlingFromUsedCodes(t *testing.T) {
+	ctx := context.Background()
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := dynamodbtest.NewRecorder()
+	recorder.OnTransactWriteItems = func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+		return nil, &dynamodb.TransactionCanceledException{
+			Message_: aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons [ThrottlingError]"),
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{Code: aws.String("ThrottlingError")},
+			},
+		}
+	}
+	repo := repositories.NewDynamoDBRoutesRepository(
+		repositories.NewRetryingClient(recorder, testRetryPolicy),
+		"picking_routes",
+		"locations",
+		fixedTimeHelper{timeHelper},
+		&sequentialUUIDHelper{},
+	)
+	now := time.Now()
+
+	err = repo.FinishPickingPoint(ctx, "r1", 0, models.PickingPoint{PickupCode: "1234", CodeUsedAt: &now}, 0, 2)
+	if !errors.Is(err, repositories.ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", err)
+	}
+	if len(recorder.Transactions) != testRetryPolicy.MaxAttempts {
+		t.Fatalf("expected %v attempts, got %v", testRetryPolicy.MaxAttempts, len(recorder.Transactions))
+	}
+}
+
+func TestAssignTellsThrottlingFromAssignedRoutes(t *testing.T) {
+	ctx := context.Background()
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := dynamodbtest.NewRecorder()
+	recorder.OnTransactWriteItems = func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+		return nil, &dynamodb.TransactionCanceledException{
+			Message_: aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons [ThrottlingError]"),
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{Code: aws.String("ThrottlingError")},
+			},
+		}
+	}
+	repo := repositories.NewDynamoDBRoutesRepository(
+		repositories.NewRetryingClient(recorder, testRetryPolicy),
+		"picking_routes",
+		"locations",
+		fixedTimeHelper{timeHelper},
+		&sequentialUUIDHelper{},
+	)
+
+	err = repo.Assign(ctx, "g1", "r1")
+	if !errors.Is(err, repositories.ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", err)
+	}
+	if len(recorder.Transactions) != testRetryPolicy.MaxAttempts {
+		t.Fatalf("expected %v attempts, got %v", testRetryPolicy.MaxAttempts, len(recorder.Transactions))
+	}
+}
+
+func TestTransactionsCancelledForOtherReasonsAreNotConditionFailures(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+	recorder.OnTransactWriteItems = func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+		return nil, &dynamodb.TransactionCanceledException{
+			Message_: aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons [TransactionConflict]"),
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{Code: aws.String("TransactionConflict")},
+			},
+		}
+	}
+
+	err := repo.Assign(ctx, "g1", "r1")
+	if err == nil || err == repositories.ErrRouteAlreadyAssigned {
+		t.Fatalf("expected the transaction error, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -18,43 +19,51 @@ var ErrNoAssignedRoutes = errors.New("no routes assigned")
 var ErrRouteAlreadyAssigned = errors.New("route already assigned")
 var ErrPickingPointAlreadyPinned = errors.New("picking point already pinned")
 var ErrNoOpenShifts = errors.New("there is no open shifts")
-
-type TimeHelper interface {
-	ToISO8601(d time.Time) (string, error)
-	FromISO8601(d string) (time.Time, error)
-	NowWithTimezoneISO8601() (string, error)
-}
+var ErrPickupCodeAlreadyUsed = errors.New("pickup code already used")
+var ErrPickingPointNotFound = errors.New("picking point not found")
+var ErrRouteNotAssignable = errors.New("route can not be assigned")
+var ErrRouteNotAssigned = errors.New("route is not assigned")
+var ErrPhotoAlreadyAttached = errors.New("photo already attached")
 
 type UUIDHelper interface {
 	New() string
 }
 
+// orUnset maps empty strings to "-", the sentinel used on the picking_routes
+// table for missing values
+func orUnset(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
 type DynamoDBRoutesRepository struct {
-	client         *dynamodb.DynamoDB
+	client         DynamoDBClient
 	tableRoutes    string
 	tableLocations string
-	timeHelper     TimeHelper
+	clock          Clock
 	uuidHelper     UUIDHelper
 }
 
 func NewDynamoDBRoutesRepository(
-	client *dynamodb.DynamoDB,
+	client DynamoDBClient,
 	tableRoutes string,
 	tableLocations string,
-	timeHelper TimeHelper,
+	clock Clock,
 	uuidHelper UUIDHelper,
 ) *DynamoDBRoutesRepository {
 	return &DynamoDBRoutesRepository{
 		client:         client,
 		tableRoutes:    tableRoutes,
 		tableLocations: tableLocations,
-		timeHelper:     timeHelper,
+		clock:          clock,
 		uuidHelper:     uuidHelper,
 	}
 }
 
-func (r *DynamoDBRoutesRepository) Find(routeID string) (models.Route, error) {
-	out, err := r.client.Query(&dynamodb.QueryInput{
+func (r *DynamoDBRoutesRepository) Find(ctx context.Context, routeID string) (models.Route, error) {
+	out, err := r.client.QueryWithContext(ctx, &dynamodb.QueryInput{
 		TableName: aws.String(r.tableRoutes),
 		KeyConditions: map[string]*dynamodb.Condition{
 			"id": {
@@ -81,14 +90,78 @@ func (r *DynamoDBRoutesRepository) Find(routeID string) (models.Route, error) {
 	return routes[0], nil
 }
 
-func (r *DynamoDBRoutesRepository) Initiate(routeID string) error {
+// Save puts the whole route item, it is meant for seeding and admin tasks
+// since it overwrites whatever is stored under the same id
+func (r *DynamoDBRoutesRepository) Save(ctx context.Context, route models.Route) error {
+	pickingPoints, err := r.hydratePickingPointsMap(route.PickingPoints)
+	if err != nil {
+		return err
+	}
+
+	item := map[string]*dynamodb.AttributeValue{
+		"id": {
+			S: aws.String(route.ID),
+		},
+		"sector": {
+			S: aws.String(route.Sector),
+		},
+		"sector_id": {
+			S: aws.String(orUnset(route.SectorID)),
+		},
+		"shift": {
+			S: aws.String(route.Shift),
+		},
+		"materials": {
+			L: r.hydratePickingPointMaterials(route.Materials),
+		},
+		"status": {
+			S: aws.String(route.Status),
+		},
+		"gatherer_id": {
+			S: aws.String(orUnset(route.GathererID)),
+		},
+		"timezone": {
+			S: aws.String(orUnset(route.Timezone)),
+		},
+		"picking_points": pickingPoints,
+	}
+	timestamps := map[string]*time.Time{
+		"starts_at":    route.StartsAt,
+		"initiated_at": route.InitiatedAt,
+		"finished_at":  route.FinishedAt,
+		"created":      route.Created,
+	}
+	for key, t := range timestamps {
+		item[key] = r.hydrateTime(t)
+	}
+	// photo_keys guards AttachPhoto against linking a photo twice, string
+	// sets cannot be empty so it is left out until there is a photo
+	photoKeys := []*string{}
+	for _, pickingPoint := range route.PickingPoints {
+		for _, photo := range pickingPoint.Photos {
+			photoKeys = append(photoKeys, aws.String(photo.Key))
+		}
+	}
+	if len(photoKeys) > 0 {
+		item["photo_keys"] = &dynamodb.AttributeValue{SS: photoKeys}
+	}
+
+	_, err = r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableRoutes),
+		Item:      item,
+	})
+	return err
+}
+
+func (r *DynamoDBRoutesRepository) Initiate(ctx context.Context, routeID string, at time.Time) error {
 	log.Printf("routesRepo: Initiating route..")
-	nowString, err := r.timeHelper.NowWithTimezoneISO8601()
+	now, err := timeOrNow(&at, r.clock)
 	if err != nil {
 		return err
 	}
+	nowString := formatTime(now)
 
-	_, err = r.client.UpdateItem(&dynamodb.UpdateItemInput{
+	_, err = r.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.tableRoutes),
 		Key: map[string]*dynamodb.AttributeValue{
 			"id": {
@@ -112,110 +185,267 @@ func (r *DynamoDBRoutesRepository) Initiate(routeID string) error {
 	return err
 }
 
-func (r *DynamoDBRoutesRepository) FinishPickingPoint(routeID string, pickingPointIndex int, locationID string, remaining int) error {
-	nowString, err := r.timeHelper.NowWithTimezoneISO8601()
+func (r *DynamoDBRoutesRepository) FinishPickingPoint(
+	ctx context.Context,
+	routeID string,
+	pickingPointIndex int,
+	pickingPoint models.PickingPoint,
+	score int,
+	remaining int,
+) error {
+	now, err := timeOrNow(pickingPoint.PickedAt, r.clock)
 	if err != nil {
 		return err
 	}
+	nowString := formatTime(now)
+
+	updateExpression := fmt.Sprintf(`
+		set picking_points[%v].picked_at = :now, 
+		picking_points[%v].quantities = :quantities`,
+		pickingPointIndex,
+		pickingPointIndex,
+	)
+	expressionAttributeNames := map[string]*string(nil)
+	expressionAttributeValues := map[string]*dynamodb.AttributeValue{
+		":now": {
+			S: aws.String(nowString),
+		},
+		":quantities": {
+			L: r.hydratePickingPointQuantities(pickingPoint.Quantities),
+		},
+	}
+
+	if pickingPoint.FinishFix != nil {
+		updateExpression += fmt.Sprintf(`, 
+		picking_points[%v].finish_fix = :fix`,
+			pickingPointIndex,
+		)
+		expressionAttributeValues[":fix"] = r.hydrateGeoFix(*pickingPoint.FinishFix)
+	}
+
+	// The pickup code is redeemed within the same write, so a replayed code
+	// cancels the whole transaction
+	var conditionExpression *string
+	if pickingPoint.CodeUsedAt != nil {
+		updateExpression += fmt.Sprintf(`, 
+		picking_points[%v].code_used_at = :now`,
+			pickingPointIndex,
+		)
+		conditionExpression = aws.String(fmt.Sprintf(
+			"picking_points[%v].pickup_code = :code AND picking_points[%v].code_used_at = :unused",
+			pickingPointIndex,
+			pickingPointIndex,
+		))
+		expressionAttributeValues[":code"] = &dynamodb.AttributeValue{
+			S: aws.String(pickingPoint.PickupCode),
+		}
+		expressionAttributeValues[":unused"] = &dynamodb.AttributeValue{
+			S: aws.String("-"),
+		}
+	}
 
 	if remaining == 1 {
-		_, err = r.client.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
-			TransactItems: []*dynamodb.TransactWriteItem{
-				{
-					Update: &dynamodb.Update{
-						TableName: aws.String(r.tableRoutes),
-						Key: map[string]*dynamodb.AttributeValue{
-							"id": {
-								S: aws.String(routeID),
-							},
-						},
-						UpdateExpression: aws.String(
-							fmt.Sprintf(`
-								set picking_points[%v].picked_at = :now, 
-								#status = :finished, 
-								finished_at = :now`,
-								pickingPointIndex,
-							),
-						),
-						ExpressionAttributeNames: map[string]*string{
-							"#status": aws.String("status"),
-						},
-						ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-							":now": {
-								S: aws.String(nowString),
-							},
-							":finished": {
-								S: aws.String(models.RouteStatusFinished),
-							},
-						},
-					},
-				},
-				{
-					Update: &dynamodb.Update{
-						TableName: aws.String(r.tableLocations),
-						Key: map[string]*dynamodb.AttributeValue{
-							"id": {
-								S: aws.String(locationID),
-							},
-						},
-						UpdateExpression: aws.String("set balance = balance + :score"),
-						ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-							":score": {
-								N: aws.String("10"),
-							},
-						},
+		updateExpression += `, 
+		#status = :finished, 
+		finished_at = :now`
+		expressionAttributeNames = map[string]*string{
+			"#status": aws.String("status"),
+		}
+		expressionAttributeValues[":finished"] = &dynamodb.AttributeValue{
+			S: aws.String(models.RouteStatusFinished),
+		}
+	}
+
+	transactItems := []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String(r.tableRoutes),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {
+						S: aws.String(routeID),
 					},
 				},
+				ConditionExpression:       conditionExpression,
+				UpdateExpression:          aws.String(updateExpression),
+				ExpressionAttributeNames:  expressionAttributeNames,
+				ExpressionAttributeValues: expressionAttributeValues,
 			},
-		})
-	} else {
-		_, err = r.client.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
-			TransactItems: []*dynamodb.TransactWriteItem{
-				{
-					Update: &dynamodb.Update{
-						TableName: aws.String(r.tableRoutes),
-						Key: map[string]*dynamodb.AttributeValue{
-							"id": {
-								S: aws.String(routeID),
-							},
-						},
-						UpdateExpression: aws.String(
-							fmt.Sprintf(`set picking_points[%v].picked_at = :now`,
-								pickingPointIndex,
-							),
-						),
-						ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-							":now": {
-								S: aws.String(nowString),
-							},
-						},
+		},
+	}
+	if score > 0 {
+		transactItems = append(transactItems, &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				TableName: aws.String(r.tableLocations),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {
+						S: aws.String(pickingPoint.LocationID),
 					},
 				},
-				{
-					Update: &dynamodb.Update{
-						TableName: aws.String(r.tableLocations),
-						Key: map[string]*dynamodb.AttributeValue{
-							"id": {
-								S: aws.String(locationID),
-							},
-						},
-						UpdateExpression: aws.String("set balance = balance + :score"),
-						ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-							":score": {
-								N: aws.String("10"),
-							},
-						},
+				UpdateExpression: aws.String("set balance = balance + :score"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":score": {
+						N: aws.String(strconv.Itoa(score)),
 					},
 				},
 			},
 		})
 	}
 
+	_, err = r.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		log.Printf("routesRepo FinishPickingPoint error: %v\n", err)
+		if conditionExpression != nil && isConditionFailed(err) {
+			return ErrPickupCodeAlreadyUsed
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *DynamoDBRoutesRepository) FailPickingPoint(
+	ctx context.Context,
+	routeID string,
+	pickingPointIndex int,
+	pickingPoint models.PickingPoint,
+	remaining int,
+) error {
+	now, err := timeOrNow(pickingPoint.FailedAt, r.clock)
+	if err != nil {
+		return err
+	}
+	nowString := formatTime(now)
+
+	note := strings.TrimSpace(pickingPoint.FailureNote)
+	if note == "" {
+		note = "-"
+	}
+
+	updateExpression := fmt.Sprintf(`
+		set picking_points[%v].failed_at = :now, 
+		picking_points[%v].failure_reason = :reason, 
+		picking_points[%v].failure_note = :note`,
+		pickingPointIndex,
+		pickingPointIndex,
+		pickingPointIndex,
+	)
+	expressionAttributeNames := map[string]*string(nil)
+	expressionAttributeValues := map[string]*dynamodb.AttributeValue{
+		":now": {
+			S: aws.String(nowString),
+		},
+		":reason": {
+			S: aws.String(pickingPoint.FailureReason),
+		},
+		":note": {
+			S: aws.String(note),
+		},
+	}
+
+	if pickingPoint.FinishFix != nil {
+		updateExpression += fmt.Sprintf(`, 
+		picking_points[%v].finish_fix = :fix`,
+			pickingPointIndex,
+		)
+		expressionAttributeValues[":fix"] = r.hydrateGeoFix(*pickingPoint.FinishFix)
+	}
+
+	// A failed picking point still counts toward the route completion
+	if remaining == 1 {
+		updateExpression += `, 
+		#status = :finished, 
+		finished_at = :now`
+		expressionAttributeNames = map[string]*string{
+			"#status": aws.String("status"),
+		}
+		expressionAttributeValues[":finished"] = &dynamodb.AttributeValue{
+			S: aws.String(models.RouteStatusFinished),
+		}
+	}
+
+	_, err = r.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableRoutes),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(routeID),
+			},
+		},
+		UpdateExpression:          aws.String(updateExpression),
+		ExpressionAttributeNames:  expressionAttributeNames,
+		ExpressionAttributeValues: expressionAttributeValues,
+	})
+
+	return err
+}
+
+// AttachPhoto appends the photo to the picking point, once. The key is added
+// to the photo_keys set of the route within the same write, attaching it
+// again fails with ErrPhotoAlreadyAttached
+func (r *DynamoDBRoutesRepository) AttachPhoto(ctx context.Context, routeID string, pickingPointIndex int, photo models.Photo) error {
+	now, err := nowFrom(r.clock)
+	if err != nil {
+		return err
+	}
+	nowString := formatTime(now)
+
+	photoItem := r.hydratePhoto(photo)
+	photoItem.M["created"] = &dynamodb.AttributeValue{
+		S: aws.String(nowString),
+	}
+
+	_, err = r.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableRoutes),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(routeID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(id) AND NOT contains(photo_keys, :key)"),
+		UpdateExpression: aws.String(fmt.Sprintf(
+			"set picking_points[%v].photos = list_append(if_not_exists(picking_points[%v].photos, :empty), :photos) add photo_keys :keys",
+			pickingPointIndex,
+			pickingPointIndex,
+		)),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":empty": {
+				L: []*dynamodb.AttributeValue{},
+			},
+			":photos": {
+				L: []*dynamodb.AttributeValue{photoItem},
+			},
+			":key": {
+				S: aws.String(photo.Key),
+			},
+			":keys": {
+				SS: []*string{aws.String(photo.Key)},
+			},
+		},
+	})
+	if isConditionFailed(err) {
+		// the route is there unless it was deleted in between, the key is
+		// what failed the condition
+		return ErrPhotoAlreadyAttached
+	}
+
 	return err
 }
 
-func (r *DynamoDBRoutesRepository) GetAssignedRoutesbyUserID(userID string) ([]models.Route, error) {
-	out, err := r.client.Query(&dynamodb.QueryInput{
+func (r *DynamoDBRoutesRepository) GetAssignedRoutesbyUserID(ctx context.Context, userID string) ([]models.Route, error) {
+	page, err := r.FindAssignedRoutesPage(ctx, userID, PageQuery{})
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Routes) == 0 {
+		return nil, ErrNoAssignedRoutes
+	}
+	return page.Routes, nil
+}
+
+// FindAssignedRoutesPage returns a page of the unfinished routes assigned to
+// the gatherer
+func (r *DynamoDBRoutesRepository) FindAssignedRoutesPage(ctx context.Context, userID string, page PageQuery) (RoutesPage, error) {
+	return r.queryRoutes(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(r.tableRoutes),
 		IndexName:              aws.String("by_gatherer_id_and_unfinished"),
 		KeyConditionExpression: aws.String("gatherer_id = :userID and finished_at = :unfinished"),
@@ -227,32 +457,30 @@ func (r *DynamoDBRoutesRepository) GetAssignedRoutesbyUserID(userID string) ([]m
 				S: aws.String("-"),
 			},
 		},
-	})
-	if err != nil {
-		return nil, err
-	}
-	if len(out.Items) == 0 {
-		return nil, ErrNoAssignedRoutes
-	}
-
-	return r.hydrateRoutes(out.Items)
+	}, page)
 }
 
 func (r *DynamoDBRoutesRepository) FindAvailableRoutes(
+	ctx context.Context,
 	currentTime time.Time,
 	maxTime time.Time,
 ) ([]models.Route, error) {
-	nowString, err := r.timeHelper.ToISO8601(currentTime)
-	if err != nil {
-		return nil, err
-	}
+	page, err := r.FindAvailableRoutesPage(ctx, currentTime, maxTime, PageQuery{})
+	return page.Routes, err
+}
 
-	thenString, err := r.timeHelper.ToISO8601(maxTime)
-	if err != nil {
-		return nil, err
-	}
+// FindAvailableRoutesPage returns a page of the closed and unassigned routes
+// starting within the window, sorted by starts_at
+func (r *DynamoDBRoutesRepository) FindAvailableRoutesPage(
+	ctx context.Context,
+	currentTime time.Time,
+	maxTime time.Time,
+	page PageQuery,
+) (RoutesPage, error) {
+	nowString := formatTime(currentTime)
+	thenString := formatTime(maxTime)
 
-	out, err := r.client.Query(&dynamodb.QueryInput{
+	return r.queryRoutes(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(r.tableRoutes),
 		IndexName:              aws.String("by_status_and_starts_at"),
 		KeyConditionExpression: aws.String("#status = :closed AND starts_at BETWEEN :now AND :then"),
@@ -274,31 +502,45 @@ func (r *DynamoDBRoutesRepository) FindAvailableRoutes(
 				S: aws.String("-"),
 			},
 		},
-	})
-	if err != nil {
-		return nil, err
-	}
-	return r.hydrateRoutes(out.Items)
+	}, page)
 }
 
 func (r *DynamoDBRoutesRepository) FindOpenShifts(
+	ctx context.Context,
 	currentTime time.Time,
 	maxTime time.Time,
 ) ([]models.Route, error) {
-	nowString, err := r.timeHelper.ToISO8601(currentTime)
-	if err != nil {
-		return nil, err
-	}
+	return r.FindByStatus(ctx, models.RouteStatusOpen, currentTime, maxTime)
+}
 
-	thenString, err := r.timeHelper.ToISO8601(maxTime)
-	if err != nil {
-		return nil, err
-	}
+// FindOpenShiftsPage returns a page of the open shifts starting within the
+// window, sorted by starts_at
+func (r *DynamoDBRoutesRepository) FindOpenShiftsPage(
+	ctx context.Context,
+	currentTime time.Time,
+	maxTime time.Time,
+	page PageQuery,
+) (RoutesPage, error) {
+	return r.FindByStatusPage(ctx, models.RouteStatusOpen, currentTime, maxTime, page)
+}
 
-	out, err := r.client.Query(&dynamodb.QueryInput{
+// FindOpenShiftsInSectorPage is FindOpenShiftsPage for the shifts of a
+// single sector, filtered by the query itself so pages still come full
+func (r *DynamoDBRoutesRepository) FindOpenShiftsInSectorPage(
+	ctx context.Context,
+	sectorID string,
+	currentTime time.Time,
+	maxTime time.Time,
+	page PageQuery,
+) (RoutesPage, error) {
+	nowString := formatTime(currentTime)
+	thenString := formatTime(maxTime)
+
+	return r.queryRoutes(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(r.tableRoutes),
 		IndexName:              aws.String("by_status_and_starts_at"),
 		KeyConditionExpression: aws.String("#status = :open AND starts_at BETWEEN :now AND :then"),
+		FilterExpression:       aws.String("sector_id = :sector_id"),
 		ExpressionAttributeNames: map[string]*string{
 			"#status": aws.String("status"),
 		},
@@ -312,16 +554,71 @@ func (r *DynamoDBRoutesRepository) FindOpenShifts(
 			":then": {
 				S: aws.String(thenString),
 			},
+			":sector_id": {
+				S: aws.String(sectorID),
+			},
 		},
-	})
+	}, page)
+}
+
+// FindByStatus returns the routes on the given status starting within the
+// window, sorted by starts_at
+func (r *DynamoDBRoutesRepository) FindByStatus(
+	ctx context.Context,
+	status string,
+	currentTime time.Time,
+	maxTime time.Time,
+) ([]models.Route, error) {
+	page, err := r.FindByStatusPage(ctx, status, currentTime, maxTime, PageQuery{})
+	return page.Routes, err
+}
+
+// FindByStatusPage is FindByStatus a page at a time
+func (r *DynamoDBRoutesRepository) FindByStatusPage(
+	ctx context.Context,
+	status string,
+	currentTime time.Time,
+	maxTime time.Time,
+	page PageQuery,
+) (RoutesPage, error) {
+	nowString := formatTime(currentTime)
+	thenString := formatTime(maxTime)
+
+	return r.queryRoutes(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableRoutes),
+		IndexName:              aws.String("by_status_and_starts_at"),
+		KeyConditionExpression: aws.String("#status = :status AND starts_at BETWEEN :now AND :then"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status": {
+				S: aws.String(status),
+			},
+			":now": {
+				S: aws.String(nowString),
+			},
+			":then": {
+				S: aws.String(thenString),
+			},
+		},
+	}, page)
+}
+
+func (r *DynamoDBRoutesRepository) queryRoutes(ctx context.Context, input *dynamodb.QueryInput, page PageQuery) (RoutesPage, error) {
+	items, cursor, err := queryPages(ctx, r.client, input, page)
 	if err != nil {
-		return nil, err
+		return RoutesPage{}, err
+	}
+	routes, err := r.hydrateRoutes(items)
+	if err != nil {
+		return RoutesPage{}, err
 	}
-	return r.hydrateRoutes(out.Items)
+	return RoutesPage{Routes: routes, Cursor: cursor}, nil
 }
 
-func (r *DynamoDBRoutesRepository) Assign(userID string, routeID string) error {
-	_, err := r.client.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+func (r *DynamoDBRoutesRepository) Assign(ctx context.Context, userID string, routeID string) error {
+	_, err := r.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
 		TransactItems: []*dynamodb.TransactWriteItem{
 			{
 				Update: &dynamodb.Update{
@@ -353,7 +650,7 @@ func (r *DynamoDBRoutesRepository) Assign(userID string, routeID string) error {
 	})
 	if err != nil {
 		log.Printf("routesRepo Assign error: %v\n", err)
-		if strings.Contains(err.Error(), "cancelled") {
+		if isConditionFailed(err) {
 			return ErrRouteAlreadyAssigned
 		}
 		return err
@@ -361,14 +658,89 @@ func (r *DynamoDBRoutesRepository) Assign(userID string, routeID string) error {
 	return nil
 }
 
-func (r *DynamoDBRoutesRepository) Pin(userID string, location models.Location, shiftID string, materials []string) error {
-	route, err := r.Find(shiftID)
+// ForceAssign assigns the route to the gatherer even if it is already
+// assigned to someone else, as long as it has not been initiated yet
+func (r *DynamoDBRoutesRepository) ForceAssign(ctx context.Context, userID string, routeID string) error {
+	_, err := r.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableRoutes),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(routeID),
+			},
+		},
+		ConditionExpression: aws.String("#status IN (:open, :closed, :assigned)"),
+		UpdateExpression:    aws.String("set gatherer_id = :userID, #status = :assigned"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":open": {
+				S: aws.String(models.RouteStatusOpen),
+			},
+			":closed": {
+				S: aws.String(models.RouteStatusClosed),
+			},
+			":assigned": {
+				S: aws.String(models.RouteStatusAssigned),
+			},
+			":userID": {
+				S: aws.String(userID),
+			},
+		},
+	})
 	if err != nil {
+		log.Printf("routesRepo ForceAssign error: %v\n", err)
+		if isConditionFailed(err) {
+			return ErrRouteNotAssignable
+		}
 		return err
 	}
+	return nil
+}
 
-	route.PickingPoints = append(route.PickingPoints, models.PickingPoint{
+// Unassign releases an assigned route, making it available to gatherers again
+func (r *DynamoDBRoutesRepository) Unassign(ctx context.Context, routeID string) error {
+	_, err := r.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableRoutes),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(routeID),
+			},
+		},
+		ConditionExpression: aws.String("#status = :assigned"),
+		UpdateExpression:    aws.String("set gatherer_id = :unassigned, #status = :closed"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":assigned": {
+				S: aws.String(models.RouteStatusAssigned),
+			},
+			":unassigned": {
+				S: aws.String("-"),
+			},
+			":closed": {
+				S: aws.String(models.RouteStatusClosed),
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("routesRepo Unassign error: %v\n", err)
+		if isConditionFailed(err) {
+			return ErrRouteNotAssigned
+		}
+		return err
+	}
+	return nil
+}
+
+// Pin appends a picking point for the location to the route. Only the new
+// element is written, so a pickup, failure or photo stored on another picking
+// point while pinning is kept
+func (r *DynamoDBRoutesRepository) Pin(ctx context.Context, userID string, location models.Location, shiftID string, materials []string) error {
+	pinned, err := r.hydratePickingPointsMap([]models.PickingPoint{{
 		ID:         r.uuidHelper.New(),
+		PickupCode: r.uuidHelper.New(),
 		LocationID: location.ID,
 		Country:    location.Country,
 		City:       location.City,
@@ -377,75 +749,105 @@ func (r *DynamoDBRoutesRepository) Pin(userID string, location models.Location,
 		Address1:   location.Address1,
 		Address2:   location.Address2,
 		Materials:  materials,
-	})
-	mapPickingPoints, err := r.hydratePickingPointsMap(route.PickingPoints)
+	}})
 	if err != nil {
 		return err
 	}
 
-	_, err = r.client.UpdateItem(&dynamodb.UpdateItemInput{
+	_, err = r.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.tableRoutes),
 		Key: map[string]*dynamodb.AttributeValue{
 			"id": {
-				S: aws.String(route.ID),
+				S: aws.String(shiftID),
 			},
 		},
-		UpdateExpression: aws.String("set picking_points = :pickingPoints"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		UpdateExpression:    aws.String("set picking_points = list_append(if_not_exists(picking_points, :empty), :pickingPoints)"),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":pickingPoints": mapPickingPoints,
+			":empty": {
+				L: []*dynamodb.AttributeValue{},
+			},
+			":pickingPoints": pinned,
 		},
 	})
-	if err != nil {
-		return err
+	if isConditionFailed(err) {
+		return ErrRouteNotFound
 	}
-
-	return nil
+	return err
 }
 
 func (r *DynamoDBRoutesRepository) hydratePickingPointsMap(pickingPoints []models.PickingPoint) (*dynamodb.AttributeValue, error) {
 	log.Printf("routes repo: hydratePickingPointsMap: hydrating (%v) pickingPointMaps\n", len(pickingPoints))
 	items := make([]*dynamodb.AttributeValue, len(pickingPoints))
 	for i, pickingPoint := range pickingPoints {
-		nowString, err := r.timeHelper.NowWithTimezoneISO8601()
-		if err != nil {
-			return nil, err
+		created := pickingPoint.Created
+		if created == nil {
+			now, err := nowFrom(r.clock)
+			if err != nil {
+				return nil, err
+			}
+			created = &now
 		}
-		items[i] = &dynamodb.AttributeValue{
-			M: map[string]*dynamodb.AttributeValue{
-				"id": {
-					S: aws.String(pickingPoint.ID),
-				},
-				"location_id": {
-					S: aws.String(pickingPoint.LocationID),
-				},
-				"country": {
-					S: aws.String(pickingPoint.Country),
-				},
-				"city": {
-					S: aws.String(pickingPoint.City),
-				},
-				"latitude": {
-					N: aws.String(fmt.Sprintf("%f", pickingPoint.Latitude)),
-				},
-				"longitude": {
-					N: aws.String(fmt.Sprintf("%f", pickingPoint.Longitude)),
-				},
-				"address_1": {
-					S: aws.String(pickingPoint.Address1),
-				},
-				"materials": {
-					L: r.hydratePickingPointMaterials(pickingPoint.Materials),
-				},
-				"address_2": {
-					S: aws.String(pickingPoint.Address2),
-				},
-				"picked_at": {
-					S: aws.String("-"),
-				},
-				"created": {
-					S: aws.String(nowString),
-				},
+		timestamps := map[string]*time.Time{
+			"picked_at":    pickingPoint.PickedAt,
+			"failed_at":    pickingPoint.FailedAt,
+			"code_used_at": pickingPoint.CodeUsedAt,
+			"created":      created,
+		}
+
+		item := map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(pickingPoint.ID),
 			},
+			"location_id": {
+				S: aws.String(pickingPoint.LocationID),
+			},
+			"country": {
+				S: aws.String(pickingPoint.Country),
+			},
+			"city": {
+				S: aws.String(pickingPoint.City),
+			},
+			"latitude": {
+				N: aws.String(fmt.Sprintf("%f", pickingPoint.Latitude)),
+			},
+			"longitude": {
+				N: aws.String(fmt.Sprintf("%f", pickingPoint.Longitude)),
+			},
+			"address_1": {
+				S: aws.String(pickingPoint.Address1),
+			},
+			"materials": {
+				L: r.hydratePickingPointMaterials(pickingPoint.Materials),
+			},
+			"quantities": {
+				L: r.hydratePickingPointQuantities(pickingPoint.Quantities),
+			},
+			"photos": {
+				L: r.hydratePickingPointPhotos(pickingPoint.Photos),
+			},
+			"address_2": {
+				S: aws.String(pickingPoint.Address2),
+			},
+			"failure_reason": {
+				S: aws.String(orUnset(pickingPoint.FailureReason)),
+			},
+			"failure_note": {
+				S: aws.String(orUnset(pickingPoint.FailureNote)),
+			},
+			"pickup_code": {
+				S: aws.String(orUnset(pickingPoint.PickupCode)),
+			},
+		}
+		for key, t := range timestamps {
+			item[key] = r.hydrateTime(t)
+		}
+		if pickingPoint.FinishFix != nil {
+			item["finish_fix"] = r.hydrateGeoFix(*pickingPoint.FinishFix)
+		}
+
+		items[i] = &dynamodb.AttributeValue{
+			M: item,
 		}
 	}
 	return &dynamodb.AttributeValue{
@@ -453,6 +855,18 @@ func (r *DynamoDBRoutesRepository) hydratePickingPointsMap(pickingPoints []model
 	}, nil
 }
 
+// hydrateTime stores nil timestamps as "-", the sentinel every reader expects
+func (r *DynamoDBRoutesRepository) hydrateTime(t *time.Time) *dynamodb.AttributeValue {
+	if t == nil {
+		return &dynamodb.AttributeValue{
+			S: aws.String("-"),
+		}
+	}
+	return &dynamodb.AttributeValue{
+		S: aws.String(formatTime(*t)),
+	}
+}
+
 func (r *DynamoDBRoutesRepository) hydratePickingPointMaterials(materials []string) []*dynamodb.AttributeValue {
 	log.Printf("routes repo: hydratePickingPointMaterials: hydrating (%v) pickingPointMaterials\n", len(materials))
 	items := make([]*dynamodb.AttributeValue, len(materials))
@@ -464,6 +878,79 @@ func (r *DynamoDBRoutesRepository) hydratePickingPointMaterials(materials []stri
 	return items
 }
 
+func (r *DynamoDBRoutesRepository) hydratePickingPointQuantities(quantities []models.MaterialQuantity) []*dynamodb.AttributeValue {
+	items := make([]*dynamodb.AttributeValue, len(quantities))
+	for i, q := range quantities {
+		items[i] = &dynamodb.AttributeValue{
+			M: map[string]*dynamodb.AttributeValue{
+				"material": {
+					S: aws.String(q.Material),
+				},
+				"amount": {
+					N: aws.String(fmt.Sprintf("%f", q.Amount)),
+				},
+				"unit": {
+					S: aws.String(q.Unit),
+				},
+			},
+		}
+	}
+	return items
+}
+
+func (r *DynamoDBRoutesRepository) hydratePickingPointPhotos(photos []models.Photo) []*dynamodb.AttributeValue {
+	items := make([]*dynamodb.AttributeValue, len(photos))
+	for i, photo := range photos {
+		items[i] = r.hydratePhoto(photo)
+	}
+	return items
+}
+
+func (r *DynamoDBRoutesRepository) hydratePhoto(photo models.Photo) *dynamodb.AttributeValue {
+	created := "-"
+	if photo.Created != nil {
+		created = formatTime(*photo.Created)
+	}
+	return &dynamodb.AttributeValue{
+		M: map[string]*dynamodb.AttributeValue{
+			"key": {
+				S: aws.String(photo.Key),
+			},
+			"kind": {
+				S: aws.String(photo.Kind),
+			},
+			"uploaded_by": {
+				S: aws.String(photo.UploadedBy),
+			},
+			"created": {
+				S: aws.String(created),
+			},
+		},
+	}
+}
+
+func (r *DynamoDBRoutesRepository) hydrateGeoFix(fix models.GeoFix) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{
+		M: map[string]*dynamodb.AttributeValue{
+			"latitude": {
+				N: aws.String(fmt.Sprintf("%f", fix.Latitude)),
+			},
+			"longitude": {
+				N: aws.String(fmt.Sprintf("%f", fix.Longitude)),
+			},
+			"accuracy": {
+				N: aws.String(fmt.Sprintf("%f", fix.Accuracy)),
+			},
+			"distance": {
+				N: aws.String(fmt.Sprintf("%f", fix.Distance)),
+			},
+			"flagged": {
+				BOOL: aws.Bool(fix.Flagged),
+			},
+		},
+	}
+}
+
 func (r *DynamoDBRoutesRepository) hydrateRoutes(items []map[string]*dynamodb.AttributeValue) ([]models.Route, error) {
 	routes := make([]models.Route, len(items))
 	for i, item := range items {
@@ -475,12 +962,18 @@ func (r *DynamoDBRoutesRepository) hydrateRoutes(items []map[string]*dynamodb.At
 		if v, ok := item["sector"]; ok {
 			route.Sector = *v.S
 		}
+		if v, ok := item["sector_id"]; ok && *v.S != "-" {
+			route.SectorID = *v.S
+		}
 		if v, ok := item["shift"]; ok {
 			route.Shift = *v.S
 		}
 		if v, ok := item["gatherer_id"]; ok && *v.S != "-" {
 			route.GathererID = *v.S
 		}
+		if v, ok := item["timezone"]; ok && *v.S != "-" {
+			route.Timezone = *v.S
+		}
 		if v, ok := item["materials"]; ok {
 			materials := make([]string, len(v.L))
 			for i, s := range v.L {
@@ -491,29 +984,29 @@ func (r *DynamoDBRoutesRepository) hydrateRoutes(items []map[string]*dynamodb.At
 		if v, ok := item["status"]; ok {
 			route.Status = *v.S
 		}
-		if v, ok := item["starts_at"]; ok {
-			parsedTime, err := r.timeHelper.FromISO8601(*v.S)
+		if v, ok := item["starts_at"]; ok && *v.S != "-" {
+			parsedTime, err := parseTime(*v.S)
 			if err != nil {
 				return nil, err
 			}
 			route.StartsAt = &parsedTime
 		}
 		if v, ok := item["finished_at"]; ok && *v.S != "-" {
-			parsedTime, err := r.timeHelper.FromISO8601(*v.S)
+			parsedTime, err := parseTime(*v.S)
 			if err != nil {
 				return nil, err
 			}
 			route.FinishedAt = &parsedTime
 		}
 		if v, ok := item["initiated_at"]; ok && *v.S != "-" {
-			parsedTime, err := r.timeHelper.FromISO8601(*v.S)
+			parsedTime, err := parseTime(*v.S)
 			if err != nil {
 				return nil, err
 			}
 			route.InitiatedAt = &parsedTime
 		}
 		if v, ok := item["created"]; ok && *v.S != "-" {
-			parsedTime, err := r.timeHelper.FromISO8601(*v.S)
+			parsedTime, err := parseTime(*v.S)
 			if err != nil {
 				return nil, err
 			}
@@ -570,14 +1063,27 @@ func (r *DynamoDBRoutesRepository) hydratePickingPoints(
 			pp.Address2 = *v.S
 		}
 		if v, ok := item.M["picked_at"]; ok && *v.S != "-" {
-			timeVal, err := r.timeHelper.FromISO8601(*v.S)
+			timeVal, err := parseTime(*v.S)
 			if err != nil {
 				return nil, err
 			}
 			pp.PickedAt = &timeVal
 		}
+		if v, ok := item.M["failed_at"]; ok && *v.S != "-" {
+			timeVal, err := parseTime(*v.S)
+			if err != nil {
+				return nil, err
+			}
+			pp.FailedAt = &timeVal
+		}
+		if v, ok := item.M["failure_reason"]; ok && *v.S != "-" {
+			pp.FailureReason = *v.S
+		}
+		if v, ok := item.M["failure_note"]; ok && *v.S != "-" {
+			pp.FailureNote = *v.S
+		}
 		if v, ok := item.M["created"]; ok && *v.S != "-" {
-			timeVal, err := r.timeHelper.FromISO8601(*v.S)
+			timeVal, err := parseTime(*v.S)
 			if err != nil {
 				return nil, err
 			}
@@ -591,7 +1097,81 @@ func (r *DynamoDBRoutesRepository) hydratePickingPoints(
 			pp.Materials = materials
 
 		}
+		if v, ok := item.M["quantities"]; ok {
+			quantities := make([]models.MaterialQuantity, len(v.L))
+			for i, q := range v.L {
+				amount, err := strconv.ParseFloat(*q.M["amount"].N, 64)
+				if err != nil {
+					return nil, err
+				}
+				quantities[i] = models.MaterialQuantity{
+					Material: *q.M["material"].S,
+					Amount:   amount,
+					Unit:     *q.M["unit"].S,
+				}
+			}
+			pp.Quantities = quantities
+		}
+		if v, ok := item.M["pickup_code"]; ok && *v.S != "-" {
+			pp.PickupCode = *v.S
+		}
+		if v, ok := item.M["code_used_at"]; ok && *v.S != "-" {
+			timeVal, err := parseTime(*v.S)
+			if err != nil {
+				return nil, err
+			}
+			pp.CodeUsedAt = &timeVal
+		}
+		if v, ok := item.M["photos"]; ok {
+			photos := make([]models.Photo, len(v.L))
+			for i, p := range v.L {
+				photo := models.Photo{
+					Key:        *p.M["key"].S,
+					Kind:       *p.M["kind"].S,
+					UploadedBy: *p.M["uploaded_by"].S,
+				}
+				if c, ok := p.M["created"]; ok && *c.S != "-" {
+					timeVal, err := parseTime(*c.S)
+					if err != nil {
+						return nil, err
+					}
+					photo.Created = &timeVal
+				}
+				photos[i] = photo
+			}
+			pp.Photos = photos
+		}
+		if v, ok := item.M["finish_fix"]; ok && v.M != nil {
+			fix, err := r.hydrateGeoFixFromMap(v.M)
+			if err != nil {
+				return nil, err
+			}
+			pp.FinishFix = &fix
+		}
 		pickingPoints[i] = pp
 	}
 	return pickingPoints, nil
 }
+
+func (r *DynamoDBRoutesRepository) hydrateGeoFixFromMap(item map[string]*dynamodb.AttributeValue) (models.GeoFix, error) {
+	fix := models.GeoFix{}
+	numbers := map[string]*float64{
+		"latitude":  &fix.Latitude,
+		"longitude": &fix.Longitude,
+		"accuracy":  &fix.Accuracy,
+		"distance":  &fix.Distance,
+	}
+	for key, dest := range numbers {
+		if v, ok := item[key]; ok {
+			floatVal, err := strconv.ParseFloat(*v.N, 64)
+			if err != nil {
+				return models.GeoFix{}, err
+			}
+			*dest = floatVal
+		}
+	}
+	if v, ok := item["flagged"]; ok && v.BOOL != nil {
+		fix.Flagged = *v.BOOL
+	}
+	return fix, nil
+}
@@ -0,0 +1,473 @@
+package repositories_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories/dynamodbtest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const fixedNow = "2020-06-01T08:00:00-0500"
+
+// fixedNowStored is fixedNow the way timestamps are stored
+const fixedNowStored = "2020-06-01T13:00:00Z"
+
+type fixedTimeHelper struct {
+	*internal.TimeHelper
+}
+
+func (f fixedTimeHelper) NowWithTimezone() (time.Time, error) {
+	return f.FromISO8601(fixedNow)
+}
+
+type sequentialUUIDHelper struct {
+	ids []string
+}
+
+func (s *sequentialUUIDHelper) New() string {
+	id := s.ids[0]
+	s.ids = s.ids[1:]
+	return id
+}
+
+func newRecordedRoutesRepository(t *testing.T, ids ...string) (*repositories.DynamoDBRoutesRepository, *dynamodbtest.Recorder) {
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := dynamodbtest.NewRecorder()
+	repo := repositories.NewDynamoDBRoutesRepository(
+		recorder,
+		"picking_routes",
+		"locations",
+		fixedTimeHelper{timeHelper},
+		&sequentialUUIDHelper{ids: ids},
+	)
+	return repo, recorder
+}
+
+func assertExpression(t *testing.T, name string, expected string, got *string) {
+	t.Helper()
+	if dynamodbtest.Expression(got) != expected {
+		t.Fatalf("expected %s\n\t%s\ngot\n\t%s", name, expected, dynamodbtest.Expression(got))
+	}
+}
+
+func assertString(t *testing.T, name string, expected string, got *string) {
+	t.Helper()
+	if aws.StringValue(got) != expected {
+		t.Fatalf("expected %s to be %q, got %q", name, expected, aws.StringValue(got))
+	}
+}
+
+func assertS(t *testing.T, name string, expected string, got *dynamodb.AttributeValue) {
+	t.Helper()
+	if got == nil {
+		t.Fatalf("expected %s to be %q, got nil", name, expected)
+	}
+	assertString(t, name, expected, got.S)
+}
+
+// Pin appends the new picking point alone, points already picked, failed or
+// whose pickup code was redeemed meanwhile are never written back
+func TestPinAppendsOnlyThePinnedPoint(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t, "pp-2", "code-2")
+
+	err := repo.Pin(ctx, "u2", models.Location{ID: "l2", City: "Bogota"}, "r1", []string{models.MaterialGlass})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Queries) != 0 || len(recorder.Updates) != 1 {
+		t.Fatalf("expected a single update and no read, got %v queries and %v updates", len(recorder.Queries), len(recorder.Updates))
+	}
+	update := recorder.Updates[0]
+	assertS(t, "key", "r1", update.Key["id"])
+	assertExpression(t, "condition expression", "attribute_exists(id)", update.ConditionExpression)
+	assertExpression(t, "update expression", "set picking_points = list_append(if_not_exists(picking_points, :empty), :pickingPoints)", update.UpdateExpression)
+
+	pickingPoints := update.ExpressionAttributeValues[":pickingPoints"].L
+	if len(pickingPoints) != 1 {
+		t.Fatalf("expected only the pinned picking point, got %v", len(pickingPoints))
+	}
+	pinned := pickingPoints[0].M
+	assertS(t, "pinned id", "pp-2", pinned["id"])
+	assertS(t, "pinned location_id", "l2", pinned["location_id"])
+	assertS(t, "pinned pickup_code", "code-2", pinned["pickup_code"])
+	assertS(t, "pinned picked_at", "-", pinned["picked_at"])
+	assertS(t, "pinned code_used_at", "-", pinned["code_used_at"])
+	assertS(t, "pinned created", fixedNowStored, pinned["created"])
+	assertS(t, "pinned material", models.MaterialGlass, pinned["materials"].L[0])
+}
+
+func TestPinMapsMissingRoutesToErrRouteNotFound(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t, "pp-2", "code-2")
+	recorder.OnUpdateItem = func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+
+	err := repo.Pin(ctx, "u2", models.Location{ID: "l2", City: "Bogota"}, "missing", []string{models.MaterialGlass})
+	if err != repositories.ErrRouteNotFound {
+		t.Fatalf("expected ErrRouteNotFound, got %v", err)
+	}
+}
+
+func TestAttachPhotoAddsTheKeyOnce(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+	photo := models.Photo{Key: "picking_points/r1/pp-1/before/p1.jpg", Kind: models.PhotoKindBefore, UploadedBy: "g1"}
+
+	if err := repo.AttachPhoto(ctx, "r1", 1, photo); err != nil {
+		t.Fatal(err)
+	}
+	update := recorder.Updates[0]
+	assertExpression(t, "condition expression", "attribute_exists(id) AND NOT contains(photo_keys, :key)", update.ConditionExpression)
+	assertExpression(t, "update expression", "set picking_points[1].photos = list_append(if_not_exists(picking_points[1].photos, :empty), :photos) add photo_keys :keys", update.UpdateExpression)
+	assertS(t, "key", photo.Key, update.ExpressionAttributeValues[":key"])
+	if keys := update.ExpressionAttributeValues[":keys"].SS; len(keys) != 1 || *keys[0] != photo.Key {
+		t.Fatalf("expected the key added to photo_keys, got %v", aws.StringValueSlice(keys))
+	}
+
+	recorder.OnUpdateItem = func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	if err := repo.AttachPhoto(ctx, "r1", 1, photo); err != repositories.ErrPhotoAlreadyAttached {
+		t.Fatalf("expected ErrPhotoAlreadyAttached, got %v", err)
+	}
+}
+
+func TestAssignIssuesConditionalTransaction(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+
+	err := repo.Assign(ctx, "g1", "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.Transactions) != 1 || len(recorder.Transactions[0].TransactItems) != 1 {
+		t.Fatalf("expected a single item transaction, got %#v", recorder.Transactions)
+	}
+	update := recorder.Transactions[0].TransactItems[0].Update
+	assertS(t, "key", "r1", update.Key["id"])
+	assertExpression(t, "condition", "gatherer_id = :unassigned", update.ConditionExpression)
+	assertExpression(t, "update expression", "set gatherer_id = :userID, #status = :assigned", update.UpdateExpression)
+	assertS(t, ":unassigned", "-", update.ExpressionAttributeValues[":unassigned"])
+	assertS(t, ":userID", "g1", update.ExpressionAttributeValues[":userID"])
+	assertS(t, ":assigned", models.RouteStatusAssigned, update.ExpressionAttributeValues[":assigned"])
+}
+
+func TestAssignMapsCancelledTransactionToErrRouteAlreadyAssigned(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+	recorder.OnTransactWriteItems = func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+		return nil, &dynamodb.TransactionCanceledException{
+			Message_: aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons [ConditionalCheckFailed]"),
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{Code: aws.String("ConditionalCheckFailed")},
+			},
+		}
+	}
+
+	err := repo.Assign(ctx, "g1", "r1")
+	if err != repositories.ErrRouteAlreadyAssigned {
+		t.Fatalf("expected ErrRouteAlreadyAssigned, got %v", err)
+	}
+}
+
+func TestFinishPickingPointIssuesTransaction(t *testing.T) {
+	ctx := context.Background()
+	usedAt := time.Now()
+	cases := []struct {
+		name              string
+		pickingPoint      models.PickingPoint
+		score             int
+		remaining         int
+		items             int
+		updateExpression  string
+		conditionExpected string
+	}{
+		{
+			name:             "pending points left",
+			pickingPoint:     models.PickingPoint{LocationID: "l1"},
+			score:            10,
+			remaining:        2,
+			items:            2,
+			updateExpression: "set picking_points[3].picked_at = :now, picking_points[3].quantities = :quantities",
+		},
+		{
+			name:             "last pending point",
+			pickingPoint:     models.PickingPoint{LocationID: "l1"},
+			score:            10,
+			remaining:        1,
+			items:            2,
+			updateExpression: "set picking_points[3].picked_at = :now, picking_points[3].quantities = :quantities, #status = :finished, finished_at = :now",
+		},
+		{
+			name: "redeemed pickup code and fix",
+			pickingPoint: models.PickingPoint{
+				LocationID: "l1",
+				PickupCode: "code-1",
+				CodeUsedAt: &usedAt,
+				FinishFix:  &models.GeoFix{Latitude: 4.7, Longitude: -74.1},
+			},
+			score:             12,
+			remaining:         2,
+			items:             2,
+			updateExpression:  "set picking_points[3].picked_at = :now, picking_points[3].quantities = :quantities, picking_points[3].finish_fix = :fix, picking_points[3].code_used_at = :now",
+			conditionExpected: "picking_points[3].pickup_code = :code AND picking_points[3].code_used_at = :unused",
+		},
+		{
+			name:             "nothing to credit",
+			pickingPoint:     models.PickingPoint{LocationID: "l1"},
+			score:            0,
+			remaining:        2,
+			items:            1,
+			updateExpression: "set picking_points[3].picked_at = :now, picking_points[3].quantities = :quantities",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			repo, recorder := newRecordedRoutesRepository(t)
+
+			err := repo.FinishPickingPoint(ctx, "r1", 3, c.pickingPoint, c.score, c.remaining)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(recorder.Transactions) != 1 {
+				t.Fatalf("expected 1 transaction, got %v", len(recorder.Transactions))
+			}
+			items := recorder.Transactions[0].TransactItems
+			if len(items) != c.items {
+				t.Fatalf("expected %v transaction items, got %v", c.items, len(items))
+			}
+
+			route := items[0].Update
+			assertString(t, "route table", "picking_routes", route.TableName)
+			assertS(t, "route key", "r1", route.Key["id"])
+			assertS(t, ":now", fixedNowStored, route.ExpressionAttributeValues[":now"])
+			assertExpression(t, "route update expression", c.updateExpression, route.UpdateExpression)
+			assertExpression(t, "route condition", c.conditionExpected, route.ConditionExpression)
+
+			if c.items == 2 {
+				location := items[1].Update
+				assertString(t, "location table", "locations", location.TableName)
+				assertS(t, "location key", "l1", location.Key["id"])
+				assertExpression(t, "location update expression", "set balance = balance + :score", location.UpdateExpression)
+				assertString(t, ":score", strconv.Itoa(c.score), location.ExpressionAttributeValues[":score"].N)
+			}
+		})
+	}
+}
+
+func TestSaveWritesTimestampsInUTC(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+	startsAt := time.Date(2020, 6, 1, 8, 0, 0, 0, time.FixedZone("COT", -5*3600))
+
+	err := repo.Save(ctx, models.Route{ID: "r1", Status: models.RouteStatusOpen, Timezone: "America/Bogota", StartsAt: &startsAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertS(t, "starts_at", fixedNowStored, recorder.Puts[0].Item["starts_at"])
+	assertS(t, "finished_at", "-", recorder.Puts[0].Item["finished_at"])
+	assertS(t, "timezone", "America/Bogota", recorder.Puts[0].Item["timezone"])
+}
+
+func TestFindOpenShiftsQueriesUTCBounds(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+	recorder.OnQuery = func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		item := func(id string, startsAt string) map[string]*dynamodb.AttributeValue {
+			return map[string]*dynamodb.AttributeValue{
+				"id":        {S: aws.String(id)},
+				"starts_at": {S: aws.String(startsAt)},
+			}
+		}
+		return &dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{
+			item("migrated", "2020-06-01T14:00:00Z"),
+			item("legacy", "2020-06-01T10:00:00-0500"),
+		}}, nil
+	}
+	from := time.Date(2020, 6, 1, 8, 0, 0, 0, time.FixedZone("COT", -5*3600))
+
+	routes, err := repo.FindOpenShifts(ctx, from, from.Add(12*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertS(t, ":now", fixedNowStored, recorder.Queries[0].ExpressionAttributeValues[":now"])
+	assertS(t, ":then", "2020-06-02T01:00:00Z", recorder.Queries[0].ExpressionAttributeValues[":then"])
+	legacyStartsAt := time.Date(2020, 6, 1, 15, 0, 0, 0, time.UTC)
+	if len(routes) != 2 || !routes[1].StartsAt.Equal(legacyStartsAt) {
+		t.Fatalf("expected the legacy starts_at to be read, got %#v", routes)
+	}
+}
+
+func TestFindAvailableRoutesPageFollowsEmptyFilteredPages(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+	key := func(id string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}}
+	}
+	pages := []*dynamodb.QueryOutput{
+		{Items: []map[string]*dynamodb.AttributeValue{}, LastEvaluatedKey: key("r1")},
+		{Items: []map[string]*dynamodb.AttributeValue{
+			{"id": {S: aws.String("r2")}, "starts_at": {S: aws.String(fixedNowStored)}},
+		}, LastEvaluatedKey: key("r2")},
+		{Items: []map[string]*dynamodb.AttributeValue{}},
+	}
+	recorder.OnQuery = func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		page := pages[0]
+		pages = pages[1:]
+		return page, nil
+	}
+	from, _ := time.Parse(time.RFC3339, fixedNowStored)
+
+	page, err := repo.FindAvailableRoutesPage(ctx, from, from.Add(12*time.Hour), repositories.PageQuery{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Routes) != 1 || page.Routes[0].ID != "r2" || page.Cursor == "" {
+		t.Fatalf("expected r2 and a cursor, got %+v", page)
+	}
+	if len(recorder.Queries) != 2 {
+		t.Fatalf("expected the empty page to be followed, got %v queries", len(recorder.Queries))
+	}
+	assertS(t, "exclusive start key", "r1", recorder.Queries[1].ExclusiveStartKey["id"])
+
+	page, err = repo.FindAvailableRoutesPage(ctx, from, from.Add(12*time.Hour), repositories.PageQuery{Limit: 1, Cursor: page.Cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertS(t, "cursor start key", "r2", recorder.Queries[2].ExclusiveStartKey["id"])
+	if len(page.Routes) != 0 || page.Cursor != "" {
+		t.Fatalf("expected an empty last page, got %+v", page)
+	}
+}
+
+func TestFindOpenShiftsInSectorPageFiltersOnTheQuery(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+	pages := []*dynamodb.QueryOutput{
+		{Items: []map[string]*dynamodb.AttributeValue{}, LastEvaluatedKey: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String("r1")},
+		}},
+		{Items: []map[string]*dynamodb.AttributeValue{
+			{"id": {S: aws.String("r2")}, "sector_id": {S: aws.String("sector-chapinero")}, "starts_at": {S: aws.String(fixedNowStored)}},
+		}},
+	}
+	recorder.OnQuery = func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		page := pages[0]
+		pages = pages[1:]
+		return page, nil
+	}
+	from, _ := time.Parse(time.RFC3339, fixedNowStored)
+
+	page, err := repo.FindOpenShiftsInSectorPage(ctx, "sector-chapinero", from, from.Add(12*time.Hour), repositories.PageQuery{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Routes) != 1 || page.Routes[0].SectorID != "sector-chapinero" || page.Cursor != "" {
+		t.Fatalf("expected r2 on the last page, got %+v", page)
+	}
+	if len(recorder.Queries) != 2 {
+		t.Fatalf("expected the empty page to be followed, got %v queries", len(recorder.Queries))
+	}
+	query := recorder.Queries[0]
+	if got := dynamodbtest.Expression(query.FilterExpression); got != "sector_id = :sector_id" {
+		t.Fatalf("unexpected filter expression %q", got)
+	}
+	assertS(t, ":sector_id", "sector-chapinero", query.ExpressionAttributeValues[":sector_id"])
+	assertS(t, ":open", models.RouteStatusOpen, query.ExpressionAttributeValues[":open"])
+}
+
+func TestGetAssignedRoutesFollowsEveryPage(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+	recorder.OnQuery = func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		out := &dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{
+			{"id": {S: aws.String("r" + strconv.Itoa(len(recorder.Queries)))}},
+		}}
+		if len(recorder.Queries) < 3 {
+			out.LastEvaluatedKey = out.Items[0]
+		}
+		return out, nil
+	}
+
+	routes, err := repo.GetAssignedRoutesbyUserID(ctx, "g1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 3 || routes[2].ID != "r3" {
+		t.Fatalf("expected the 3 pages of routes, got %#v", routes)
+	}
+	if recorder.Queries[0].Limit != nil {
+		t.Fatalf("expected no limit, got %v", *recorder.Queries[0].Limit)
+	}
+}
+
+func TestFindOpenShiftsPageRejectsForgedCursors(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+	cursor := func(key map[string]*dynamodb.AttributeValue) string {
+		raw, err := json.Marshal(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	from, _ := time.Parse(time.RFC3339, fixedNowStored)
+
+	for name, key := range map[string]map[string]*dynamodb.AttributeValue{
+		"List":      {"id": {L: []*dynamodb.AttributeValue{{S: aws.String("r1")}}}},
+		"Null":      {"id": {NULL: aws.Bool(true)}},
+		"TwoTypes":  {"id": {S: aws.String("r1"), N: aws.String("1")}},
+		"NoType":    {"id": {}},
+		"StringSet": {"id": {SS: []*string{aws.String("r1")}}},
+	} {
+		_, err := repo.FindOpenShiftsPage(ctx, from, from.Add(12*time.Hour), repositories.PageQuery{Cursor: cursor(key)})
+		if err != repositories.ErrInvalidCursor {
+			t.Fatalf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+	if len(recorder.Queries) != 0 {
+		t.Fatalf("expected no query with a forged cursor, got %v", len(recorder.Queries))
+	}
+}
+
+func TestFindOpenShiftsPageMapsRefusedStartKeysToInvalidCursor(t *testing.T) {
+	ctx := context.Background()
+	repo, recorder := newRecordedRoutesRepository(t)
+	recorder.OnQuery = func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		return nil, awserr.New("ValidationException", "The provided starting key is invalid", nil)
+	}
+	from, _ := time.Parse(time.RFC3339, fixedNowStored)
+	stale := base64.RawURLEncoding.EncodeToString([]byte(`{"user_id":{"S":"u1"}}`))
+
+	_, err := repo.FindOpenShiftsPage(ctx, from, from.Add(12*time.Hour), repositories.PageQuery{Cursor: stale})
+	if err != repositories.ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	// without a cursor the start key is not to blame
+	_, err = repo.FindOpenShiftsPage(ctx, from, from.Add(12*time.Hour), repositories.PageQuery{})
+	if err == nil || err == repositories.ErrInvalidCursor {
+		t.Fatalf("expected the ValidationException, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/geo"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var ErrSectorNotFound = errors.New("the location is not inside any sector")
+
+// DynamoDBSectorsRepository keeps the polygons of the sectors routes go
+// around. They are a few per city, so they are scanned whole to locate a point
+type DynamoDBSectorsRepository struct {
+	client       DynamoDBClient
+	tableSectors string
+}
+
+func NewDynamoDBSectorsRepository(client DynamoDBClient, tableSectors string) *DynamoDBSectorsRepository {
+	return &DynamoDBSectorsRepository{
+		client:       client,
+		tableSectors: tableSectors,
+	}
+}
+
+// Save puts the whole sector item, it is meant for seeding and admin tasks
+func (r *DynamoDBSectorsRepository) Save(ctx context.Context, sector models.Sector) error {
+	polygon := make([]*dynamodb.AttributeValue, len(sector.Polygon))
+	for i, point := range sector.Polygon {
+		polygon[i] = &dynamodb.AttributeValue{
+			M: map[string]*dynamodb.AttributeValue{
+				"latitude": {
+					N: aws.String(strconv.FormatFloat(point.Latitude, 'f', -1, 64)),
+				},
+				"longitude": {
+					N: aws.String(strconv.FormatFloat(point.Longitude, 'f', -1, 64)),
+				},
+			},
+		}
+	}
+	_, err := r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableSectors),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(sector.ID),
+			},
+			"name": {
+				S: aws.String(sector.Name),
+			},
+			"city": {
+				S: aws.String(sector.City),
+			},
+			"polygon": {
+				L: polygon,
+			},
+		},
+	})
+	return err
+}
+
+func (r *DynamoDBSectorsRepository) Find(ctx context.Context, id string) (models.Sector, error) {
+	out, err := r.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableSectors),
+		KeyConditionExpression: aws.String("id = :id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {
+				S: aws.String(id),
+			},
+		},
+	})
+	if err != nil {
+		return models.Sector{}, err
+	}
+	if len(out.Items) == 0 {
+		return models.Sector{}, ErrSectorNotFound
+	}
+	return r.hydrate(out.Items[0])
+}
+
+// All returns every sector sorted by id
+func (r *DynamoDBSectorsRepository) All(ctx context.Context) ([]models.Sector, error) {
+	sectors := []models.Sector{}
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(r.tableSectors),
+	}
+	for {
+		out, err := r.client.ScanWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range out.Items {
+			sector, err := r.hydrate(item)
+			if err != nil {
+				return nil, err
+			}
+			sectors = append(sectors, sector)
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	sort.Slice(sectors, func(i, j int) bool {
+		return sectors[i].ID < sectors[j].ID
+	})
+	return sectors, nil
+}
+
+// Locate returns the sector holding the point. When sectors overlap the
+// smallest one wins, so a sector can be carved out of a larger one, and the
+// first one by id among sectors of the same size
+func (r *DynamoDBSectorsRepository) Locate(ctx context.Context, lat float64, lon float64) (models.Sector, error) {
+	sectors, err := r.All(ctx)
+	if err != nil {
+		return models.Sector{}, err
+	}
+	return locateSector(sectors, lat, lon)
+}
+
+// locateSector expects the sectors sorted by id
+func locateSector(sectors []models.Sector, lat float64, lon float64) (models.Sector, error) {
+	found := -1
+	smallest := 0.0
+	for i, sector := range sectors {
+		if !sector.Polygon.Bounds().Contains(lat, lon) || !sector.Contains(lat, lon) {
+			continue
+		}
+		if area := sector.Polygon.Area(); found < 0 || area < smallest {
+			found, smallest = i, area
+		}
+	}
+	if found < 0 {
+		return models.Sector{}, ErrSectorNotFound
+	}
+	return sectors[found], nil
+}
+
+func (r *DynamoDBSectorsRepository) hydrate(item map[string]*dynamodb.AttributeValue) (models.Sector, error) {
+	sector := models.Sector{}
+	if v, ok := item["id"]; ok {
+		sector.ID = *v.S
+	}
+	if v, ok := item["name"]; ok {
+		sector.Name = *v.S
+	}
+	if v, ok := item["city"]; ok {
+		sector.City = *v.S
+	}
+	if v, ok := item["polygon"]; ok {
+		sector.Polygon = make(geo.Polygon, len(v.L))
+		for i, pointItem := range v.L {
+			lat, err := strconv.ParseFloat(*pointItem.M["latitude"].N, 64)
+			if err != nil {
+				return models.Sector{}, err
+			}
+			lon, err := strconv.ParseFloat(*pointItem.M["longitude"].N, 64)
+			if err != nil {
+				return models.Sector{}, err
+			}
+			sector.Polygon[i] = geo.Point{Latitude: lat, Longitude: lon}
+		}
+	}
+	return sector, nil
+}
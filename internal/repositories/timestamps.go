@@ -0,0 +1,49 @@
+package repositories
+
+import "time"
+
+// legacyTimeLayout is the local offset layout timestamps were stored with
+// before being normalized to UTC, items not migrated yet still have it. See
+// MigrateTimestamps
+const legacyTimeLayout = "2006-01-02T15:04:05-0700"
+
+// Clock tells the current time, the zone it is in does not matter since
+// timestamps are stored in UTC
+type Clock interface {
+	NowWithTimezone() (time.Time, error)
+}
+
+// formatTime writes t as UTC RFC 3339 with second precision, so timestamps
+// sort the same way as strings than they do as times and range queries on
+// them are correct
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseTime reads timestamps written by formatTime, or with the legacy layout
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Parse(legacyTimeLayout, s)
+	}
+	return t, nil
+}
+
+// nowFrom reads the clock truncated to the precision timestamps are stored with
+func nowFrom(clock Clock) (time.Time, error) {
+	t, err := clock.NowWithTimezone()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC().Truncate(time.Second), nil
+}
+
+// timeOrNow is t truncated the way timestamps are stored, or the time of the
+// clock when t is not given. Actions synced from offline devices carry the
+// time they happened at, which is the one to keep
+func timeOrNow(t *time.Time, clock Clock) (time.Time, error) {
+	if t == nil || t.IsZero() {
+		return nowFrom(clock)
+	}
+	return t.UTC().Truncate(time.Second), nil
+}
@@ -0,0 +1,144 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var ErrNoGathererPosition = errors.New("no recent position of the gatherer")
+
+// DynamoDBTrackingRepository keeps the last position of the gatherer of every
+// initiated route, each one expiring after a while without new pings
+type DynamoDBTrackingRepository struct {
+	client         DynamoDBClient
+	tablePositions string
+	clock          Clock
+}
+
+func NewDynamoDBTrackingRepository(client DynamoDBClient, tablePositions string, clock Clock) *DynamoDBTrackingRepository {
+	return &DynamoDBTrackingRepository{
+		client:         client,
+		tablePositions: tablePositions,
+		clock:          clock,
+	}
+}
+
+// Track stores position as the last one of its route for ttl. Pings arriving
+// after a more recent one are ignored
+func (r *DynamoDBTrackingRepository) Track(ctx context.Context, position models.GathererPosition, ttl time.Duration) error {
+	now, err := nowFrom(r.clock)
+	if err != nil {
+		return err
+	}
+	recordedAt := formatTime(position.RecordedAt)
+	_, err = r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tablePositions),
+		Item: map[string]*dynamodb.AttributeValue{
+			"route_id": {
+				S: aws.String(position.RouteID),
+			},
+			"gatherer_id": {
+				S: aws.String(position.GathererID),
+			},
+			"latitude": {
+				N: aws.String(strconv.FormatFloat(position.Latitude, 'f', -1, 64)),
+			},
+			"longitude": {
+				N: aws.String(strconv.FormatFloat(position.Longitude, 'f', -1, 64)),
+			},
+			"accuracy": {
+				N: aws.String(strconv.FormatFloat(position.Accuracy, 'f', -1, 64)),
+			},
+			"recorded_at": {
+				S: aws.String(recordedAt),
+			},
+			"expires_at": {
+				N: aws.String(strconv.FormatInt(now.Add(ttl).Unix(), 10)),
+			},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(route_id) OR recorded_at <= :recorded_at OR expires_at <= :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":recorded_at": {
+				S: aws.String(recordedAt),
+			},
+			":now": {
+				N: aws.String(strconv.FormatInt(now.Unix(), 10)),
+			},
+		},
+	})
+	if err != nil && isConditionFailed(err) {
+		log.Printf("ignoring ping of route (%s) recorded at (%s), a newer one is stored\n", position.RouteID, recordedAt)
+		return nil
+	}
+	return err
+}
+
+// Latest is the last position of the gatherer of the route, as long as it
+// did not expire. DynamoDB removes expired items with some delay, so they are
+// filtered out here too
+func (r *DynamoDBTrackingRepository) Latest(ctx context.Context, routeID string) (models.GathererPosition, error) {
+	now, err := nowFrom(r.clock)
+	if err != nil {
+		return models.GathererPosition{}, err
+	}
+	out, err := r.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.tablePositions),
+		KeyConditionExpression: aws.String("route_id = :route_id"),
+		FilterExpression:       aws.String("expires_at > :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":route_id": {
+				S: aws.String(routeID),
+			},
+			":now": {
+				N: aws.String(strconv.FormatInt(now.Unix(), 10)),
+			},
+		},
+	})
+	if err != nil {
+		return models.GathererPosition{}, err
+	}
+	if len(out.Items) == 0 {
+		return models.GathererPosition{}, ErrNoGathererPosition
+	}
+	return r.hydratePosition(out.Items[0])
+}
+
+func (r *DynamoDBTrackingRepository) hydratePosition(item map[string]*dynamodb.AttributeValue) (models.GathererPosition, error) {
+	position := models.GathererPosition{}
+	if v, ok := item["route_id"]; ok {
+		position.RouteID = *v.S
+	}
+	if v, ok := item["gatherer_id"]; ok {
+		position.GathererID = *v.S
+	}
+	for name, field := range map[string]*float64{
+		"latitude":  &position.Latitude,
+		"longitude": &position.Longitude,
+		"accuracy":  &position.Accuracy,
+	} {
+		v, ok := item[name]
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(*v.N, 64)
+		if err != nil {
+			return models.GathererPosition{}, err
+		}
+		*field = f
+	}
+	if v, ok := item["recorded_at"]; ok {
+		recordedAt, err := parseTime(*v.S)
+		if err != nil {
+			return models.GathererPosition{}, err
+		}
+		position.RecordedAt = recordedAt
+	}
+	return position, nil
+}
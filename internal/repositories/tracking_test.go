@@ -0,0 +1,44 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories/dynamodbtest"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestTrackIgnoresLatePings(t *testing.T) {
+	ctx := context.Background()
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := dynamodbtest.NewRecorder()
+	recorder.OnPutItem = func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "the conditional request failed", nil)
+	}
+	repo := repositories.NewDynamoDBTrackingRepository(recorder, "gatherer_positions", timeHelper)
+
+	recordedAt := time.Date(2020, 10, 5, 8, 30, 0, 0, time.FixedZone("COT", -5*60*60))
+	err = repo.Track(ctx, models.GathererPosition{RouteID: "r1", GathererID: "g1", RecordedAt: recordedAt}, time.Minute)
+	if err != nil {
+		t.Fatalf("expected the late ping to be ignored, got %v", err)
+	}
+
+	put := recorder.Puts[0]
+	if got := *put.Item["recorded_at"].S; got != "2020-10-05T13:30:00Z" {
+		t.Fatalf("expected recorded_at in UTC, got %v", got)
+	}
+	if got := *put.ExpressionAttributeValues[":recorded_at"].S; got != "2020-10-05T13:30:00Z" {
+		t.Fatalf("expected the ping to be compared in UTC, got %v", got)
+	}
+	if put.Item["expires_at"].N == nil {
+		t.Fatalf("expected expires_at to be a number DynamoDB TTL understands")
+	}
+}
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"errors"
 
 	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
@@ -11,19 +12,19 @@ import (
 var ErrUserNotFound = errors.New("user not found")
 
 type DynamoDBUsersRepository struct {
-	client     *dynamodb.DynamoDB
+	client     DynamoDBClient
 	tableUsers string
 }
 
-func NewDynamoDBUsersRepository(client *dynamodb.DynamoDB, tableUsers string) *DynamoDBUsersRepository {
+func NewDynamoDBUsersRepository(client DynamoDBClient, tableUsers string) *DynamoDBUsersRepository {
 	return &DynamoDBUsersRepository{
 		client:     client,
 		tableUsers: tableUsers,
 	}
 }
 
-func (r *DynamoDBUsersRepository) Find(userID string) (models.User, error) {
-	out, err := r.client.Query(&dynamodb.QueryInput{
+func (r *DynamoDBUsersRepository) Find(ctx context.Context, userID string) (models.User, error) {
+	out, err := r.client.QueryWithContext(ctx, &dynamodb.QueryInput{
 		TableName: aws.String(r.tableUsers),
 		KeyConditions: map[string]*dynamodb.Condition{
 			"id": {
@@ -45,8 +46,36 @@ func (r *DynamoDBUsersRepository) Find(userID string) (models.User, error) {
 	return r.hydrate(out.Items[0]), nil
 }
 
-func (r *DynamoDBUsersRepository) FindByUsername(username string) (models.User, error) {
-	out, err := r.client.Query(&dynamodb.QueryInput{
+// Save puts the whole user item, it is meant for seeding and admin tasks
+func (r *DynamoDBUsersRepository) Save(ctx context.Context, user models.User) error {
+	_, err := r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableUsers),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id": {
+				S: aws.String(user.ID),
+			},
+			"username": {
+				S: aws.String(user.Username),
+			},
+			"firstname": {
+				S: aws.String(user.Firstname),
+			},
+			"lastname": {
+				S: aws.String(user.Lastname),
+			},
+			"type": {
+				S: aws.String(user.Type),
+			},
+			"country": {
+				S: aws.String(user.Country),
+			},
+		},
+	})
+	return err
+}
+
+func (r *DynamoDBUsersRepository) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	out, err := r.client.QueryWithContext(ctx, &dynamodb.QueryInput{
 		TableName:              aws.String(r.tableUsers),
 		IndexName:              aws.String("by_username"),
 		KeyConditionExpression: aws.String("username = :username"),
@@ -0,0 +1,251 @@
+// Package schema declares every table and global secondary index the
+// repositories query, so they can be created on DynamoDB Local or any other
+// configurable endpoint. IaC/main.tf remains the source for AWS
+package schema
+
+import (
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type Names struct {
+	Users             string
+	Locations         string
+	UserLocations     string
+	PickingRoutes     string
+	IdempotencyKeys   string
+	GathererPositions string
+	Sectors           string
+}
+
+// DefaultNames are the table names used on config.dev.yml.example
+var DefaultNames = Names{
+	Users:             "users",
+	Locations:         "locations",
+	UserLocations:     "user_locations",
+	PickingRoutes:     "picking_routes",
+	IdempotencyKeys:   "idempotency_keys",
+	GathererPositions: "gatherer_positions",
+	Sectors:           "sectors",
+}
+
+// WithPrefix returns the same names prefixed, handy to isolate test runs
+func (n Names) WithPrefix(prefix string) Names {
+	return Names{
+		Users:             prefix + n.Users,
+		Locations:         prefix + n.Locations,
+		UserLocations:     prefix + n.UserLocations,
+		PickingRoutes:     prefix + n.PickingRoutes,
+		IdempotencyKeys:   prefix + n.IdempotencyKeys,
+		GathererPositions: prefix + n.GathererPositions,
+		Sectors:           prefix + n.Sectors,
+	}
+}
+
+func Tables(names Names) []*dynamodb.CreateTableInput {
+	return []*dynamodb.CreateTableInput{
+		{
+			TableName:   aws.String(names.Users),
+			BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				stringAttribute("id"),
+				stringAttribute("username"),
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				hashKey("id"),
+			},
+			GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+				index("by_username", hashKey("username")),
+			},
+		},
+		{
+			TableName:   aws.String(names.Locations),
+			BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				stringAttribute("id"),
+				stringAttribute("geohash_cell"),
+				stringAttribute("geohash"),
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				hashKey("id"),
+			},
+			GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+				index("by_geohash_cell", hashKey("geohash_cell"), rangeKey("geohash")),
+			},
+		},
+		{
+			TableName:   aws.String(names.UserLocations),
+			BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				stringAttribute("id"),
+				stringAttribute("user_id"),
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				hashKey("id"),
+			},
+			GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+				index("by_user_id", hashKey("user_id")),
+			},
+		},
+		{
+			TableName:   aws.String(names.PickingRoutes),
+			BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				stringAttribute("id"),
+				stringAttribute("status"),
+				stringAttribute("starts_at"),
+				stringAttribute("gatherer_id"),
+				stringAttribute("finished_at"),
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				hashKey("id"),
+			},
+			GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+				index("by_status_and_starts_at", hashKey("status"), rangeKey("starts_at")),
+				index("by_gatherer_id_and_unfinished", hashKey("gatherer_id"), rangeKey("finished_at")),
+			},
+		},
+		{
+			TableName:   aws.String(names.IdempotencyKeys),
+			BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				stringAttribute("id"),
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				hashKey("id"),
+			},
+		},
+		{
+			TableName:   aws.String(names.GathererPositions),
+			BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				stringAttribute("route_id"),
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				hashKey("route_id"),
+			},
+		},
+		{
+			TableName:   aws.String(names.Sectors),
+			BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				stringAttribute("id"),
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				hashKey("id"),
+			},
+		},
+	}
+}
+
+// TimeToLive lists the tables whose items expire, by the epoch seconds
+// attribute telling when
+func TimeToLive(names Names) map[string]string {
+	return map[string]string{
+		names.IdempotencyKeys:   "expires_at",
+		names.GathererPositions: "expires_at",
+	}
+}
+
+// Create creates every missing table and waits for them to be active, tables
+// that already exist are left untouched
+func Create(client *dynamodb.DynamoDB, names Names) error {
+	for _, table := range Tables(names) {
+		_, err := client.CreateTable(table)
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceInUseException {
+			log.Printf("schema: table (%s) already exists\n", *table.TableName)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("schema: creating table (%s)\n", *table.TableName)
+	}
+
+	for _, table := range Tables(names) {
+		err := client.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+			TableName: table.TableName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for table, attribute := range TimeToLive(names) {
+		_, err := client.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+			TableName: aws.String(table),
+			TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+				AttributeName: aws.String(attribute),
+				Enabled:       aws.Bool(true),
+			},
+		})
+		// enabling it again on an existing table is rejected
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "ValidationException" {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drop deletes every table, missing tables are ignored
+func Drop(client *dynamodb.DynamoDB, names Names) error {
+	for _, table := range Tables(names) {
+		_, err := client.DeleteTable(&dynamodb.DeleteTableInput{
+			TableName: table.TableName,
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("schema: dropping table (%s)\n", *table.TableName)
+	}
+
+	for _, table := range Tables(names) {
+		err := client.WaitUntilTableNotExists(&dynamodb.DescribeTableInput{
+			TableName: table.TableName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stringAttribute(name string) *dynamodb.AttributeDefinition {
+	return &dynamodb.AttributeDefinition{
+		AttributeName: aws.String(name),
+		AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+	}
+}
+
+func hashKey(name string) *dynamodb.KeySchemaElement {
+	return &dynamodb.KeySchemaElement{
+		AttributeName: aws.String(name),
+		KeyType:       aws.String(dynamodb.KeyTypeHash),
+	}
+}
+
+func rangeKey(name string) *dynamodb.KeySchemaElement {
+	return &dynamodb.KeySchemaElement{
+		AttributeName: aws.String(name),
+		KeyType:       aws.String(dynamodb.KeyTypeRange),
+	}
+}
+
+func index(name string, keySchema ...*dynamodb.KeySchemaElement) *dynamodb.GlobalSecondaryIndex {
+	return &dynamodb.GlobalSecondaryIndex{
+		IndexName: aws.String(name),
+		KeySchema: keySchema,
+		Projection: &dynamodb.Projection{
+			ProjectionType: aws.String(dynamodb.ProjectionTypeAll),
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"math"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+// PickupBaseScore is the amount credited to a location for every successful
+// pickup, regardless of what was collected
+const PickupBaseScore = 10
+
+// MaxPickupScore caps the balance a single pickup credits, whatever the
+// quantities recorded
+const MaxPickupScore = 500
+
+var scorePerKilogram = map[string]float64{
+	models.MaterialPlastic:    2,
+	models.MaterialMetal:      3,
+	models.MaterialGlass:      1,
+	models.MaterialPaper:      1,
+	models.MaterialTechnology: 5,
+}
+
+var scorePerUnit = map[string]float64{
+	models.MaterialPlastic:    0.1,
+	models.MaterialMetal:      0.2,
+	models.MaterialGlass:      0.2,
+	models.MaterialPaper:      0.05,
+	models.MaterialTechnology: 2,
+}
+
+// PickupScore calculates the balance to credit to a location given the
+// quantities recorded at pickup, up to MaxPickupScore. Quantities that are
+// not positive add nothing
+func PickupScore(quantities []models.MaterialQuantity) int {
+	score := float64(PickupBaseScore)
+	for _, q := range quantities {
+		if q.Amount <= 0 {
+			continue
+		}
+		switch q.Unit {
+		case models.UnitKilograms:
+			score += q.Amount * scorePerKilogram[q.Material]
+		case models.UnitUnits:
+			score += q.Amount * scorePerUnit[q.Material]
+		}
+	}
+	return int(math.Round(math.Min(score, MaxPickupScore)))
+}
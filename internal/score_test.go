@@ -0,0 +1,44 @@
+package internal_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+)
+
+func TestPickupScore(t *testing.T) {
+	kg := func(material string, amount float64) models.MaterialQuantity {
+		return models.MaterialQuantity{Material: material, Amount: amount, Unit: models.UnitKilograms}
+	}
+	units := func(material string, amount float64) models.MaterialQuantity {
+		return models.MaterialQuantity{Material: material, Amount: amount, Unit: models.UnitUnits}
+	}
+	cases := []struct {
+		name       string
+		quantities []models.MaterialQuantity
+		score      int
+	}{
+		{"NoQuantities", nil, internal.PickupBaseScore},
+		{"Kilograms", []models.MaterialQuantity{kg(models.MaterialPlastic, 3.5)}, 17},
+		{"Units", []models.MaterialQuantity{units(models.MaterialTechnology, 2)}, 14},
+		{"Rounded", []models.MaterialQuantity{units(models.MaterialPaper, 9)}, 10},
+		{"Mixed", []models.MaterialQuantity{kg(models.MaterialMetal, 2), units(models.MaterialGlass, 5)}, 17},
+		{"UnknownUnit", []models.MaterialQuantity{{Material: models.MaterialMetal, Amount: 5, Unit: "lb"}}, internal.PickupBaseScore},
+		{"NotPositive", []models.MaterialQuantity{kg(models.MaterialMetal, -50), kg(models.MaterialMetal, 0)}, internal.PickupBaseScore},
+		{"LargestAllowed", []models.MaterialQuantity{kg(models.MaterialTechnology, models.MaxQuantityAmount)}, internal.MaxPickupScore},
+		{"ManyQuantities", []models.MaterialQuantity{
+			kg(models.MaterialMetal, 100), kg(models.MaterialMetal, 100), kg(models.MaterialMetal, 100),
+		}, internal.MaxPickupScore},
+		{"Huge", []models.MaterialQuantity{kg(models.MaterialMetal, math.MaxFloat64)}, internal.MaxPickupScore},
+		{"Infinite", []models.MaterialQuantity{kg(models.MaterialMetal, math.Inf(1))}, internal.MaxPickupScore},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if score := internal.PickupScore(c.quantities); score != c.score {
+				t.Fatalf("expected score %v, got %v", c.score, score)
+			}
+		})
+	}
+}
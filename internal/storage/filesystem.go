@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FilesystemObjectStore keeps the objects on a local directory, it is meant
+// to be used when running the backend locally. It also works as the
+// http.Handler receiving the uploads
+type FilesystemObjectStore struct {
+	dir     string
+	baseURL string
+}
+
+func NewFilesystemObjectStore(dir string, baseURL string) (*FilesystemObjectStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FilesystemObjectStore{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (s *FilesystemObjectStore) UploadURL(key string, contentType string, expires time.Duration) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	return s.baseURL + "/" + key, nil
+}
+
+func (s *FilesystemObjectStore) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+func (s *FilesystemObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, err := s.path(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Written aside and moved in place once complete, so Exists never
+		// reports an upload still in progress
+		file, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(file.Name())
+		_, err = io.Copy(file, r.Body)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(file.Name(), path)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("filesystem store: stored (%s)\n", path)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		http.ServeFile(w, r, path)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *FilesystemObjectStore) path(key string) (string, error) {
+	// Keys go into the upload URL as they are, escapes would have it point
+	// somewhere else than the file checked here
+	cleaned := filepath.Clean("/" + key)
+	if key == "" || cleaned == "/" || cleaned != "/"+key || strings.ContainsAny(key, "%\\") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(cleaned)), nil
+}
@@ -0,0 +1,125 @@
+package storage_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/storage"
+)
+
+// escapes are keys reaching outside the directory of the store one way or
+// another, or naming no object at all
+var escapes = []struct {
+	name string
+	key  string
+}{
+	{"Parent", "../outside.jpg"},
+	{"NestedParent", "picking_points/../../outside.jpg"},
+	{"Absolute", "/tmp/outside.jpg"},
+	{"DoubleSlash", "picking_points//pp1.jpg"},
+	{"Dot", "picking_points/./pp1.jpg"},
+	{"Encoded", "%2e%2e/outside.jpg"},
+	{"EncodedSlash", "..%2foutside.jpg"},
+	{"Backslash", `..\outside.jpg`},
+	{"Empty", ""},
+}
+
+// newStore serves a store kept in a fresh directory under a parent of its
+// own, so writes escaping it can be looked for
+func newStore(t *testing.T) (*storage.FilesystemObjectStore, string) {
+	t.Helper()
+	parent, err := ioutil.TempDir("", "filesystem-store-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(parent) })
+	store, err := storage.NewFilesystemObjectStore(filepath.Join(parent, "uploads"), "http://localhost:8080/uploads/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, parent
+}
+
+func TestFilesystemStoreRefusesKeysOutsideItsDirectory(t *testing.T) {
+	store, _ := newStore(t)
+
+	for _, c := range escapes {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := store.UploadURL(c.key, "image/jpeg", time.Minute); err != storage.ErrInvalidKey {
+				t.Fatalf("expected ErrInvalidKey issuing the upload, got %v", err)
+			}
+			if _, err := store.Exists(context.Background(), c.key); err != storage.ErrInvalidKey {
+				t.Fatalf("expected ErrInvalidKey checking the object, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFilesystemStoreServesNothingOutsideItsDirectory(t *testing.T) {
+	store, parent := newStore(t)
+	if err := ioutil.WriteFile(filepath.Join(parent, "secret.jpg"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/../outside.jpg", "/%2e%2e/outside.jpg", "/..%2foutside.jpg", "/picking_points/..%2f..%2foutside.jpg"} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			store.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, path, strings.NewReader("payload")))
+			if rec.Code == http.StatusOK {
+				t.Fatalf("expected the upload to be refused, got %v", rec.Code)
+			}
+
+			rec = httptest.NewRecorder()
+			store.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, strings.Replace(path, "outside", "secret", 1), nil))
+			if rec.Code == http.StatusOK || strings.Contains(rec.Body.String(), "secret") {
+				t.Fatalf("expected the file outside to stay hidden, got %v %q", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	entries, err := ioutil.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "uploads" && entry.Name() != "secret.jpg" {
+			t.Fatalf("expected nothing written outside the store, found %s", entry.Name())
+		}
+	}
+}
+
+func TestFilesystemStoreTellsUploadedObjects(t *testing.T) {
+	store, _ := newStore(t)
+	ctx := context.Background()
+	key := "picking_points/r1/pp1/photo.jpg"
+
+	if uploaded, err := store.Exists(ctx, key); err != nil || uploaded {
+		t.Fatalf("expected nothing before the upload, got %v %v", uploaded, err)
+	}
+
+	rec := httptest.NewRecorder()
+	store.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/"+key, strings.NewReader("jpeg")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the upload stored, got %v: %s", rec.Code, rec.Body.String())
+	}
+	if uploaded, err := store.Exists(ctx, key); err != nil || !uploaded {
+		t.Fatalf("expected the object after the upload, got %v %v", uploaded, err)
+	}
+	// directories are not objects
+	if uploaded, err := store.Exists(ctx, "picking_points/r1/pp1"); err != nil || uploaded {
+		t.Fatalf("expected no object for a directory, got %v %v", uploaded, err)
+	}
+
+	rec = httptest.NewRecorder()
+	store.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "jpeg" {
+		t.Fatalf("expected the uploaded content, got %v %q", rec.Code, rec.Body.String())
+	}
+}
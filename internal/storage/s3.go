@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type S3ObjectStore struct {
+	client *s3.S3
+	bucket string
+}
+
+func NewS3ObjectStore(client *s3.S3, bucket string) *S3ObjectStore {
+	return &S3ObjectStore{
+		client: client,
+		bucket: bucket,
+	}
+}
+
+func (s *S3ObjectStore) UploadURL(key string, contentType string, expires time.Duration) (string, error) {
+	req, _ := s.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	return req.Presign(expires)
+}
+
+// Exists needs s3:ListBucket on the bucket, without it S3 answers missing
+// objects with AccessDenied instead of NotFound
+func (s *S3ObjectStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == "NotFound" || aerr.Code() == s3.ErrCodeNoSuchKey) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrInvalidKey = errors.New("invalid object key")
+
+// ObjectStore abstracts the place where picking point photos are uploaded to.
+// Clients never send the file through the API, they get an upload slot and
+// PUT the content there directly, Exists then tells whether they did
+type ObjectStore interface {
+	UploadURL(key string, contentType string, expires time.Duration) (string, error)
+	Exists(ctx context.Context, key string) (bool, error)
+}
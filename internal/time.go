@@ -1,39 +1,15 @@
 package internal
 
 import (
-	"fmt"
 	"time"
 )
 
+// TimeHelper renders and reads dates the way clients see them, in a zone.
+// Storage does not go through it, the repositories keep timestamps in UTC
 type TimeHelper struct {
 	Timezone string
 }
 
-var spanishMonths = map[string]string{
-	"January":   "Enero",
-	"February":  "Febrero",
-	"March":     "Marzo",
-	"April":     "Abril",
-	"May":       "Mayo",
-	"June":      "Junio",
-	"July":      "Julio",
-	"August":    "Agosto",
-	"September": "Septiembre",
-	"October":   "Octubre",
-	"November":  "Noviembre",
-	"December":  "Diciembre",
-}
-
-var spanishDays = map[string]string{
-	"Sunday":    "Domingo",
-	"Monday":    "Lunes",
-	"Tuesday":   "Martes",
-	"Wednesday": "Miércoles",
-	"Thursday":  "Jueves",
-	"Friday":    "Viernes",
-	"Saturday":  "Sábado",
-}
-
 func NewTimeHelper(timezone string) (*TimeHelper, error) {
 	_, err := time.LoadLocation(timezone)
 	if err != nil {
@@ -44,8 +20,21 @@ func NewTimeHelper(timezone string) (*TimeHelper, error) {
 	}, nil
 }
 
+// Location loads the given IANA zone, or the helper one when it is empty
+func (t *TimeHelper) Location(zone string) (*time.Location, error) {
+	if zone == "" {
+		zone = t.Timezone
+	}
+	return time.LoadLocation(zone)
+}
+
 func (t *TimeHelper) ToISO8601(d time.Time) (string, error) {
-	location, err := time.LoadLocation(t.Timezone)
+	return t.ToISO8601In(d, "")
+}
+
+// ToISO8601In writes d in the given zone, see Location
+func (t *TimeHelper) ToISO8601In(d time.Time, zone string) (string, error) {
+	location, err := t.Location(zone)
 	if err != nil {
 		return "", err
 	}
@@ -53,18 +42,30 @@ func (t *TimeHelper) ToISO8601(d time.Time) (string, error) {
 	return timezoned.Format("2006-01-02T15:04:05-0700"), nil
 }
 
+// ToLatamFormat writes d in the helper zone and the default locale, see
+// FormatDate
 func (t *TimeHelper) ToLatamFormat(d time.Time) (string, error) {
-	location, err := time.LoadLocation(t.Timezone)
+	return t.FormatDate(d, "", DefaultLocale)
+}
+
+// FormatDate writes d in the given zone, see Location, the way locale does
+func (t *TimeHelper) FormatDate(d time.Time, zone string, locale *Locale) (string, error) {
+	location, err := t.Location(zone)
 	if err != nil {
 		return "", err
 	}
-	timezoned := d.In(location)
-	return fmt.Sprintf(
-		"%s %v de %s",
-		spanishDays[timezoned.Weekday().String()],
-		timezoned.Day(),
-		spanishMonths[timezoned.Month().String()],
-	), nil
+	return locale.FormatDate(d.In(location)), nil
+}
+
+// EndOfDayAfter is the last second of the day that comes days after the one
+// of d, both days being taken in the given zone, see Location
+func (t *TimeHelper) EndOfDayAfter(d time.Time, days int, zone string) (time.Time, error) {
+	location, err := t.Location(zone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	year, month, day := d.In(location).Date()
+	return time.Date(year, month, day+days+1, 0, 0, 0, 0, location).Add(-time.Second), nil
 }
 
 func (t *TimeHelper) FromISO8601(d string) (time.Time, error) {
@@ -83,15 +84,3 @@ func (t *TimeHelper) NowWithTimezone() (time.Time, error) {
 	timezoned := time.Now().In(location)
 	return timezoned, nil
 }
-
-func (t *TimeHelper) NowWithTimezoneISO8601() (string, error) {
-	nowTimezoned, err := t.NowWithTimezone()
-	if err != nil {
-		return "", err
-	}
-	iso8601, err := t.ToISO8601(nowTimezoned)
-	if err != nil {
-		return "", err
-	}
-	return iso8601, nil
-}
@@ -0,0 +1,78 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+)
+
+func TestToISO8601InFallsBackToTheHelperZone(t *testing.T) {
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := time.Date(2020, time.June, 1, 13, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		zone     string
+		expected string
+	}{
+		{"", "2020-06-01T08:00:00-0500"},
+		{"America/Sao_Paulo", "2020-06-01T10:00:00-0300"},
+		{"America/Los_Angeles", "2020-06-01T06:00:00-0700"},
+		{"UTC", "2020-06-01T13:00:00+0000"},
+	}
+	for _, c := range cases {
+		got, err := timeHelper.ToISO8601In(d, c.zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Errorf("%q: expected %s, got %s", c.zone, c.expected, got)
+		}
+	}
+
+	if _, err := timeHelper.ToISO8601In(d, "Mars/Olympus_Mons"); err == nil {
+		t.Fatalf("expected an unknown zone to fail")
+	}
+}
+
+func TestEndOfDayAfterCountsDaysInTheZone(t *testing.T) {
+	timeHelper, err := internal.NewTimeHelper("America/Bogota")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		now      time.Time
+		days     int
+		zone     string
+		expected string
+	}{
+		// 02:30 UTC is still the previous evening in Bogota
+		{"HelperZone", time.Date(2020, time.June, 2, 2, 30, 0, 0, time.UTC), 0, "", "2020-06-01T23:59:59-0500"},
+		{"DaysAhead", time.Date(2020, time.June, 2, 2, 30, 0, 0, time.UTC), 7, "", "2020-06-08T23:59:59-0500"},
+		{"CallerZoneAlreadyTomorrow", time.Date(2020, time.June, 2, 2, 30, 0, 0, time.UTC), 0, "America/Sao_Paulo", "2020-06-01T23:59:59-0300"},
+		{"CallerZoneAhead", time.Date(2020, time.June, 2, 3, 30, 0, 0, time.UTC), 0, "America/Sao_Paulo", "2020-06-02T23:59:59-0300"},
+		{"AcrossMonths", time.Date(2020, time.June, 29, 12, 0, 0, 0, time.UTC), 3, "", "2020-07-02T23:59:59-0500"},
+		// New York springs forward on March 8, 2020
+		{"AcrossDST", time.Date(2020, time.March, 7, 17, 0, 0, 0, time.UTC), 1, "America/New_York", "2020-03-08T23:59:59-0400"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			end, err := timeHelper.EndOfDayAfter(c.now, c.days, c.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := timeHelper.ToISO8601In(end, c.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.expected {
+				t.Fatalf("expected %s, got %s", c.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// DefinitionsID is the id of the shared definitions. Endpoint schemas with an
+// id under https://reciapp.quartrino.com/schemas/ reference them relatively,
+// e.g. {"$ref": "../definitions.json#/definitions/material"}
+const DefinitionsID = "https://reciapp.quartrino.com/schemas/definitions.json"
+
+// definitions are built from the models constants so the enums accepted by
+// the endpoints never drift from the ones the backend knows about
+func definitions() map[string]interface{} {
+	return map[string]interface{}{
+		"$id": DefinitionsID,
+		"definitions": map[string]interface{}{
+			"id": map[string]interface{}{
+				"type":      "string",
+				"minLength": 1,
+			},
+			"material": map[string]interface{}{
+				"type": "string",
+				"enum": models.Materials,
+			},
+			"unit": map[string]interface{}{
+				"type": "string",
+				"enum": models.Units,
+			},
+			"amount": map[string]interface{}{
+				"type":             "number",
+				"exclusiveMinimum": 0,
+				"maximum":          models.MaxQuantityAmount,
+			},
+			"failure_reason": map[string]interface{}{
+				"type": "string",
+				"enum": models.FailureReasons,
+			},
+			"photo_kind": map[string]interface{}{
+				"type": "string",
+				"enum": models.PhotoKinds,
+			},
+		},
+	}
+}
+
+// MustCompileSchema compiles a draft 7 JSON Schema able to reference the
+// shared definitions. It panics on invalid schemas, which are constants
+// checked by the tests
+func MustCompileSchema(source string) *gojsonschema.Schema {
+	schema, err := CompileSchema(source)
+	if err != nil {
+		panic("internal: compiling schema: " + err.Error())
+	}
+	return schema
+}
+
+func CompileSchema(source string) (*gojsonschema.Schema, error) {
+	loader := gojsonschema.NewSchemaLoader()
+	loader.Draft = gojsonschema.Draft7
+	if err := loader.AddSchemas(gojsonschema.NewGoLoader(definitions())); err != nil {
+		return nil, err
+	}
+	return loader.Compile(gojsonschema.NewStringLoader(source))
+}
+
+// ValidateBody validates the request body against the schema before the
+// handler runs, answering 400 with every violation found
+func ValidateBody(source string) Middleware {
+	schema := MustCompileSchema(source)
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			result, err := schema.Validate(gojsonschema.NewStringLoader(req.Body))
+			if err != nil {
+				return Fail(malformedBody(err)), nil
+			}
+			if !result.Valid() {
+				return SchemaErrors(http.StatusBadRequest, result.Errors()), nil
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// ValidatePath validates the path parameters, as a JSON object, against the
+// schema before the handler runs
+func ValidatePath(source string) Middleware {
+	schema := MustCompileSchema(source)
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			params := map[string]interface{}{}
+			for k, v := range req.PathParameters {
+				params[k] = v
+			}
+			result, err := schema.Validate(gojsonschema.NewGoLoader(params))
+			if err != nil {
+				return Error(http.StatusBadRequest, err), nil
+			}
+			if !result.Valid() {
+				return SchemaErrors(http.StatusBadRequest, result.Errors()), nil
+			}
+			return next(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package internal_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/assignpickingroute"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/finishpickingpoint"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getassignedroutes"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getgathererposition"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getlocationscore"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/getpickupcode"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/login"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/pinpickingpoint"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/requestphotoupload"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/startpickingroute"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/syncfieldwork"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/trackgathererposition"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestEndpointSchemasCompile(t *testing.T) {
+	schemas := map[string]string{
+		"assign_picking_route":    assignpickingroute.RequestSchema,
+		"finish_picking_point":    finishpickingpoint.RequestSchema,
+		"get_assigned_routes":     getassignedroutes.PathSchema,
+		"get_gatherer_position":   getgathererposition.PathSchema,
+		"get_user_score":          getlocationscore.PathSchema,
+		"get_pickup_code":         getpickupcode.PathSchema,
+		"login":                   login.RequestSchema,
+		"pin_picking_point":       pinpickingpoint.RequestSchema,
+		"request_photo_upload":    requestphotoupload.RequestSchema,
+		"start_picking_route":     startpickingroute.RequestSchema,
+		"sync_field_work":         syncfieldwork.RequestSchema,
+		"track_gatherer_position": trackgathererposition.RequestSchema,
+	}
+	for name, schema := range schemas {
+		if _, err := internal.CompileSchema(schema); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	handler := internal.ValidateBody(pinpickingpoint.RequestSchema)(ok)
+
+	cases := []struct {
+		name       string
+		body       string
+		status     int
+		violations []string
+	}{
+		{"MalformedBody", `{`, http.StatusBadRequest, nil},
+		{
+			"EveryViolation",
+			`{"user_id":"","materials":["plastic","wood"]}`,
+			http.StatusBadRequest,
+			[]string{"user_id", "shift_id", "location_id", "materials.1"},
+		},
+		{
+			"Valid",
+			`{"user_id":"u1","shift_id":"s1","location_id":"l1","materials":["plastic","glass"]}`,
+			http.StatusOK,
+			nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, _ := handler(context.Background(), events.APIGatewayProxyRequest{Body: c.body})
+			if res.StatusCode != c.status {
+				t.Fatalf("expected status %v, got %v (%s)", c.status, res.StatusCode, res.Body)
+			}
+			for _, violation := range c.violations {
+				if !strings.Contains(res.Body, violation) {
+					t.Errorf("expected a violation on %s, got %s", violation, res.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	handler := internal.ValidatePath(getpickupcode.PathSchema)(ok)
+
+	res, _ := handler(context.Background(), events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"user_id": "u1", "route_id": ""},
+	})
+	if res.StatusCode != http.StatusBadRequest ||
+		!strings.Contains(res.Body, "route_id") || !strings.Contains(res.Body, "picking_point_id") {
+		t.Fatalf("expected route_id and picking_point_id violations, got %v (%s)", res.StatusCode, res.Body)
+	}
+}
+
+func TestQuantitiesAmountIsBounded(t *testing.T) {
+	handler := internal.ValidateBody(finishpickingpoint.RequestSchema)(ok)
+
+	cases := []struct {
+		amount string
+		status int
+	}{
+		{"0", http.StatusBadRequest},
+		{"-1", http.StatusBadRequest},
+		{"1000", http.StatusOK},
+		{"1000.5", http.StatusBadRequest},
+		{"1e308", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		body := `{"user_id":"g1","route_id":"r1","picking_point_id":"pp1","quantities":[{"material":"metal","amount":` + c.amount + `,"unit":"kg"}]}`
+		res, _ := handler(context.Background(), events.APIGatewayProxyRequest{Body: body})
+		if res.StatusCode != c.status {
+			t.Errorf("amount %s: expected status %v, got %v (%s)", c.amount, c.status, res.StatusCode, res.Body)
+		}
+	}
+}
@@ -1,169 +1,19 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
-	"errors"
-	"log"
-	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/Globhack/ghl2020-reciapp-backend/internal"
-	"github.com/Globhack/ghl2020-reciapp-backend/internal/models"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/startpickingroute"
 	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
-var ErrUserIDEmpty = errors.New("user_id cannot be empty")
-var ErrRouteIDEmpty = errors.New("route_id  cannot be empty")
-var ErrWrongGathererID = errors.New("this route is assigned to another gatherer")
-var ErrWrongUserType = errors.New("user must be of type gatherer")
-
-type Handler func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
-
-type UsersRepository interface {
-	Find(userID string) (models.User, error)
-}
-
-type RouteRepository interface {
-	Find(routeID string) (models.Route, error)
-	Initiate(routeID string) error
-}
-
-type TimeHelper interface {
-	ToLatamFormat(d time.Time) (string, error)
-	ToISO8601(d time.Time) (string, error)
-}
-
-type Request struct {
-	UserID  string `json:"user_id"`
-	RouteID string `json:"route_id"`
-}
-
-type ResponsePickingPoint struct {
-	ID         string   `json:"id"`
-	Country    string   `json:"country"`
-	City       string   `json:"city"`
-	Address1   string   `json:"address_1"`
-	Address2   string   `json:"address_2"`
-	LocationID string   `json:"location_id"`
-	Name       string   `json:"name"`
-	Latitude   float64  `json:"latitude"`
-	Longitude  float64  `json:"longitude"`
-	Materials  []string `json:"materials"`
-}
-
-type ResponseRoute struct {
-	ID            string                 `json:"id"`
-	Materials     []string               `json:"materials"`
-	Sector        string                 `json:"sector"`
-	Status        string                 `json:"status"`
-	Shift         string                 `json:"shift"`
-	Date          string                 `json:"date"`
-	PickingPoints []ResponsePickingPoint `json:"picking_points"`
-}
-
-type Response struct {
-	AssignedRoute ResponseRoute `json:"assigned_route"`
-}
-
-func Adapter(
-	usersRepo UsersRepository,
-	routeRepo RouteRepository,
-	timeHelper TimeHelper,
-) Handler {
-	return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-
-		reqBody := Request{}
-		err := json.Unmarshal([]byte(req.Body), &reqBody)
-		if err != nil {
-			return internal.Error(http.StatusBadRequest, err), nil
-		}
-
-		if reqBody.UserID == "" {
-			return internal.Error(http.StatusBadRequest, ErrUserIDEmpty), nil
-		}
-		if reqBody.RouteID == "" {
-			return internal.Error(http.StatusBadRequest, ErrRouteIDEmpty), nil
-		}
-
-		user, err := usersRepo.Find(reqBody.UserID)
-		if err != nil {
-			if err == repositories.ErrUserNotFound {
-				return internal.Error(http.StatusNotFound, err), nil
-			}
-			return internal.Error(http.StatusInternalServerError, err), nil
-		}
-
-		route, err := routeRepo.Find(reqBody.RouteID)
-		if err != nil {
-			if err == repositories.ErrRouteNotFound {
-				return internal.Error(http.StatusNotFound, err), nil
-			}
-			return internal.Error(http.StatusInternalServerError, err), nil
-		}
-
-		if user.Type != models.UserTypeGatherer {
-			return internal.Error(http.StatusForbidden, ErrWrongUserType), nil
-		}
-		if route.GathererID != user.ID {
-			return internal.Error(http.StatusForbidden, ErrWrongGathererID), nil
-		}
-
-		log.Printf("route.InitiatedAt: (%v)\n", route.InitiatedAt)
-		if route.InitiatedAt == nil {
-			log.Printf("Initiating route\n")
-			err := routeRepo.Initiate(route.ID)
-			if err != nil {
-				return internal.Error(http.StatusInternalServerError, err), nil
-			}
-		}
-
-		responseRoutePickingPoints := make([]ResponsePickingPoint, len(route.PickingPoints))
-		for i, pp := range route.PickingPoints {
-			responseRoutePickingPoints[i] = ResponsePickingPoint{
-				ID:         pp.ID,
-				Country:    pp.Country,
-				City:       pp.City,
-				Address1:   pp.Address1,
-				Address2:   pp.Address2,
-				LocationID: pp.LocationID,
-				Latitude:   pp.Latitude,
-				Longitude:  pp.Longitude,
-				Materials:  pp.Materials,
-			}
-		}
-
-		startsAt, err := timeHelper.ToISO8601(*route.StartsAt)
-		if err != nil {
-			return internal.Error(http.StatusInternalServerError, err), nil
-		}
-		responseAssignedRoute := ResponseRoute{
-			ID:            route.ID,
-			Materials:     route.Materials,
-			Sector:        route.Sector,
-			Status:        models.RouteStatusInitiated,
-			Shift:         route.Shift,
-			Date:          startsAt,
-			PickingPoints: responseRoutePickingPoints,
-		}
-
-		response := Response{
-			AssignedRoute: responseAssignedRoute,
-		}
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			return internal.Error(http.StatusInternalServerError, err), nil
-		}
-
-		return internal.Respond(http.StatusOK, string(jsonResponse)), nil
-	}
-}
-
 func main() {
 	usersTable := os.Getenv("DYNAMODB_USERS")
 	if usersTable == "" {
@@ -180,11 +30,41 @@ func main() {
 		panic("DYNAMODB_LOCATIONS cannot be empty")
 	}
 
+	positionsTable := os.Getenv("DYNAMODB_GATHERER_POSITIONS")
+	if positionsTable == "" {
+		panic("DYNAMODB_GATHERER_POSITIONS cannot be empty")
+	}
+
 	timezone := os.Getenv("TIMEZONE")
 	if timezone == "" {
 		panic("TIMEZONE cannot be empty")
 	}
 
+	etaSpeedString := os.Getenv("ETA_AVERAGE_SPEED_KMH")
+	if etaSpeedString == "" {
+		panic("ETA_AVERAGE_SPEED_KMH cannot be empty")
+	}
+
+	etaSpeed, err := strconv.ParseFloat(etaSpeedString, 64)
+	if err != nil {
+		panic("ETA_AVERAGE_SPEED_KMH must be a number")
+	}
+
+	etaServiceTimeString := os.Getenv("ETA_SERVICE_TIME_MINUTES")
+	if etaServiceTimeString == "" {
+		panic("ETA_SERVICE_TIME_MINUTES cannot be empty")
+	}
+
+	etaServiceTime, err := strconv.ParseFloat(etaServiceTimeString, 64)
+	if err != nil {
+		panic("ETA_SERVICE_TIME_MINUTES must be a number")
+	}
+
+	etaCalculator := internal.ETACalculator{
+		AverageSpeed: etaSpeed,
+		ServiceTime:  time.Duration(etaServiceTime * float64(time.Minute)),
+	}
+
 	timeHelper, err := internal.NewTimeHelper(timezone)
 	if err != nil {
 		panic(err)
@@ -193,7 +73,10 @@ func main() {
 	uuidHelper := internal.NewUUIDHelper()
 
 	session := session.New()
-	dynamodbClient := dynamodb.New(session)
+	dynamodbClient := repositories.NewRetryingClient(
+		dynamodb.New(session, aws.NewConfig().WithMaxRetries(0)),
+		repositories.DefaultRetryPolicy,
+	)
 	usersRepo := repositories.NewDynamoDBUsersRepository(
 		dynamodbClient,
 		usersTable,
@@ -206,6 +89,12 @@ func main() {
 		uuidHelper,
 	)
 
-	handler := Adapter(usersRepo, routesRepo, timeHelper)
+	trackingRepo := repositories.NewDynamoDBTrackingRepository(
+		dynamodbClient,
+		positionsTable,
+		timeHelper,
+	)
+
+	handler := startpickingroute.Adapter(usersRepo, routesRepo, trackingRepo, timeHelper, etaCalculator)
 	lambda.Start(handler)
 }
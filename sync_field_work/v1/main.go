@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/Globhack/ghl2020-reciapp-backend/internal"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/finishpickingpoint"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/handlers/syncfieldwork"
+	"github.com/Globhack/ghl2020-reciapp-backend/internal/repositories"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func main() {
+	usersTable := os.Getenv("DYNAMODB_USERS")
+	if usersTable == "" {
+		panic("DYNAMODB_USERS cannot be empty")
+	}
+
+	routesTable := os.Getenv("DYNAMODB_PICKING_ROUTES")
+	if routesTable == "" {
+		panic("DYNAMODB_PICKING_ROUTES cannot be empty")
+	}
+
+	idempotencyTable := os.Getenv("DYNAMODB_IDEMPOTENCY_KEYS")
+	if idempotencyTable == "" {
+		panic("DYNAMODB_IDEMPOTENCY_KEYS cannot be empty")
+	}
+
+	timezone := os.Getenv("TIMEZONE")
+	if timezone == "" {
+		panic("TIMEZONE cannot be empty")
+	}
+
+	geofenceRadiusString := os.Getenv("GEOFENCE_RADIUS_METERS")
+	if geofenceRadiusString == "" {
+		panic("GEOFENCE_RADIUS_METERS cannot be empty")
+	}
+
+	geofenceRadius, err := strconv.ParseFloat(geofenceRadiusString, 64)
+	if err != nil {
+		panic("GEOFENCE_RADIUS_METERS must be a number")
+	}
+
+	geofenceMode := os.Getenv("GEOFENCE_MODE")
+	if geofenceMode != finishpickingpoint.GeofenceModeReject && geofenceMode != finishpickingpoint.GeofenceModeFlag {
+		panic("GEOFENCE_MODE must be either reject or flag")
+	}
+
+	locationsTable := os.Getenv("DYNAMODB_LOCATIONS")
+	if locationsTable == "" {
+		panic("DYNAMODB_LOCATIONS cannot be empty")
+	}
+
+	timeHelper, err := internal.NewTimeHelper(timezone)
+	if err != nil {
+		panic(err)
+	}
+
+	uuidHelper := internal.NewUUIDHelper()
+
+	session := session.New()
+	dynamodbClient := repositories.NewRetryingClient(
+		dynamodb.New(session, aws.NewConfig().WithMaxRetries(0)),
+		repositories.DefaultRetryPolicy,
+	)
+
+	usersRepo := repositories.NewDynamoDBUsersRepository(
+		dynamodbClient,
+		usersTable,
+	)
+	routesRepo := repositories.NewDynamoDBRoutesRepository(
+		dynamodbClient,
+		routesTable,
+		locationsTable,
+		timeHelper,
+		uuidHelper,
+	)
+
+	idempotencyRepo := repositories.NewDynamoDBIdempotencyRepository(
+		dynamodbClient,
+		idempotencyTable,
+		timeHelper,
+	)
+
+	handler := syncfieldwork.Adapter(usersRepo, routesRepo, geofenceRadius, geofenceMode, idempotencyRepo)
+	lambda.Start(handler)
+}